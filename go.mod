@@ -2,7 +2,4 @@ module github.com/alekitto/traefik-aws-lambda-plugin
 
 go 1.16
 
-require (
-	github.com/aws/aws-sdk-go v1.42.25
-	github.com/stretchr/testify v1.7.0
-)
+require github.com/stretchr/testify v1.7.0
@@ -0,0 +1,257 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const defaultRequestIDHeader = "X-Amzn-Requestid"
+
+// AccessLogSamplingConfig logs a percentage of the access log lines, e.g. 1% of the successful
+// requests but all the failed ones.
+type AccessLogSamplingConfig struct {
+	// SuccessPercentage of the successful requests logged (default 100).
+	SuccessPercentage float64 `json:"successPercentage,omitempty"`
+	// ErrorPercentage of the failed requests logged, answered with 5xx or failed invocations (default 100).
+	ErrorPercentage float64 `json:"errorPercentage,omitempty"`
+}
+
+// logSampler picks the access log lines to write.
+type logSampler struct {
+	success float64
+	errors  float64
+}
+
+func newLogSampler(config *AccessLogSamplingConfig) (*logSampler, error) {
+	s := &logSampler{success: config.SuccessPercentage, errors: config.ErrorPercentage}
+	for _, percentage := range []*float64{&s.success, &s.errors} {
+		if *percentage == 0 {
+			*percentage = 100
+		}
+
+		if *percentage < 0 || *percentage > 100 {
+			return nil, fmt.Errorf("access log sampling: percentages must be between 0 and 100")
+		}
+	}
+
+	return s, nil
+}
+
+// sample reports whether the line of a request is logged. A nil sampler logs them all.
+func (s *logSampler) sample(failed bool) bool {
+	if s == nil {
+		return true
+	}
+
+	percentage := s.success
+	if failed {
+		percentage = s.errors
+	}
+
+	return percentage == 100 || rand.Float64()*100 < percentage //nolint:gosec // No need for a secure random source.
+}
+
+// invocationRecordKey is the context key of the invocationRecord of a request.
+type invocationRecordKey struct{}
+
+// invocationRecord collects what is reported about a proxied request: the invoked target, the
+// payload sizes and the outcome.
+type invocationRecord struct {
+	// retries is first to be 64-bit aligned for the atomic operations: the hedged invocations retry
+	// concurrently.
+	retries         int64
+	function        string
+	qualifier       string
+	requestID       string
+	executedVersion string
+	coldStart       bool
+	report          *invocationReport
+	invokeDuration  time.Duration
+	timings         [phaseCount]time.Duration
+	span            *span
+	cacheStatus     string
+	requestBytes    int
+	payloadBytes    int
+	responseBytes   int
+	errorCode       string
+}
+
+// withInvocationRecord returns the context carrying the record.
+func withInvocationRecord(ctx context.Context, record *invocationRecord) context.Context {
+	return context.WithValue(ctx, invocationRecordKey{}, record)
+}
+
+// invocationRecordFrom returns the record of the request of the context. The methods of the record
+// accept a nil one, for the contexts without.
+func invocationRecordFrom(ctx context.Context) *invocationRecord {
+	record, _ := ctx.Value(invocationRecordKey{}).(*invocationRecord)
+	return record
+}
+
+// invocationRecordOf returns the record of the request answered by the response writer, nil when
+// it has none.
+func invocationRecordOf(rw http.ResponseWriter) *invocationRecord {
+	if rec, ok := rw.(*statusRecorder); ok {
+		return rec.record
+	}
+
+	return nil
+}
+
+// setInput records the invocation of the function.
+func (r *invocationRecord) setInput(in *invokeInput) {
+	if r == nil {
+		return
+	}
+
+	r.function, r.qualifier, r.payloadBytes = in.FunctionName, in.Qualifier, len(in.Payload)
+}
+
+// setTarget records the non-Lambda target of the request, e.g. a state machine.
+func (r *invocationRecord) setTarget(target string) {
+	if r != nil {
+		r.function = target
+	}
+}
+
+// setResult records the outcome of an invocation lasting duration.
+func (r *invocationRecord) setResult(result *invokeOutput, duration time.Duration) {
+	if r != nil && result != nil {
+		r.invokeDuration = duration
+		r.requestID, r.responseBytes = result.RequestID, len(result.Payload)
+		r.executedVersion, r.report = result.ExecutedVersion, parseReport(result.LogResult)
+		r.coldStart = r.report != nil && r.report.initDurationMs > 0
+	}
+}
+
+// tracingSpan returns the span of the request, nil when it is not traced.
+func (r *invocationRecord) tracingSpan() *span {
+	if r == nil {
+		return nil
+	}
+
+	return r.span
+}
+
+// setCacheStatus records whether the request was served from the response cache.
+func (r *invocationRecord) setCacheStatus(hit bool) {
+	if r == nil {
+		return
+	}
+
+	r.cacheStatus = "miss"
+	if hit {
+		r.cacheStatus = "hit"
+	}
+}
+
+// retried records a retried invocation.
+func (r *invocationRecord) retried() {
+	if r != nil {
+		atomic.AddInt64(&r.retries, 1)
+	}
+}
+
+// retryCount returns the number of retried invocations.
+func (r *invocationRecord) retryCount() int64 {
+	return atomic.LoadInt64(&r.retries)
+}
+
+// setError records the failure of the request.
+func (r *invocationRecord) setError(statusCode int, err error) {
+	if r == nil {
+		return
+	}
+
+	r.errorCode = errorCode(statusCode, err)
+	if r.requestID == "" {
+		r.requestID = errorRequestID(err)
+	}
+}
+
+// writeInvocationHeaders adds the request ID and, with the debug headers, the metadata of the
+// invocation to the response headers.
+func (r *statusRecorder) writeInvocationHeaders() {
+	if r.record == nil || r.record.requestID == "" {
+		return
+	}
+
+	header := r.Header()
+	if r.requestIDHeader != "" {
+		header.Set(r.requestIDHeader, r.record.requestID)
+	}
+
+	if !r.debugHeaders {
+		return
+	}
+
+	header.Set("X-Lambda-Request-Id", r.record.requestID)
+	header.Set("X-Lambda-Duration-Ms", strconv.FormatInt(r.record.invokeDuration.Milliseconds(), 10))
+	if r.record.executedVersion != "" {
+		header.Set("X-Lambda-Executed-Version", r.record.executedVersion)
+	}
+}
+
+// requestIDHeader returns the response header carrying the Lambda request ID, empty when it is not
+// propagated.
+func requestIDHeader(config *Config) string {
+	switch {
+	case config.RequestIDHeader != "":
+		return http.CanonicalHeaderKey(config.RequestIDHeader)
+	case config.PropagateRequestID:
+		return defaultRequestIDHeader
+	default:
+		return ""
+	}
+}
+
+// accessLogEntry is the structured access log line of a request.
+type accessLogEntry struct {
+	Method        string  `json:"method"`
+	Path          string  `json:"path"`
+	Function      string  `json:"function,omitempty"`
+	Qualifier     string  `json:"qualifier,omitempty"`
+	RequestID     string  `json:"requestId,omitempty"`
+	Status        int     `json:"status"`
+	DurationMs    float64 `json:"durationMs"`
+	RequestBytes  int     `json:"requestBytes"`
+	PayloadBytes  int     `json:"payloadBytes"`
+	ResponseBytes int     `json:"responseBytes"`
+	Error         string  `json:"error,omitempty"`
+
+	BilledDurationMs float64 `json:"billedDurationMs,omitempty"`
+	MemorySizeMB     int     `json:"memorySizeMb,omitempty"`
+	MaxMemoryUsedMB  int     `json:"maxMemoryUsedMb,omitempty"`
+	InitDurationMs   float64 `json:"initDurationMs,omitempty"`
+}
+
+// logAccess writes the access log line of a request served in duration with the status.
+func (a *AwsLambdaPlugin) logAccess(req *http.Request, record *invocationRecord, status int, duration time.Duration) {
+	line := accessLogEntry{
+		Method:        req.Method,
+		Path:          req.URL.Path,
+		Function:      record.function,
+		Qualifier:     record.qualifier,
+		RequestID:     record.requestID,
+		Status:        status,
+		DurationMs:    float64(duration.Microseconds()) / 1000,
+		RequestBytes:  record.requestBytes,
+		PayloadBytes:  record.payloadBytes,
+		ResponseBytes: record.responseBytes,
+		Error:         record.errorCode,
+	}
+
+	if report := record.report; report != nil {
+		line.BilledDurationMs, line.InitDurationMs = report.billedDurationMs, report.initDurationMs
+		line.MemorySizeMB, line.MaxMemoryUsedMB = report.memorySizeMB, report.maxMemoryUsedMB
+	}
+
+	entry, _ := json.Marshal(line)
+	a.logger.infof("access %s", entry)
+}
@@ -0,0 +1,297 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	var failure string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+
+		switch failure {
+		case "throttle":
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+		default:
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`{"statusCode": 201, "body": "created"}`))
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx"
+	cfg.Qualifier = "live"
+	cfg.Endpoint = mockserver.URL
+	cfg.AccessLog = true
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	serve := func(f string) map[string]interface{} {
+		failure = f
+		buf.Reset()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/items", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		line := buf.String()
+		i := strings.Index(line, "[lambda-plugin] access ")
+		if i < 0 {
+			t.Fatalf("no access log line in %q", line)
+		}
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[i+len("[lambda-plugin] access "):])), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		return entry
+	}
+
+	entry := serve("")
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/items", entry["path"])
+	assert.Equal(t, "arn:aws:lambda:eu-west-1:000000000000:function:xxx", entry["function"])
+	assert.Equal(t, "live", entry["qualifier"])
+	assert.Equal(t, "req-1", entry["requestId"])
+	assert.Equal(t, float64(201), entry["status"])
+	assert.Equal(t, float64(5), entry["requestBytes"])
+	assert.Greater(t, entry["payloadBytes"], float64(5))
+	assert.Equal(t, float64(38), entry["responseBytes"])
+	assert.NotContains(t, entry, "error")
+	assert.Contains(t, entry, "durationMs")
+
+	entry = serve("throttle")
+	assert.Equal(t, float64(503), entry["status"])
+	assert.Equal(t, "lambda_throttled", entry["error"])
+
+	cfg.AccessLog = false
+	handler, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotContains(t, buf.String(), "access {")
+}
+
+func TestDebugHeaders(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+		res.Header().Set("X-Amz-Executed-Version", "7")
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	for _, enabled := range []bool{true, false} {
+		cfg.DebugHeaders = enabled
+		handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+
+		if !enabled {
+			assert.Empty(t, recorder.Header().Get("X-Lambda-Request-Id"))
+			continue
+		}
+
+		assert.Equal(t, "req-1", recorder.Header().Get("X-Lambda-Request-Id"))
+		assert.Equal(t, "7", recorder.Header().Get("X-Lambda-Executed-Version"))
+
+		duration, err := strconv.Atoi(recorder.Header().Get("X-Lambda-Duration-Ms"))
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, duration, 20)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var failure bool
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if failure {
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+
+			return
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.AccessLog = true
+	cfg.AccessLogSampling = &awslambdaplugin.AccessLogSamplingConfig{SuccessPercentage: 1e-9}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	serve := func(f bool) {
+		failure = f
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for i := 0; i < 20; i++ {
+		serve(false)
+	}
+	assert.NotContains(t, buf.String(), "access {")
+
+	serve(true)
+	assert.Contains(t, buf.String(), `"error":"lambda_throttled"`)
+
+	cfg.AccessLogSampling = &awslambdaplugin.AccessLogSamplingConfig{ErrorPercentage: 120}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "access log sampling: percentages must be between 0 and 100")
+
+	cfg.AccessLog = false
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "access log sampling requires access log")
+}
+
+func TestPropagateRequestID(t *testing.T) {
+	var failure bool
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+		if failure {
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+
+			return
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	testCases := []struct {
+		desc      string
+		propagate bool
+		header    string
+		failure   bool
+		expected  string
+	}{
+		{desc: "disabled", header: "", expected: ""},
+		{desc: "default header", propagate: true, expected: "X-Amzn-Requestid"},
+		{desc: "failed invocation", propagate: true, failure: true, expected: "X-Amzn-Requestid"},
+		{desc: "custom header", header: "x-request-id", expected: "X-Request-Id"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			cfg.PropagateRequestID = test.propagate
+			cfg.RequestIDHeader = test.header
+			failure = test.failure
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if test.expected == "" {
+				assert.Empty(t, recorder.Header().Get("X-Amzn-Requestid"))
+				return
+			}
+
+			assert.Equal(t, "req-1", recorder.Header().Get(test.expected))
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package awslambdaplugin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const defaultPartition = "aws"
+
+// partition an AWS partition, its region prefix and the domain of its endpoints.
+type partition struct {
+	name         string
+	regionPrefix string
+	dnsSuffix    string
+}
+
+// partitions every region is matched against in order; the aws partition is the fallback.
+var partitions = []partition{
+	{name: "aws-cn", regionPrefix: "cn-", dnsSuffix: "amazonaws.com.cn"},
+	{name: "aws-us-gov", regionPrefix: "us-gov-", dnsSuffix: "amazonaws.com"},
+	{name: "aws-iso-b", regionPrefix: "us-isob-", dnsSuffix: "sc2s.sgov.gov"},
+	{name: "aws-iso", regionPrefix: "us-iso-", dnsSuffix: "c2s.ic.gov"},
+}
+
+// regionPartition returns the partition a region belongs to.
+func regionPartition(region string) partition {
+	for _, p := range partitions {
+		if strings.HasPrefix(region, p.regionPrefix) {
+			return p
+		}
+	}
+
+	return partition{name: defaultPartition, dnsSuffix: "amazonaws.com"}
+}
+
+var (
+	regionRegexp            = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+	accountRegexp           = regexp.MustCompile(`^\d{12}$`)
+	functionNameRegexp      = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	functionQualifierRegexp = regexp.MustCompile(`^(\$LATEST|[a-zA-Z0-9_-]{1,128})$`)
+)
+
+// functionArn a parsed function identifier. Lambda accepts a function name, a partial ARN
+// (account:function:name) and a full ARN, each optionally followed by a version or alias qualifier.
+// Only the full ARN carries partition and region.
+type functionArn struct {
+	partition string
+	region    string
+	account   string
+	name      string
+	qualifier string
+}
+
+func parseFunctionArn(value string) (functionArn, error) {
+	var fn functionArn
+
+	parts := strings.Split(value, ":")
+	switch {
+	case parts[0] == "arn":
+		if err := fn.parsePrefix(value, parts); err != nil {
+			return fn, err
+		}
+
+		parts = parts[6:]
+	case len(parts) >= 3 && parts[1] == "function":
+		fn.account = parts[0]
+		parts = parts[2:]
+	}
+
+	if fn.account != "" && !accountRegexp.MatchString(fn.account) {
+		return fn, fmt.Errorf("invalid function arn %q: invalid account id %q", value, fn.account)
+	}
+
+	if len(parts) > 2 || !functionNameRegexp.MatchString(parts[0]) {
+		return fn, fmt.Errorf("invalid function arn %q: invalid function name", value)
+	}
+
+	fn.name = parts[0]
+	if len(parts) == 2 {
+		if !functionQualifierRegexp.MatchString(parts[1]) {
+			return fn, fmt.Errorf("invalid function arn %q: invalid qualifier %q", value, parts[1])
+		}
+
+		fn.qualifier = parts[1]
+	}
+
+	return fn, nil
+}
+
+// parsePrefix parses the arn:partition:lambda:region:account:function prefix of a full ARN.
+func (fn *functionArn) parsePrefix(value string, parts []string) error {
+	if len(parts) < 7 || len(parts) > 8 {
+		return fmt.Errorf("invalid function arn %q: expected arn:partition:lambda:region:account:function:name[:qualifier]", value)
+	}
+
+	if parts[2] != "lambda" || parts[5] != "function" {
+		return fmt.Errorf("invalid function arn %q: not a lambda function", value)
+	}
+
+	if !regionRegexp.MatchString(parts[3]) {
+		return fmt.Errorf("invalid function arn %q: invalid region %q", value, parts[3])
+	}
+
+	if expected := regionPartition(parts[3]).name; parts[1] != expected {
+		return fmt.Errorf("invalid function arn %q: region %s belongs to partition %s, not %s",
+			value, parts[3], expected, parts[1])
+	}
+
+	fn.partition, fn.region, fn.account = parts[1], parts[3], parts[4]
+
+	return nil
+}
+
+// functionRegion returns the region of the function: the configured one, defaulting to the ARN region.
+func functionRegion(region string, fn functionArn) (string, error) {
+	if fn.region == "" {
+		return region, nil
+	}
+
+	if region != "" && region != fn.region {
+		return "", fmt.Errorf("region %q does not match the function arn region %q", region, fn.region)
+	}
+
+	return fn.region, nil
+}
+
+// checkQualifier validates the configured qualifier, which Lambda only accepts along a qualified
+// function ARN when both are the same.
+func checkQualifier(qualifier string, fn functionArn) error {
+	if qualifier == "" {
+		return nil
+	}
+
+	if !functionQualifierRegexp.MatchString(qualifier) {
+		return fmt.Errorf("invalid qualifier %q", qualifier)
+	}
+
+	if fn.qualifier != "" && fn.qualifier != qualifier {
+		return fmt.Errorf("qualifier %q does not match the function arn qualifier %q", qualifier, fn.qualifier)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package awslambdaplugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFunctionArn(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected functionArn
+		err      string
+	}{
+		{
+			value:    "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1",
+			expected: functionArn{partition: "aws", region: "eu-west-1", account: "000000000000", name: "xxx", qualifier: "1"},
+		},
+		{
+			value:    "arn:aws-cn:lambda:cn-north-1:000000000000:function:xxx",
+			expected: functionArn{partition: "aws-cn", region: "cn-north-1", account: "000000000000", name: "xxx"},
+		},
+		{
+			value:    "arn:aws-us-gov:lambda:us-gov-west-1:000000000000:function:xxx:$LATEST",
+			expected: functionArn{partition: "aws-us-gov", region: "us-gov-west-1", account: "000000000000", name: "xxx", qualifier: "$LATEST"},
+		},
+		{value: "000000000000:function:xxx:live", expected: functionArn{account: "000000000000", name: "xxx", qualifier: "live"}},
+		{value: "my_function-1", expected: functionArn{name: "my_function-1"}},
+		{value: "my-function:live", expected: functionArn{name: "my-function", qualifier: "live"}},
+		{
+			value: "arn:aws:lambda:eu-west-1:000000000000:xxx",
+			err:   `invalid function arn "arn:aws:lambda:eu-west-1:000000000000:xxx": expected arn:partition:lambda:region:account:function:name[:qualifier]`,
+		},
+		{
+			value: "arn:aws:sqs:eu-west-1:000000000000:function:xxx",
+			err:   `invalid function arn "arn:aws:sqs:eu-west-1:000000000000:function:xxx": not a lambda function`,
+		},
+		{
+			value: "arn:aws:lambda:cn-north-1:000000000000:function:xxx",
+			err:   `invalid function arn "arn:aws:lambda:cn-north-1:000000000000:function:xxx": region cn-north-1 belongs to partition aws-cn, not aws`,
+		},
+		{
+			value: "arn:aws:lambda:europe:000000000000:function:xxx",
+			err:   `invalid function arn "arn:aws:lambda:europe:000000000000:function:xxx": invalid region "europe"`,
+		},
+		{
+			value: "arn:aws:lambda:eu-west-1:0000:function:xxx",
+			err:   `invalid function arn "arn:aws:lambda:eu-west-1:0000:function:xxx": invalid account id "0000"`,
+		},
+		{value: "my function", err: `invalid function arn "my function": invalid function name`},
+		{value: "xxx:live:1", err: `invalid function arn "xxx:live:1": invalid function name`},
+		{value: "xxx:li.ve", err: `invalid function arn "xxx:li.ve": invalid qualifier "li.ve"`},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.value, func(t *testing.T) {
+			fn, err := parseFunctionArn(test.value)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, fn)
+		})
+	}
+}
+
+func TestRegionPartition(t *testing.T) {
+	assert.Equal(t, "aws", regionPartition("eu-west-1").name)
+	assert.Equal(t, "amazonaws.com.cn", regionPartition("cn-northwest-1").dnsSuffix)
+	assert.Equal(t, "aws-us-gov", regionPartition("us-gov-east-1").name)
+	assert.Equal(t, "c2s.ic.gov", regionPartition("us-iso-east-1").dnsSuffix)
+	assert.Equal(t, "sc2s.sgov.gov", regionPartition("us-isob-east-1").dnsSuffix)
+}
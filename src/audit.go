@@ -0,0 +1,181 @@
+package awslambdaplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// syslogPriority is the log audit facility (13) at the informational severity (6).
+const syslogPriority = 13*8 + 6
+
+var defaultAuditIdentityHeaders = []string{"X-Forwarded-User", "X-Auth-Request-User", "X-Auth-Request-Email"}
+
+// AuditConfig records who invoked which function and when, one JSON line per request, to a
+// dedicated file or a syslog server.
+type AuditConfig struct {
+	// File appends the records to a file.
+	File string `json:"file,omitempty"`
+	// Syslog sends the records to a syslog server, as RFC 5424 messages: udp://host:514,
+	// tcp://host:514 or unix:///dev/log.
+	Syslog string `json:"syslog,omitempty"`
+	// IdentityHeaders are the request headers identifying the caller, e.g. set by a forward auth
+	// middleware (default X-Forwarded-User, X-Auth-Request-User and X-Auth-Request-Email).
+	IdentityHeaders []string `json:"identityHeaders,omitempty"`
+}
+
+// auditRecord is the audit line of a request.
+type auditRecord struct {
+	Time         string            `json:"time"`
+	Middleware   string            `json:"middleware"`
+	ClientIP     string            `json:"clientIp"`
+	ForwardedFor string            `json:"forwardedFor,omitempty"`
+	Identity     map[string]string `json:"identity,omitempty"`
+	Method       string            `json:"method"`
+	Path         string            `json:"path"`
+	Function     string            `json:"function"`
+	Qualifier    string            `json:"qualifier,omitempty"`
+	RequestID    string            `json:"requestId,omitempty"`
+	Status       int               `json:"status"`
+}
+
+// auditLog writes the audit records.
+type auditLog struct {
+	logger   *logger
+	headers  []string
+	hostname string
+
+	mu     sync.Mutex
+	out    io.Writer
+	syslog *url.URL
+}
+
+func newAuditLog(logger *logger, config *AuditConfig) (*auditLog, error) {
+	if (config.File == "") == (config.Syslog == "") {
+		return nil, fmt.Errorf("audit: one of file or syslog is required")
+	}
+
+	a := &auditLog{logger: logger, headers: config.IdentityHeaders}
+	if len(a.headers) == 0 {
+		a.headers = defaultAuditIdentityHeaders
+	}
+
+	if config.File != "" {
+		file, err := openLogFile(config.File)
+		if err != nil {
+			return nil, fmt.Errorf("audit: %w", err)
+		}
+
+		a.out = file
+
+		return a, nil
+	}
+
+	u, err := url.Parse(config.Syslog)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp" && u.Scheme != "unix") {
+		return nil, fmt.Errorf("audit: invalid syslog address %q", config.Syslog)
+	}
+
+	a.syslog = u
+	a.hostname, _ = os.Hostname()
+	if a.hostname == "" {
+		a.hostname = "-"
+	}
+
+	if err := a.dial(); err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+
+	return a, nil
+}
+
+// dial connects to the syslog server.
+func (a *auditLog) dial() error {
+	network, address := a.syslog.Scheme, a.syslog.Host
+	if network == "unix" {
+		network, address = "unixgram", a.syslog.Path
+	}
+
+	conn, err := net.DialTimeout(network, address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	a.out = conn
+
+	return nil
+}
+
+// record writes the audit record of a request served with the status.
+func (a *auditLog) record(req *http.Request, clientIP, function string, record *invocationRecord, status int, now time.Time) {
+	entry := auditRecord{
+		Time:         now.UTC().Format(time.RFC3339Nano),
+		Middleware:   a.logger.name,
+		ClientIP:     clientIP,
+		ForwardedFor: req.Header.Get(headerXForwardedFor),
+		Method:       req.Method,
+		Path:         req.URL.Path,
+		Function:     function,
+		Qualifier:    record.qualifier,
+		RequestID:    record.requestID,
+		Status:       status,
+	}
+
+	for _, name := range a.headers {
+		if value := req.Header.Get(name); value != "" {
+			if entry.Identity == nil {
+				entry.Identity = map[string]string{}
+			}
+
+			entry.Identity[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		a.logger.errorf("cannot encode the audit record: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.syslog == nil {
+		line = append(line, '\n')
+		if _, err := a.out.Write(line); err != nil {
+			a.logger.errorf("cannot write the audit record: %v", err)
+		}
+
+		return
+	}
+
+	message := []byte(fmt.Sprintf("<%d>1 %s %s traefik-aws-lambda-plugin - - - %s",
+		syslogPriority, now.UTC().Format(time.RFC3339), a.hostname, line))
+	if a.syslog.Scheme == "tcp" {
+		message = append(message, '\n')
+	}
+
+	if _, err := a.out.Write(message); err == nil {
+		return
+	}
+
+	// The connection may have been closed by the server: reconnect once.
+	if closer, ok := a.out.(io.Closer); ok {
+		_ = closer.Close()
+	}
+
+	if err := a.dial(); err != nil {
+		a.logger.errorf("cannot write the audit record: %v", err)
+		return
+	}
+
+	if _, err := a.out.Write(message); err != nil {
+		a.logger.errorf("cannot write the audit record: %v", err)
+	}
+}
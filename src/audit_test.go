@@ -0,0 +1,136 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 204}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx"
+	cfg.Qualifier = "live"
+	cfg.Endpoint = mockserver.URL
+	cfg.Audit = &awslambdaplugin.AuditConfig{File: file, IdentityHeaders: []string{"x-user"}}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "http://localhost/items/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "192.0.2.10:41000"
+	req.Header.Set("X-User", "alice")
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(content, &record))
+	assert.Equal(t, "lambda-plugin", record["middleware"])
+	assert.Equal(t, "192.0.2.10", record["clientIp"])
+	assert.Equal(t, "198.51.100.7", record["forwardedFor"])
+	assert.Equal(t, map[string]interface{}{"X-User": "alice"}, record["identity"])
+	assert.Equal(t, "DELETE", record["method"])
+	assert.Equal(t, "/items/1", record["path"])
+	assert.Equal(t, "arn:aws:lambda:eu-west-1:000000000000:function:xxx", record["function"])
+	assert.Equal(t, "live", record["qualifier"])
+	assert.Equal(t, "req-1", record["requestId"])
+	assert.Equal(t, float64(204), record["status"])
+	assert.NotEmpty(t, record["time"])
+
+	cfg.Audit = &awslambdaplugin.AuditConfig{}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "audit: one of file or syslog is required")
+
+	cfg.Audit = &awslambdaplugin.AuditConfig{Syslog: "http://localhost:514"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `audit: invalid syslog address "http://localhost:514"`)
+}
+
+func TestAuditSyslog(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	syslog, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = syslog.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Audit = &awslambdaplugin.AuditConfig{Syslog: "udp://" + syslog.LocalAddr().String()}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Forwarded-User", "bob")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	buf := make([]byte, 4096)
+	_ = syslog.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := syslog.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := string(buf[:n])
+	assert.Regexp(t, regexp.MustCompile(`^<110>1 \S+ \S+ traefik-aws-lambda-plugin - - - \{`), message)
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(message[strings.Index(message, "{"):]), &record))
+	assert.Equal(t, map[string]interface{}{"X-Forwarded-User": "bob"}, record["identity"])
+	assert.Equal(t, float64(200), record["status"])
+}
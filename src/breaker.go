@@ -0,0 +1,264 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerWindow       = 10 * time.Second
+	defaultBreakerMinRequests  = 20
+	defaultBreakerErrorRatio   = 0.5
+	defaultBreakerOpenDuration = 30 * time.Second
+
+	breakerBuckets = 10
+)
+
+// CircuitBreakerConfig stops invoking a function which keeps failing or answering slowly: once
+// the failure ratio or the slow call ratio of the window is reached, the requests are answered
+// right away with the configured response for OpenDuration, then a single probe invocation decides
+// whether the circuit closes again.
+type CircuitBreakerConfig struct {
+	// Window over which the invocations are counted (default 10s).
+	Window string `json:"window,omitempty"`
+	// MinRequests in the window before the circuit may trip (default 20).
+	MinRequests int `json:"minRequests,omitempty"`
+	// ErrorRatio of failed invocations tripping the circuit (default 0.5).
+	ErrorRatio float64 `json:"errorRatio,omitempty"`
+	// SlowCallDuration marks the invocations lasting longer as slow. Unset disables the latency check.
+	SlowCallDuration string `json:"slowCallDuration,omitempty"`
+	// SlowCallRatio of slow invocations tripping the circuit (default 0.5).
+	SlowCallRatio float64 `json:"slowCallRatio,omitempty"`
+	// OpenDuration the circuit stays open before probing the function again (default 30s).
+	OpenDuration string `json:"openDuration,omitempty"`
+	// StatusCode (default 503) and Body of the responses sent while the circuit is open.
+	StatusCode int    `json:"statusCode,omitempty"`
+	Body       string `json:"body,omitempty"`
+}
+
+// errCircuitOpen is the cause of the invocations refused by the open circuit.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breakerBucket struct {
+	start               time.Time
+	total, failed, slow int
+}
+
+// circuitBreaker counts the invocation outcomes in a sliding window made of buckets.
+type circuitBreaker struct {
+	logger       *logger
+	bucketSize   time.Duration
+	minRequests  int
+	errorRatio   float64
+	slowDuration time.Duration
+	slowRatio    float64
+	openDuration time.Duration
+	statusCode   int
+	body         string
+
+	mu       sync.Mutex
+	state    int
+	openedAt time.Time
+	probing  bool
+	buckets  [breakerBuckets]breakerBucket
+}
+
+func newCircuitBreaker(logger *logger, config *CircuitBreakerConfig) (*circuitBreaker, error) {
+	window, err := parseDurationDefault(config.Window, defaultBreakerWindow)
+	if err != nil || window/breakerBuckets <= 0 {
+		return nil, fmt.Errorf("circuit breaker: invalid window %q", config.Window)
+	}
+
+	slowDuration, err := parseDurationDefault(config.SlowCallDuration, 0)
+	if err != nil || slowDuration < 0 {
+		return nil, fmt.Errorf("circuit breaker: invalid slow call duration %q", config.SlowCallDuration)
+	}
+
+	openDuration, err := parseDurationDefault(config.OpenDuration, defaultBreakerOpenDuration)
+	if err != nil || openDuration <= 0 {
+		return nil, fmt.Errorf("circuit breaker: invalid open duration %q", config.OpenDuration)
+	}
+
+	b := &circuitBreaker{
+		logger:       logger,
+		bucketSize:   window / breakerBuckets,
+		minRequests:  config.MinRequests,
+		errorRatio:   config.ErrorRatio,
+		slowDuration: slowDuration,
+		slowRatio:    config.SlowCallRatio,
+		openDuration: openDuration,
+		statusCode:   config.StatusCode,
+		body:         config.Body,
+	}
+
+	b.setDefaults()
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *circuitBreaker) setDefaults() {
+	if b.minRequests == 0 {
+		b.minRequests = defaultBreakerMinRequests
+	}
+	if b.errorRatio == 0 {
+		b.errorRatio = defaultBreakerErrorRatio
+	}
+	if b.slowRatio == 0 {
+		b.slowRatio = defaultBreakerErrorRatio
+	}
+	if b.statusCode == 0 {
+		b.statusCode = http.StatusServiceUnavailable
+	}
+	if b.body == "" {
+		b.body = http.StatusText(b.statusCode)
+	}
+}
+
+func (b *circuitBreaker) validate() error {
+	switch {
+	case b.minRequests < 1:
+		return fmt.Errorf("circuit breaker: min requests must be positive")
+	case b.errorRatio < 0 || b.errorRatio > 1, b.slowRatio < 0 || b.slowRatio > 1:
+		return fmt.Errorf("circuit breaker: ratios must be between 0 and 1")
+	case b.statusCode < 200 || b.statusCode > 599:
+		return fmt.Errorf("circuit breaker: invalid status code %d", b.statusCode)
+	}
+
+	return nil
+}
+
+// allow reports whether the function may be invoked. While half open, only one probe is let through.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.openDuration {
+			return false
+		}
+
+		b.state = breakerHalfOpen
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+
+		b.probing = true
+	}
+
+	return true
+}
+
+// currentState returns the state of the breaker: closed, open or half open.
+func (b *circuitBreaker) currentState() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// record accounts the outcome of an invocation allowed by allow.
+func (b *circuitBreaker) record(failed bool, latency time.Duration, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slow := b.slowDuration > 0 && latency > b.slowDuration
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if failed || slow {
+			b.trip(now)
+			return
+		}
+
+		b.buckets = [breakerBuckets]breakerBucket{}
+		b.state = breakerClosed
+		b.logger.infof("circuit breaker closed")
+
+		return
+	}
+
+	bucket := &b.buckets[now.UnixNano()/int64(b.bucketSize)%breakerBuckets]
+	if start := now.Truncate(b.bucketSize); !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+
+	bucket.total++
+	if failed {
+		bucket.failed++
+	}
+	if slow {
+		bucket.slow++
+	}
+
+	total, failures, slowCalls := b.windowCounts(now)
+	if b.state == breakerClosed && b.exceeded(total, failures, slowCalls) {
+		b.trip(now)
+		b.logger.warnf("circuit breaker open: %d failed and %d slow of %d invocations", failures, slowCalls, total)
+	}
+}
+
+// windowCounts sums the invocations, failures and slow calls of the current window. The caller holds the lock.
+func (b *circuitBreaker) windowCounts(now time.Time) (total, failures, slowCalls int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.bucketSize*breakerBuckets {
+			total += bucket.total
+			failures += bucket.failed
+			slowCalls += bucket.slow
+		}
+	}
+
+	return total, failures, slowCalls
+}
+
+// exceeded reports whether the window counts reach the failure or the slow call ratio.
+func (b *circuitBreaker) exceeded(total, failures, slowCalls int) bool {
+	return total >= b.minRequests &&
+		(float64(failures) >= b.errorRatio*float64(total) ||
+			(b.slowDuration > 0 && float64(slowCalls) >= b.slowRatio*float64(total)))
+}
+
+// release gives back the probe slot of an invocation allowed by allow whose outcome is not
+// accounted, e.g. because the client went away.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// canceledByClient reports whether the invocation failed only because the client went away:
+// the outcome says nothing about the function health.
+func canceledByClient(req *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) && req.Context().Err() != nil
+}
+
+func (b *circuitBreaker) trip(now time.Time) {
+	b.openedAt = now
+	b.state = breakerOpen
+}
+
+// response returns the response sent while the circuit is open.
+func (b *circuitBreaker) response() LambdaResponse {
+	return LambdaResponse{
+		StatusCode: b.statusCode,
+		Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+		Body:       b.body,
+	}
+}
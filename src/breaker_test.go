@@ -0,0 +1,148 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b, err := newCircuitBreaker(&logger{name: "test"}, &CircuitBreakerConfig{MinRequests: 4, OpenDuration: "1m", StatusCode: 504})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		assert.True(t, b.allow(now))
+		b.record(i > 0, time.Millisecond, now)
+	}
+
+	// Failures below min requests do not trip the circuit.
+	assert.True(t, b.allow(now))
+	b.record(true, time.Millisecond, now)
+
+	assert.False(t, b.allow(now.Add(time.Second)))
+	assert.Equal(t, 504, b.response().StatusCode)
+
+	// A single probe is let through once open duration elapsed.
+	probe := now.Add(time.Minute)
+	assert.True(t, b.allow(probe))
+	assert.False(t, b.allow(probe))
+	b.record(true, time.Millisecond, probe)
+	assert.False(t, b.allow(probe.Add(time.Second)))
+
+	probe = probe.Add(time.Minute)
+	assert.True(t, b.allow(probe))
+	b.record(false, time.Millisecond, probe)
+	assert.True(t, b.allow(probe))
+	assert.True(t, b.allow(probe))
+
+	// Outcomes older than the window are forgotten.
+	later := probe.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		b.record(true, time.Millisecond, later)
+	}
+	b.record(false, time.Millisecond, later.Add(15*time.Second))
+	assert.True(t, b.allow(later.Add(15*time.Second)))
+}
+
+func TestCircuitBreakerSlowCalls(t *testing.T) {
+	b, err := newCircuitBreaker(&logger{name: "test"}, &CircuitBreakerConfig{MinRequests: 2, SlowCallDuration: "1s", SlowCallRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	b.record(false, 2*time.Second, now)
+	b.record(false, 10*time.Millisecond, now)
+	assert.True(t, b.allow(now))
+
+	b.record(false, 2*time.Second, now)
+	b.record(false, 2*time.Second, now)
+	assert.True(t, b.allow(now))
+
+	b, err = newCircuitBreaker(&logger{name: "test"}, &CircuitBreakerConfig{MinRequests: 2, SlowCallDuration: "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.record(false, 2*time.Second, now)
+	b.record(false, 2*time.Second, now)
+	assert.False(t, b.allow(now))
+
+	_, err = newCircuitBreaker(&logger{name: "test"}, &CircuitBreakerConfig{ErrorRatio: 1.5})
+	assert.EqualError(t, err, "circuit breaker: ratios must be between 0 and 1")
+}
+
+func TestCircuitBreakerClientCanceled(t *testing.T) {
+	hang := make(chan struct{})
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		<-hang
+	}))
+	defer func() { mockserver.Close() }()
+	defer close(hang)
+
+	testCases := []struct {
+		desc      string
+		configure func(cfg *Config)
+	}{
+		{
+			desc: "invoke",
+			configure: func(cfg *Config) {
+				cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+				cfg.Endpoint = mockserver.URL
+			},
+		},
+		{
+			desc: "response streaming",
+			configure: func(cfg *Config) {
+				cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+				cfg.Endpoint = mockserver.URL
+				cfg.ResponseStreaming = true
+			},
+		},
+		{
+			desc: "state machine",
+			configure: func(cfg *Config) {
+				cfg.StateMachineArn = "arn:aws:states:eu-west-1:000000000000:stateMachine:api"
+				cfg.StepFunctionsEndpoint = mockserver.URL
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.CircuitBreaker = &CircuitBreakerConfig{MinRequests: 1, ErrorRatio: 0.1}
+			test.configure(cfg)
+
+			handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}), cfg, "breaker-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The requests abandoned by the client are not accounted as failures.
+			for i := 0; i < 3; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil).WithContext(ctx)
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					cancel()
+				}()
+
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			assert.True(t, handler.(*AwsLambdaPlugin).breaker.allow(time.Now()))
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package awslambdaplugin
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheMaxEntries    = 1000
+	defaultCacheMaxEntryBytes = 1024 * 1024
+	defaultCacheKey           = "{method} {host}{path}?{query}"
+)
+
+var cacheKeyPlaceholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// cacheableStatusCodes are the successful and negative responses stored when fresh.
+var cacheableStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// CacheConfig stores the GET and HEAD responses of the function that are fresh according to their
+// Cache-Control and Expires headers, and serves the repeated requests without invoking it, as a
+// shared cache would. The least recently used responses are evicted first.
+type CacheConfig struct {
+	// Key is the template of the cache key, with the {method}, {host}, {path}, {query} (the whole
+	// query string), {query:name} and {header:Name} placeholders, e.g.
+	// "{path}?page={query:page}&lang={header:Accept-Language}" (default "{method} {host}{path}?{query}").
+	// The key always includes the invoked function, and HEAD requests are keyed apart from GET.
+	Key string `json:"key,omitempty"`
+	// MaxEntries is the number of responses kept (default 1000).
+	MaxEntries int `json:"maxEntries,omitempty"`
+	// MaxEntryBytes is the largest response body stored (default 1 MiB).
+	MaxEntryBytes int `json:"maxEntryBytes,omitempty"`
+}
+
+// cacheEntry is a stored response and the request header values it varies on.
+type cacheEntry struct {
+	key     string
+	resp    LambdaResponse
+	vary    map[string]string
+	stored  time.Time
+	age     time.Duration
+	expires time.Time
+}
+
+// responseCache holds the fresh responses by request key, the most recently used first.
+type responseCache struct {
+	key           string
+	maxEntries    int
+	maxEntryBytes int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+func newResponseCache(config *CacheConfig) (*responseCache, error) {
+	if config.MaxEntries < 0 {
+		return nil, fmt.Errorf("cache: max entries cannot be negative")
+	}
+
+	if config.MaxEntryBytes < 0 {
+		return nil, fmt.Errorf("cache: max entry bytes cannot be negative")
+	}
+
+	c := &responseCache{
+		key:           config.Key,
+		maxEntries:    config.MaxEntries,
+		maxEntryBytes: config.MaxEntryBytes,
+		entries:       map[string]*list.Element{},
+		lru:           list.New(),
+	}
+
+	if c.key == "" {
+		c.key = defaultCacheKey
+	}
+
+	if err := validateCacheKey(c.key); err != nil {
+		return nil, err
+	}
+
+	if c.maxEntries == 0 {
+		c.maxEntries = defaultCacheMaxEntries
+	}
+
+	if c.maxEntryBytes == 0 {
+		c.maxEntryBytes = defaultCacheMaxEntryBytes
+	}
+
+	return c, nil
+}
+
+// validateCacheKey checks every placeholder of the key is supported.
+func validateCacheKey(key string) error {
+	for _, match := range cacheKeyPlaceholderRegexp.FindAllStringSubmatch(key, -1) {
+		name := match[1]
+		switch {
+		case name == "method" || name == "host" || name == "path" || name == "query":
+		case strings.HasPrefix(name, "query:") && len(name) > len("query:"):
+		case strings.HasPrefix(name, "header:") && len(name) > len("header:"):
+		default:
+			return fmt.Errorf("cache: unsupported key placeholder %q", match[0])
+		}
+	}
+
+	return nil
+}
+
+// requestKey renders the key of the requests sharing a response, prefixed with the invoked function. It
+// reports false for the requests that are not cacheable.
+func (c *responseCache) requestKey(req *http.Request, in *invokeInput) (string, bool) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || req.ContentLength != 0 ||
+		in.InvocationType == invocationTypeEvent {
+		return "", false
+	}
+
+	query := req.URL.Query()
+	key := cacheKeyPlaceholderRegexp.ReplaceAllStringFunc(c.key, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		switch {
+		case name == "method":
+			return req.Method
+		case name == "host":
+			return req.Host
+		case name == "path":
+			return req.URL.EscapedPath()
+		case name == "query":
+			return req.URL.RawQuery
+		case strings.HasPrefix(name, "query:"):
+			return url.QueryEscape(strings.Join(query[strings.TrimPrefix(name, "query:")], ","))
+		default:
+			return url.QueryEscape(strings.Join(req.Header.Values(strings.TrimPrefix(name, "header:")), ","))
+		}
+	})
+
+	return strings.Join([]string{in.FunctionName, in.Qualifier, strconv.FormatBool(req.Method == http.MethodHead), key}, "\x00"), true
+}
+
+// lookup returns the fresh response stored for the request, with its Age header set. The requests
+// asking for a revalidation always miss.
+func (c *responseCache) lookup(key string, req *http.Request, now time.Time) (LambdaResponse, bool) {
+	directives := parseCacheControl(req.Header.Values("Cache-Control"))
+	if directives.has("no-cache") || directives.has("no-store") || strings.Contains(req.Header.Get("Pragma"), "no-cache") {
+		return LambdaResponse{}, false
+	}
+
+	c.mu.Lock()
+	var entry *cacheEntry
+	if element, ok := c.entries[key]; ok {
+		entry = element.Value.(*cacheEntry)
+		if now.Before(entry.expires) {
+			c.lru.MoveToFront(element)
+		} else {
+			c.remove(element)
+			entry = nil
+		}
+	}
+	c.mu.Unlock()
+
+	if entry == nil {
+		return LambdaResponse{}, false
+	}
+
+	for name, value := range entry.vary {
+		if strings.Join(req.Header.Values(name), ",") != value {
+			return LambdaResponse{}, false
+		}
+	}
+
+	resp := entry.resp
+	resp.Headers = make(map[string]string, len(entry.resp.Headers)+1)
+	for name, value := range entry.resp.Headers {
+		if !strings.EqualFold(name, "Age") {
+			resp.Headers[name] = value
+		}
+	}
+
+	resp.Headers["Age"] = strconv.FormatInt(int64((entry.age + now.Sub(entry.stored)).Seconds()), 10)
+
+	return resp, true
+}
+
+// store keeps the response of the request, served with the status, when it is cacheable and fresh,
+// evicting the least recently used responses over the max entries.
+func (c *responseCache) store(key string, req *http.Request, resp LambdaResponse, status int, now time.Time) {
+	header := responseHeader(resp)
+	directives := parseCacheControl(header.Values("Cache-Control"))
+	if !c.cacheable(req, resp, status, header, directives) {
+		return
+	}
+
+	lifetime, ok := freshnessLifetime(header, directives, now)
+	if !ok {
+		return
+	}
+
+	age, _ := strconv.ParseInt(header.Get("Age"), 10, 64)
+	entry := &cacheEntry{key: key, resp: resp, stored: now, age: time.Duration(age) * time.Second}
+	if entry.age >= lifetime {
+		return
+	}
+
+	entry.expires = now.Add(lifetime - entry.age)
+	if entry.vary, ok = varyValues(header, req); !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// cacheable reports whether the response of the request, served with the status, may be stored.
+func (c *responseCache) cacheable(req *http.Request, resp LambdaResponse, status int, header http.Header, directives cacheControl) bool {
+	if !cacheableStatusCodes[status] || len(resp.Body) > c.maxEntryBytes {
+		return false
+	}
+
+	if parseCacheControl(req.Header.Values("Cache-Control")).has("no-store") {
+		return false
+	}
+
+	if directives.has("no-store") || directives.has("no-cache") || directives.has("private") ||
+		header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	// A shared cache only stores the responses to authorized requests explicitly allowed to.
+	return req.Header.Get("Authorization") == "" ||
+		directives.has("public") || directives.has("s-maxage") || directives.has("must-revalidate")
+}
+
+// varyValues returns the request values of the headers the response varies on. It reports false
+// when the response varies on everything.
+func varyValues(header http.Header, req *http.Request) (map[string]string, bool) {
+	var vary map[string]string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil, false
+			}
+
+			if name != "" {
+				if vary == nil {
+					vary = map[string]string{}
+				}
+
+				vary[name] = strings.Join(req.Header.Values(name), ",")
+			}
+		}
+	}
+
+	return vary, true
+}
+
+// remove drops a stored response. The caller holds the lock.
+func (c *responseCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+// freshnessLifetime returns how long a response stays fresh: its s-maxage or max-age directive,
+// otherwise the time between its Date and Expires headers. It reports false when the response has
+// no explicit lifetime.
+func freshnessLifetime(header http.Header, directives cacheControl, now time.Time) (time.Duration, bool) {
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	if header.Get("Expires") == "" {
+		return 0, false
+	}
+
+	// An invalid Expires, e.g. 0, means already expired.
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0, false
+	}
+
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = now
+	}
+
+	lifetime := expires.Sub(date)
+
+	return lifetime, lifetime > 0
+}
+
+// cacheControl are the directives of Cache-Control headers, by lowercase name.
+type cacheControl map[string]string
+
+func parseCacheControl(values []string) cacheControl {
+	directives := cacheControl{}
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument := strings.TrimSpace(directive), ""
+			if i := strings.Index(name, "="); i >= 0 {
+				name, argument = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+			}
+
+			if name != "" {
+				directives[strings.ToLower(name)] = argument
+			}
+		}
+	}
+
+	return directives
+}
+
+func (c cacheControl) has(name string) bool {
+	_, ok := c[name]
+	return ok
+}
+
+// responseHeader returns the headers of a function response, as written to the client.
+func responseHeader(resp LambdaResponse) http.Header {
+	header := http.Header{}
+	for name, value := range resp.Headers {
+		header.Set(name, value)
+	}
+
+	for name, values := range resp.MultiValueHeaders {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+
+	return header
+}
+
+// invokeCached serves the request from the cache when a fresh response is stored, invokes the
+// function and stores its response otherwise.
+func (a *AwsLambdaPlugin) invokeCached(ctx context.Context, rw http.ResponseWriter, req *http.Request, in *invokeInput) {
+	key, cacheable := "", false
+	if a.cache != nil {
+		key, cacheable = a.cache.requestKey(req, in)
+	}
+
+	if !cacheable {
+		resp, err := a.invokeCoalesced(ctx, req, in)
+		a.respond(rw, req, resp, err)
+
+		return
+	}
+
+	resp, hit := a.cache.lookup(key, req, time.Now())
+	invocationRecordOf(rw).setCacheStatus(hit)
+	if hit {
+		a.logger.debugf("served %s %s from the cache", req.Method, req.URL.RequestURI())
+		a.writeConditional(rw, req, resp)
+
+		return
+	}
+
+	resp, err := a.invokeCoalesced(ctx, req, in)
+	if err == nil {
+		if a.etag {
+			// Stored with the ETag, not to hash the body again on every hit.
+			resp = a.withETag(resp)
+		}
+
+		if status, statusErr := a.statusCode(resp.StatusCode); statusErr == nil {
+			a.cache.store(key, req, resp, status, time.Now())
+		}
+	}
+
+	a.respond(rw, req, resp, err)
+}
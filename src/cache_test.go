@@ -0,0 +1,207 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseCache(t *testing.T) {
+	var invocations int32
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&invocations, 1)
+
+		var event awslambdaplugin.LambdaRequest
+		_ = json.NewDecoder(req.Body).Decode(&event)
+
+		headers := map[string]string{}
+		switch event.Path {
+		case "/fresh":
+			headers["Cache-Control"] = "max-age=60"
+		case "/expires":
+			headers["Date"] = time.Now().UTC().Format(http.TimeFormat)
+			headers["Expires"] = time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+		case "/no-store":
+			headers["Cache-Control"] = "no-store, max-age=60"
+		case "/expired":
+			headers["Cache-Control"] = "max-age=60"
+			headers["Age"] = "60"
+		case "/vary":
+			headers["Cache-Control"] = "max-age=60"
+			headers["Vary"] = "Accept-Language"
+		case "/cookie":
+			headers["Cache-Control"] = "max-age=60"
+			headers["Set-Cookie"] = "session=1"
+		case "/authorized":
+			headers["Cache-Control"] = "max-age=60"
+		case "/public":
+			headers["Cache-Control"] = "public, max-age=60"
+		}
+
+		body, _ := json.Marshal(map[string]interface{}{"statusCode": 200, "headers": headers, "body": "hello"})
+		res.WriteHeader(200)
+		_, _ = res.Write(body)
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Cache = &awslambdaplugin.CacheConfig{}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+
+		return recorder
+	}
+
+	// invoked serves twice the request and returns the number of invocations.
+	invoked := func(method, path string, first, second http.Header) int32 {
+		atomic.StoreInt32(&invocations, 0)
+		serve(method, path, first)
+		serve(method, path, second)
+
+		return atomic.LoadInt32(&invocations)
+	}
+
+	atomic.StoreInt32(&invocations, 0)
+	assert.Empty(t, serve(http.MethodGet, "/fresh", nil).Header().Get("Age"))
+	cached := serve(http.MethodGet, "/fresh", nil)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&invocations))
+	assert.Equal(t, "hello", cached.Body.String())
+	assert.Equal(t, "max-age=60", cached.Header().Get("Cache-Control"))
+	assert.Equal(t, "0", cached.Header().Get("Age"))
+
+	assert.Equal(t, int32(1), invoked(http.MethodGet, "/expires", nil, nil))
+	assert.Equal(t, int32(1), invoked(http.MethodGet, "/fresh?page=2", nil, nil))
+	assert.Equal(t, int32(2), invoked(http.MethodGet, "/uncacheable", nil, nil))
+	assert.Equal(t, int32(2), invoked(http.MethodGet, "/no-store", nil, nil))
+	assert.Equal(t, int32(2), invoked(http.MethodGet, "/expired", nil, nil))
+	assert.Equal(t, int32(2), invoked(http.MethodGet, "/cookie", nil, nil))
+	assert.Equal(t, int32(2), invoked(http.MethodPost, "/fresh", nil, nil))
+
+	// The client asks for a revalidation.
+	assert.Equal(t, int32(1), invoked(http.MethodGet, "/fresh", nil, http.Header{"Cache-Control": {"no-cache"}}))
+
+	fr := http.Header{"Accept-Language": {"fr"}}
+	assert.Equal(t, int32(2), invoked(http.MethodGet, "/vary", http.Header{"Accept-Language": {"en"}}, fr))
+	assert.Equal(t, int32(0), invoked(http.MethodGet, "/vary", fr, fr))
+
+	authorized := http.Header{"Authorization": {"Bearer token"}}
+	assert.Equal(t, int32(2), invoked(http.MethodGet, "/authorized", authorized, authorized))
+	assert.Equal(t, int32(1), invoked(http.MethodGet, "/public", authorized, authorized))
+
+	cfg.Cache = &awslambdaplugin.CacheConfig{MaxEntries: -1}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "cache: max entries cannot be negative")
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	var invocations int32
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&invocations, 1)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200, "headers": {"Cache-Control": "max-age=60"}, "body": "hello"}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Metrics = &awslambdaplugin.MetricsConfig{Path: "/_metrics"}
+	cfg.Cache = &awslambdaplugin.CacheConfig{Key: "{path}?page={query:page}&lang={header:Accept-Language}", MaxEntries: 2}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path, language string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Language", language)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	// invoked serves the request and reports whether the function was invoked.
+	invoked := func(path, language string) bool {
+		atomic.StoreInt32(&invocations, 0)
+		serve(path, language)
+
+		return atomic.LoadInt32(&invocations) > 0
+	}
+
+	assert.True(t, invoked("/items?page=1&utm=a", "en"))
+	assert.False(t, invoked("/items?utm=b&page=1", "en"))
+	assert.True(t, invoked("/items?page=2", "en"))
+	assert.False(t, invoked("/items?page=1", "en"))
+
+	// The least recently used response, of the page 2, is evicted.
+	assert.True(t, invoked("/items?page=1", "fr"))
+	assert.False(t, invoked("/items?page=1", "en"))
+	assert.True(t, invoked("/items?page=2", "en"))
+	assert.False(t, invoked("/items?page=1", "en"))
+
+	metrics := serve("/_metrics", "").Body.String()
+	assert.Contains(t, metrics, `traefik_lambda_cache_hits_total{middleware="lambda-plugin",function="arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"} 4`)
+	assert.Contains(t, metrics, `traefik_lambda_cache_misses_total{middleware="lambda-plugin",function="arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"} 4`)
+
+	cfg.Metrics = nil
+	cfg.Cache = &awslambdaplugin.CacheConfig{MaxEntryBytes: 4}
+	handler, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, invoked("/items", "en"))
+	assert.True(t, invoked("/items", "en"))
+
+	cfg.Cache = &awslambdaplugin.CacheConfig{Key: "{path}{cookie:session}"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `cache: unsupported key placeholder "{cookie:session}"`)
+
+	cfg.Cache = &awslambdaplugin.CacheConfig{MaxEntryBytes: -1}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "cache: max entry bytes cannot be negative")
+}
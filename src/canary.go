@@ -0,0 +1,52 @@
+package awslambdaplugin
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// CanaryConfig sends a share of the requests to a second version or alias of the function, the split
+// being decided by the plugin instead of the alias traffic shifting of Lambda.
+type CanaryConfig struct {
+	// Qualifier is the version or alias receiving the canary traffic (e.g. v2).
+	Qualifier string `json:"qualifier,omitempty"`
+	// Weight is the percentage of the requests sent to the canary, between 0 and 100.
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// canaryRouting picks the requests invoking the canary qualifier.
+type canaryRouting struct {
+	qualifier string
+	weight    float64
+}
+
+func newCanaryRouting(config *CanaryConfig, functionArn string) (*canaryRouting, error) {
+	if config.Qualifier == "" {
+		return nil, fmt.Errorf("canary: qualifier cannot be empty")
+	}
+
+	if config.Weight < 0 || config.Weight > 100 {
+		return nil, fmt.Errorf("canary: weight must be between 0 and 100")
+	}
+
+	fn, err := parseFunctionArn(functionArn)
+	if err != nil {
+		return nil, err
+	}
+
+	// The canary qualifier is sent apart, so the ARN must not pin a version of its own.
+	if fn.qualifier != "" {
+		return nil, fmt.Errorf("canary: functionArn cannot include a qualifier, use the qualifier option")
+	}
+
+	if err := checkQualifier(config.Qualifier, fn); err != nil {
+		return nil, fmt.Errorf("canary: %w", err)
+	}
+
+	return &canaryRouting{qualifier: config.Qualifier, weight: config.Weight}, nil
+}
+
+// pick reports whether the request goes to the canary.
+func (c *canaryRouting) pick() bool {
+	return rand.Float64()*100 < c.weight //nolint:gosec // No need for a secure random source.
+}
@@ -0,0 +1,110 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanary(t *testing.T) {
+	qualifiers := map[string]int{}
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		qualifiers[req.URL.Query().Get("Qualifier")]++
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		desc     string
+		weight   float64
+		expected map[string]int
+	}{
+		{desc: "disabled", weight: 0, expected: map[string]int{"live": 10}},
+		{desc: "all", weight: 100, expected: map[string]int{"v2": 10}},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx"
+			cfg.Qualifier = "live"
+			cfg.Endpoint = mockserver.URL
+			cfg.Canary = &awslambdaplugin.CanaryConfig{Qualifier: "v2", Weight: test.weight}
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			qualifiers = map[string]int{}
+			for i := 0; i < 10; i++ {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, req)
+				assert.Equal(t, 200, recorder.Result().StatusCode)
+			}
+
+			assert.Equal(t, test.expected, qualifiers)
+		})
+	}
+}
+
+func TestCanaryConfig(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		functionArn string
+		canary      awslambdaplugin.CanaryConfig
+		err         string
+	}{
+		{
+			desc:        "qualified arn",
+			functionArn: "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1",
+			canary:      awslambdaplugin.CanaryConfig{Qualifier: "v2", Weight: 5},
+			err:         "canary: functionArn cannot include a qualifier, use the qualifier option",
+		},
+		{
+			desc:        "weight",
+			functionArn: "arn:aws:lambda:eu-west-1:000000000000:function:xxx",
+			canary:      awslambdaplugin.CanaryConfig{Qualifier: "v2", Weight: 150},
+			err:         "canary: weight must be between 0 and 100",
+		},
+		{
+			desc:        "qualifier",
+			functionArn: "arn:aws:lambda:eu-west-1:000000000000:function:xxx",
+			canary:      awslambdaplugin.CanaryConfig{Qualifier: "v.2", Weight: 5},
+			err:         `canary: invalid qualifier "v.2"`,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = test.functionArn
+			cfg.Canary = &test.canary
+
+			_, err := awslambdaplugin.New(context.Background(), http.NotFoundHandler(), cfg, "lambda-plugin")
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package awslambdaplugin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// clientContextMaxSize is the longest base64 encoded ClientContext accepted by Invoke.
+const clientContextMaxSize = 3583
+
+var headerPlaceholderRegexp = regexp.MustCompile(`\{header:([A-Za-z0-9_-]+)\}`)
+
+// ClientContextConfig the ClientContext passed to the function, as the mobile SDKs do. Values may
+// contain {header:Name} placeholders, replaced with the value of the request header.
+type ClientContextConfig struct {
+	// Client describes the calling application (installation_id, app_title, app_version_name, ...).
+	Client map[string]string `json:"client,omitempty"`
+	// Custom values, for the application use.
+	Custom map[string]string `json:"custom,omitempty"`
+	// Env describes the device (platform, make, model, locale, ...).
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// clientContextTemplate renders the ClientContext of the invocations. Without placeholders
+// the context is encoded once.
+type clientContextTemplate struct {
+	sections map[string]map[string]string
+	dynamic  bool
+	encoded  string
+}
+
+// newClientContextTemplate builds the ClientContext template. The custom eventEncoding key
+// announces the binary event encodings and cannot be overridden.
+func newClientContextTemplate(config *ClientContextConfig, encoding string) (*clientContextTemplate, error) {
+	t := &clientContextTemplate{sections: map[string]map[string]string{}}
+	if config != nil {
+		for name, values := range map[string]map[string]string{"client": config.Client, "custom": config.Custom, "env": config.Env} {
+			if len(values) == 0 {
+				continue
+			}
+
+			section := make(map[string]string, len(values))
+			for key, value := range values {
+				section[key] = value
+				if headerPlaceholderRegexp.MatchString(value) {
+					t.dynamic = true
+				}
+			}
+
+			t.sections[name] = section
+		}
+	}
+
+	if encoding != encodingJSON {
+		if t.sections["custom"] == nil {
+			t.sections["custom"] = map[string]string{}
+		}
+
+		t.sections["custom"]["eventEncoding"] = encoding
+	}
+
+	if len(t.sections) == 0 {
+		return t, nil
+	}
+
+	if !t.dynamic {
+		encoded, err := encodeClientContext(t.sections)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(encoded) > clientContextMaxSize {
+			return nil, errClientContextTooLarge
+		}
+
+		t.encoded = encoded
+	}
+
+	return t, nil
+}
+
+// render returns the base64 encoded ClientContext of the request.
+func (t *clientContextTemplate) render(req *http.Request) (string, error) {
+	if !t.dynamic {
+		return t.encoded, nil
+	}
+
+	sections := make(map[string]map[string]string, len(t.sections))
+	for name, values := range t.sections {
+		section := make(map[string]string, len(values))
+		for key, value := range values {
+			section[key] = headerPlaceholderRegexp.ReplaceAllStringFunc(value, func(placeholder string) string {
+				return req.Header.Get(headerPlaceholderRegexp.FindStringSubmatch(placeholder)[1])
+			})
+		}
+
+		sections[name] = section
+	}
+
+	encoded, err := encodeClientContext(sections)
+	if err != nil {
+		return "", err
+	}
+
+	if len(encoded) > clientContextMaxSize {
+		return "", errClientContextTooLarge
+	}
+
+	return encoded, nil
+}
+
+var errClientContextTooLarge = fmt.Errorf("client context exceeds %d bytes once encoded", clientContextMaxSize)
+
+// encodeClientContext builds the base64 encoded ClientContext made of the given sections.
+func encodeClientContext(sections map[string]map[string]string) (string, error) {
+	buf, err := json.Marshal(sections)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,84 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientContext(t *testing.T) {
+	var clientContext string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		decoded, err := base64.StdEncoding.DecodeString(req.Header.Get("X-Amz-Client-Context"))
+		assert.NoError(t, err)
+		clientContext = string(decoded)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.ClientContext = &awslambdaplugin.ClientContextConfig{
+		Client: map[string]string{"app_title": "web"},
+		Custom: map[string]string{"device": "{header:X-Device-Id}", "tenant": "t-{header:X-Tenant}"},
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Device-Id", "d-42")
+	req.Header.Set("X-Tenant", "acme")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.JSONEq(t, `{"client": {"app_title": "web"}, "custom": {"device": "d-42", "tenant": "t-acme"}}`, clientContext)
+
+	req.Header.Set("X-Device-Id", strings.Repeat("x", 4096))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 431, recorder.Code)
+
+	cfg.ClientContext = &awslambdaplugin.ClientContextConfig{Custom: map[string]string{"eventEncoding": "json", "app": "web"}}
+	cfg.EventEncoding = "msgpack"
+
+	handler, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockserver.Config.Handler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		decoded, _ := base64.StdEncoding.DecodeString(req.Header.Get("X-Amz-Client-Context"))
+		clientContext = string(decoded)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte{0x81, 0xaa, 's', 't', 'a', 't', 'u', 's', 'C', 'o', 'd', 'e', 0xcc, 0xc8})
+	})
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.JSONEq(t, `{"custom": {"eventEncoding": "msgpack", "app": "web"}}`, clientContext)
+}
@@ -0,0 +1,74 @@
+package awslambdaplugin
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+const headerXForwardedFor = "X-Forwarded-For"
+
+// normalizeIP strips brackets, ports and zones from a client address so that it can be parsed by
+// common IP libraries. IPv4-mapped IPv6 addresses are rendered as plain IPv4 when unmapV4 is set.
+func normalizeIP(addr string, unmapV4 bool) string {
+	s := strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return s
+	}
+
+	// net.IP renders IPv4-mapped addresses in the dotted form: keep the original family unless asked.
+	if v4 := ip.To4(); v4 != nil && strings.Contains(s, ":") && !unmapV4 {
+		return "::ffff:" + v4.String()
+	}
+
+	return ip.String()
+}
+
+// forwardedFor normalizes the X-Forwarded-For chain of the request and appends the client address.
+func forwardedFor(req *http.Request, clientIP string, unmapV4 bool) string {
+	var chain []string
+	for _, value := range req.Header.Values(headerXForwardedFor) {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				chain = append(chain, normalizeIP(part, unmapV4))
+			}
+		}
+	}
+
+	if clientIP != "" {
+		chain = append(chain, clientIP)
+	}
+
+	return strings.Join(chain, ", ")
+}
+
+// setClientAddress populates the source IP of the event and rewrites the X-Forwarded-For header,
+// with the normalized client address compat switch.
+func (a *AwsLambdaPlugin) setClientAddress(request *LambdaRequest, req *http.Request) {
+	if a.compat.ClientAddress != clientAddressNormalized {
+		return
+	}
+
+	clientIP := ""
+	if req.RemoteAddr != "" {
+		clientIP = normalizeIP(req.RemoteAddr, a.unmapIPv4)
+	}
+
+	if xff := forwardedFor(req, clientIP, a.unmapIPv4); xff != "" {
+		req.Header.Set(headerXForwardedFor, xff)
+	}
+
+	request.RequestContext = &LambdaRequestContext{
+		Identity: LambdaRequestIdentity{SourceIP: clientIP},
+	}
+}
@@ -0,0 +1,133 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientAddressNormalization(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		remoteAddr string
+		xff        string
+		unmap      bool
+		compat     string
+		level      string
+		sourceIP   string
+		expected   string
+	}{
+		{
+			desc:       "passthrough by default",
+			remoteAddr: "[fe80::1%eth0]:4321",
+			xff:        "[2001:db8::1], 203.0.113.7:80",
+			expected:   "[2001:db8::1], 203.0.113.7:80",
+		},
+		{
+			desc:       "bracketed ipv6 with zone",
+			compat:     "normalized",
+			remoteAddr: "[fe80::1%eth0]:4321",
+			xff:        "[2001:db8::1], 203.0.113.7:80",
+			sourceIP:   "fe80::1",
+			expected:   "2001:db8::1, 203.0.113.7, fe80::1",
+		},
+		{
+			desc:       "v2 preset",
+			remoteAddr: "[2001:db8::2]:4321",
+			level:      "v2",
+			sourceIP:   "2001:db8::2",
+			expected:   "2001:db8::2",
+		},
+		{
+			desc:       "ipv4-mapped kept",
+			compat:     "normalized",
+			remoteAddr: "[::ffff:192.0.2.1]:4321",
+			sourceIP:   "::ffff:192.0.2.1",
+			expected:   "::ffff:192.0.2.1",
+		},
+		{
+			desc:       "ipv4-mapped unmapped",
+			compat:     "normalized",
+			remoteAddr: "[::ffff:192.0.2.1]:4321",
+			xff:        "::FFFF:198.51.100.2",
+			unmap:      true,
+			sourceIP:   "192.0.2.1",
+			expected:   "198.51.100.2, 192.0.2.1",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				var buf bytes.Buffer
+				_, err := io.Copy(&buf, req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var lReq awslambdaplugin.LambdaRequest
+				err = json.Unmarshal(buf.Bytes(), &lReq)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if test.sourceIP == "" {
+					assert.Nil(t, lReq.RequestContext)
+				} else {
+					assert.Equal(t, test.sourceIP, lReq.RequestContext.Identity.SourceIP)
+				}
+				xff := lReq.Headers["X-Forwarded-For"]
+				if test.level == "v2" {
+					xff = lReq.Headers["x-forwarded-for"]
+				}
+				assert.Equal(t, test.expected, xff)
+
+				res.WriteHeader(200)
+				_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+			}))
+			defer func() { mockserver.Close() }()
+
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.MapIPv4MappedAddresses = test.unmap
+			cfg.CompatLevel = test.level
+			if test.compat != "" {
+				cfg.Compat = &awslambdaplugin.CompatConfig{ClientAddress: test.compat}
+			}
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.RemoteAddr = test.remoteAddr
+			if test.xff != "" {
+				req.Header.Set("X-Forwarded-For", test.xff)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, 200, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CoalescingConfig shares a single invocation between the concurrent identical requests, so that
+// bursts of the same GET cost one invocation (and at most one cold start).
+type CoalescingConfig struct {
+	// Methods whose requests are coalesced (default GET and HEAD). Requests with a body never are.
+	Methods []string `json:"methods,omitempty"`
+	// VaryHeaders are the request headers distinguishing otherwise identical requests
+	// (default Authorization and Cookie), so that responses are never shared between users.
+	VaryHeaders []string `json:"varyHeaders,omitempty"`
+}
+
+var errCoalescedCallFailed = errors.New("coalesced invocation failed")
+
+// coalescedCall is an invocation shared by identical requests.
+type coalescedCall struct {
+	done chan struct{}
+	resp LambdaResponse
+	err  error
+}
+
+// requestCoalescer tracks the pending invocations by request key.
+type requestCoalescer struct {
+	methods     map[string]bool
+	varyHeaders []string
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+func newRequestCoalescer(config *CoalescingConfig) *requestCoalescer {
+	methods := config.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead}
+	}
+
+	varyHeaders := config.VaryHeaders
+	if len(varyHeaders) == 0 {
+		varyHeaders = []string{"Authorization", "Cookie"}
+	}
+
+	c := &requestCoalescer{methods: map[string]bool{}, calls: map[string]*coalescedCall{}}
+	for _, m := range methods {
+		c.methods[strings.ToUpper(m)] = true
+	}
+
+	for _, name := range varyHeaders {
+		c.varyHeaders = append(c.varyHeaders, http.CanonicalHeaderKey(name))
+	}
+
+	return c
+}
+
+// key identifies the requests sharing the invocation: the invoked function, the method, host,
+// path and query of the request and its vary headers. It reports false for the requests that
+// cannot be coalesced.
+func (c *requestCoalescer) key(req *http.Request, in *invokeInput) (string, bool) {
+	if !c.methods[req.Method] || req.ContentLength != 0 || in.InvocationType == invocationTypeEvent {
+		return "", false
+	}
+
+	parts := []string{in.FunctionName, in.Qualifier, req.Method, req.Host, req.URL.RequestURI()}
+	for _, name := range c.varyHeaders {
+		parts = append(parts, name+"="+strings.Join(req.Header.Values(name), ","))
+	}
+
+	return strings.Join(parts, "\x00"), true
+}
+
+// do runs fn, unless an invocation with the same key is pending: its result is then shared when it
+// completes, or the context error returned if the context is done first.
+func (c *requestCoalescer) do(ctx context.Context, key string, fn func() (LambdaResponse, error)) (resp LambdaResponse, shared bool, err error) {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+
+		select {
+		case <-call.done:
+			return call.resp, true, call.err
+		case <-ctx.Done():
+			return LambdaResponse{}, true, ctx.Err()
+		}
+	}
+
+	// The error stays when fn panics.
+	call := &coalescedCall{done: make(chan struct{}), err: errCoalescedCallFailed}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+
+		close(call.done)
+	}()
+
+	call.resp, call.err = fn()
+
+	return call.resp, false, call.err
+}
+
+// invokeCoalesced invokes the function for the request, sharing the invocation with the identical
+// pending requests. A request whose shared invocation was canceled, because the client that started
+// it went away, invokes the function on its own.
+func (a *AwsLambdaPlugin) invokeCoalesced(ctx context.Context, req *http.Request, in *invokeInput) (LambdaResponse, error) {
+	if a.coalescer == nil {
+		return a.invokeRetryingStatus(ctx, req, in)
+	}
+
+	key, ok := a.coalescer.key(req, in)
+	if !ok {
+		return a.invokeRetryingStatus(ctx, req, in)
+	}
+
+	resp, shared, err := a.coalescer.do(ctx, key, func() (LambdaResponse, error) {
+		return a.invokeRetryingStatus(ctx, req, in)
+	})
+	if shared && errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		return a.invokeRetryingStatus(ctx, req, in)
+	}
+
+	return resp, err
+}
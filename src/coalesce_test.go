@@ -0,0 +1,110 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalescing(t *testing.T) {
+	var calls int32
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200, \"body\": \"shared\"}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Coalescing = &awslambdaplugin.CoalescingConfig{}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc     string
+		requests []func(*http.Request)
+		expected int32
+	}{
+		{
+			desc:     "identical",
+			requests: []func(*http.Request){nil, nil, nil},
+			expected: 1,
+		},
+		{
+			desc: "different users",
+			requests: []func(*http.Request){
+				func(req *http.Request) { req.Header.Set("Authorization", "Bearer a") },
+				func(req *http.Request) { req.Header.Set("Authorization", "Bearer b") },
+			},
+			expected: 2,
+		},
+		{
+			desc: "different queries",
+			requests: []func(*http.Request){
+				func(req *http.Request) { req.URL.RawQuery = "page=1" },
+				func(req *http.Request) { req.URL.RawQuery = "page=2" },
+			},
+			expected: 2,
+		},
+		{
+			desc: "not coalesced method",
+			requests: []func(*http.Request){
+				func(req *http.Request) { req.Method = http.MethodDelete },
+				func(req *http.Request) { req.Method = http.MethodDelete },
+			},
+			expected: 2,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+
+			var wg sync.WaitGroup
+			for _, prepare := range test.requests {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/items", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if prepare != nil {
+					prepare(req)
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					recorder := httptest.NewRecorder()
+					handler.ServeHTTP(recorder, req)
+
+					assert.Equal(t, 200, recorder.Code)
+					assert.Equal(t, "shared", recorder.Body.String())
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, test.expected, atomic.LoadInt32(&calls))
+		})
+	}
+}
@@ -0,0 +1,877 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	encodingJSON    = "json"
+	encodingCBOR    = "cbor"
+	encodingMsgpack = "msgpack"
+
+	maxCodecDepth = 32
+)
+
+var (
+	errTruncated   = errors.New("truncated payload")
+	errNotAnObject = errors.New("response is not a JSON object")
+)
+
+// eventCodec serializes the events sent to the function and parses its responses.
+type eventCodec interface {
+	name() string
+	// encode serializes the event. Text bodies may be sent verbatim instead of base64 encoded.
+	encode(request *LambdaRequest, body []byte, text bool) ([]byte, error)
+	decode(payload []byte) (LambdaResponse, error)
+}
+
+func newEventCodec(encoding string) (eventCodec, error) {
+	switch encoding {
+	case "", encodingJSON:
+		return jsonCodec{}, nil
+	case encodingCBOR:
+		return binaryCodec{encoding: encodingCBOR, marshal: marshalCBOR, unmarshal: unmarshalCBOR}, nil
+	case encodingMsgpack:
+		return binaryCodec{encoding: encodingMsgpack, marshal: marshalMsgpack, unmarshal: unmarshalMsgpack}, nil
+	default:
+		return nil, fmt.Errorf("unsupported event encoding %q", encoding)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) name() string { return encodingJSON }
+
+func (jsonCodec) encode(request *LambdaRequest, body []byte, text bool) ([]byte, error) {
+	switch {
+	case body == nil:
+	case text:
+		request.Body = string(body)
+	default:
+		request.Body = base64.StdEncoding.EncodeToString(body)
+		request.IsBase64Encoded = true
+	}
+
+	return json.Marshal(request)
+}
+
+func (jsonCodec) decode(payload []byte) (LambdaResponse, error) {
+	var resp LambdaResponse
+	if trimmed := bytes.TrimSpace(payload); len(trimmed) == 0 || trimmed[0] != '{' {
+		return resp, errNotAnObject
+	}
+
+	err := json.Unmarshal(payload, &resp)
+
+	return resp, err
+}
+
+// binaryCodec encodes the event as a binary map, carrying the body as a raw byte string. The
+// Invoke API only accepts JSON payloads: the binary event is sent base64 encoded in a JSON envelope,
+// {"eventEncoding": "cbor", "payload": "<base64>"}, which the function decodes. The function may
+// answer with the same envelope, a binary map or a JSON response.
+type binaryCodec struct {
+	encoding  string
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(b []byte) (interface{}, error)
+}
+
+func (c binaryCodec) name() string { return c.encoding }
+
+func (c binaryCodec) encode(request *LambdaRequest, body []byte, _ bool) ([]byte, error) {
+	if body == nil {
+		body = []byte{}
+	}
+
+	event := orderedMap{
+		{"httpMethod", request.HTTPMethod},
+		{"path", request.Path},
+		{"queryStringParameters", request.QueryStringParameters},
+		{"multiValueQueryStringParameters", request.MultiValueQueryStringParameters},
+		{"multiValueHeaders", request.MultiValueHeaders},
+		{"headers", request.Headers},
+		{"body", body},
+		{"isBase64Encoded", false},
+	}
+	if request.BodyURL != "" {
+		event = append(event, orderedField{"bodyUrl", request.BodyURL})
+	}
+
+	if request.RequestContext != nil {
+		event = append(event, orderedField{"requestContext", orderedMap{
+			{"identity", orderedMap{{"sourceIp", request.RequestContext.Identity.SourceIP}}},
+		}})
+	}
+
+	encoded, err := c.marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(binaryEnvelope{Encoding: c.encoding, Payload: encoded})
+}
+
+func (c binaryCodec) decode(payload []byte) (LambdaResponse, error) {
+	if trimmed := bytes.TrimSpace(payload); len(trimmed) > 0 && trimmed[0] == '{' {
+		var envelope binaryEnvelope
+		if err := json.Unmarshal(trimmed, &envelope); err != nil || envelope.Encoding != c.encoding {
+			return jsonCodec{}.decode(payload)
+		}
+
+		payload = envelope.Payload
+	}
+
+	v, err := c.unmarshal(payload)
+	if err != nil {
+		return LambdaResponse{}, fmt.Errorf("%s: %w", c.encoding, err)
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return LambdaResponse{}, fmt.Errorf("%s: response is not a map", c.encoding)
+	}
+
+	if body, ok := m["body"].([]byte); ok {
+		m["body"] = string(body)
+	}
+
+	// The normalized value only contains JSON-compatible types at this point.
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return LambdaResponse{}, err
+	}
+
+	return jsonCodec{}.decode(buf)
+}
+
+// binaryEnvelope carries a binary event or response in a JSON payload.
+type binaryEnvelope struct {
+	Encoding string `json:"eventEncoding"`
+	Payload  []byte `json:"payload"`
+}
+
+type orderedField struct {
+	key   string
+	value interface{}
+}
+
+// orderedMap a map whose keys are encoded in declaration order.
+type orderedMap []orderedField
+
+// --- CBOR (RFC 8949) ---
+
+func marshalCBOR(v interface{}) ([]byte, error) {
+	return appendCBOR(nil, v)
+}
+
+func cborHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, major|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		b = append(b, major|26)
+		return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		b = append(b, major|27)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], n)
+		return append(b, buf[:]...)
+	}
+}
+
+func appendCBOR(b []byte, v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case nil:
+		return append(b, 0xf6), nil
+	case bool:
+		if t {
+			return append(b, 0xf5), nil
+		}
+		return append(b, 0xf4), nil
+	case int:
+		if t < 0 {
+			return cborHead(b, 1, uint64(-1-t)), nil
+		}
+		return cborHead(b, 0, uint64(t)), nil
+	case float64:
+		b = append(b, 0xfb)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(t))
+		return append(b, buf[:]...), nil
+	case string:
+		return append(cborHead(b, 3, uint64(len(t))), t...), nil
+	case []byte:
+		return append(cborHead(b, 2, uint64(len(t))), t...), nil
+	case []string:
+		b = cborHead(b, 4, uint64(len(t)))
+		for _, s := range t {
+			b = append(cborHead(b, 3, uint64(len(s))), s...)
+		}
+		return b, nil
+	default:
+		return appendCBORMap(b, v)
+	}
+}
+
+func appendCBORMap(b []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch t := v.(type) {
+	case map[string]string:
+		if t == nil {
+			return append(b, 0xf6), nil
+		}
+		b = cborHead(b, 5, uint64(len(t)))
+		for _, k := range sortedKeys(t) {
+			b = append(cborHead(b, 3, uint64(len(k))), k...)
+			b = append(cborHead(b, 3, uint64(len(t[k]))), t[k]...)
+		}
+		return b, nil
+	case map[string][]string:
+		if t == nil {
+			return append(b, 0xf6), nil
+		}
+		b = cborHead(b, 5, uint64(len(t)))
+		for _, k := range sortedMultiKeys(t) {
+			b = append(cborHead(b, 3, uint64(len(k))), k...)
+			if b, err = appendCBOR(b, t[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case orderedMap:
+		b = cborHead(b, 5, uint64(len(t)))
+		for _, f := range t {
+			b = append(cborHead(b, 3, uint64(len(f.key))), f.key...)
+			if b, err = appendCBOR(b, f.value); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported type %T", v)
+	}
+}
+
+func unmarshalCBOR(b []byte) (interface{}, error) {
+	d := &byteDecoder{buf: b}
+	v, err := d.cbor(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.pos != len(d.buf) {
+		return nil, errors.New("trailing data after cbor value")
+	}
+
+	return v, nil
+}
+
+func (d *byteDecoder) cborArgument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		v, err := d.take(1)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(v[0]), nil
+	case info == 25:
+		v, err := d.take(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(v)), nil
+	case info == 26:
+		v, err := d.take(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(v)), nil
+	case info == 27:
+		v, err := d.take(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(v), nil
+	default:
+		return 0, fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+}
+
+func (d *byteDecoder) cbor(depth int) (interface{}, error) {
+	if depth > maxCodecDepth {
+		return nil, errors.New("cbor: maximum nesting depth exceeded")
+	}
+
+	head, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+
+	major, info := head[0]>>5, head[0]&0x1f
+	if info == 31 {
+		return d.cborIndefinite(major, depth)
+	}
+
+	if major == 7 {
+		return d.cborSimple(info)
+	}
+
+	n, err := d.cborArgument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		return n, nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer overflow")
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		return d.cborString(major, n)
+	case 4:
+		return d.cborArray(n, depth)
+	case 5:
+		return d.cborMap(n, depth)
+	default: // tags: decode the tagged content as is.
+		return d.cbor(depth + 1)
+	}
+}
+
+func (d *byteDecoder) cborString(major byte, n uint64) (interface{}, error) {
+	raw, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if major == 3 {
+		return string(raw), nil
+	}
+
+	return append([]byte{}, raw...), nil
+}
+
+func (d *byteDecoder) cborArray(n uint64, depth int) (interface{}, error) {
+	arr := make([]interface{}, 0, d.capacity(n))
+	for i := uint64(0); i < n; i++ {
+		item, err := d.cbor(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		arr = append(arr, item)
+	}
+
+	return arr, nil
+}
+
+func (d *byteDecoder) cborMap(n uint64, depth int) (interface{}, error) {
+	m := make(map[string]interface{}, d.capacity(n))
+	for i := uint64(0); i < n; i++ {
+		if err := d.cborEntry(m, depth); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (d *byteDecoder) cborEntry(m map[string]interface{}, depth int) error {
+	key, err := d.cbor(depth + 1)
+	if err != nil {
+		return err
+	}
+
+	k, ok := key.(string)
+	if !ok {
+		return errors.New("cbor: map keys must be strings")
+	}
+
+	m[k], err = d.cbor(depth + 1)
+
+	return err
+}
+
+func (d *byteDecoder) cborSimple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		v, err := d.take(2)
+		if err != nil {
+			return nil, err
+		}
+		return halfToFloat(binary.BigEndian.Uint16(v)), nil
+	case 26:
+		v, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(v))), nil
+	case 27:
+		v, err := d.take(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(v)), nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
+
+func (d *byteDecoder) cborIndefinite(major byte, depth int) (interface{}, error) {
+	switch major {
+	case 2, 3:
+		return d.cborIndefiniteString(major, depth)
+	case 4:
+		arr := []interface{}{}
+		for !d.cborBreak() {
+			item, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+		return arr, nil
+	case 5:
+		m := map[string]interface{}{}
+		for !d.cborBreak() {
+			if err := d.cborEntry(m, depth); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("cbor: invalid indefinite length for major type %d", major)
+	}
+}
+
+func (d *byteDecoder) cborIndefiniteString(major byte, depth int) (interface{}, error) {
+	var raw []byte
+	for !d.cborBreak() {
+		chunk, err := d.cbor(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		switch c := chunk.(type) {
+		case string:
+			raw = append(raw, c...)
+		case []byte:
+			raw = append(raw, c...)
+		default:
+			return nil, errors.New("cbor: invalid indefinite-length string chunk")
+		}
+	}
+
+	if major == 3 {
+		return string(raw), nil
+	}
+
+	return raw, nil
+}
+
+// cborBreak consumes the "break" stop code if it is the next byte.
+func (d *byteDecoder) cborBreak() bool {
+	if d.pos < len(d.buf) && d.buf[d.pos] == 0xff {
+		d.pos++
+		return true
+	}
+
+	return false
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var v float64
+	switch exp {
+	case 0:
+		v = mant * math.Pow(2, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = (1 + mant/1024) * math.Pow(2, float64(exp-15))
+	}
+
+	if h&0x8000 != 0 {
+		return -v
+	}
+
+	return v
+}
+
+// --- MessagePack ---
+
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	return appendMsgpack(nil, v)
+}
+
+func msgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	return append(b, s...)
+}
+
+func msgpackContainer(b []byte, fix, b16, b32 byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, b16, byte(n>>8), byte(n))
+	default:
+		return append(b, b32, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpack(b []byte, v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if t {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return msgpackInt(b, t), nil
+	case float64:
+		b = append(b, 0xcb)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(t))
+		return append(b, buf[:]...), nil
+	case string:
+		return msgpackString(b, t), nil
+	case []byte:
+		return msgpackBinary(b, t), nil
+	case []string:
+		b = msgpackContainer(b, 0x90, 0xdc, 0xdd, len(t))
+		for _, s := range t {
+			b = msgpackString(b, s)
+		}
+		return b, nil
+	default:
+		return appendMsgpackMap(b, v)
+	}
+}
+
+func msgpackInt(b []byte, n int) []byte {
+	if (n >= 0 && n < 128) || (n < 0 && n >= -32) {
+		return append(b, byte(n))
+	}
+
+	b = append(b, 0xd3)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+
+	return append(b, buf[:]...)
+}
+
+func msgpackBinary(b, raw []byte) []byte {
+	n := len(raw)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xc5, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xc6, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	return append(b, raw...)
+}
+
+func appendMsgpackMap(b []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch t := v.(type) {
+	case map[string]string:
+		if t == nil {
+			return append(b, 0xc0), nil
+		}
+		b = msgpackContainer(b, 0x80, 0xde, 0xdf, len(t))
+		for _, k := range sortedKeys(t) {
+			b = msgpackString(msgpackString(b, k), t[k])
+		}
+		return b, nil
+	case map[string][]string:
+		if t == nil {
+			return append(b, 0xc0), nil
+		}
+		b = msgpackContainer(b, 0x80, 0xde, 0xdf, len(t))
+		for _, k := range sortedMultiKeys(t) {
+			if b, err = appendMsgpack(msgpackString(b, k), t[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case orderedMap:
+		b = msgpackContainer(b, 0x80, 0xde, 0xdf, len(t))
+		for _, f := range t {
+			if b, err = appendMsgpack(msgpackString(b, f.key), f.value); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+}
+
+func unmarshalMsgpack(b []byte) (interface{}, error) {
+	d := &byteDecoder{buf: b}
+	v, err := d.msgpack(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.pos != len(d.buf) {
+		return nil, errors.New("trailing data after msgpack value")
+	}
+
+	return v, nil
+}
+
+func (d *byteDecoder) uint(size int) (uint64, error) {
+	raw, err := d.take(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	for _, c := range raw {
+		n = n<<8 | uint64(c)
+	}
+
+	return n, nil
+}
+
+func (d *byteDecoder) msgpack(depth int) (interface{}, error) {
+	if depth > maxCodecDepth {
+		return nil, errors.New("msgpack: maximum nesting depth exceeded")
+	}
+
+	head, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+
+	c := head[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.msgpackMap(uint64(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.msgpackArray(uint64(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.msgpackRaw(uint64(c&0x1f), true)
+	}
+
+	return d.msgpackFormat(c, depth)
+}
+
+// msgpackFormat decodes the value of a format marker but the fix ones.
+func (d *byteDecoder) msgpackFormat(c byte, depth int) (interface{}, error) {
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb, 0xdc, 0xdd, 0xde, 0xdf:
+		return d.msgpackSized(c, depth)
+	case 0xca, 0xcb, 0xcc, 0xcd, 0xce, 0xcf, 0xd0, 0xd1, 0xd2, 0xd3:
+		return d.msgpackNumber(c)
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported format 0x%02x", c)
+	}
+}
+
+// msgpackSized decodes the bin, str, array and map formats, prefixed by their length.
+func (d *byteDecoder) msgpackSized(c byte, depth int) (interface{}, error) {
+	var size int
+	switch {
+	case c <= 0xc6:
+		size = 1 << (c - 0xc4)
+	case c <= 0xdb:
+		size = 1 << (c - 0xd9)
+	default: // 16 and 32 bits arrays and maps.
+		size = 2 << ((c - 0xdc) & 1)
+	}
+
+	n, err := d.uint(size)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0xc6:
+		return d.msgpackRaw(n, false)
+	case c <= 0xdb:
+		return d.msgpackRaw(n, true)
+	case c <= 0xdd:
+		return d.msgpackArray(n, depth)
+	default:
+		return d.msgpackMap(n, depth)
+	}
+}
+
+// msgpackNumber decodes the float, uint and int formats.
+func (d *byteDecoder) msgpackNumber(c byte) (interface{}, error) {
+	switch c {
+	case 0xca:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 0xcb:
+		n, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(n), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (c - 0xcc))
+	default:
+		size := 1 << (c - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		shift := uint(64 - 8*size)
+		return int64(n<<shift) >> shift, nil
+	}
+}
+
+func (d *byteDecoder) msgpackRaw(n uint64, text bool) (interface{}, error) {
+	raw, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if text {
+		return string(raw), nil
+	}
+
+	return append([]byte{}, raw...), nil
+}
+
+func (d *byteDecoder) msgpackArray(n uint64, depth int) (interface{}, error) {
+	arr := make([]interface{}, 0, d.capacity(n))
+	for i := uint64(0); i < n; i++ {
+		item, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		arr = append(arr, item)
+	}
+
+	return arr, nil
+}
+
+func (d *byteDecoder) msgpackMap(n uint64, depth int) (interface{}, error) {
+	m := make(map[string]interface{}, d.capacity(n))
+	for i := uint64(0); i < n; i++ {
+		key, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		k, ok := key.(string)
+		if !ok {
+			return nil, errors.New("msgpack: map keys must be strings")
+		}
+
+		if m[k], err = d.msgpack(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// byteDecoder a bounds-checked cursor over a binary payload.
+type byteDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *byteDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)-d.pos) {
+		return nil, errTruncated
+	}
+
+	start := d.pos
+	d.pos += int(n)
+
+	return d.buf[start:d.pos], nil
+}
+
+// capacity bounds preallocations by the remaining input, as every element takes at least one byte.
+func (d *byteDecoder) capacity(n uint64) int {
+	if remaining := uint64(len(d.buf) - d.pos); n > remaining {
+		return int(remaining)
+	}
+
+	return int(n)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedMultiKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
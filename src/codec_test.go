@@ -0,0 +1,120 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventEncoding(t *testing.T) {
+	testCases := []struct {
+		encoding string
+		mapHead  byte
+		response []byte
+	}{
+		{
+			encoding: "cbor",
+			mapHead:  0xa8,
+			// {"statusCode": 201, "body": h'6869'}
+			response: []byte{0xa2, 0x6a, 's', 't', 'a', 't', 'u', 's', 'C', 'o', 'd', 'e', 0x18, 0xc9, 0x64, 'b', 'o', 'd', 'y', 0x42, 'h', 'i'},
+		},
+		{
+			encoding: "msgpack",
+			mapHead:  0x88,
+			// {"statusCode": 201, "body": bin "hi"}
+			response: []byte{0x82, 0xaa, 's', 't', 'a', 't', 'u', 's', 'C', 'o', 'd', 'e', 0xcc, 0xc9, 0xa4, 'b', 'o', 'd', 'y', 0xc4, 0x02, 'h', 'i'},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.encoding, func(t *testing.T) {
+			enveloped := false
+			mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				clientContext, err := base64.StdEncoding.DecodeString(req.Header.Get("X-Amz-Client-Context"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				assert.JSONEq(t, `{"custom":{"eventEncoding":"`+test.encoding+`"}}`, string(clientContext))
+
+				// The Invoke API only accepts JSON: the binary event is enveloped.
+				var envelope struct {
+					EventEncoding string `json:"eventEncoding"`
+					Payload       []byte `json:"payload"`
+				}
+				if err := json.NewDecoder(req.Body).Decode(&envelope); err != nil {
+					t.Fatal(err)
+				}
+
+				assert.Equal(t, test.encoding, envelope.EventEncoding)
+				assert.Equal(t, test.mapHead, envelope.Payload[0])
+				assert.True(t, bytes.Contains(envelope.Payload, []byte("httpMethod")))
+				assert.True(t, bytes.Contains(envelope.Payload, []byte("This is the body")))
+
+				response := test.response
+				if enveloped {
+					response, err = json.Marshal(map[string]interface{}{"eventEncoding": test.encoding, "payload": test.response})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				res.WriteHeader(200)
+				_, err = res.Write(response)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}))
+			defer func() { mockserver.Close() }()
+
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.EventEncoding = test.encoding
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The function answers with a binary map, then with an enveloped one.
+			for _, enveloped = range []bool{false, true} {
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/", bytes.NewBufferString("This is the body"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, req)
+
+				assert.Equal(t, 201, recorder.Code)
+				assert.Equal(t, "hi", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnsupportedEventEncoding(t *testing.T) {
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.EventEncoding = "xml"
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	_, err := awslambdaplugin.New(context.Background(), next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported event encoding "xml"`)
+}
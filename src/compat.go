@@ -0,0 +1,174 @@
+package awslambdaplugin
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Compatibility levels. Level v1 preserves the historical behavior of the plugin,
+// v2 mirrors what an ALB sends to a Lambda target.
+const (
+	compatLevelV1 = "v1"
+	compatLevelV2 = "v2"
+)
+
+// Compatibility switch values.
+const (
+	headerCasingCanonical = "canonical"
+	headerCasingLower     = "lower"
+
+	base64Always = "always"
+	base64Binary = "binary"
+
+	mapPopulationSplit  = "split"
+	mapPopulationSingle = "single"
+	mapPopulationMulti  = "multi"
+
+	floatFormatFixed    = "fixed"
+	floatFormatShortest = "shortest"
+
+	clientAddressPassthrough = "passthrough"
+	clientAddressNormalized  = "normalized"
+)
+
+// CompatConfig gathers the behavior-compatibility switches. Unset switches take the value of the compatLevel preset.
+type CompatConfig struct {
+	// HeaderCasing of the event header names: canonical (v1) or lower (v2).
+	HeaderCasing string `json:"headerCasing,omitempty"`
+	// Base64Policy encodes every body (always, v1) or only non-textual ones (binary, v2).
+	Base64Policy string `json:"base64Policy,omitempty"`
+	// MapPopulation of the headers and query string maps: split (v1), single (v2) or multi.
+	MapPopulation string `json:"mapPopulation,omitempty"`
+	// FloatFormat of numeric values converted to strings: fixed with 4 decimals (v1) or shortest (v2).
+	FloatFormat string `json:"floatFormat,omitempty"`
+	// ClientAddress leaves X-Forwarded-For as received (passthrough, v1) or normalizes its IPv6
+	// addresses, appends the client address and sets requestContext.identity.sourceIp (normalized, v2).
+	ClientAddress string `json:"clientAddress,omitempty"`
+}
+
+var compatPresets = map[string]CompatConfig{
+	compatLevelV1: {
+		HeaderCasing:  headerCasingCanonical,
+		Base64Policy:  base64Always,
+		MapPopulation: mapPopulationSplit,
+		FloatFormat:   floatFormatFixed,
+		ClientAddress: clientAddressPassthrough,
+	},
+	compatLevelV2: {
+		HeaderCasing:  headerCasingLower,
+		Base64Policy:  base64Binary,
+		MapPopulation: mapPopulationSingle,
+		FloatFormat:   floatFormatShortest,
+		ClientAddress: clientAddressNormalized,
+	},
+}
+
+// resolveCompat applies the explicit switches over the preset of the configured level.
+// The legacy multiValueHeadersEnabled flag takes precedence over the preset map population.
+func resolveCompat(config *Config) (CompatConfig, error) {
+	level := config.CompatLevel
+	if level == "" {
+		level = compatLevelV1
+	}
+
+	settings, ok := compatPresets[level]
+	if !ok {
+		return CompatConfig{}, fmt.Errorf("unsupported compat level %q", level)
+	}
+
+	if config.MultiValueHeadersEnabled != nil {
+		settings.MapPopulation = mapPopulationSingle
+		if *config.MultiValueHeadersEnabled {
+			settings.MapPopulation = mapPopulationMulti
+		}
+	}
+
+	if c := config.Compat; c != nil {
+		for _, o := range []struct {
+			value   string
+			target  *string
+			name    string
+			allowed []string
+		}{
+			{c.HeaderCasing, &settings.HeaderCasing, "header casing", []string{headerCasingCanonical, headerCasingLower}},
+			{c.Base64Policy, &settings.Base64Policy, "base64 policy", []string{base64Always, base64Binary}},
+			{c.MapPopulation, &settings.MapPopulation, "map population", []string{mapPopulationSplit, mapPopulationSingle, mapPopulationMulti}},
+			{c.FloatFormat, &settings.FloatFormat, "float format", []string{floatFormatFixed, floatFormatShortest}},
+			{c.ClientAddress, &settings.ClientAddress, "client address", []string{clientAddressPassthrough, clientAddressNormalized}},
+		} {
+			if o.value == "" {
+				continue
+			}
+
+			if !containsString(o.allowed, o.value) {
+				return CompatConfig{}, fmt.Errorf("unsupported compat %s %q", o.name, o.value)
+			}
+
+			*o.target = o.value
+		}
+	}
+
+	return settings, nil
+}
+
+// floatPrecision returns the strconv precision used to render floating point values.
+func (c CompatConfig) floatPrecision() int {
+	if c.FloatFormat == floatFormatShortest {
+		return -1
+	}
+
+	return 4
+}
+
+// headerName renders a header name according to the casing policy.
+func (c CompatConfig) headerName(name string) string {
+	if c.HeaderCasing == headerCasingLower {
+		return strings.ToLower(name)
+	}
+
+	return name
+}
+
+// encodeAsText reports whether the body can be sent verbatim rather than base64 encoded.
+func (c CompatConfig) encodeAsText(req *http.Request, body []byte) bool {
+	if c.Base64Policy != base64Binary || req.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	return isTextualContentType(req.Header.Get("Content-Type")) && utf8.Valid(body)
+}
+
+func isTextualContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-www-form-urlencoded", "application/graphql":
+		return true
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,128 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompatLevel(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		level    string
+		compat   *awslambdaplugin.CompatConfig
+		body     string
+		headers  map[string]string
+		multi    map[string][]string
+		base64   bool
+		response string
+	}{
+		{
+			desc:    "v1",
+			level:   "",
+			headers: map[string]string{"Content-Type": "application/json"},
+			multi:   map[string][]string{"X-Test": {"foo", "foobar"}},
+			body:    "eyJhIjoxfQ==",
+			base64:  true,
+		},
+		{
+			desc:    "v2",
+			level:   "v2",
+			headers: map[string]string{"content-type": "application/json", "x-test": "foobar"},
+			body:    `{"a":1}`,
+		},
+		{
+			desc:   "v2 with overrides",
+			level:  "v2",
+			compat: &awslambdaplugin.CompatConfig{MapPopulation: "multi", Base64Policy: "always"},
+			multi:  map[string][]string{"content-type": {"application/json"}, "x-test": {"foo", "foobar"}},
+			body:   "eyJhIjoxfQ==",
+			base64: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				var buf bytes.Buffer
+				_, err := io.Copy(&buf, req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var lReq awslambdaplugin.LambdaRequest
+				err = json.Unmarshal(buf.Bytes(), &lReq)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if test.headers != nil {
+					assert.Equal(t, test.headers, lReq.Headers)
+				}
+				if test.multi != nil {
+					assert.Equal(t, test.multi, lReq.MultiValueHeaders)
+				}
+				assert.Equal(t, test.body, lReq.Body)
+				assert.Equal(t, test.base64, lReq.IsBase64Encoded)
+
+				res.WriteHeader(200)
+				_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+			}))
+			defer func() { mockserver.Close() }()
+
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.CompatLevel = test.level
+			cfg.Compat = test.compat
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/", bytes.NewBufferString(`{"a":1}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Add("X-Test", "foo")
+			req.Header.Add("X-Test", "foobar")
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, 200, recorder.Code)
+		})
+	}
+}
+
+func TestCompatInvalidSwitch(t *testing.T) {
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Compat = &awslambdaplugin.CompatConfig{HeaderCasing: "upper"}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	_, err := awslambdaplugin.New(context.Background(), next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported compat header casing "upper"`)
+
+	cfg.Compat = nil
+	cfg.CompatLevel = "v9"
+	_, err = awslambdaplugin.New(context.Background(), next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported compat level "v9"`)
+}
@@ -0,0 +1,138 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	ecsCredentialsHost    = "http://169.254.170.2"
+	remoteCredentialsWait = 5 * time.Second
+)
+
+// containerCredentials credentials served by a container credentials endpoint: the ECS task role
+// endpoint or the EKS Pod Identity agent.
+type containerCredentials struct {
+	endpoint  string
+	authToken string
+	// authTokenFile is read on every retrieval, as the EKS Pod Identity token is rotated.
+	authTokenFile string
+	httpClient    *http.Client
+}
+
+// newEnvContainerCredentials configures the container provider from the environment, returning
+// nil when the process is not running in a container with a task role or a pod identity.
+func newEnvContainerCredentials() (credentialsProvider, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	if endpoint != "" {
+		endpoint = ecsCredentialsHost + endpoint
+	} else if endpoint = os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); endpoint != "" {
+		if err := validateContainerEndpoint(endpoint); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, nil
+	}
+
+	return &containerCredentials{
+		endpoint:      endpoint,
+		authToken:     os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"),
+		authTokenFile: os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"),
+		httpClient:    &http.Client{Timeout: remoteCredentialsWait},
+	}, nil
+}
+
+// validateContainerEndpoint only allows plain HTTP full URIs towards the loopback interface,
+// the ECS endpoint and the EKS Pod Identity agent, so the token is never sent in clear elsewhere.
+func validateContainerEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("container credentials: invalid full uri: %w", err)
+	}
+
+	if u.Scheme == "https" {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); u.Scheme == "http" && (host == "localhost" || ip != nil && ip.IsLoopback() ||
+		host == "169.254.170.2" || host == "169.254.170.23" || host == "fd00:ec2::23") {
+		return nil
+	}
+
+	return fmt.Errorf("container credentials: full uri host %q is not allowed over %s", host, u.Scheme)
+}
+
+func (p *containerCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	authToken := p.authToken
+	if p.authTokenFile != "" {
+		token, err := os.ReadFile(filepath.Clean(p.authTokenFile))
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("container credentials: %w", err)
+		}
+
+		authToken = strings.TrimSpace(string(token))
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if authToken != "" {
+		req.Header.Set("Authorization", authToken)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("container credentials: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("container credentials: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("container credentials: endpoint responded with status %d", resp.StatusCode)
+	}
+
+	return decodeRemoteCredentials(body, "container credentials")
+}
+
+// decodeRemoteCredentials parses the JSON document served by the ECS and EC2 credentials endpoints.
+func decodeRemoteCredentials(body []byte, source string) (awsCredentials, error) {
+	var payload struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return awsCredentials{}, fmt.Errorf("%s: invalid response: %w", source, err)
+	}
+
+	if payload.AccessKeyID == "" || payload.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("%s: %w", source, errNoCredentials)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     payload.AccessKeyID,
+		SecretAccessKey: payload.SecretAccessKey,
+		SessionToken:    payload.Token,
+		Expires:         payload.Expiration,
+		Source:          source,
+	}, nil
+}
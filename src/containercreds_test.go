@@ -0,0 +1,101 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerCredentials(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v2/credentials/task-id", req.URL.Path)
+		assert.Equal(t, "auth-token", req.Header.Get("Authorization"))
+
+		_, _ = res.Write([]byte(`{"AccessKeyId":"ASIATASK","SecretAccessKey":"task-secret",` +
+			`"Token":"task-token","Expiration":"2030-01-02T03:04:05Z"}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	provider := &containerCredentials{
+		endpoint:   mockserver.URL + "/v2/credentials/task-id",
+		authToken:  "auth-token",
+		httpClient: http.DefaultClient,
+	}
+
+	creds, err := provider.retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "ASIATASK", creds.AccessKeyID)
+	assert.Equal(t, "task-secret", creds.SecretAccessKey)
+	assert.Equal(t, "task-token", creds.SessionToken)
+	assert.Equal(t, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), creds.Expires)
+}
+
+func TestEnvContainerCredentials(t *testing.T) {
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	provider, err := newEnvContainerCredentials()
+	assert.NoError(t, err)
+	assert.Nil(t, provider)
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials/task-id")
+	provider, err = newEnvContainerCredentials()
+	assert.NoError(t, err)
+	if container, ok := provider.(*containerCredentials); assert.True(t, ok) {
+		assert.Equal(t, "http://169.254.170.2/v2/credentials/task-id", container.endpoint)
+	}
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "http://169.254.170.23/v1/credentials")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", "/var/run/secrets/pods.eks.amazonaws.com/serviceaccount/eks-pod-identity-token")
+	provider, err = newEnvContainerCredentials()
+	assert.NoError(t, err)
+	if container, ok := provider.(*containerCredentials); assert.True(t, ok) {
+		assert.Equal(t, "http://169.254.170.23/v1/credentials", container.endpoint)
+		assert.Equal(t, "/var/run/secrets/pods.eks.amazonaws.com/serviceaccount/eks-pod-identity-token", container.authTokenFile)
+	}
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "http://credentials.example.com/v1/credentials")
+	_, err = newEnvContainerCredentials()
+	assert.EqualError(t, err, `container credentials: full uri host "credentials.example.com" is not allowed over http`)
+}
+
+func TestPodIdentityCredentials(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "eks-pod-identity-token")
+	if err := os.WriteFile(tokenFile, []byte("pod-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "pod-token", req.Header.Get("Authorization"))
+
+		_, _ = res.Write([]byte(`{"AccessKeyId":"ASIAPOD","SecretAccessKey":"pod-secret",` +
+			`"Token":"pod-session","Expiration":"2030-01-02T03:04:05Z"}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", mockserver.URL+"/v1/credentials")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+
+	provider, err := newEnvContainerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := provider.retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "ASIAPOD", creds.AccessKeyID)
+	assert.Equal(t, "pod-session", creds.SessionToken)
+}
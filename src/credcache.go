@@ -0,0 +1,170 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// credentialsExpiryWindow stops using temporary credentials slightly before they actually expire.
+	credentialsExpiryWindow = time.Minute
+
+	defaultCredentialsRefreshBefore = 5 * time.Minute
+	defaultCredentialsRetryAttempts = 3
+	credentialsRetryBackoff         = 200 * time.Millisecond
+	credentialsRefreshRetryInterval = 10 * time.Second
+)
+
+// CredentialsCacheConfig tunes the caching of the resolved (non-static) credentials.
+type CredentialsCacheConfig struct {
+	// RefreshBefore renews temporary credentials in background this long before they expire (default 5m).
+	RefreshBefore string `json:"refreshBefore,omitempty"`
+	// MaxAge re-resolves credentials without expiration (e.g. rotated shared credentials files)
+	// after this long. Unset keeps them until the service rejects them.
+	MaxAge string `json:"maxAge,omitempty"`
+	// RetryAttempts of a failed resolution when no usable credentials are cached (default 3).
+	RetryAttempts int `json:"retryAttempts,omitempty"`
+}
+
+// cacheOptions parsed CredentialsCacheConfig. The zero value applies the defaults.
+type cacheOptions struct {
+	refreshBefore time.Duration
+	maxAge        time.Duration
+	retryAttempts int
+	// logger reports the failed background renewals.
+	logger *logger
+}
+
+func newCacheOptions(config *CredentialsCacheConfig) (cacheOptions, error) {
+	if config == nil {
+		return cacheOptions{}, nil
+	}
+
+	refreshBefore, err := parseDurationDefault(config.RefreshBefore, defaultCredentialsRefreshBefore)
+	if err != nil {
+		return cacheOptions{}, fmt.Errorf("credentials cache: invalid refresh before: %w", err)
+	}
+
+	maxAge, err := parseDurationDefault(config.MaxAge, 0)
+	if err != nil {
+		return cacheOptions{}, fmt.Errorf("credentials cache: invalid max age: %w", err)
+	}
+
+	if maxAge > 0 && maxAge <= refreshBefore {
+		return cacheOptions{}, fmt.Errorf("credentials cache: max age must be longer than refresh before")
+	}
+
+	if config.RetryAttempts < 0 {
+		return cacheOptions{}, fmt.Errorf("credentials cache: retry attempts cannot be negative")
+	}
+
+	return cacheOptions{refreshBefore: refreshBefore, maxAge: maxAge, retryAttempts: config.RetryAttempts}, nil
+}
+
+// cachedCredentials memoizes the wrapped provider result. Credentials close to their expiration
+// are renewed in background while the current ones are still served; a failed renewal is retried
+// later without failing the requests, as long as the cached credentials remain valid.
+type cachedCredentials struct {
+	provider credentialsProvider
+	options  cacheOptions
+
+	mu          sync.Mutex
+	creds       *awsCredentials
+	expires     time.Time
+	refreshing  bool
+	nextRefresh time.Time
+}
+
+func newCachedCredentials(provider credentialsProvider, options cacheOptions) *cachedCredentials {
+	if options.refreshBefore == 0 {
+		options.refreshBefore = defaultCredentialsRefreshBefore
+	}
+	if options.retryAttempts == 0 {
+		options.retryAttempts = defaultCredentialsRetryAttempts
+	}
+	if options.logger == nil {
+		options.logger = &logger{}
+	}
+
+	return &cachedCredentials{provider: provider, options: options}
+}
+
+func (c *cachedCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.creds != nil && (c.expires.IsZero() || now.Add(credentialsExpiryWindow).Before(c.expires)) {
+		if c.refreshDue(now) {
+			c.refreshing = true
+			go c.refresh()
+		}
+
+		return *c.creds, nil
+	}
+
+	var err error
+	for attempt := 0; attempt < c.options.retryAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return awsCredentials{}, fmt.Errorf("%w (%s)", err, ctx.Err())
+			case <-time.After(credentialsRetryBackoff << (attempt - 1)):
+			}
+		}
+
+		var creds awsCredentials
+		if creds, err = c.provider.retrieve(ctx); err == nil {
+			c.store(creds)
+			return creds, nil
+		}
+	}
+
+	return awsCredentials{}, err
+}
+
+// refreshDue reports whether the expiring credentials are to be renewed in background. The caller
+// holds the lock.
+func (c *cachedCredentials) refreshDue(now time.Time) bool {
+	return !c.expires.IsZero() && !c.refreshing && now.Add(c.options.refreshBefore).After(c.expires) &&
+		!now.Before(c.nextRefresh)
+}
+
+// refresh renews the credentials in background.
+func (c *cachedCredentials) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.refreshBefore)
+	defer cancel()
+
+	creds, err := c.provider.retrieve(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refreshing = false
+	if err != nil {
+		c.options.logger.warnf("credentials refresh failed, retrying in %s: %s", credentialsRefreshRetryInterval, err)
+		c.nextRefresh = time.Now().Add(credentialsRefreshRetryInterval)
+		return
+	}
+
+	c.store(creds)
+}
+
+func (c *cachedCredentials) store(creds awsCredentials) {
+	c.creds = &creds
+	c.expires = creds.Expires
+	if c.expires.IsZero() && c.options.maxAge > 0 {
+		c.expires = time.Now().Add(c.options.maxAge)
+	}
+}
+
+// invalidate discards the cached credentials, e.g. after the service rejected them because
+// the keys were rotated or the session token was revoked.
+func (c *cachedCredentials) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.creds = nil
+}
@@ -0,0 +1,132 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCredentials returns the queued results in order, repeating the last one.
+type fakeCredentials struct {
+	mu      sync.Mutex
+	calls   int
+	results []fakeResult
+}
+
+type fakeResult struct {
+	creds awsCredentials
+	err   error
+}
+
+func (f *fakeCredentials) retrieve(context.Context) (awsCredentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := f.results[len(f.results)-1]
+	if f.calls < len(f.results) {
+		r = f.results[f.calls]
+	}
+
+	f.calls++
+
+	return r.creds, r.err
+}
+
+func (f *fakeCredentials) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls
+}
+
+func TestCachedCredentialsRetriesResolution(t *testing.T) {
+	failure := errors.New("endpoint unavailable")
+	provider := &fakeCredentials{results: []fakeResult{
+		{err: failure},
+		{err: failure},
+		{creds: awsCredentials{AccessKeyID: "AKID"}},
+	}}
+
+	cached := newCachedCredentials(provider, cacheOptions{})
+	creds, err := cached.retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "AKID", creds.AccessKeyID)
+	assert.Equal(t, 3, provider.callCount())
+
+	_, err = newCachedCredentials(&fakeCredentials{results: []fakeResult{{err: failure}}}, cacheOptions{retryAttempts: 1}).
+		retrieve(context.Background())
+	assert.Equal(t, failure, err)
+}
+
+func TestCachedCredentialsBackgroundRefresh(t *testing.T) {
+	expiring := time.Now().Add(3 * time.Minute)
+	provider := &fakeCredentials{results: []fakeResult{
+		{creds: awsCredentials{AccessKeyID: "OLD", Expires: expiring}},
+		{err: errors.New("sts unavailable")},
+		{creds: awsCredentials{AccessKeyID: "NEW", Expires: time.Now().Add(time.Hour)}},
+	}}
+
+	cached := newCachedCredentials(provider, cacheOptions{})
+	creds, err := cached.retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "OLD", creds.AccessKeyID)
+
+	// Inside the refresh window: the cached credentials are served while renewing them.
+	creds, err = cached.retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "OLD", creds.AccessKeyID)
+	assert.Eventually(t, func() bool { return provider.callCount() == 2 }, time.Second, 5*time.Millisecond)
+
+	// The renewal failed: the still valid credentials keep being served until the retry interval elapses.
+	assert.Eventually(t, func() bool {
+		cached.mu.Lock()
+		defer cached.mu.Unlock()
+
+		return !cached.refreshing
+	}, time.Second, 5*time.Millisecond)
+
+	creds, err = cached.retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "OLD", creds.AccessKeyID)
+	assert.Equal(t, 2, provider.callCount())
+
+	cached.mu.Lock()
+	cached.nextRefresh = time.Time{}
+	cached.mu.Unlock()
+
+	_, _ = cached.retrieve(context.Background())
+	assert.Eventually(t, func() bool {
+		creds, _ := cached.retrieve(context.Background())
+		return creds.AccessKeyID == "NEW"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCachedCredentialsInvalidateAndMaxAge(t *testing.T) {
+	provider := &fakeCredentials{results: []fakeResult{{creds: awsCredentials{AccessKeyID: "AKID"}}}}
+
+	cached := newCachedCredentials(provider, cacheOptions{})
+	for i := 0; i < 2; i++ {
+		_, err := cached.retrieve(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, provider.callCount())
+
+	cached.invalidate()
+	_, err := cached.retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, provider.callCount())
+
+	options, err := newCacheOptions(&CredentialsCacheConfig{MaxAge: "1h"})
+	assert.NoError(t, err)
+
+	cached = newCachedCredentials(provider, options)
+	_, _ = cached.retrieve(context.Background())
+	assert.WithinDuration(t, time.Now().Add(time.Hour), cached.expires, time.Second)
+
+	_, err = newCacheOptions(&CredentialsCacheConfig{MaxAge: "2m"})
+	assert.EqualError(t, err, "credentials cache: max age must be longer than refresh before")
+}
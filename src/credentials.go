@@ -0,0 +1,219 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// awsCredentials a set of credentials used to sign requests.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expires is the zero time for credentials that never expire.
+	Expires time.Time
+	Source  string
+}
+
+func (c awsCredentials) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !now.Before(c.Expires)
+}
+
+// credentialsProvider resolves the credentials used to sign requests.
+type credentialsProvider interface {
+	retrieve(ctx context.Context) (awsCredentials, error)
+}
+
+var errNoCredentials = errors.New("no valid credentials found")
+
+// staticCredentials credentials given in the middleware configuration.
+type staticCredentials awsCredentials
+
+func (s staticCredentials) retrieve(context.Context) (awsCredentials, error) {
+	return awsCredentials(s), nil
+}
+
+// envCredentials credentials read from the standard AWS environment variables.
+type envCredentials struct{}
+
+func (envCredentials) retrieve(context.Context) (awsCredentials, error) {
+	accessKey := firstEnv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY")
+	secretKey := firstEnv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY")
+	if accessKey == "" || secretKey == "" {
+		return awsCredentials{}, fmt.Errorf("environment: %w", errNoCredentials)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     accessKey,
+		SecretAccessKey: secretKey,
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Source:          "environment",
+	}, nil
+}
+
+// sharedCredentials credentials read from the shared credentials file, or from the
+// profile section of the shared config file when the credentials file has none.
+type sharedCredentials struct {
+	filename       string
+	configFilename string
+	profile        string
+}
+
+func (s sharedCredentials) retrieve(context.Context) (awsCredentials, error) {
+	ini, err := loadINI(s.filename)
+	if err != nil && (s.configFilename == "" || !os.IsNotExist(err)) {
+		return awsCredentials{}, fmt.Errorf("shared credentials: %w", err)
+	}
+
+	section, source := ini[s.profile], "shared credentials file"
+	if section["aws_access_key_id"] == "" && s.configFilename != "" {
+		if config, err := loadINI(s.configFilename); err == nil {
+			section, source = profileSection(config, s.profile), "shared config file"
+		}
+	}
+
+	if section["aws_access_key_id"] == "" || section["aws_secret_access_key"] == "" {
+		return awsCredentials{}, fmt.Errorf("shared credentials profile %q: %w", s.profile, errNoCredentials)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     section["aws_access_key_id"],
+		SecretAccessKey: section["aws_secret_access_key"],
+		SessionToken:    section["aws_session_token"],
+		Source:          source,
+	}, nil
+}
+
+// newProfileCredentials reads the credentials of an explicitly selected profile,
+// failing when neither shared file defines it.
+func newProfileCredentials(profile string) (credentialsProvider, error) {
+	sso, err := newSSOCredentials(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if sso != nil {
+		return sso, nil
+	}
+
+	provider := sharedCredentials{
+		filename:       sharedCredentialsFilename(),
+		configFilename: sharedConfigFilename(),
+		profile:        profile,
+	}
+
+	found := false
+	if ini, err := loadINI(provider.filename); err == nil {
+		_, found = ini[profile]
+	}
+	if ini, err := loadINI(provider.configFilename); err == nil && !found {
+		found = profileSection(ini, profile) != nil
+	}
+
+	if !found {
+		return nil, fmt.Errorf("profile %q not found in the shared credentials and config files", profile)
+	}
+
+	if process := newProfileProcessCredentials(profile); process != nil {
+		return chainCredentials{provider, process}, nil
+	}
+
+	return provider, nil
+}
+
+// chainCredentials returns the credentials of the first provider that succeeds.
+type chainCredentials []credentialsProvider
+
+func (c chainCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	errs := make([]string, 0, len(c))
+	for _, p := range c {
+		creds, err := p.retrieve(ctx)
+		if err == nil {
+			return creds, nil
+		}
+
+		errs = append(errs, err.Error())
+	}
+
+	return awsCredentials{}, fmt.Errorf("%w: %s", errNoCredentials, strings.Join(errs, "; "))
+}
+
+// defaultCredentialsChain mimics the default SDK resolution: environment, shared credentials file,
+// profile credential_process, SSO profile, the container credentials endpoint (ECS or EKS Pod Identity), then the EC2 instance profile.
+func defaultCredentialsChain(profile string, imds *IMDSConfig) (credentialsProvider, error) {
+	chain := chainCredentials{
+		envCredentials{},
+		sharedCredentials{filename: sharedCredentialsFilename(), profile: profile},
+	}
+
+	if process := newProfileProcessCredentials(profile); process != nil {
+		chain = append(chain, process)
+	}
+
+	sso, err := newSSOCredentials(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if sso != nil {
+		chain = append(chain, sso)
+	}
+
+	container, err := newEnvContainerCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	if container != nil {
+		chain = append(chain, container)
+	}
+
+	instance, err := newIMDSCredentials(imds)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance != nil {
+		chain = append(chain, instance)
+	}
+
+	return chain, nil
+}
+
+// ambientCredentials resolves the credentials not given inline in the configuration: the credential
+// process, the selected profile or, when neither is set, the default chain.
+func ambientCredentials(config *Config, profile string, cache cacheOptions) (credentialsProvider, error) {
+	if len(config.CredentialProcess) > 0 {
+		return newCachedCredentials(&processCredentials{command: config.CredentialProcess}, cache), nil
+	}
+
+	var (
+		creds credentialsProvider
+		err   error
+	)
+	if len(config.Profile) > 0 {
+		creds, err = newProfileCredentials(config.Profile)
+	} else {
+		creds, err = defaultCredentialsChain(profile, config.IMDS)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newCachedCredentials(creds, cache), nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
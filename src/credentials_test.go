@@ -0,0 +1,165 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeSharedFiles(t *testing.T, credentials, config string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials")
+	configFile := filepath.Join(dir, "config")
+
+	if err := os.WriteFile(credentialsFile, []byte(credentials), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+}
+
+func TestProfileCredentials(t *testing.T) {
+	writeSharedFiles(t, `[default]
+aws_access_key_id = DEFAULTKEY
+aws_secret_access_key = default-secret
+
+[invoker]
+aws_access_key_id = INVOKERKEY
+aws_secret_access_key = invoker-secret
+`, `[profile from-config]
+region = eu-south-1
+aws_access_key_id = CONFIGKEY
+aws_secret_access_key = config-secret
+`)
+
+	provider, err := newProfileCredentials("invoker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := provider.retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "INVOKERKEY", creds.AccessKeyID)
+	assert.Equal(t, "shared credentials file", creds.Source)
+
+	provider, err = newProfileCredentials("from-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err = provider.retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "CONFIGKEY", creds.AccessKeyID)
+	assert.Equal(t, "shared config file", creds.Source)
+	assert.Equal(t, "eu-south-1", resolveRegion("", "from-config"))
+
+	_, err = newProfileCredentials("missing")
+	assert.EqualError(t, err, `profile "missing" not found in the shared credentials and config files`)
+}
+
+func TestSSOCredentials(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeSharedFiles(t, "", `[profile developer]
+sso_session = corp
+sso_account_id = 000000000000
+sso_role_name = Invoker
+
+[sso-session corp]
+sso_start_url = https://corp.awsapps.com/start
+sso_region = eu-west-1
+`)
+
+	cacheDir := filepath.Join(home, ".aws", "sso", "cache")
+	if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	// SHA-1 of the session name "corp".
+	token := `{"accessToken":"sso-token","expiresAt":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`
+	if err := os.WriteFile(filepath.Join(cacheDir, "ee0bfd2552fbd840c02cc48b6e823320543c450f.json"), []byte(token), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/federation/credentials", req.URL.Path)
+		assert.Equal(t, "000000000000", req.URL.Query().Get("account_id"))
+		assert.Equal(t, "Invoker", req.URL.Query().Get("role_name"))
+		assert.Equal(t, "sso-token", req.Header.Get("X-Amz-Sso_bearer_token"))
+
+		_, _ = res.Write([]byte(`{"roleCredentials":{"accessKeyId":"ASIASSO","secretAccessKey":"sso-secret",` +
+			`"sessionToken":"sso-session-token","expiration":1893553445000}}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	provider, err := newSSOCredentials("developer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sso := provider.(*ssoCredentials)
+	assert.Equal(t, "https://portal.sso.eu-west-1.amazonaws.com", sso.portalURL)
+	sso.portalURL = mockserver.URL
+
+	creds, err := provider.retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "ASIASSO", creds.AccessKeyID)
+	assert.Equal(t, "sso-session-token", creds.SessionToken)
+	assert.Equal(t, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), creds.Expires.UTC())
+
+	provider, err = newSSOCredentials("default")
+	assert.NoError(t, err)
+	assert.Nil(t, provider)
+}
+
+func TestProcessCredentials(t *testing.T) {
+	writeSharedFiles(t, "", `[profile vault]
+credential_process = echo '{"Version":1,"AccessKeyId":"ASIAPROCESS","SecretAccessKey":"process-secret","SessionToken":"process-token","Expiration":"2030-01-02T03:04:05Z"}'
+
+[profile broken]
+credential_process = echo 'denied' >&2; exit 3
+`)
+
+	provider := newProfileProcessCredentials("vault")
+	if provider == nil {
+		t.Fatal("credential_process not found")
+	}
+
+	creds, err := provider.retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "ASIAPROCESS", creds.AccessKeyID)
+	assert.Equal(t, "process-token", creds.SessionToken)
+	assert.Equal(t, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), creds.Expires)
+
+	_, err = newProfileProcessCredentials("broken").retrieve(context.Background())
+	assert.EqualError(t, err, "credential process: exit status 3: denied")
+
+	assert.Nil(t, newProfileProcessCredentials("default"))
+
+	_, err = (&processCredentials{command: `echo '{"Version":2}'`}).retrieve(context.Background())
+	assert.EqualError(t, err, "credential process: unsupported output version 2")
+}
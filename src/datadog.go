@@ -0,0 +1,74 @@
+package awslambdaplugin
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"strconv"
+)
+
+const (
+	datadogTraceIDHeader          = "X-Datadog-Trace-Id"
+	datadogParentIDHeader         = "X-Datadog-Parent-Id"
+	datadogSamplingPriorityHeader = "X-Datadog-Sampling-Priority"
+	datadogTagsHeader             = "X-Datadog-Tags"
+)
+
+// propagateDatadogTrace sets the Datadog trace headers forwarded to the function: the span of the
+// invocation when traced, otherwise the ones of the request, generated when missing or invalid so
+// that the function starts the trace.
+func propagateDatadogTrace(req *http.Request, s *span) {
+	if s != nil {
+		// Datadog correlates 128-bit trace IDs on their lower 64 bits.
+		priority := "0"
+		if s.sampled {
+			priority = "1"
+		}
+
+		req.Header.Set(datadogTraceIDHeader, strconv.FormatUint(binary.BigEndian.Uint64(s.traceID[8:]), 10))
+		req.Header.Set(datadogParentIDHeader, strconv.FormatUint(binary.BigEndian.Uint64(s.spanID[:]), 10))
+		req.Header.Set(datadogSamplingPriorityHeader, priority)
+		req.Header.Del(datadogTagsHeader)
+
+		return
+	}
+
+	if validDatadogID(req.Header.Get(datadogTraceIDHeader)) && validDatadogID(req.Header.Get(datadogParentIDHeader)) {
+		return
+	}
+
+	traceID, ok := randomDatadogID()
+	if !ok {
+		return
+	}
+
+	parentID, ok := randomDatadogID()
+	if !ok {
+		return
+	}
+
+	req.Header.Set(datadogTraceIDHeader, strconv.FormatUint(traceID, 10))
+	req.Header.Set(datadogParentIDHeader, strconv.FormatUint(parentID, 10))
+	req.Header.Set(datadogSamplingPriorityHeader, "1")
+	req.Header.Del(datadogTagsHeader)
+}
+
+// validDatadogID reports whether the value is a non-zero unsigned 64-bit decimal ID.
+func validDatadogID(value string) bool {
+	id, err := strconv.ParseUint(value, 10, 64)
+	return err == nil && id != 0
+}
+
+// randomDatadogID returns a non-zero 63-bit random ID, as generated by the Datadog tracers.
+func randomDatadogID() (uint64, bool) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, false
+		}
+
+		if id := binary.BigEndian.Uint64(b[:]) >> 1; id != 0 {
+			return id, true
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatadogTracing(t *testing.T) {
+	var event awslambdaplugin.LambdaRequest
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		event = awslambdaplugin.LambdaRequest{}
+		_ = json.NewDecoder(req.Body).Decode(&event)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.DatadogTracing = true
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(traceID, parentID string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if traceID != "" {
+			req.Header.Set("X-Datadog-Trace-Id", traceID)
+			req.Header.Set("X-Datadog-Parent-Id", parentID)
+			req.Header.Set("X-Datadog-Sampling-Priority", "2")
+			req.Header.Set("X-Datadog-Tags", "_dd.p.dm=-4")
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("1234567890123456789", "987654321")
+	assert.Equal(t, "1234567890123456789", event.Headers["X-Datadog-Trace-Id"])
+	assert.Equal(t, "987654321", event.Headers["X-Datadog-Parent-Id"])
+	assert.Equal(t, "2", event.Headers["X-Datadog-Sampling-Priority"])
+	assert.Equal(t, "_dd.p.dm=-4", event.Headers["X-Datadog-Tags"])
+
+	for _, traceID := range []string{"", "0", "not-an-id"} {
+		serve(traceID, "987654321")
+		assert.Regexp(t, regexp.MustCompile(`^[1-9][0-9]*$`), event.Headers["X-Datadog-Trace-Id"])
+		assert.Regexp(t, regexp.MustCompile(`^[1-9][0-9]*$`), event.Headers["X-Datadog-Parent-Id"])
+		assert.NotEqual(t, "987654321", event.Headers["X-Datadog-Parent-Id"])
+		assert.Equal(t, "1", event.Headers["X-Datadog-Sampling-Priority"])
+		assert.NotContains(t, event.Headers, "X-Datadog-Tags")
+	}
+
+	// The function continues the span of the invocation.
+	cfg.Tracing = &awslambdaplugin.TracingConfig{Endpoint: "http://127.0.0.1:1"}
+	handler, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// 0xa3ce929d0e0e4736, the lower 64 bits of the trace ID.
+	assert.Equal(t, "11803532876627986230", event.Headers["X-Datadog-Trace-Id"])
+	assert.Regexp(t, regexp.MustCompile(`^[1-9][0-9]*$`), event.Headers["X-Datadog-Parent-Id"])
+	assert.Equal(t, "1", event.Headers["X-Datadog-Sampling-Priority"])
+}
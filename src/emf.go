@@ -0,0 +1,127 @@
+package awslambdaplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const defaultEMFNamespace = "TraefikLambda"
+
+// EMFConfig writes a CloudWatch Embedded Metric Format line per request, which the CloudWatch
+// agent or a log shipper turns into CloudWatch metrics.
+type EMFConfig struct {
+	// Namespace of the metrics (default TraefikLambda).
+	Namespace string `json:"namespace,omitempty"`
+	// File receives the lines: stdout (default), stderr or a file path, appended to.
+	File string `json:"file,omitempty"`
+}
+
+// emfEmitter writes the metrics of the requests in Embedded Metric Format.
+type emfEmitter struct {
+	middleware string
+	namespace  string
+	out        *log.Logger
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// emfLine is a line of the Embedded Metric Format: the metadata, the dimensions and the values.
+type emfLine struct {
+	AWS         emfMetadata `json:"_aws"`
+	Middleware  string      `json:"Middleware"`
+	Function    string      `json:"Function"`
+	Invocations int         `json:"Invocations"`
+	Errors      int         `json:"Errors"`
+	Throttles   int         `json:"Throttles"`
+	Latency     float64     `json:"Latency"`
+	StatusCode  int         `json:"StatusCode"`
+	ErrorCode   string      `json:"ErrorCode,omitempty"`
+	RequestID   string      `json:"RequestId,omitempty"`
+}
+
+var emfMetrics = []emfMetric{
+	{Name: "Invocations", Unit: "Count"},
+	{Name: "Errors", Unit: "Count"},
+	{Name: "Throttles", Unit: "Count"},
+	{Name: "Latency", Unit: "Milliseconds"},
+}
+
+func newEMFEmitter(middleware string, config *EMFConfig) (*emfEmitter, error) {
+	e := &emfEmitter{middleware: middleware, namespace: config.Namespace}
+	if e.namespace == "" {
+		e.namespace = defaultEMFNamespace
+	}
+
+	var out io.Writer
+	switch config.File {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		file, err := openLogFile(config.File)
+		if err != nil {
+			return nil, fmt.Errorf("emf: %w", err)
+		}
+
+		out = file
+	}
+
+	e.out = log.New(out, "", 0)
+
+	return e, nil
+}
+
+// emit writes the metrics of a request served in duration with the status.
+func (e *emfEmitter) emit(function string, record *invocationRecord, status int, duration time.Duration, now time.Time) {
+	line := emfLine{
+		AWS: emfMetadata{
+			Timestamp: now.UnixNano() / int64(time.Millisecond),
+			CloudWatchMetrics: []emfDirective{{
+				Namespace:  e.namespace,
+				Dimensions: [][]string{{"Middleware", "Function"}, {"Middleware"}},
+				Metrics:    emfMetrics,
+			}},
+		},
+		Middleware:  e.middleware,
+		Function:    function,
+		Invocations: 1,
+		Latency:     float64(duration.Microseconds()) / 1000,
+		StatusCode:  status,
+		ErrorCode:   record.errorCode,
+		RequestID:   record.requestID,
+	}
+
+	if record.errorCode != "" || status >= 500 {
+		line.Errors = 1
+	}
+
+	if record.errorCode == "lambda_throttled" {
+		line.Throttles = 1
+	}
+
+	entry, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+
+	e.out.Print(string(entry))
+}
@@ -0,0 +1,90 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEMF(t *testing.T) {
+	var failure bool
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+		if failure {
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+
+			return
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	file := filepath.Join(t.TempDir(), "emf.log")
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.EMF = &awslambdaplugin.EMFConfig{Namespace: "Edge", File: file}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []bool{false, true} {
+		failure = f
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+
+	var success, throttled map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &success))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &throttled))
+
+	directive := success["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Edge", directive["Namespace"])
+	assert.Equal(t, []interface{}{[]interface{}{"Middleware", "Function"}, []interface{}{"Middleware"}}, directive["Dimensions"])
+	assert.Len(t, directive["Metrics"], 4)
+
+	assert.Equal(t, "lambda-plugin", success["Middleware"])
+	assert.Equal(t, "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1", success["Function"])
+	assert.Equal(t, float64(1), success["Invocations"])
+	assert.Equal(t, float64(0), success["Errors"])
+	assert.Equal(t, "req-1", success["RequestId"])
+	assert.Contains(t, success, "Latency")
+
+	assert.Equal(t, float64(1), throttled["Errors"])
+	assert.Equal(t, float64(1), throttled["Throttles"])
+	assert.Equal(t, float64(503), throttled["StatusCode"])
+	assert.Equal(t, "lambda_throttled", throttled["ErrorCode"])
+}
@@ -0,0 +1,76 @@
+package awslambdaplugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// jsonError is the body of the error responses in the json error format.
+type jsonError struct {
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// parseErrorFormat reports whether the error responses have a JSON body.
+func parseErrorFormat(value string) (bool, error) {
+	switch value {
+	case "", errorFormatText:
+		return false, nil
+	case errorFormatJSON:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported error format %q", value)
+	}
+}
+
+// errorCode returns the machine-readable code of a failure answered with the status code.
+func errorCode(statusCode int, err error) string {
+	switch errorClass(statusCode, err) {
+	case errorClassThrottle:
+		return "lambda_throttled"
+	case errorClassTimeout:
+		return "lambda_timeout"
+	case errorClassBadResponse:
+		return "lambda_bad_response"
+	case errorClassInvokeFailure:
+		return "lambda_invoke_failed"
+	}
+
+	if errors.Is(err, errCircuitOpen) {
+		return "circuit_open"
+	}
+
+	return "request_failed"
+}
+
+// errorRequestID returns the Lambda request ID of a failed invocation, if known.
+func errorRequestID(err error) string {
+	var failed *functionFailedError
+	if errors.As(err, &failed) {
+		return failed.requestID
+	}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.RequestID
+	}
+
+	return ""
+}
+
+// jsonErrorResponse replaces the body of the error response with its JSON error.
+func jsonErrorResponse(resp LambdaResponse, err error) LambdaResponse {
+	body, _ := json.Marshal(jsonError{Error: errorCode(resp.StatusCode, err), RequestID: errorRequestID(err)})
+
+	return LambdaResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    replaceContentType(resp.Headers, "application/json"),
+		Body:       string(body),
+	}
+}
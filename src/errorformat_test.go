@@ -0,0 +1,81 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONErrorFormat(t *testing.T) {
+	var failure string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+
+		switch failure {
+		case "throttle":
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+		case "function":
+			res.Header().Set("X-Amz-Function-Error", "Unhandled")
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`{"errorMessage": "boom"}`))
+		case "response":
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`not json`))
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.ErrorFormat = "json"
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(f string) *httptest.ResponseRecorder {
+		failure = f
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := serve("function")
+	assert.Equal(t, 502, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"lambda_invoke_failed","requestId":"req-1"}`, recorder.Body.String())
+
+	recorder = serve("throttle")
+	assert.Equal(t, 503, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"lambda_throttled","requestId":"req-1"}`, recorder.Body.String())
+
+	recorder = serve("response")
+	assert.Equal(t, 502, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"lambda_bad_response"}`, recorder.Body.String())
+
+	cfg.ErrorFormat = "xml"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported error format "xml"`)
+}
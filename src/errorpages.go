@@ -0,0 +1,158 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	statusCodePlaceholder = "{statusCode}"
+	statusTextPlaceholder = "{statusText}"
+
+	defaultErrorPageContentType = "text/html; charset=utf-8"
+
+	errorClassInvokeFailure = "invokeFailure"
+	errorClassThrottle      = "throttle"
+	errorClassTimeout       = "timeout"
+	errorClassBadResponse   = "badResponse"
+)
+
+// ErrorPagesConfig replaces the bodies of the error responses by class of failure, so that the end
+// users see branded pages instead of bare status texts. {statusCode} and {statusText} placeholders
+// in the pages are replaced with the status of the response.
+type ErrorPagesConfig struct {
+	// InvokeFailure is the page of the failed invocations, function errors included.
+	InvokeFailure *ErrorPageConfig `json:"invokeFailure,omitempty"`
+	// Throttle is the page of the invocations throttled by Lambda.
+	Throttle *ErrorPageConfig `json:"throttle,omitempty"`
+	// Timeout is the page of the invocations exceeding the invoke timeout.
+	Timeout *ErrorPageConfig `json:"timeout,omitempty"`
+	// BadResponse is the page of the invocations whose response cannot be decoded.
+	BadResponse *ErrorPageConfig `json:"badResponse,omitempty"`
+}
+
+// ErrorPageConfig is an error page, given inline or read from a file at startup.
+type ErrorPageConfig struct {
+	Body string `json:"body,omitempty"`
+	File string `json:"file,omitempty"`
+	// ContentType of the page (default text/html; charset=utf-8).
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// errorPage is a parsed ErrorPageConfig.
+type errorPage struct {
+	body        string
+	contentType string
+}
+
+// errorPages are the error pages by error class.
+type errorPages map[string]*errorPage
+
+func newErrorPages(config *ErrorPagesConfig) (errorPages, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	pages := errorPages{}
+	for class, page := range map[string]*ErrorPageConfig{
+		errorClassInvokeFailure: config.InvokeFailure,
+		errorClassThrottle:      config.Throttle,
+		errorClassTimeout:       config.Timeout,
+		errorClassBadResponse:   config.BadResponse,
+	} {
+		if page == nil {
+			continue
+		}
+
+		p, err := newErrorPage(page)
+		if err != nil {
+			return nil, fmt.Errorf("error pages: %s: %w", class, err)
+		}
+
+		pages[class] = p
+	}
+
+	return pages, nil
+}
+
+func newErrorPage(config *ErrorPageConfig) (*errorPage, error) {
+	p := &errorPage{body: config.Body, contentType: config.ContentType}
+	if p.contentType == "" {
+		p.contentType = defaultErrorPageContentType
+	}
+
+	switch {
+	case config.Body != "" && config.File != "":
+		return nil, fmt.Errorf("body and file are mutually exclusive")
+	case config.File != "":
+		body, err := os.ReadFile(config.File)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the page: %w", err)
+		}
+
+		p.body = string(body)
+	case config.Body == "":
+		return nil, fmt.Errorf("body or file is required")
+	}
+
+	return p, nil
+}
+
+// errorClass returns the class of the failure answered with the status code, or an empty string for
+// the failures without error pages, e.g. an open circuit. The categorized failures keep their class
+// whatever status code they are mapped to.
+func errorClass(statusCode int, err error) string {
+	if _, throttled := throttledResponse(err); throttled {
+		return errorClassThrottle
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || statusCode == http.StatusGatewayTimeout:
+		return errorClassTimeout
+	case errors.Is(err, errBadResponse):
+		return errorClassBadResponse
+	case statusCode == http.StatusBadGateway || errorCategory(err) != "":
+		return errorClassInvokeFailure
+	default:
+		return ""
+	}
+}
+
+// apply replaces the body of the error response with the page of its class, if any.
+func (p errorPages) apply(resp LambdaResponse, err error) (LambdaResponse, bool) {
+	page := p[errorClass(resp.StatusCode, err)]
+	if page == nil {
+		return resp, false
+	}
+
+	replacer := strings.NewReplacer(
+		statusCodePlaceholder, strconv.Itoa(resp.StatusCode),
+		statusTextPlaceholder, http.StatusText(resp.StatusCode),
+	)
+
+	return LambdaResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    replaceContentType(resp.Headers, page.contentType),
+		Body:       replacer.Replace(page.body),
+	}, true
+}
+
+// replaceContentType returns a copy of the headers of an error response whose body is replaced, with
+// the content type of the new body.
+func replaceContentType(headers map[string]string, contentType string) map[string]string {
+	replaced := make(map[string]string, len(headers)+1)
+	for name, value := range headers {
+		if !strings.EqualFold(name, "Content-Type") && !strings.EqualFold(name, "Content-Length") {
+			replaced[name] = value
+		}
+	}
+
+	replaced["Content-Type"] = contentType
+
+	return replaced
+}
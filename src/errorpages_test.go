@@ -0,0 +1,115 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorPages(t *testing.T) {
+	var failure string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch failure {
+		case "throttle":
+			res.Header().Set("Retry-After", "2")
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+		case "function":
+			res.Header().Set("X-Amz-Function-Error", "Unhandled")
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`{"errorMessage": "boom"}`))
+		case "response":
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`not json`))
+		case "timeout":
+			select {
+			case <-time.After(300 * time.Millisecond):
+			case <-req.Context().Done():
+			}
+		default:
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`{"statusCode": 200, "body": "ok"}`))
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	file := filepath.Join(t.TempDir(), "throttle.html")
+	if err := os.WriteFile(file, []byte("<h1>Slow down ({statusCode})</h1>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.InvokeTimeout = "50ms"
+	cfg.ErrorPages = &awslambdaplugin.ErrorPagesConfig{
+		InvokeFailure: &awslambdaplugin.ErrorPageConfig{Body: "<h1>{statusCode} {statusText}</h1>"},
+		Throttle:      &awslambdaplugin.ErrorPageConfig{File: file},
+		Timeout:       &awslambdaplugin.ErrorPageConfig{Body: `{"error":"timeout"}`, ContentType: "application/json"},
+		BadResponse:   &awslambdaplugin.ErrorPageConfig{Body: "bad response"},
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(f string) *httptest.ResponseRecorder {
+		failure = f
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := serve("")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+
+	recorder = serve("function")
+	assert.Equal(t, 502, recorder.Code)
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "<h1>502 Bad Gateway</h1>", recorder.Body.String())
+
+	recorder = serve("throttle")
+	assert.Equal(t, 503, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, "<h1>Slow down (503)</h1>", recorder.Body.String())
+
+	recorder = serve("response")
+	assert.Equal(t, 502, recorder.Code)
+	assert.Equal(t, "bad response", recorder.Body.String())
+
+	recorder = serve("timeout")
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `{"error":"timeout"}`, recorder.Body.String())
+
+	cfg.ErrorPages = &awslambdaplugin.ErrorPagesConfig{
+		Timeout: &awslambdaplugin.ErrorPageConfig{Body: "timeout", File: file},
+	}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "error pages: timeout: body and file are mutually exclusive")
+
+	cfg.ErrorPages = &awslambdaplugin.ErrorPagesConfig{Timeout: &awslambdaplugin.ErrorPageConfig{}}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "error pages: timeout: body or file is required")
+}
@@ -0,0 +1,105 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	errorCategoryResourceNotFound = "ResourceNotFound"
+	errorCategoryAccessDenied     = "AccessDenied"
+	errorCategoryUnhandled        = "Unhandled"
+	errorCategoryHandled          = "Handled"
+	errorCategoryThrottled        = "Throttled"
+	errorCategoryTimeout          = "Timeout"
+)
+
+// functionFailedError reports an invocation whose function failed, with FunctionError Handled or
+// Unhandled.
+type functionFailedError struct {
+	functionError string
+	requestID     string
+}
+
+func (e *functionFailedError) Error() string {
+	return "function error: " + e.functionError
+}
+
+// errorStatusCodes maps the categories of failed invocations to the status codes of their responses.
+type errorStatusCodes map[string]int
+
+func newErrorStatusCodes(config map[string]int) (errorStatusCodes, error) {
+	if len(config) == 0 {
+		return nil, nil
+	}
+
+	codes := errorStatusCodes{}
+	for category, statusCode := range config {
+		switch category {
+		case errorCategoryResourceNotFound, errorCategoryAccessDenied, errorCategoryUnhandled,
+			errorCategoryHandled, errorCategoryThrottled, errorCategoryTimeout:
+		default:
+			return nil, fmt.Errorf("error status codes: unsupported category %q", category)
+		}
+
+		if statusCode < 400 || statusCode > 599 {
+			return nil, fmt.Errorf("error status codes: %s: status code must be between 400 and 599", category)
+		}
+
+		codes[category] = statusCode
+	}
+
+	return codes, nil
+}
+
+// errorCategory returns the category of a failed invocation, or an empty string when it has none.
+func errorCategory(err error) string {
+	var failed *functionFailedError
+	if errors.As(err, &failed) {
+		if strings.HasPrefix(failed.functionError, errorCategoryHandled) {
+			return errorCategoryHandled
+		}
+
+		return errorCategoryUnhandled
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorCategoryTimeout
+	}
+
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+
+	switch {
+	case apiErr.StatusCode == http.StatusTooManyRequests:
+		return errorCategoryThrottled
+	case apiErr.Code == "ResourceNotFoundException":
+		return errorCategoryResourceNotFound
+	case apiErr.StatusCode == http.StatusForbidden || strings.HasPrefix(apiErr.Code, "AccessDenied"):
+		return errorCategoryAccessDenied
+	default:
+		return ""
+	}
+}
+
+// apply sets the status code configured for the category of the failure to its response. Bodies
+// made of the status text follow the new status.
+func (c errorStatusCodes) apply(resp LambdaResponse, err error) LambdaResponse {
+	statusCode, ok := c[errorCategory(err)]
+	if !ok || statusCode == resp.StatusCode {
+		return resp
+	}
+
+	if text := http.StatusText(resp.StatusCode); strings.HasPrefix(resp.Body, text) && !resp.IsBase64Encoded {
+		resp.Body = http.StatusText(statusCode) + strings.TrimPrefix(resp.Body, text)
+	}
+
+	resp.StatusCode = statusCode
+
+	return resp
+}
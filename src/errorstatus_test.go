@@ -0,0 +1,101 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatusCodes(t *testing.T) {
+	var failure string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch failure {
+		case "notFound":
+			res.Header().Set("X-Amzn-ErrorType", "ResourceNotFoundException")
+			res.WriteHeader(404)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Function not found"}`))
+		case "accessDenied":
+			res.Header().Set("X-Amzn-ErrorType", "AccessDeniedException")
+			res.WriteHeader(403)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Not authorized"}`))
+		case "throttle":
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+		case "unhandled", "handled":
+			res.Header().Set("X-Amz-Function-Error", map[string]string{"unhandled": "Unhandled", "handled": "Handled"}[failure])
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`{"errorMessage": "boom"}`))
+		case "timeout":
+			select {
+			case <-time.After(300 * time.Millisecond):
+			case <-req.Context().Done():
+			}
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.InvokeTimeout = "50ms"
+	cfg.ErrorStatusCodes = map[string]int{
+		"ResourceNotFound": 404,
+		"AccessDenied":     500,
+		"Unhandled":        500,
+		"Throttled":        429,
+		"Timeout":          504,
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(f string) *httptest.ResponseRecorder {
+		failure = f
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	assert.Equal(t, 404, serve("notFound").Code)
+	assert.Equal(t, 500, serve("accessDenied").Code)
+
+	recorder := serve("unhandled")
+	assert.Equal(t, 500, recorder.Code)
+	assert.Equal(t, "Internal Server Error", recorder.Body.String())
+
+	assert.Equal(t, 502, serve("handled").Code)
+
+	recorder = serve("throttle")
+	assert.Equal(t, 429, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+
+	assert.Equal(t, 504, serve("timeout").Code)
+
+	cfg.ErrorStatusCodes = map[string]int{"Unknown": 500}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `error status codes: unsupported category "Unknown"`)
+
+	cfg.ErrorStatusCodes = map[string]int{"Timeout": 200}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "error status codes: Timeout: status code must be between 400 and 599")
+}
@@ -0,0 +1,86 @@
+package awslambdaplugin
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// notModifiedHeaders are the headers of a response kept in its 304 Not Modified answer.
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Vary"}
+
+// withETag returns the response with a strong ETag computed over its decoded body, unless it is not
+// a 200 or the function set one.
+func (a *AwsLambdaPlugin) withETag(resp LambdaResponse) LambdaResponse {
+	if status, err := a.statusCode(resp.StatusCode); err != nil || status != http.StatusOK || hasHeader(resp.Headers, "ETag") {
+		return resp
+	}
+
+	if _, ok := resp.MultiValueHeaders[http.CanonicalHeaderKey("ETag")]; ok {
+		return resp
+	}
+
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		// An invalid body is rejected when written, or forwarded as is with lenient base64.
+		if decoded, err := base64.StdEncoding.DecodeString(resp.Body); err == nil {
+			body = decoded
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	headers := make(map[string]string, len(resp.Headers)+1)
+	for name, value := range resp.Headers {
+		headers[name] = value
+	}
+
+	headers["ETag"] = `"` + hex.EncodeToString(sum[:16]) + `"`
+	resp.Headers = headers
+
+	return resp
+}
+
+// writeConditional writes the response of the function, with its ETag when enabled, or a 304 Not
+// Modified without the body when the ETag matches the If-None-Match header of the GET or HEAD request.
+func (a *AwsLambdaPlugin) writeConditional(rw http.ResponseWriter, req *http.Request, resp LambdaResponse) {
+	if !a.etag {
+		a.writeResponse(rw, resp)
+		return
+	}
+
+	resp = a.withETag(resp)
+
+	header := responseHeader(resp)
+	etag := header.Get("ETag")
+	if status, err := a.statusCode(resp.StatusCode); err != nil || status != http.StatusOK || etag == "" ||
+		(req.Method != http.MethodGet && req.Method != http.MethodHead) || !etagMatches(req.Header.Values("If-None-Match"), etag) {
+		a.writeResponse(rw, resp)
+		return
+	}
+
+	notModified := LambdaResponse{StatusCode: http.StatusNotModified, Headers: map[string]string{}}
+	for _, name := range notModifiedHeaders {
+		if value := header.Get(name); value != "" {
+			notModified.Headers[name] = value
+		}
+	}
+
+	a.writeResponse(rw, notModified)
+}
+
+// etagMatches reports whether the If-None-Match values list the ETag, with the weak comparison.
+func etagMatches(ifNoneMatch []string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, value := range ifNoneMatch {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	var invocations int32
+	response := `{"statusCode": 200, "headers": {"Cache-Control": "max-age=60", "Content-Type": "text/plain"}, "body": "aGVsbG8=", "isBase64Encoded": true}`
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&invocations, 1)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(response))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.ETag = true
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "hello", recorder.Body.String())
+
+	// The first 16 bytes of the SHA-256 of "hello".
+	etag := `"2cf24dba5fb0a30e26e83b2ac5b9e29e"`
+	assert.Equal(t, etag, recorder.Header().Get("ETag"))
+
+	for _, ifNoneMatch := range []string{etag, `"other", W/` + etag, "*"} {
+		recorder = serve(http.MethodGet, ifNoneMatch)
+		assert.Equal(t, 304, recorder.Code)
+		assert.Empty(t, recorder.Body.String())
+		assert.Equal(t, etag, recorder.Header().Get("ETag"))
+		assert.Equal(t, "max-age=60", recorder.Header().Get("Cache-Control"))
+		assert.Empty(t, recorder.Header().Get("Content-Type"))
+	}
+
+	assert.Equal(t, 200, serve(http.MethodGet, `"other"`).Code)
+	assert.Equal(t, 200, serve(http.MethodPost, etag).Code)
+
+	// The ETag of the function is kept.
+	response = `{"statusCode": 200, "headers": {"ETag": "W/\"v1\""}, "body": "hello"}`
+	assert.Equal(t, `W/"v1"`, serve(http.MethodGet, "").Header().Get("ETag"))
+	assert.Equal(t, 304, serve(http.MethodGet, `"v1"`).Code)
+
+	response = `{"statusCode": 404, "body": "not found"}`
+	recorder = serve(http.MethodGet, "*")
+	assert.Equal(t, 404, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("ETag"))
+
+	// The cached responses are revalidated without invoking the function.
+	response = `{"statusCode": 200, "headers": {"Cache-Control": "max-age=60"}, "body": "hello"}`
+	cfg.Cache = &awslambdaplugin.CacheConfig{}
+	handler, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&invocations, 0)
+	assert.Regexp(t, regexp.MustCompile(`^"[0-9a-f]{32}"$`), serve(http.MethodGet, "").Header().Get("ETag"))
+	recorder = serve(http.MethodGet, etag)
+	assert.Equal(t, 304, recorder.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&invocations))
+}
@@ -0,0 +1,146 @@
+package awslambdaplugin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	invocationTypeEvent = "Event"
+
+	requestIDPlaceholder = "{requestId}"
+)
+
+// EventResponseConfig the response returned right away to the callers of an asynchronously
+// invoked function. {requestId} placeholders in the body are replaced with the invocation request ID.
+type EventResponseConfig struct {
+	// StatusCode of the response (default 202).
+	StatusCode int `json:"statusCode,omitempty"`
+	// Body of the response (default {"requestId":"{requestId}"}).
+	Body string `json:"body,omitempty"`
+	// Headers of the response. Content-Type defaults to application/json when the body is not set.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// eventResponse builds the responses of the Event invocations.
+type eventResponse struct {
+	statusCode int
+	body       string
+	headers    map[string]string
+}
+
+// invocationTypes maps the request methods to their invocation type.
+type invocationTypes struct {
+	defaultType string
+	methods     map[string]string
+}
+
+func newInvocationTypes(config *Config) (invocationTypes, error) {
+	t := invocationTypes{defaultType: invocationTypeRequestResponse, methods: map[string]string{}}
+	switch config.InvocationType {
+	case "", invocationTypeRequestResponse:
+	case invocationTypeEvent:
+		if config.ResponseStreaming {
+			return t, fmt.Errorf("response streaming requires the %s invocation type", invocationTypeRequestResponse)
+		}
+
+		t.defaultType = invocationTypeEvent
+	default:
+		return t, fmt.Errorf("unsupported invocation type %q", config.InvocationType)
+	}
+
+	for method, invocationType := range config.MethodInvocationTypes {
+		switch invocationType {
+		case invocationTypeRequestResponse, invocationTypeEvent:
+		default:
+			return t, fmt.Errorf("unsupported invocation type %q for method %s", invocationType, method)
+		}
+
+		t.methods[strings.ToUpper(method)] = invocationType
+	}
+
+	return t, nil
+}
+
+// get returns the invocation type of the requests with the method.
+func (t invocationTypes) get(method string) string {
+	if invocationType, ok := t.methods[method]; ok {
+		return invocationType
+	}
+
+	return t.defaultType
+}
+
+// async reports whether any request is invoked asynchronously.
+func (t invocationTypes) async() bool {
+	if t.defaultType == invocationTypeEvent {
+		return true
+	}
+
+	for _, invocationType := range t.methods {
+		if invocationType == invocationTypeEvent {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newEventResponse returns the response of the Event invocations; nil when there are none.
+func newEventResponse(config *Config, types invocationTypes) (*eventResponse, error) {
+	if !types.async() {
+		return nil, nil
+	}
+
+	r := &eventResponse{statusCode: http.StatusAccepted, headers: map[string]string{}}
+	if c := config.EventResponse; c != nil {
+		if c.StatusCode != 0 {
+			if c.StatusCode < 200 || c.StatusCode > 599 {
+				return nil, fmt.Errorf("invalid event response status code %d", c.StatusCode)
+			}
+
+			r.statusCode = c.StatusCode
+		}
+
+		r.body = c.Body
+		for name, value := range c.Headers {
+			r.headers[name] = value
+		}
+	}
+
+	if r.body == "" {
+		r.body = `{"requestId":"` + requestIDPlaceholder + `"}`
+		if !hasHeader(r.headers, "Content-Type") {
+			r.headers["Content-Type"] = "application/json"
+		}
+	}
+
+	return r, nil
+}
+
+// response returns the response of an accepted invocation.
+func (r *eventResponse) response(requestID string) LambdaResponse {
+	headers := make(map[string]string, len(r.headers)+1)
+	for name, value := range r.headers {
+		headers[name] = value
+	}
+
+	headers["X-Amzn-Requestid"] = requestID
+
+	return LambdaResponse{
+		StatusCode: r.statusCode,
+		Headers:    headers,
+		Body:       strings.ReplaceAll(r.body, requestIDPlaceholder, requestID),
+	}
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,147 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventInvocation(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "Event", req.Header.Get("X-Amz-Invocation-Type"))
+
+		res.Header().Set("X-Amzn-Requestid", "5a3b1c2d-0000-4000-8000-000000000000")
+		res.WriteHeader(202)
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		desc        string
+		response    *awslambdaplugin.EventResponseConfig
+		status      int
+		body        string
+		contentType string
+	}{
+		{
+			desc:        "default response",
+			status:      202,
+			body:        `{"requestId":"5a3b1c2d-0000-4000-8000-000000000000"}`,
+			contentType: "application/json",
+		},
+		{
+			desc: "custom response",
+			response: &awslambdaplugin.EventResponseConfig{
+				StatusCode: 200,
+				Body:       "queued as {requestId}",
+				Headers:    map[string]string{"Content-Type": "text/plain"},
+			},
+			status:      200,
+			body:        "queued as 5a3b1c2d-0000-4000-8000-000000000000",
+			contentType: "text/plain",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.InvocationType = "Event"
+			cfg.EventResponse = test.response
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/hook", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.body, recorder.Body.String())
+			assert.Equal(t, test.contentType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, "5a3b1c2d-0000-4000-8000-000000000000", recorder.Header().Get("X-Amzn-Requestid"))
+		})
+	}
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.InvocationType = "DryRun"
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	_, err := awslambdaplugin.New(context.Background(), next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported invocation type "DryRun"`)
+}
+
+func TestMethodInvocationTypes(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Amz-Invocation-Type") == "Event" {
+			res.Header().Set("X-Amzn-Requestid", "5a3b1c2d-0000-4000-8000-000000000000")
+			res.WriteHeader(202)
+			return
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200, \"body\": \"sync\"}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.MethodInvocationTypes = map[string]string{"post": "Event"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		method string
+		status int
+		body   string
+	}{
+		{method: http.MethodGet, status: 200, body: "sync"},
+		{method: http.MethodPost, status: 202, body: `{"requestId":"5a3b1c2d-0000-4000-8000-000000000000"}`},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.method, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, test.method, "http://localhost/hook", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.body, recorder.Body.String())
+		})
+	}
+
+	cfg.MethodInvocationTypes = map[string]string{"POST": "DryRun"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported invocation type "DryRun" for method POST`)
+}
@@ -0,0 +1,108 @@
+package awslambdaplugin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// eventStreamMaxMessage bounds the messages of an event stream (application/vnd.amazon.eventstream).
+const eventStreamMaxMessage = 16 << 20
+
+var errEventStreamCorrupted = errors.New("event stream: corrupted message")
+
+// eventStreamMessage a message of an event stream. Only the string headers are kept.
+type eventStreamMessage struct {
+	headers map[string]string
+	payload []byte
+}
+
+// readEventStreamMessage decodes the next message: a prelude with the total and headers lengths
+// and its CRC, the headers, the payload and the CRC of the whole message.
+func readEventStreamMessage(r io.Reader) (*eventStreamMessage, error) {
+	prelude := make([]byte, 12)
+	if _, err := io.ReadFull(r, prelude); err != nil {
+		return nil, err
+	}
+
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, errEventStreamCorrupted
+	}
+
+	if total > eventStreamMaxMessage || total < 16 || headersLen > total-16 {
+		return nil, errEventStreamCorrupted
+	}
+
+	msg := make([]byte, total)
+	copy(msg, prelude)
+	if _, err := io.ReadFull(r, msg[12:]); err != nil {
+		return nil, fmt.Errorf("event stream: %w", noEOF(err))
+	}
+
+	if crc32.ChecksumIEEE(msg[:total-4]) != binary.BigEndian.Uint32(msg[total-4:]) {
+		return nil, errEventStreamCorrupted
+	}
+
+	headers, err := decodeEventStreamHeaders(msg[12 : 12+headersLen])
+	if err != nil {
+		return nil, err
+	}
+
+	return &eventStreamMessage{headers: headers, payload: msg[12+headersLen : total-4]}, nil
+}
+
+// eventStreamValueSizes of the fixed size header value types, indexed by type.
+var eventStreamValueSizes = map[byte]int{0: 0, 1: 0, 2: 1, 3: 2, 4: 4, 5: 8, 8: 8, 9: 16}
+
+func decodeEventStreamHeaders(b []byte) (map[string]string, error) {
+	headers := map[string]string{}
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 1+nameLen+1 {
+			return nil, errEventStreamCorrupted
+		}
+
+		name := string(b[1 : 1+nameLen])
+		valueType := b[1+nameLen]
+		b = b[2+nameLen:]
+
+		switch valueType {
+		case 6, 7:
+			if len(b) < 2 {
+				return nil, errEventStreamCorrupted
+			}
+
+			valueLen := int(binary.BigEndian.Uint16(b))
+			if len(b) < 2+valueLen {
+				return nil, errEventStreamCorrupted
+			}
+
+			if valueType == 7 {
+				headers[name] = string(b[2 : 2+valueLen])
+			}
+
+			b = b[2+valueLen:]
+		default:
+			size, ok := eventStreamValueSizes[valueType]
+			if !ok || len(b) < size {
+				return nil, errEventStreamCorrupted
+			}
+
+			b = b[size:]
+		}
+	}
+
+	return headers, nil
+}
+
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
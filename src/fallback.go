@@ -0,0 +1,47 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+func newFallbackFunction(functionArn, region string) (string, error) {
+	if functionArn == "" {
+		return "", nil
+	}
+
+	fn, err := parseFunctionArn(functionArn)
+	if err != nil {
+		return "", fmt.Errorf("invalid fallback function arn: %w", err)
+	}
+
+	if _, err := functionRegion(region, fn); err != nil {
+		return "", fmt.Errorf("invalid fallback function arn: %w", err)
+	}
+
+	return functionArn, nil
+}
+
+// invokeFallback invokes the fallback function in place of the failed primary one. The fallback has
+// an invoke timeout of its own, so that it still runs when the primary invocation timed out.
+func (a *AwsLambdaPlugin) invokeFallback(req *http.Request, in *invokeInput, cause error) (LambdaResponse, error) {
+	a.logger.warnf("invoking the fallback function: %s", cause)
+
+	ctx, cancel := context.WithTimeout(req.Context(), a.invokeTimeout)
+	defer cancel()
+
+	fallback := *in
+	fallback.FunctionName = a.fallback
+	fallback.Qualifier = ""
+
+	result, err := a.invoke(ctx, &fallback)
+
+	return a.invocationResponse(&fallback, result, err)
+}
+
+// shouldFallback reports whether the failed invocation of the request is handed to the fallback
+// function; it is not when the client is gone.
+func (a *AwsLambdaPlugin) shouldFallback(req *http.Request) bool {
+	return a.fallback != "" && req.Context().Err() == nil
+}
@@ -0,0 +1,83 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackFunction(t *testing.T) {
+	var failure string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "/standby/") {
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte("{\"statusCode\": 200, \"body\": \"standby\"}"))
+			return
+		}
+
+		switch failure {
+		case "throttle":
+			res.Header().Set("X-Amzn-Errortype", "TooManyRequestsException")
+			res.WriteHeader(429)
+			return
+		case "function error":
+			res.Header().Set("X-Amz-Function-Error", "Unhandled")
+		case "timeout":
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200, \"body\": \"primary\"}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.FallbackFunctionArn = "standby"
+	cfg.InvokeTimeout = "20ms"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		failure  string
+		expected string
+	}{
+		{expected: "primary"},
+		{failure: "throttle", expected: "standby"},
+		{failure: "function error", expected: "standby"},
+		{failure: "timeout", expected: "standby"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.failure, func(t *testing.T) {
+			failure = test.failure
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, 200, recorder.Code)
+			assert.Equal(t, test.expected, recorder.Body.String())
+		})
+	}
+}
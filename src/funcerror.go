@@ -0,0 +1,129 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	functionErrorLogLimit     = 4096
+	functionErrorMessageLimit = 256
+
+	// badResponseLogLimit bounds the logged start of the invalid responses that are not JSON, whose
+	// content cannot be redacted.
+	badResponseLogLimit = 64
+)
+
+// functionErrorPayload the payload returned by the runtimes for failed invocations.
+type functionErrorPayload struct {
+	ErrorType    string `json:"errorType"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// functionError returns the error of an invocation whose function failed.
+func functionError(result *invokeOutput) error {
+	return &functionFailedError{functionError: result.FunctionError, requestID: result.RequestID}
+}
+
+// functionErrorResponse logs the error payload of an invocation whose function failed, handled
+// or unhandled, and returns a 502 response. The error type and message are included in the body
+// only when details are enabled, stripped of control characters and truncated.
+func (a *AwsLambdaPlugin) functionErrorResponse(result *invokeOutput) LambdaResponse {
+	payload := string(result.Payload)
+	if len(payload) > functionErrorLogLimit {
+		payload = payload[:functionErrorLogLimit] + "..."
+	}
+
+	a.logger.warnf("function error (%s) [request id: %s]: %s", result.FunctionError, result.RequestID, payload)
+
+	body := http.StatusText(http.StatusBadGateway)
+	if a.functionErrorDetails {
+		var e functionErrorPayload
+		if err := json.Unmarshal(result.Payload, &e); err == nil && (e.ErrorType != "" || e.ErrorMessage != "") {
+			details := e.ErrorType
+			if e.ErrorMessage != "" {
+				details = strings.TrimPrefix(details+": "+e.ErrorMessage, ": ")
+			}
+
+			body += ": " + sanitizeErrorMessage(details)
+		}
+	}
+
+	return LambdaResponse{
+		StatusCode: http.StatusBadGateway,
+		Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+		Body:       body,
+	}
+}
+
+// sanitizeErrorMessage makes an error message safe to return to the clients.
+func sanitizeErrorMessage(msg string) string {
+	msg = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+
+		return r
+	}, msg)
+
+	if runes := []rune(msg); len(runes) > functionErrorMessageLimit {
+		msg = string(runes[:functionErrorMessageLimit]) + "..."
+	}
+
+	return strings.TrimSpace(msg)
+}
+
+// logBadResponse logs the payload of an invocation whose response cannot be decoded, redacted.
+func (a *AwsLambdaPlugin) logBadResponse(requestID string, payload []byte) {
+	a.logger.errorf("invalid function response [request id: %s]: %s", requestID, redactPayload(payload))
+}
+
+// redactPayload returns the payload of an invalid response in a form safe to log: the string values
+// of the JSON payloads are replaced with their length, keeping the shape of the envelope, and only the
+// start of the other ones is kept. The result is truncated.
+func redactPayload(payload []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		if len(payload) > badResponseLogLimit {
+			return strconv.Quote(string(payload[:badResponseLogLimit])) + "..."
+		}
+
+		return strconv.Quote(string(payload))
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(redactValue(v))
+
+	redacted := strings.TrimSuffix(buf.String(), "\n")
+	if len(redacted) > functionErrorLogLimit {
+		return redacted[:functionErrorLogLimit] + "..."
+	}
+
+	return redacted
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return "<redacted " + strconv.Itoa(len(v)) + " bytes>"
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = redactValue(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,124 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFunctionError(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amz-Function-Error", "Unhandled")
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"errorType": "TypeError", "errorMessage": "cannot read\nproperty 'id'", "stackTrace": ["at handler (index.js:3)"]}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		desc    string
+		details bool
+		body    string
+	}{
+		{desc: "without details", body: "Bad Gateway"},
+		{desc: "with details", details: true, body: "Bad Gateway: TypeError: cannot read property 'id'"},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.FunctionErrorDetails = test.details
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, 502, recorder.Code)
+			assert.Equal(t, test.body, recorder.Body.String())
+			assert.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestMalformedResponse(t *testing.T) {
+	var payload string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(payload))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		payload string
+		logged  string
+	}{
+		{
+			payload: `{"statusCode": "200", "body": "secret-token"}`,
+			logged:  `invalid function response [request id: req-1]: {"body":"<redacted 12 bytes>","statusCode":"<redacted 3 bytes>"}`,
+		},
+		{payload: `null`, logged: `invalid function response [request id: req-1]: null`},
+		{payload: `["ok"]`, logged: `invalid function response [request id: req-1]: ["<redacted 2 bytes>"]`},
+		{payload: `<html>` + strings.Repeat("x", 100), logged: `"<html>` + strings.Repeat("x", 58) + `"...`},
+	}
+
+	for _, test := range tests {
+		payload = test.payload
+		buf.Reset()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, 502, recorder.Code, test.payload)
+		assert.Contains(t, buf.String(), test.logged)
+		assert.NotContains(t, buf.String(), "secret-token")
+	}
+}
@@ -0,0 +1,291 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	functionURLAuthIAM  = "AWS_IAM"
+	functionURLAuthNone = "NONE"
+
+	// functionURLErrorBodyLimit bounds the error bodies read to report the service errors.
+	functionURLErrorBodyLimit = 64 * 1024
+)
+
+// hopHeaders are meaningful for a single connection and never forwarded.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// functionURLBackend forwards the requests to a Lambda function URL.
+type functionURLBackend struct {
+	url         *url.URL
+	region      string
+	iam         bool
+	credentials credentialsProvider
+	httpClient  *http.Client
+}
+
+func newFunctionURLBackend(config *Config, region string, creds credentialsProvider, httpClient *http.Client) (*functionURLBackend, error) {
+	u, err := url.Parse(config.FunctionURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid function url: %w", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("invalid function url %q: scheme and host are required, query is not allowed", config.FunctionURL)
+	}
+
+	// The redirects returned by the function are for the client to follow.
+	client := *httpClient
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	b := &functionURLBackend{url: u, region: region, credentials: creds, httpClient: &client}
+	switch config.FunctionURLAuthType {
+	case "", functionURLAuthIAM:
+		b.iam = true
+	case functionURLAuthNone:
+	default:
+		return nil, fmt.Errorf("unsupported function url auth type %q", config.FunctionURLAuthType)
+	}
+
+	if urlRegion := functionURLRegion(config.FunctionURL); urlRegion != "" {
+		b.region = urlRegion
+	}
+
+	return b, nil
+}
+
+// functionURLRegion returns the region of a <url-id>.lambda-url.<region>.on.aws function URL.
+func functionURLRegion(functionURL string) string {
+	u, err := url.Parse(functionURL)
+	if err != nil {
+		return ""
+	}
+
+	if labels := strings.Split(u.Hostname(), "."); len(labels) == 5 && labels[1] == "lambda-url" {
+		return labels[2]
+	}
+
+	return ""
+}
+
+// checkFunctionURLOptions rejects the options unsupported by the function URL backend.
+func checkFunctionURLOptions(config *Config) error {
+	if err := checkInvokeOptions(config, "functionUrl"); err != nil {
+		return err
+	}
+
+	if config.Publish != nil {
+		return fmt.Errorf("publish is not supported with functionUrl")
+	}
+
+	// The streamed body cannot be passed to the next handler anymore.
+	if config.OnError == onErrorContinue {
+		return fmt.Errorf("onError continue is not supported with functionUrl")
+	}
+
+	return nil
+}
+
+// checkInvokeOptions rejects the options relying on the Invoke API, unsupported by the backend option.
+func checkInvokeOptions(config *Config, backend string) error {
+	options := []struct {
+		name string
+		set  bool
+	}{
+		{"invocationType", config.InvocationType != "" && config.InvocationType != invocationTypeRequestResponse},
+		{"methodInvocationTypes", len(config.MethodInvocationTypes) > 0},
+		{"responseStreaming", config.ResponseStreaming},
+		{"eventEncoding", config.EventEncoding != "" && config.EventEncoding != encodingJSON},
+		{"clientContext", config.ClientContext != nil},
+		{"logTail", config.LogTail != nil},
+		{"hedging", config.Hedging != nil},
+		{"coalescing", config.Coalescing != nil},
+		{"canary", config.Canary != nil},
+		{"latencyRouting", config.LatencyRouting != nil},
+		{"functionOverride", config.FunctionOverride != nil},
+		{"fallbackFunctionArn", config.FallbackFunctionArn != ""},
+		{"s3Offload", config.S3Offload != nil},
+		{"mirror", config.Mirror != nil},
+	}
+
+	for _, option := range options {
+		if option.set {
+			return fmt.Errorf("%s is not supported with %s", option.name, backend)
+		}
+	}
+
+	if config.FunctionArn == "" && (config.HealthCheck != nil || config.Warmer != nil) {
+		return fmt.Errorf("healthCheck and warmer require functionArn")
+	}
+
+	return nil
+}
+
+// forward sends the request to the function URL and streams the response back. The body is streamed
+// too, without buffering, honoring Expect: 100-continue: with the AWS_IAM auth type the signature
+// leaves the payload unsigned. It returns the error of a request the function URL failed to answer,
+// or answered with a service error, without writing a response.
+func (b *functionURLBackend) forward(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	out, err := b.newRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.httpClient.Do(out)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.Header.Get("X-Amzn-Errortype") != "" {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, functionURLErrorBodyLimit))
+		return newRESTError(resp, errBody)
+	}
+
+	removeHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		rw.Header()[name] = values
+	}
+
+	rw.WriteHeader(resp.StatusCode)
+	copyResponseBody(rw, resp.Body)
+
+	return nil
+}
+
+// newRequest builds the request to the function URL, streaming the body of the client request.
+func (b *functionURLBackend) newRequest(ctx context.Context, req *http.Request) (*http.Request, error) {
+	target := *b.url
+	target.Path = strings.TrimSuffix(b.url.Path, "/") + req.URL.Path
+	target.RawPath = strings.TrimSuffix(b.url.EscapedPath(), "/") + req.URL.EscapedPath()
+	target.RawQuery = req.URL.RawQuery
+
+	out, err := http.NewRequestWithContext(ctx, req.Method, target.String(), req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// A zero length with a body means an unknown length, the transport probes the body.
+	out.ContentLength = req.ContentLength
+	if req.Body == nil || req.Body == http.NoBody {
+		out.Body = http.NoBody
+	}
+
+	if b.iam {
+		if err := b.sign(ctx, out, req); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, values := range req.Header {
+		if _, signed := out.Header[name]; signed || (b.iam && name == "Authorization") {
+			continue
+		}
+
+		out.Header[name] = values
+	}
+
+	removeHopHeaders(out.Header)
+
+	return out, nil
+}
+
+// copyResponseBody streams the response body to the client, flushing every read.
+func copyResponseBody(rw http.ResponseWriter, body io.Reader) {
+	flusher, _ := rw.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, err := rw.Write(buf[:n]); err != nil {
+				// The client went away.
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		if err == io.EOF {
+			return
+		}
+
+		if err != nil {
+			// The status is already sent: abort the response so the client sees it is incomplete.
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// sign adds the SigV4 signature of the AWS_IAM auth type, with an unsigned payload not to buffer the
+// body. The client headers are added unsigned, as proxies may alter them.
+func (b *functionURLBackend) sign(ctx context.Context, out, req *http.Request) error {
+	out.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		out.Header.Set("Content-Type", contentType)
+	}
+
+	creds, err := b.credentials.retrieve(ctx)
+	if err != nil {
+		return err
+	}
+
+	signV4(out, unsignedPayload, creds, b.region, "lambda", time.Now())
+
+	return nil
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, name := range strings.Split(header.Get("Connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			header.Del(name)
+		}
+	}
+
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// serveFunctionURL forwards the request to the function URL, accounting the outcome in the circuit breaker.
+func (a *AwsLambdaPlugin) serveFunctionURL(ctx context.Context, rw http.ResponseWriter, req *http.Request) {
+	if a.breaker != nil && !a.breaker.allow(time.Now()) {
+		a.respond(rw, req, a.breaker.response(), errCircuitOpen)
+		return
+	}
+
+	record := invocationRecordOf(rw)
+	record.setTarget(a.functionURL.url.String())
+	if record != nil && req.ContentLength > 0 {
+		record.requestBytes = int(req.ContentLength)
+	}
+
+	start := time.Now()
+	err := a.functionURL.forward(ctx, rw, req)
+	if a.breaker != nil {
+		if canceledByClient(req, err) {
+			a.breaker.release()
+		} else {
+			a.breaker.record(err != nil, time.Since(start), time.Now())
+		}
+	}
+
+	if a.limiter != nil {
+		a.limiter.record(start, err)
+	}
+
+	if err != nil {
+		resp, _ := throttledResponse(err)
+		a.respond(rw, req, resp, err)
+	}
+}
@@ -0,0 +1,246 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFunctionURL(t *testing.T) {
+	var received *http.Request
+	var receivedBody string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		received, receivedBody = req, string(body)
+
+		switch req.URL.Path {
+		case "/prefix/throttled":
+			res.Header().Set("X-Amzn-Errortype", "TooManyRequestsException")
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Message":"Rate Exceeded."}`))
+		case "/prefix/redirect":
+			http.Redirect(res, req, "/prefix/elsewhere", http.StatusFound)
+		default:
+			res.Header().Set("Content-Type", "text/plain")
+			res.WriteHeader(201)
+			_, _ = res.Write([]byte("created"))
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		desc     string
+		authType string
+	}{
+		{desc: "iam"},
+		{desc: "none", authType: "NONE"},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionURL = mockserver.URL + "/prefix/"
+			cfg.FunctionURLAuthType = test.authType
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			serve := func(path, body string) *httptest.ResponseRecorder {
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost"+path, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer client-token")
+				req.Header.Set("X-Custom", "value")
+				req.Header.Set("Connection", "X-Hop")
+				req.Header.Set("X-Hop", "dropped")
+
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, req)
+
+				return recorder
+			}
+
+			recorder := serve("/items?a=1&b=2", `{"name":"item"}`)
+			assert.Equal(t, 201, recorder.Code)
+			assert.Equal(t, "created", recorder.Body.String())
+			assert.Equal(t, "text/plain", recorder.Header().Get("Content-Type"))
+
+			assert.Equal(t, "/prefix/items", received.URL.Path)
+			assert.Equal(t, "a=1&b=2", received.URL.RawQuery)
+			assert.Equal(t, `{"name":"item"}`, receivedBody)
+			assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+			assert.Equal(t, "value", received.Header.Get("X-Custom"))
+			assert.Empty(t, received.Header.Get("X-Hop"))
+
+			if test.authType == "NONE" {
+				assert.Equal(t, "Bearer client-token", received.Header.Get("Authorization"))
+				assert.Empty(t, received.Header.Get("X-Amz-Date"))
+			} else {
+				assert.Equal(t, "UNSIGNED-PAYLOAD", received.Header.Get("X-Amz-Content-Sha256"))
+				assert.True(t, strings.HasPrefix(received.Header.Get("Authorization"),
+					"AWS4-HMAC-SHA256 Credential=aws-key/"), received.Header.Get("Authorization"))
+				assert.Contains(t, received.Header.Get("Authorization"), "/eu-west-1/lambda/aws4_request, "+
+					"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, ")
+			}
+
+			recorder = serve("/redirect", "")
+			assert.Equal(t, 302, recorder.Code)
+			assert.Equal(t, "/prefix/elsewhere", recorder.Header().Get("Location"))
+
+			recorder = serve("/throttled", "")
+			assert.Equal(t, 503, recorder.Code)
+			assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestFunctionURLConfig(t *testing.T) {
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionURL = "https://abcdefghijklmnopqrstuvwxyz012345.lambda-url.eu-west-1.on.aws/"
+	cfg.Hedging = &awslambdaplugin.HedgingConfig{Delay: "100ms"}
+
+	_, err := awslambdaplugin.New(context.Background(), http.NotFoundHandler(), cfg, "lambda-plugin")
+	assert.EqualError(t, err, "hedging is not supported with functionUrl")
+
+	cfg.Hedging = nil
+	cfg.OnError = "continue"
+	_, err = awslambdaplugin.New(context.Background(), http.NotFoundHandler(), cfg, "lambda-plugin")
+	assert.EqualError(t, err, "onError continue is not supported with functionUrl")
+
+	cfg.OnError = ""
+	cfg.FunctionURLAuthType = "IAM"
+	_, err = awslambdaplugin.New(context.Background(), http.NotFoundHandler(), cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported function url auth type "IAM"`)
+}
+
+func TestFunctionURLStreamingUpload(t *testing.T) {
+	received := make(chan string, 1)
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "UNSIGNED-PAYLOAD", req.Header.Get("X-Amz-Content-Sha256"))
+		assert.Equal(t, "100-continue", req.Header.Get("Expect"))
+
+		body, _ := io.ReadAll(req.Body)
+		received <- string(body)
+
+		res.WriteHeader(204)
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionURL = mockserver.URL
+
+	ctx := context.Background()
+	handler, err := awslambdaplugin.New(ctx, http.NotFoundHandler(), cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The body is still being written by the client while it is forwarded.
+	body, writer := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://localhost/upload", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Expect", "100-continue")
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			_, _ = writer.Write([]byte("chunk;"))
+		}
+		_ = writer.Close()
+	}()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, 204, recorder.Code)
+	assert.Equal(t, "chunk;chunk;chunk;", <-received)
+}
+
+func TestFunctionURLLargeUpload(t *testing.T) {
+	received := make(chan int64, 1)
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		n, _ := io.Copy(io.Discard, req.Body)
+		received <- n
+
+		res.WriteHeader(204)
+	}))
+	defer func() { mockserver.Close() }()
+
+	// Over the 6 MB payload limit of the synchronous invocations.
+	const size = 7 * 1024 * 1024
+
+	testCases := []struct {
+		desc          string
+		maxBodyBytes  int64
+		contentLength bool
+		expected      int
+	}{
+		{desc: "known length", contentLength: true, expected: 204},
+		{desc: "chunked", expected: 204},
+		{desc: "over max request body bytes", maxBodyBytes: 1024 * 1024, contentLength: true, expected: 413},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionURL = mockserver.URL
+			cfg.MaxRequestBodyBytes = test.maxBodyBytes
+
+			ctx := context.Background()
+			handler, err := awslambdaplugin.New(ctx, http.NotFoundHandler(), cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body io.Reader = bytes.NewReader(bytes.Repeat([]byte("x"), size))
+			if !test.contentLength {
+				body = io.MultiReader(body)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://localhost/upload", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.contentLength {
+				req.ContentLength = -1
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, test.expected, recorder.Code)
+			if recorder.Code == 204 {
+				assert.Equal(t, int64(size), <-received)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	invocationTypeDryRun = "DryRun"
+
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+)
+
+// HealthCheckConfig enables periodic DryRun invocations, which verify the function exists and
+// may be invoked with the current credentials without running it.
+type HealthCheckConfig struct {
+	// Interval between two checks (default 30s).
+	Interval string `json:"interval,omitempty"`
+	// Timeout of a check (default 5s).
+	Timeout string `json:"timeout,omitempty"`
+	// Header names a response header reporting the last check result: healthy or unhealthy.
+	Header string `json:"header,omitempty"`
+	// FailFast answers 503 without invoking the function while the last check failed.
+	FailFast bool `json:"failFast,omitempty"`
+}
+
+// healthChecker tracks the result of the DryRun invocations.
+type healthChecker struct {
+	logger   *logger
+	interval time.Duration
+	timeout  time.Duration
+	header   string
+	failFast bool
+	check    func(context.Context) error
+
+	mu        sync.Mutex
+	checked   bool
+	healthy   bool
+	lastError error
+}
+
+func newHealthChecker(logger *logger, config *HealthCheckConfig, check func(context.Context) error) (*healthChecker, error) {
+	interval, err := parseDurationDefault(config.Interval, defaultHealthCheckInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("health check: invalid interval %q", config.Interval)
+	}
+
+	timeout, err := parseDurationDefault(config.Timeout, defaultHealthCheckTimeout)
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("health check: invalid timeout %q", config.Timeout)
+	}
+
+	return &healthChecker{
+		logger:   logger,
+		interval: interval,
+		timeout:  timeout,
+		header:   http.CanonicalHeaderKey(config.Header),
+		failFast: config.FailFast,
+		check:    check,
+	}, nil
+}
+
+// run checks the function right away, then at every interval until the context is done.
+func (h *healthChecker) run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *healthChecker) probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	err := h.check(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case err != nil && (h.healthy || !h.checked):
+		h.logger.warnf("health check failed: %s", err)
+	case err == nil && !h.healthy && h.checked:
+		h.logger.infof("health check recovered")
+	}
+
+	h.checked = true
+	h.healthy = err == nil
+	h.lastError = err
+}
+
+// status returns whether the function is considered healthy; it is until the first check completes.
+func (h *healthChecker) status() (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.healthy || !h.checked, h.lastError
+}
+
+// intercept reports the health through the header and, with fail fast, answers 503 when unhealthy.
+// It returns true when the request has been answered.
+func (h *healthChecker) intercept(rw http.ResponseWriter) bool {
+	healthy, _ := h.status()
+	if h.header != "" {
+		value := "healthy"
+		if !healthy {
+			value = "unhealthy"
+		}
+
+		rw.Header().Set(h.header, value)
+	}
+
+	if healthy || !h.failFast {
+		return false
+	}
+
+	http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+	return true
+}
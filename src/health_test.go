@@ -0,0 +1,80 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var denied int32
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Amz-Invocation-Type") != "DryRun" {
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+			return
+		}
+
+		if atomic.LoadInt32(&denied) == 1 {
+			res.Header().Set("X-Amzn-Errortype", "AccessDeniedException")
+			res.WriteHeader(403)
+			return
+		}
+
+		res.WriteHeader(204)
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.HealthCheck = &awslambdaplugin.HealthCheckConfig{Interval: "10ms", Header: "X-Lambda-Health", FailFast: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := serve()
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "healthy", recorder.Header().Get("X-Lambda-Health"))
+
+	atomic.StoreInt32(&denied, 1)
+	assert.Eventually(t, func() bool {
+		recorder := serve()
+		return recorder.Code == 503 && recorder.Header().Get("X-Lambda-Health") == "unhealthy"
+	}, time.Second, 10*time.Millisecond)
+
+	atomic.StoreInt32(&denied, 0)
+	assert.Eventually(t, func() bool { return serve().Code == 200 }, time.Second, 10*time.Millisecond)
+
+	cfg.HealthCheck = &awslambdaplugin.HealthCheckConfig{Interval: "-1s"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `health check: invalid interval "-1s"`)
+}
@@ -0,0 +1,88 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HedgingConfig issues a second invocation of the idempotent requests still pending after Delay,
+// answering with whichever completes first, to cut the tail latency caused by cold starts.
+type HedgingConfig struct {
+	// Delay before the hedged invocation, e.g. the p95 latency of the function.
+	Delay string `json:"delay,omitempty"`
+	// Methods whose requests are hedged (default GET, HEAD and OPTIONS).
+	Methods []string `json:"methods,omitempty"`
+}
+
+// hedgingPolicy parsed HedgingConfig.
+type hedgingPolicy struct {
+	delay   time.Duration
+	methods map[string]bool
+}
+
+func newHedgingPolicy(config *HedgingConfig) (*hedgingPolicy, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	delay, err := parseDurationDefault(config.Delay, 0)
+	if err != nil || delay <= 0 {
+		return nil, fmt.Errorf("hedging: invalid delay %q", config.Delay)
+	}
+
+	methods := config.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+	}
+
+	p := &hedgingPolicy{delay: delay, methods: map[string]bool{}}
+	for _, m := range methods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+
+	return p, nil
+}
+
+type invokeResult struct {
+	output *invokeOutput
+	err    error
+}
+
+// hedgedInvoke invokes the function, hedging the invocation when the method allows it.
+// The first successful result wins and cancels the other invocation.
+func (a *AwsLambdaPlugin) hedgedInvoke(ctx context.Context, in *invokeInput, method string) (*invokeOutput, error) {
+	if a.hedging == nil || !a.hedging.methods[method] || in.InvocationType == invocationTypeEvent {
+		return a.invoke(ctx, in)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan invokeResult, 2)
+	launch := func() {
+		output, err := a.invoke(ctx, in)
+		results <- invokeResult{output, err}
+	}
+
+	go launch()
+
+	timer := time.NewTimer(a.hedging.delay)
+	defer timer.Stop()
+
+	pending := 1
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil || pending == 0 {
+				return r.output, r.err
+			}
+		case <-timer.C:
+			pending++
+			go launch()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedging(t *testing.T) {
+	var calls int32
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// Cold start.
+			select {
+			case <-time.After(300 * time.Millisecond):
+			case <-req.Context().Done():
+				return
+			}
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Hedging = &awslambdaplugin.HedgingConfig{Delay: "20ms"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method string) (int, time.Duration) {
+		req, err := http.NewRequestWithContext(ctx, method, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder.Code, time.Since(start)
+	}
+
+	status, elapsed := serve(http.MethodGet)
+	assert.Equal(t, 200, status)
+	assert.Less(t, int64(elapsed), int64(200*time.Millisecond))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Non idempotent methods are never hedged.
+	atomic.StoreInt32(&calls, 0)
+	status, elapsed = serve(http.MethodPost)
+	assert.Equal(t, 200, status)
+	assert.GreaterOrEqual(t, int64(elapsed), int64(300*time.Millisecond))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
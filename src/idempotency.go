@@ -0,0 +1,95 @@
+package awslambdaplugin
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+const defaultIdempotencyHeader = "Idempotency-Key"
+
+// IdempotencyKeyConfig gives every event a stable idempotency key, e.g. for the AWS Lambda Powertools
+// idempotency utility, taken from the request or generated when the client sends none. The key stays
+// the same across the retried and hedged invocations of a request.
+type IdempotencyKeyConfig struct {
+	// Header carrying the key in the event (default Idempotency-Key).
+	Header string `json:"header,omitempty"`
+	// SourceHeaders are the request headers whose first value found is propagated as the key
+	// (default Idempotency-Key and X-Request-Id). A random UUID is generated otherwise.
+	SourceHeaders []string `json:"sourceHeaders,omitempty"`
+	// ClientContextKey also passes the key in this key of the ClientContext custom map.
+	ClientContextKey string `json:"clientContextKey,omitempty"`
+}
+
+// idempotencyKey sets the idempotency key of the requests.
+type idempotencyKey struct {
+	header  string
+	sources []string
+}
+
+func newIdempotencyKey(config *IdempotencyKeyConfig) *idempotencyKey {
+	k := &idempotencyKey{header: http.CanonicalHeaderKey(config.Header), sources: config.SourceHeaders}
+	if k.header == "" {
+		k.header = defaultIdempotencyHeader
+	}
+	if len(k.sources) == 0 {
+		k.sources = []string{defaultIdempotencyHeader, "X-Request-Id"}
+	}
+
+	return k
+}
+
+// apply sets the key header of the request, so that it is sent in the event.
+func (k *idempotencyKey) apply(req *http.Request) error {
+	for _, source := range k.sources {
+		if value := req.Header.Get(source); value != "" {
+			req.Header.Set(k.header, value)
+			return nil
+		}
+	}
+
+	key, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(k.header, key)
+
+	return nil
+}
+
+// idempotencyClientContext returns the ClientContext configuration with the key added to the custom map.
+func idempotencyClientContext(config *Config) *ClientContextConfig {
+	idempotency := config.IdempotencyKey
+	if idempotency == nil || idempotency.ClientContextKey == "" {
+		return config.ClientContext
+	}
+
+	clientContext := ClientContextConfig{}
+	if config.ClientContext != nil {
+		clientContext = *config.ClientContext
+	}
+
+	custom := make(map[string]string, len(clientContext.Custom)+1)
+	for key, value := range clientContext.Custom {
+		custom[key] = value
+	}
+
+	custom[idempotency.ClientContextKey] = "{header:" + newIdempotencyKey(idempotency).header + "}"
+	clientContext.Custom = custom
+
+	return &clientContext
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
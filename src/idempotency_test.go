@@ -0,0 +1,89 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	var (
+		event         map[string]interface{}
+		clientContext map[string]map[string]string
+	)
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		event = nil
+		_ = json.Unmarshal(body, &event)
+
+		clientContext = nil
+		buf, _ := base64.StdEncoding.DecodeString(req.Header.Get("X-Amz-Client-Context"))
+		_ = json.Unmarshal(buf, &clientContext)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.CompatLevel = "v2"
+	cfg.IdempotencyKey = &awslambdaplugin.IdempotencyKeyConfig{ClientContextKey: "idempotencyKey"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc     string
+		headers  map[string]string
+		expected string
+	}{
+		{desc: "propagated", headers: map[string]string{"Idempotency-Key": "key-1", "X-Request-Id": "req-1"}, expected: "key-1"},
+		{desc: "request id", headers: map[string]string{"X-Request-Id": "req-1"}, expected: "req-1"},
+		{desc: "generated"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, 200, recorder.Code)
+
+			headers, _ := event["headers"].(map[string]interface{})
+			key, _ := headers["idempotency-key"].(string)
+			if test.expected != "" {
+				assert.Equal(t, test.expected, key)
+			} else {
+				assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), key)
+			}
+
+			assert.Equal(t, key, clientContext["custom"]["idempotencyKey"])
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package awslambdaplugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIMDSEndpoint = "http://169.254.169.254"
+	defaultIMDSTokenTTL = 6 * time.Hour
+	defaultIMDSTimeout  = time.Second
+	imdsCredentialsPath = "/latest/meta-data/iam/security-credentials/"
+)
+
+// IMDSConfig configures the EC2 instance profile credentials provider.
+type IMDSConfig struct {
+	// Disabled skips the instance metadata service (AWS_EC2_METADATA_DISABLED=true has the same effect).
+	Disabled bool `json:"disabled,omitempty"`
+	// Endpoint of the instance metadata service (default http://169.254.169.254).
+	Endpoint string `json:"endpoint,omitempty"`
+	// TokenTTL of the IMDSv2 session tokens (default 6h).
+	TokenTTL string `json:"tokenTtl,omitempty"`
+	// Timeout of every metadata call (default 1s). The IMDSv2 token response is dropped when it needs
+	// more network hops than the instance hop limit allows (e.g. from a bridged container): the token
+	// request then times out.
+	Timeout string `json:"timeout,omitempty"`
+	// AllowV1Fallback retries without a session token when the token cannot be obtained, for instances
+	// where IMDSv1 is still enabled but the hop limit prevents IMDSv2 from being reached.
+	AllowV1Fallback bool `json:"allowV1Fallback,omitempty"`
+}
+
+// imdsCredentials credentials of the EC2 instance profile, obtained through IMDSv2.
+type imdsCredentials struct {
+	endpoint        string
+	tokenTTL        time.Duration
+	allowV1Fallback bool
+	httpClient      *http.Client
+
+	mu           sync.Mutex
+	token        string
+	tokenExpires time.Time
+}
+
+var errIMDSUnauthorized = errors.New("instance metadata token rejected")
+
+func newIMDSCredentials(config *IMDSConfig) (credentialsProvider, error) {
+	if config == nil {
+		config = &IMDSConfig{}
+	}
+
+	if config.Disabled || strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, nil
+	}
+
+	ttl, err := parseDurationDefault(config.TokenTTL, defaultIMDSTokenTTL)
+	if err != nil || ttl < time.Second || ttl > defaultIMDSTokenTTL {
+		return nil, fmt.Errorf("imds: token ttl must be a duration between 1s and 6h")
+	}
+
+	timeout, err := parseDurationDefault(config.Timeout, defaultIMDSTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("imds: invalid timeout: %w", err)
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = firstEnv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = defaultIMDSEndpoint
+	}
+
+	return &imdsCredentials{
+		endpoint:        strings.TrimSuffix(endpoint, "/"),
+		tokenTTL:        ttl,
+		allowV1Fallback: config.AllowV1Fallback,
+		httpClient:      &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (p *imdsCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	creds, err := p.fetchCredentials(ctx)
+	if errors.Is(err, errIMDSUnauthorized) {
+		// The session token expired or was revoked: get a new one and retry once.
+		p.mu.Lock()
+		p.token = ""
+		p.mu.Unlock()
+
+		creds, err = p.fetchCredentials(ctx)
+	}
+
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("instance profile: %w", err)
+	}
+
+	return creds, nil
+}
+
+func (p *imdsCredentials) fetchCredentials(ctx context.Context) (awsCredentials, error) {
+	token, err := p.sessionToken(ctx)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	roles, err := p.get(ctx, imdsCredentialsPath, token)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(roles))
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) == "" {
+		return awsCredentials{}, fmt.Errorf("no instance profile attached: %w", errNoCredentials)
+	}
+
+	body, err := p.get(ctx, imdsCredentialsPath+strings.TrimSpace(scanner.Text()), token)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	return decodeRemoteCredentials(body, "instance profile")
+}
+
+// sessionToken returns a valid IMDSv2 token. An empty token is returned when falling back to IMDSv1.
+func (p *imdsCredentials) sessionToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExpires) {
+		return p.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+
+	ttl := int(p.tokenTTL.Seconds())
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", strconv.Itoa(ttl))
+
+	token, err := p.do(req)
+	if err != nil {
+		if p.allowV1Fallback {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("cannot obtain an IMDSv2 session token (from a container the instance "+
+			"metadata hop limit may need to be raised to 2): %w", err)
+	}
+
+	p.token = strings.TrimSpace(string(token))
+	// Renew the token a little before the instance metadata service discards it.
+	p.tokenExpires = time.Now().Add(p.tokenTTL - p.tokenTTL/10)
+
+	return p.token, nil
+}
+
+func (p *imdsCredentials) get(ctx context.Context, path, token string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	}
+
+	return p.do(req)
+}
+
+func (p *imdsCredentials) do(req *http.Request) ([]byte, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, errIMDSUnauthorized
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s %s: status %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,132 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockIMDS(t *testing.T, tokens bool) (*httptest.Server, *int) {
+	t.Helper()
+
+	issued := 0
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/latest/api/token" {
+			if !tokens {
+				res.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			assert.Equal(t, http.MethodPut, req.Method)
+			assert.Equal(t, "21600", req.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+
+			issued++
+			_, _ = res.Write([]byte("session-token"))
+			return
+		}
+
+		if tokens && req.Header.Get("X-Aws-Ec2-Metadata-Token") != "session-token" {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch req.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			_, _ = res.Write([]byte("instance-role\n"))
+		case "/latest/meta-data/iam/security-credentials/instance-role":
+			_, _ = res.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIAINSTANCE","SecretAccessKey":"instance-secret",` +
+				`"Token":"instance-token","Expiration":"2030-01-02T03:04:05Z"}`))
+		default:
+			res.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return mockserver, &issued
+}
+
+func TestIMDSCredentials(t *testing.T) {
+	mockserver, issued := newMockIMDS(t, true)
+	defer func() { mockserver.Close() }()
+
+	provider, err := newIMDSCredentials(&IMDSConfig{Endpoint: mockserver.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		creds, err := provider.retrieve(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "ASIAINSTANCE", creds.AccessKeyID)
+		assert.Equal(t, "instance-secret", creds.SecretAccessKey)
+		assert.Equal(t, "instance-token", creds.SessionToken)
+		assert.Equal(t, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), creds.Expires)
+	}
+
+	assert.Equal(t, 1, *issued)
+}
+
+func TestIMDSCredentialsRefreshesRejectedToken(t *testing.T) {
+	mockserver, issued := newMockIMDS(t, true)
+	defer func() { mockserver.Close() }()
+
+	provider, err := newIMDSCredentials(&IMDSConfig{Endpoint: mockserver.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imds := provider.(*imdsCredentials)
+	imds.token = "revoked-token"
+	imds.tokenExpires = time.Now().Add(time.Hour)
+
+	_, err = provider.retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, *issued)
+}
+
+func TestIMDSCredentialsV1Fallback(t *testing.T) {
+	mockserver, _ := newMockIMDS(t, false)
+	defer func() { mockserver.Close() }()
+
+	provider, err := newIMDSCredentials(&IMDSConfig{Endpoint: mockserver.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.retrieve(context.Background())
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "hop limit"))
+	}
+
+	provider, err = newIMDSCredentials(&IMDSConfig{Endpoint: mockserver.URL, AllowV1Fallback: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := provider.retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "ASIAINSTANCE", creds.AccessKeyID)
+}
+
+func TestIMDSCredentialsDisabled(t *testing.T) {
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	provider, err := newIMDSCredentials(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, provider)
+
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+
+	_, err = newIMDSCredentials(&IMDSConfig{TokenTTL: "12h"})
+	assert.EqualError(t, err, "imds: token ttl must be a duration between 1s and 6h")
+}
@@ -0,0 +1,169 @@
+package awslambdaplugin
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// interpolateConfig returns a copy of the configuration where the ${VAR} references of every
+// string value are replaced by the environment variables, so a single static configuration can be
+// reused across environments. ${VAR:-default} falls back to default when VAR is unset or empty,
+// and $${ escapes a literal "${".
+func interpolateConfig(config *Config) (*Config, error) {
+	copied, err := interpolateValue("", reflect.ValueOf(config).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := copied.Interface().(Config)
+
+	return &resolved, nil
+}
+
+// interpolateValue deep copies v, expanding the strings it contains.
+func interpolateValue(path string, v reflect.Value) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := expandEnv(v.String())
+		if err != nil {
+			return v, fmt.Errorf("%s: %w", path, err)
+		}
+
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(s)
+
+		return out, nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, nil
+		}
+
+		elem, err := interpolateValue(path, v.Elem())
+		if err != nil {
+			return v, err
+		}
+
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(elem)
+
+		return out, nil
+	case reflect.Struct:
+		return interpolateStruct(path, v)
+	case reflect.Slice:
+		return interpolateSlice(path, v)
+	case reflect.Map:
+		return interpolateMap(path, v)
+	default:
+		return v, nil
+	}
+}
+
+// interpolateStruct copies the struct, interpolating its exported fields.
+func interpolateStruct(path string, v reflect.Value) (reflect.Value, error) {
+	out := reflect.New(v.Type()).Elem()
+	out.Set(v)
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		value, err := interpolateValue(configFieldPath(path, field), v.Field(i))
+		if err != nil {
+			return v, err
+		}
+
+		out.Field(i).Set(value)
+	}
+
+	return out, nil
+}
+
+// interpolateSlice copies the slice, interpolating its elements.
+func interpolateSlice(path string, v reflect.Value) (reflect.Value, error) {
+	if v.IsNil() {
+		return v, nil
+	}
+
+	out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	for i := 0; i < v.Len(); i++ {
+		value, err := interpolateValue(path+"["+strconv.Itoa(i)+"]", v.Index(i))
+		if err != nil {
+			return v, err
+		}
+
+		out.Index(i).Set(value)
+	}
+
+	return out, nil
+}
+
+// interpolateMap copies the map, interpolating its values.
+func interpolateMap(path string, v reflect.Value) (reflect.Value, error) {
+	if v.IsNil() {
+		return v, nil
+	}
+
+	out := reflect.MakeMapWithSize(v.Type(), v.Len())
+	for _, k := range v.MapKeys() {
+		value, err := interpolateValue(path+"."+fmt.Sprint(k.Interface()), v.MapIndex(k))
+		if err != nil {
+			return v, err
+		}
+
+		out.SetMapIndex(k, value)
+	}
+
+	return out, nil
+}
+
+// expandEnv replaces the ${VAR} and ${VAR:-default} references of s. Unlike os.Expand,
+// a reference to an unset variable without default is an error rather than an empty string.
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var out strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			out.WriteString(s)
+			return out.String(), nil
+		}
+
+		if start > 0 && s[start-1] == '$' {
+			out.WriteString(s[:start-1] + "${")
+			s = s[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s)
+		}
+
+		out.WriteString(s[:start])
+
+		name, def, hasDefault := s[start+2:start+end], "", false
+		if i := strings.Index(name, ":-"); i >= 0 {
+			name, def, hasDefault = name[:i], name[i+2:], true
+		}
+
+		value, ok := os.LookupEnv(name)
+		switch {
+		case hasDefault && value == "":
+			value = def
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		out.WriteString(value)
+		s = s[start+end+1:]
+	}
+}
@@ -0,0 +1,57 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigInterpolation(t *testing.T) {
+	t.Setenv("LAMBDA_ACCESS_KEY", "env-key")
+	t.Setenv("LAMBDA_SECRET_KEY", "env-secret")
+
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Contains(t, req.Header.Get("Authorization"), "Credential=env-key/")
+		assert.Equal(t, "/2015-03-31/functions/arn%3Aaws%3Alambda%3Aeu-west-1%3A000000000000%3Afunction%3Adefault-fn%3A1/invocations", req.URL.RawPath)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	t.Setenv("LAMBDA_ENDPOINT", mockserver.URL)
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "${LAMBDA_ACCESS_KEY}"
+	cfg.SecretKey = "${LAMBDA_SECRET_KEY}"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:${LAMBDA_FUNCTION:-default-fn}:1"
+	cfg.Endpoint = "${LAMBDA_ENDPOINT}"
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "${LAMBDA_ACCESS_KEY}", cfg.AccessKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+
+	cfg.SLO = &awslambdaplugin.SLOConfig{MetricsPath: "/metrics/$${literal}/${LAMBDA_UNSET_VARIABLE}"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "slo.metricsPath: environment variable LAMBDA_UNSET_VARIABLE is not set")
+}
@@ -0,0 +1,129 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	kmsSecretPrefix = "kms:"
+	kmsTimeout      = 10 * time.Second
+)
+
+// KMSConfig configures the decryption of the KMS-encrypted secrets.
+type KMSConfig struct {
+	// Endpoint overrides the KMS endpoint (e.g. a VPC endpoint).
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region of the key, when different from the plugin region.
+	Region string `json:"region,omitempty"`
+	// KeyID restricts the decryption to the given key, required for asymmetric keys.
+	KeyID string `json:"keyId,omitempty"`
+	// EncryptionContext the secrets have been encrypted with.
+	EncryptionContext map[string]string `json:"encryptionContext,omitempty"`
+}
+
+// kmsClient calls the KMS JSON API.
+type kmsClient struct {
+	*serviceClient
+}
+
+type kmsDecryptInput struct {
+	CiphertextBlob    []byte            `json:"CiphertextBlob"`
+	KeyID             string            `json:"KeyId,omitempty"`
+	EncryptionContext map[string]string `json:"EncryptionContext,omitempty"`
+}
+
+type kmsDecryptOutput struct {
+	KeyID     string `json:"KeyId"`
+	Plaintext []byte `json:"Plaintext"`
+}
+
+// decrypt calls the Decrypt API, returning the plaintext.
+func (c *kmsClient) decrypt(ctx context.Context, in *kmsDecryptInput) ([]byte, error) {
+	var out kmsDecryptOutput
+	if err := c.callJSON(ctx, "TrentService.Decrypt", in, &out); err != nil {
+		return nil, err
+	}
+
+	return out.Plaintext, nil
+}
+
+// decryptKMSSecrets replaces the secrets given as "kms:<base64 ciphertext blob>" with their plaintext.
+// The configuration is updated in place, so it must be a private copy as returned by resolveSecretFiles.
+func decryptKMSSecrets(ctx context.Context, config *Config, region, profile string, httpClient *http.Client, cache cacheOptions) (*Config, error) {
+	var encrypted []secretFile
+	for _, s := range configSecrets(config) {
+		if strings.HasPrefix(*s.target, kmsSecretPrefix) {
+			encrypted = append(encrypted, s)
+		}
+	}
+
+	if len(encrypted) == 0 {
+		return config, nil
+	}
+
+	client, err := newKMSClient(config, region, profile, httpClient, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, kmsTimeout)
+	defer cancel()
+
+	for _, s := range encrypted {
+		blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(*s.target, kmsSecretPrefix)))
+		if err != nil || len(blob) == 0 {
+			return nil, fmt.Errorf("invalid %s: malformed kms ciphertext blob", s.name)
+		}
+
+		in := &kmsDecryptInput{CiphertextBlob: blob}
+		if config.KMS != nil {
+			in.KeyID = config.KMS.KeyID
+			in.EncryptionContext = config.KMS.EncryptionContext
+		}
+
+		plaintext, err := client.decrypt(ctx, in)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt %s: %w", s.name, err)
+		}
+
+		*s.target = string(plaintext)
+	}
+
+	return config, nil
+}
+
+func newKMSClient(config *Config, region, profile string, httpClient *http.Client, cache cacheOptions) (*kmsClient, error) {
+	var endpoint string
+	if config.KMS != nil {
+		endpoint = config.KMS.Endpoint
+		if config.KMS.Region != "" {
+			region = config.KMS.Region
+		}
+	}
+
+	if endpoint == "" {
+		fips, err := useFIPSEndpoint(config, region)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoint = serviceEndpoint("kms", region, fips)
+	}
+
+	creds, err := ambientCredentials(config, profile, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := newServiceClient("kms", region, endpoint, creds, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsClient{service}, nil
+}
@@ -0,0 +1,85 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKMSSecrets(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "ambient-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "ambient-secret")
+
+	kms := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "TrentService.Decrypt", req.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "application/x-amz-json-1.1", req.Header.Get("Content-Type"))
+		assert.Contains(t, req.Header.Get("Authorization"), "Credential=ambient-key/")
+		assert.Contains(t, req.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request")
+
+		var in struct {
+			CiphertextBlob    []byte
+			EncryptionContext map[string]string
+		}
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, map[string]string{"app": "traefik"}, in.EncryptionContext)
+		if string(in.CiphertextBlob) == "bad-blob" {
+			res.Header().Set("X-Amzn-Errortype", "InvalidCiphertextException")
+			res.WriteHeader(400)
+			_, _ = res.Write([]byte("{}"))
+			return
+		}
+
+		_ = json.NewEncoder(res).Encode(map[string][]byte{"Plaintext": []byte("plain-" + string(in.CiphertextBlob))})
+	}))
+	defer func() { kms.Close() }()
+
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Contains(t, req.Header.Get("Authorization"), "Credential=plain-key/")
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "kms:" + base64.StdEncoding.EncodeToString([]byte("key"))
+	cfg.SecretKey = "kms:" + base64.StdEncoding.EncodeToString([]byte("secret"))
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.KMS = &awslambdaplugin.KMSConfig{Endpoint: kms.URL, EncryptionContext: map[string]string{"app": "traefik"}}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+
+	cfg.SecretKey = "kms:" + base64.StdEncoding.EncodeToString([]byte("bad-blob"))
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "cannot decrypt secretKey: InvalidCiphertextException (status 400)")
+
+	cfg.SecretKey = "kms:not base64"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "invalid secretKey: malformed kms ciphertext blob")
+}
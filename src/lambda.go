@@ -0,0 +1,496 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	invocationTypeRequestResponse = "RequestResponse"
+)
+
+// serviceClient sends SigV4 (or SigV4A) signed requests to an AWS service endpoint.
+type serviceClient struct {
+	service     string
+	region      string
+	endpoint    *url.URL
+	credentials credentialsProvider
+	httpClient  *http.Client
+
+	// regionSet switches the signature to SigV4A, valid in all the listed regions.
+	regionSet []string
+	v4aKeys   sigV4AKeys
+
+	// jsonVersion of the AWS JSON protocol (default 1.1).
+	jsonVersion string
+}
+
+// serviceEndpoint returns the default endpoint of a service in the region.
+func serviceEndpoint(service, region string, fips bool) string {
+	if fips {
+		service += "-fips"
+	}
+
+	return "https://" + service + "." + region + "." + regionPartition(region).dnsSuffix
+}
+
+// useFIPSEndpoint reports whether the FIPS endpoints are enabled by the configuration
+// or, when unset, by AWS_USE_FIPS_ENDPOINT.
+func useFIPSEndpoint(config *Config, region string) (bool, error) {
+	fips := strings.EqualFold(os.Getenv("AWS_USE_FIPS_ENDPOINT"), "true")
+	if config.UseFIPSEndpoint != nil {
+		fips = *config.UseFIPSEndpoint
+	}
+
+	if p := regionPartition(region).name; fips && p != defaultPartition && p != "aws-us-gov" {
+		return false, fmt.Errorf("fips endpoints are not available in region %s", region)
+	}
+
+	return fips, nil
+}
+
+func newServiceClient(service, region, endpoint string, creds credentialsProvider, httpClient *http.Client) (*serviceClient, error) {
+	if endpoint == "" {
+		endpoint = serviceEndpoint(service, region, false)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s endpoint: %w", service, err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s endpoint %q: scheme and host are required", service, endpoint)
+	}
+
+	return &serviceClient{
+		service:     service,
+		region:      region,
+		endpoint:    u,
+		credentials: creds,
+		httpClient:  httpClient,
+	}, nil
+}
+
+// send signs and sends a request. The path must already be escaped.
+func (c *serviceClient) send(ctx context.Context, method, path string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *c.endpoint
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + path
+	p, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = p
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	creds, err := c.credentials.retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.regionSet != nil {
+		key, err := c.v4aKeys.get(creds)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := signV4A(req, hashHex(body), creds, key, c.regionSet, c.service, time.Now()); err != nil {
+			return nil, err
+		}
+	} else {
+		signV4(req, hashHex(body), creds, c.region, c.service, time.Now())
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusForbidden && rejectedCredentials(resp.Header.Get("X-Amzn-Errortype")) {
+		if cache, ok := c.credentials.(credentialsInvalidator); ok {
+			cache.invalidate()
+		}
+	}
+
+	return resp, nil
+}
+
+// rejectedCredentials reports whether the error type means the credentials are no longer valid.
+func rejectedCredentials(errorType string) bool {
+	if i := strings.IndexByte(errorType, ':'); i >= 0 {
+		errorType = errorType[:i]
+	}
+
+	switch errorType {
+	case "UnrecognizedClientException", "InvalidSignatureException", "ExpiredTokenException":
+		return true
+	}
+
+	return false
+}
+
+// apiError an error response returned by an AWS API.
+type apiError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	// RetryAfter is the back off suggested by throttling errors, zero when none.
+	RetryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%s (status %d)", e.Code, e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	if e.RequestID != "" {
+		msg += " [request id: " + e.RequestID + "]"
+	}
+
+	return msg
+}
+
+// newRESTError parses the error response of a REST-JSON API.
+func newRESTError(resp *http.Response, body []byte) *apiError {
+	e := &apiError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Amzn-Requestid"),
+	}
+
+	var payload struct {
+		Type       string      `json:"__type"`
+		Message    string      `json:"message"`
+		MessageAlt string      `json:"Message"`
+		RetryAfter interface{} `json:"retryAfterSeconds"`
+	}
+	_ = json.Unmarshal(body, &payload)
+
+	e.Code = resp.Header.Get("X-Amzn-Errortype")
+	if e.Code == "" {
+		e.Code = payload.Type
+	}
+
+	// Error types may be suffixed with a documentation URL or prefixed with a namespace.
+	if i := strings.IndexByte(e.Code, ':'); i >= 0 {
+		e.Code = e.Code[:i]
+	}
+
+	if i := strings.LastIndexByte(e.Code, '#'); i >= 0 {
+		e.Code = e.Code[i+1:]
+	}
+
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+
+	e.Message = payload.Message
+	if e.Message == "" {
+		e.Message = payload.MessageAlt
+	}
+
+	retryAfter := resp.Header.Get("Retry-After")
+	if retryAfter == "" && payload.RetryAfter != nil {
+		retryAfter = fmt.Sprint(payload.RetryAfter)
+	}
+
+	if seconds, err := strconv.ParseFloat(retryAfter, 64); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds * float64(time.Second))
+	}
+
+	return e
+}
+
+// callJSON calls an operation of an AWS JSON protocol API (e.g. KMS), decoding the result in out.
+func (c *serviceClient) callJSON(ctx context.Context, target string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	jsonVersion := c.jsonVersion
+	if jsonVersion == "" {
+		jsonVersion = "1.1"
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-amz-json-"+jsonVersion)
+	header.Set("X-Amz-Target", target)
+
+	resp, err := c.send(ctx, http.MethodPost, "/", nil, header, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return newRESTError(resp, payload)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(payload, out)
+}
+
+// lambdaClient calls the Lambda REST API.
+type lambdaClient struct {
+	*serviceClient
+}
+
+// newLambdaClient returns the client of the Lambda endpoint of the region: the given one or, when
+// empty, the default (or FIPS) endpoint.
+func newLambdaClient(config *Config, region, endpoint string, creds credentialsProvider, httpClient *http.Client) (*lambdaClient, error) {
+	if endpoint == "" {
+		fips, err := useFIPSEndpoint(config, region)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoint = serviceEndpoint("lambda", region, fips)
+	}
+
+	service, err := newServiceClient("lambda", region, endpoint, creds, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.SigningAlgorithm {
+	case "", signingSigV4:
+	case signingSigV4A:
+		service.regionSet = config.SigningRegionSet
+		if len(service.regionSet) == 0 {
+			service.regionSet = []string{"*"}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", config.SigningAlgorithm)
+	}
+
+	return &lambdaClient{service}, nil
+}
+
+type invokeInput struct {
+	FunctionName   string
+	Qualifier      string
+	InvocationType string
+	ClientContext  string
+	LogType        string
+	TraceHeader    string
+	Payload        []byte
+}
+
+type invokeOutput struct {
+	StatusCode      int
+	FunctionError   string
+	LogResult       string
+	ExecutedVersion string
+	RequestID       string
+	Payload         []byte
+}
+
+// invoke calls the Invoke API of the given function.
+func (c *lambdaClient) invoke(ctx context.Context, in *invokeInput) (*invokeOutput, error) {
+	header, query := invokeParameters(in)
+
+	path := "/2015-03-31/functions/" + escapeRFC3986(in.FunctionName, true) + "/invocations"
+	resp, err := c.send(ctx, http.MethodPost, path, query, header, in.Payload)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	payload, err := readAll(resp.Body, resp.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, newRESTError(resp, payload)
+	}
+
+	return &invokeOutput{
+		StatusCode:      resp.StatusCode,
+		FunctionError:   resp.Header.Get("X-Amz-Function-Error"),
+		LogResult:       resp.Header.Get("X-Amz-Log-Result"),
+		ExecutedVersion: resp.Header.Get("X-Amz-Executed-Version"),
+		RequestID:       resp.Header.Get("X-Amzn-Requestid"),
+		Payload:         payload,
+	}, nil
+}
+
+// functionConfiguration the subset of the GetFunctionConfiguration result used by the plugin.
+type functionConfiguration struct {
+	FunctionArn     string `json:"FunctionArn"`
+	Version         string `json:"Version"`
+	Timeout         int    `json:"Timeout"`
+	State           string `json:"State"`
+	StateReason     string `json:"StateReason"`
+	StateReasonCode string `json:"StateReasonCode"`
+}
+
+// getFunctionConfiguration calls the GetFunctionConfiguration API of the given function.
+func (c *lambdaClient) getFunctionConfiguration(ctx context.Context, functionName, qualifier string) (*functionConfiguration, error) {
+	query := url.Values{}
+	if qualifier != "" {
+		query.Set("Qualifier", qualifier)
+	}
+
+	path := "/2015-03-31/functions/" + escapeRFC3986(functionName, true) + "/configuration"
+	resp, err := c.send(ctx, http.MethodGet, path, query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, newRESTError(resp, payload)
+	}
+
+	var out functionConfiguration
+	if err := json.Unmarshal(payload, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// invokeParameters returns the headers and query string shared by the invoke APIs.
+func invokeParameters(in *invokeInput) (http.Header, url.Values) {
+	header := make(http.Header, 5)
+	header.Set("Content-Type", "application/json")
+
+	invocationType := in.InvocationType
+	if invocationType == "" {
+		invocationType = invocationTypeRequestResponse
+	}
+
+	header.Set("X-Amz-Invocation-Type", invocationType)
+	if in.ClientContext != "" {
+		header.Set("X-Amz-Client-Context", in.ClientContext)
+	}
+
+	if in.LogType != "" {
+		header.Set("X-Amz-Log-Type", in.LogType)
+	}
+
+	if in.TraceHeader != "" {
+		header.Set(xrayTraceHeader, in.TraceHeader)
+	}
+
+	query := url.Values{}
+	if in.Qualifier != "" {
+		query.Set("Qualifier", in.Qualifier)
+	}
+
+	return header, query
+}
+
+// invokeStream calls the InvokeWithResponseStream API of the given function.
+func (c *lambdaClient) invokeStream(ctx context.Context, in *invokeInput) (*responseStream, error) {
+	header, query := invokeParameters(in)
+
+	path := "/2021-11-15/functions/" + escapeRFC3986(in.FunctionName, true) + "/response-streaming-invocations"
+	resp, err := c.send(ctx, http.MethodPost, path, query, header, in.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer func() { _ = resp.Body.Close() }()
+
+		payload, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, newRESTError(resp, payload)
+	}
+
+	return &responseStream{
+		body:            resp.Body,
+		ExecutedVersion: resp.Header.Get("X-Amz-Executed-Version"),
+		RequestID:       resp.Header.Get("X-Amzn-Requestid"),
+	}, nil
+}
+
+// responseStream the event stream of a streamed invocation.
+type responseStream struct {
+	body            io.ReadCloser
+	ExecutedVersion string
+	RequestID       string
+}
+
+// next returns the next chunk of the function response, io.EOF once the invocation completed.
+func (s *responseStream) next() ([]byte, error) {
+	for {
+		msg, err := readEventStreamMessage(s.body)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+
+		switch msg.headers[":message-type"] {
+		case "event":
+			switch msg.headers[":event-type"] {
+			case "PayloadChunk":
+				if len(msg.payload) > 0 {
+					return msg.payload, nil
+				}
+			case "InvokeComplete":
+				var complete struct {
+					ErrorCode    string `json:"ErrorCode"`
+					ErrorDetails string `json:"ErrorDetails"`
+				}
+				_ = json.Unmarshal(msg.payload, &complete)
+				if complete.ErrorCode != "" {
+					return nil, fmt.Errorf("function error (%s): %s", complete.ErrorCode, complete.ErrorDetails)
+				}
+
+				return nil, io.EOF
+			}
+		case "exception":
+			var payload struct {
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(msg.payload, &payload)
+
+			return nil, fmt.Errorf("response stream %s: %s [request id: %s]", msg.headers[":exception-type"], payload.Message, s.RequestID)
+		case "error":
+			return nil, fmt.Errorf("response stream %s: %s [request id: %s]", msg.headers[":error-code"], msg.headers[":error-message"], s.RequestID)
+		}
+	}
+}
+
+func (s *responseStream) close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,29 @@
+package awslambdaplugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceEndpoint(t *testing.T) {
+	assert.Equal(t, "https://lambda.eu-west-1.amazonaws.com", serviceEndpoint("lambda", "eu-west-1", false))
+	assert.Equal(t, "https://lambda-fips.us-gov-west-1.amazonaws.com", serviceEndpoint("lambda", "us-gov-west-1", true))
+	assert.Equal(t, "https://lambda.cn-north-1.amazonaws.com.cn", serviceEndpoint("lambda", "cn-north-1", false))
+}
+
+func TestUseFIPSEndpoint(t *testing.T) {
+	t.Setenv("AWS_USE_FIPS_ENDPOINT", "true")
+
+	fips, err := useFIPSEndpoint(&Config{}, "us-east-1")
+	assert.NoError(t, err)
+	assert.True(t, fips)
+
+	disabled := false
+	fips, err = useFIPSEndpoint(&Config{UseFIPSEndpoint: &disabled}, "us-east-1")
+	assert.NoError(t, err)
+	assert.False(t, fips)
+
+	_, err = useFIPSEndpoint(&Config{}, "cn-north-1")
+	assert.EqualError(t, err, "fips endpoints are not available in region cn-north-1")
+}
@@ -0,0 +1,205 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLatencyProbeInterval = 10 * time.Second
+	defaultLatencyProbeTimeout  = 5 * time.Second
+
+	// latencySmoothing is the weight of the last probe in the moving average of the latency.
+	latencySmoothing = 0.3
+)
+
+// LatencyRoutingConfig routes each request to the regional replica of the function with the lowest
+// observed latency. The latencies are measured by DryRun invocations of every replica in background;
+// replicas failing the probe are skipped until they answer again.
+type LatencyRoutingConfig struct {
+	// Replicas lists the full ARNs of the function replicas in the other regions. The qualifier, if
+	// any, applies to every replica.
+	Replicas []string `json:"replicas,omitempty"`
+	// ProbeInterval between two probes (default 10s).
+	ProbeInterval string `json:"probeInterval,omitempty"`
+	// ProbeTimeout of a probe (default 5s).
+	ProbeTimeout string `json:"probeTimeout,omitempty"`
+	// Endpoints overrides the Lambda endpoint of the replica regions, e.g. {"us-east-1": "https://vpce..."}.
+	Endpoints map[string]string `json:"endpoints,omitempty"`
+}
+
+// regionalReplica tracks the latency of a replica of the function.
+type regionalReplica struct {
+	// function is empty for the configured function.
+	function string
+	region   string
+	client   *lambdaClient
+
+	mu        sync.Mutex
+	probed    bool
+	available bool
+	latency   time.Duration
+}
+
+// latencyRouter picks the replica with the lowest latency.
+type latencyRouter struct {
+	logger   *logger
+	interval time.Duration
+	timeout  time.Duration
+	probe    func(context.Context, *lambdaClient, string) error
+
+	// replicas starts with the configured function.
+	replicas []*regionalReplica
+	clients  map[string]*lambdaClient
+}
+
+func newLatencyRouter(
+	logger *logger, config *Config, region string, primary *lambdaClient, newClient func(region, endpoint string) (*lambdaClient, error),
+	probe func(context.Context, *lambdaClient, string) error,
+) (*latencyRouter, error) {
+	routing := config.LatencyRouting
+
+	interval, err := parseDurationDefault(routing.ProbeInterval, defaultLatencyProbeInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("latency routing: invalid probe interval %q", routing.ProbeInterval)
+	}
+
+	timeout, err := parseDurationDefault(routing.ProbeTimeout, defaultLatencyProbeTimeout)
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("latency routing: invalid probe timeout %q", routing.ProbeTimeout)
+	}
+
+	if len(routing.Replicas) == 0 {
+		return nil, fmt.Errorf("latency routing: replicas cannot be empty")
+	}
+
+	r := &latencyRouter{
+		logger:   logger,
+		interval: interval,
+		timeout:  timeout,
+		probe:    probe,
+		replicas: []*regionalReplica{{region: region, client: primary}},
+		clients:  map[string]*lambdaClient{},
+	}
+
+	for _, replica := range routing.Replicas {
+		fn, err := parseFunctionArn(replica)
+		if err != nil {
+			return nil, fmt.Errorf("latency routing: %w", err)
+		}
+
+		if fn.region == "" {
+			return nil, fmt.Errorf("latency routing: replica %q must be a full function arn", replica)
+		}
+
+		// As for the canary, the qualifier is sent apart and shared by all the replicas.
+		if fn.qualifier != "" {
+			return nil, fmt.Errorf("latency routing: replica %q cannot include a qualifier, use the qualifier option", replica)
+		}
+
+		client, err := newClient(fn.region, routing.Endpoints[fn.region])
+		if err != nil {
+			return nil, fmt.Errorf("latency routing: %w", err)
+		}
+
+		r.replicas = append(r.replicas, &regionalReplica{function: replica, region: fn.region, client: client})
+		r.clients[replica] = client
+	}
+
+	return r, nil
+}
+
+// run probes the replicas right away, then at every interval until the context is done.
+func (r *latencyRouter) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+		for _, replica := range r.replicas {
+			wg.Add(1)
+			go func(replica *regionalReplica) {
+				defer wg.Done()
+				r.measure(ctx, replica)
+			}(replica)
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *latencyRouter) measure(ctx context.Context, replica *regionalReplica) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := r.probe(ctx, replica.client, replica.function)
+	elapsed := time.Since(start)
+
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+
+	switch {
+	case err != nil && (replica.available || !replica.probed):
+		r.logger.warnf("latency probe of region %s failed: %s", replica.region, err)
+	case err == nil && !replica.available && replica.probed:
+		r.logger.infof("latency probe of region %s recovered", replica.region)
+	}
+
+	if err == nil {
+		if replica.available {
+			replica.latency = time.Duration(latencySmoothing*float64(elapsed) + (1-latencySmoothing)*float64(replica.latency))
+		} else {
+			replica.latency = elapsed
+		}
+	}
+
+	replica.probed = true
+	replica.available = err == nil
+}
+
+// route sends the invocation to the available replica with the lowest latency. The configured
+// function is kept until a replica is known to be faster, or when no replica is available.
+func (r *latencyRouter) route(in *invokeInput) {
+	var (
+		best    *regionalReplica
+		latency time.Duration
+	)
+
+	for _, replica := range r.replicas {
+		replica.mu.Lock()
+		available, current := replica.available, replica.latency
+		replica.mu.Unlock()
+
+		if available && (best == nil || current < latency) {
+			best, latency = replica, current
+		}
+	}
+
+	if best != nil && best.function != "" {
+		in.FunctionName = best.function
+	}
+}
+
+// clientFor returns the client of the function replica, nil for the other functions.
+func (r *latencyRouter) clientFor(function string) *lambdaClient {
+	return r.clients[function]
+}
+
+// clientFor returns the client reaching the region of the function.
+func (a *AwsLambdaPlugin) clientFor(function string) *lambdaClient {
+	if a.latency != nil {
+		if client := a.latency.clientFor(function); client != nil {
+			return client
+		}
+	}
+
+	return a.client
+}
@@ -0,0 +1,99 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyRouting(t *testing.T) {
+	var primaryInvoked, replicaInvoked, replicaDown int32
+	primary := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Amz-Invocation-Type") == "DryRun" {
+			time.Sleep(50 * time.Millisecond)
+			res.WriteHeader(204)
+			return
+		}
+
+		atomic.AddInt32(&primaryInvoked, 1)
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { primary.Close() }()
+
+	var replicaPath string
+	replica := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Amz-Invocation-Type") == "DryRun" {
+			if atomic.LoadInt32(&replicaDown) == 1 {
+				res.Header().Set("X-Amzn-Errortype", "ServiceException")
+				res.WriteHeader(500)
+				return
+			}
+
+			res.WriteHeader(204)
+			return
+		}
+
+		replicaPath = req.URL.EscapedPath()
+		atomic.AddInt32(&replicaInvoked, 1)
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { replica.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx"
+	cfg.Endpoint = primary.URL
+	cfg.LatencyRouting = &awslambdaplugin.LatencyRoutingConfig{
+		Replicas:      []string{"arn:aws:lambda:us-east-1:000000000000:function:xxx"},
+		ProbeInterval: "10ms",
+		Endpoints:     map[string]string{"us-east-1": replica.URL},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+	}
+
+	assert.Eventually(t, func() bool {
+		serve()
+		return atomic.LoadInt32(&replicaInvoked) > 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "/2015-03-31/functions/arn%3Aaws%3Alambda%3Aus-east-1%3A000000000000%3Afunction%3Axxx/invocations", replicaPath)
+
+	atomic.StoreInt32(&replicaDown, 1)
+	invoked := atomic.LoadInt32(&primaryInvoked)
+	assert.Eventually(t, func() bool {
+		serve()
+		return atomic.LoadInt32(&primaryInvoked) > invoked
+	}, time.Second, 10*time.Millisecond)
+
+	cfg.LatencyRouting.Replicas = []string{"arn:aws:lambda:us-east-1:000000000000:function:xxx:live"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `latency routing: replica "arn:aws:lambda:us-east-1:000000000000:function:xxx:live" cannot include a qualifier, use the qualifier option`)
+}
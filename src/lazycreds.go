@@ -0,0 +1,76 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"sync"
+)
+
+// lazyCredentials builds the credentials chain of a middleware on its first use instead of in New:
+// reading the shared config files, probing the container and instance metadata settings and preparing
+// the role sessions are left out of the plugin load, which must complete quickly. New starts a
+// background warm-up building the chain, so the first request does not wait for it either. A failed
+// build is not kept: the next request tries again.
+type lazyCredentials struct {
+	build func() (credentialsProvider, error)
+
+	mu       sync.Mutex
+	provider credentialsProvider
+}
+
+func newLazyCredentials(build func() (credentialsProvider, error)) *lazyCredentials {
+	return &lazyCredentials{build: build}
+}
+
+// resolve returns the credentials chain, built by the first call.
+func (c *lazyCredentials) resolve() (credentialsProvider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.provider == nil {
+		provider, err := c.build()
+		if err != nil {
+			return nil, err
+		}
+
+		c.provider = provider
+	}
+
+	return c.provider, nil
+}
+
+func (c *lazyCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	provider, err := c.resolve()
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	return provider.retrieve(ctx)
+}
+
+// invalidate discards the cached credentials of the chain, when it is built.
+func (c *lazyCredentials) invalidate() {
+	c.mu.Lock()
+	provider := c.provider
+	c.mu.Unlock()
+
+	if cache, ok := provider.(credentialsInvalidator); ok {
+		cache.invalidate()
+	}
+}
+
+// warmUp builds the credentials chain in background, logging why it cannot be.
+func (c *lazyCredentials) warmUp(ctx context.Context, logger *logger) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	if _, err := c.resolve(); err != nil {
+		logger.errorf("cannot resolve the AWS credentials, retrying on the first request: %v", err)
+	}
+}
+
+// credentialsInvalidator is a credentials provider caching the credentials, which are discarded
+// when the service rejects them.
+type credentialsInvalidator interface {
+	invalidate()
+}
@@ -0,0 +1,78 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyCredentials(t *testing.T) {
+	writeSharedFiles(t, "", "")
+
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=LAZYKEY/"))
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.Profile = "lazy"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The missing profile does not fail the plugin load.
+	handler, err := New(ctx, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}), cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() int {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusBadGateway, serve())
+
+	if err := os.WriteFile(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), []byte(`[lazy]
+aws_access_key_id = LAZYKEY
+aws_secret_access_key = lazy-secret
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed build is retried.
+	assert.Equal(t, http.StatusOK, serve())
+
+	builds := 0
+	creds := newLazyCredentials(func() (credentialsProvider, error) {
+		builds++
+		return staticCredentials{AccessKeyID: "key", SecretAccessKey: "secret"}, nil
+	})
+
+	creds.warmUp(ctx, handler.(*AwsLambdaPlugin).logger)
+	for i := 0; i < 2; i++ {
+		resolved, err := creds.retrieve(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "key", resolved.AccessKeyID)
+	}
+
+	assert.Equal(t, 1, builds)
+}
@@ -0,0 +1,225 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultAdaptiveDecreaseFactor = 0.5
+
+// AdaptiveConcurrencyConfig adjusts the in-flight limit to the capacity of the function, AIMD style:
+// the limit grows by one every limit healthy invocations, and is multiplied by DecreaseFactor when
+// an invocation is throttled or slower than LatencyThreshold.
+type AdaptiveConcurrencyConfig struct {
+	// MinLimit is the lowest limit (default 1).
+	MinLimit int `json:"minLimit,omitempty"`
+	// InitialLimit is the limit at startup (default maxConcurrentInvocations, the highest limit).
+	InitialLimit int `json:"initialLimit,omitempty"`
+	// LatencyThreshold is the invocation latency considered a congestion signal; unset only the
+	// throttled invocations are.
+	LatencyThreshold string `json:"latencyThreshold,omitempty"`
+	// DecreaseFactor applied to the limit on congestion, between 0 and 1 excluded (default 0.5).
+	DecreaseFactor float64 `json:"decreaseFactor,omitempty"`
+}
+
+// adaptiveLimit parsed AdaptiveConcurrencyConfig.
+type adaptiveLimit struct {
+	minLimit         int
+	maxLimit         int
+	latencyThreshold time.Duration
+	decreaseFactor   float64
+}
+
+// concurrencyLimiter bounds the in-flight invocations of a middleware. Requests over the limit wait
+// for a free slot up to the queue timeout, or are rejected right away without one.
+type concurrencyLimiter struct {
+	queueTimeout time.Duration
+	adaptive     *adaptiveLimit
+
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	// freed is closed, and replaced, when a slot gets free.
+	freed        chan struct{}
+	successes    int
+	lastDecrease time.Time
+}
+
+func newConcurrencyLimiter(config *Config) (*concurrencyLimiter, error) {
+	if config.MaxConcurrentInvocations == 0 {
+		if config.AdaptiveConcurrency != nil {
+			return nil, fmt.Errorf("adaptive concurrency requires max concurrent invocations")
+		}
+
+		return nil, nil
+	}
+
+	if config.MaxConcurrentInvocations < 0 {
+		return nil, fmt.Errorf("max concurrent invocations cannot be negative")
+	}
+
+	queueTimeout, err := parseDurationDefault(config.ConcurrencyQueueTimeout, 0)
+	if err != nil || queueTimeout < 0 {
+		return nil, fmt.Errorf("invalid concurrency queue timeout %q", config.ConcurrencyQueueTimeout)
+	}
+
+	l := &concurrencyLimiter{
+		queueTimeout: queueTimeout,
+		limit:        config.MaxConcurrentInvocations,
+		freed:        make(chan struct{}),
+	}
+
+	if config.AdaptiveConcurrency != nil {
+		l.adaptive, l.limit, err = newAdaptiveLimit(config.AdaptiveConcurrency, config.MaxConcurrentInvocations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// newAdaptiveLimit returns the adaptive limit with a maxLimit ceiling, and its initial value.
+func newAdaptiveLimit(config *AdaptiveConcurrencyConfig, maxLimit int) (*adaptiveLimit, int, error) {
+	a := &adaptiveLimit{
+		minLimit:       config.MinLimit,
+		maxLimit:       maxLimit,
+		decreaseFactor: config.DecreaseFactor,
+	}
+
+	if a.minLimit == 0 {
+		a.minLimit = 1
+	}
+	if a.minLimit < 0 || a.minLimit > maxLimit {
+		return nil, 0, fmt.Errorf("adaptive concurrency: min limit must be between 1 and max concurrent invocations")
+	}
+
+	initial := config.InitialLimit
+	if initial == 0 {
+		initial = maxLimit
+	}
+	if initial < a.minLimit || initial > maxLimit {
+		return nil, 0, fmt.Errorf("adaptive concurrency: initial limit must be between min limit and max concurrent invocations")
+	}
+
+	if a.decreaseFactor == 0 {
+		a.decreaseFactor = defaultAdaptiveDecreaseFactor
+	}
+	if a.decreaseFactor <= 0 || a.decreaseFactor >= 1 {
+		return nil, 0, fmt.Errorf("adaptive concurrency: decrease factor must be between 0 and 1")
+	}
+
+	var err error
+	a.latencyThreshold, err = parseDurationDefault(config.LatencyThreshold, 0)
+	if err != nil || a.latencyThreshold < 0 {
+		return nil, 0, fmt.Errorf("adaptive concurrency: invalid latency threshold %q", config.LatencyThreshold)
+	}
+
+	return a, initial, nil
+}
+
+// tryAcquire takes a slot if one is free, otherwise it returns the channel closed when one gets free.
+func (l *concurrencyLimiter) tryAcquire() (bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight < l.limit {
+		l.inFlight++
+		return true, nil
+	}
+
+	return false, l.freed
+}
+
+// acquire takes a slot, reporting false when none got free in time.
+func (l *concurrencyLimiter) acquire(ctx context.Context) bool {
+	acquired, freed := l.tryAcquire()
+	if acquired {
+		return true
+	}
+
+	if l.queueTimeout == 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-freed:
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+
+		if acquired, freed = l.tryAcquire(); acquired {
+			return true
+		}
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.notify()
+}
+
+// notify wakes up the queued requests. The caller holds the lock.
+func (l *concurrencyLimiter) notify() {
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+// record adjusts the adaptive limit to the outcome of an invocation started at start. Only the
+// first congestion signal of the invocations in flight at the last decrease shrinks the limit.
+func (l *concurrencyLimiter) record(start time.Time, err error) {
+	if l.adaptive == nil {
+		return
+	}
+
+	_, throttled := throttledResponse(err)
+	slow := l.adaptive.latencyThreshold > 0 && time.Since(start) > l.adaptive.latencyThreshold
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case throttled || slow:
+		if start.Before(l.lastDecrease) {
+			return
+		}
+
+		l.limit = int(float64(l.limit) * l.adaptive.decreaseFactor)
+		if l.limit < l.adaptive.minLimit {
+			l.limit = l.adaptive.minLimit
+		}
+
+		l.successes = 0
+		l.lastDecrease = time.Now()
+	case err == nil:
+		l.successes++
+		if l.successes >= l.limit && l.limit < l.adaptive.maxLimit {
+			l.limit++
+			l.successes = 0
+			l.notify()
+		}
+	}
+}
+
+// intercept takes a slot for the request, answering 503 when none is available.
+// The returned function releases the slot; nil means the request has been answered.
+func (l *concurrencyLimiter) intercept(rw http.ResponseWriter, req *http.Request) func() {
+	if !l.acquire(req.Context()) {
+		http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return nil
+	}
+
+	return l.release
+}
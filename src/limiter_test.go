@@ -0,0 +1,179 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxConcurrentInvocations(t *testing.T) {
+	started := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-unblock
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		desc         string
+		queueTimeout string
+		status       int
+	}{
+		{desc: "reject", status: 503},
+		{desc: "queue", queueTimeout: "5s", status: 200},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.MaxConcurrentInvocations = 1
+			cfg.ConcurrencyQueueTimeout = test.queueTimeout
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			serve := func() int {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+				if err != nil {
+					t.Error(err)
+					return 0
+				}
+
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, req)
+
+				return recorder.Code
+			}
+
+			first := make(chan int)
+			go func() { first <- serve() }()
+			<-started
+
+			second := make(chan int)
+			go func() { second <- serve() }()
+
+			if test.queueTimeout == "" {
+				assert.Equal(t, test.status, <-second)
+				unblock <- struct{}{}
+			} else {
+				time.Sleep(20 * time.Millisecond)
+				unblock <- struct{}{}
+				<-started
+				unblock <- struct{}{}
+				assert.Equal(t, test.status, <-second)
+			}
+
+			assert.Equal(t, 200, <-first)
+		})
+	}
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	const (
+		modeOK int32 = iota
+		modeThrottled
+		modeBlocked
+	)
+
+	var mode int32
+	started := make(chan struct{}, 4)
+	unblock := make(chan struct{})
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch atomic.LoadInt32(&mode) {
+		case modeThrottled:
+			res.Header().Set("X-Amzn-Errortype", "TooManyRequestsException")
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"message":"Rate Exceeded."}`))
+			return
+		case modeBlocked:
+			started <- struct{}{}
+			<-unblock
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.MaxConcurrentInvocations = 4
+	cfg.AdaptiveConcurrency = &awslambdaplugin.AdaptiveConcurrencyConfig{}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() int {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder.Code
+	}
+
+	// saturate blocks limit invocations, checking the next request is rejected.
+	saturate := func(limit int) {
+		atomic.StoreInt32(&mode, modeBlocked)
+
+		codes := make(chan int, limit)
+		for i := 0; i < limit; i++ {
+			go func() { codes <- serve() }()
+			<-started
+		}
+
+		assert.Equal(t, 503, serve())
+
+		for i := 0; i < limit; i++ {
+			unblock <- struct{}{}
+			assert.Equal(t, 200, <-codes)
+		}
+
+		atomic.StoreInt32(&mode, modeOK)
+	}
+
+	atomic.StoreInt32(&mode, modeThrottled)
+	assert.Equal(t, 503, serve())
+	saturate(2)
+
+	// The two saturating invocations succeeded: the limit grew by one.
+	saturate(3)
+
+	cfg.AdaptiveConcurrency.DecreaseFactor = 1
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "adaptive concurrency: decrease factor must be between 0 and 1")
+}
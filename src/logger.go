@@ -0,0 +1,174 @@
+package awslambdaplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logLevelDebug = iota - 1
+	logLevelInfo
+	logLevelWarn
+	logLevelError
+)
+
+var logLevels = map[string]int{
+	"debug": logLevelDebug,
+	"info":  logLevelInfo,
+	"warn":  logLevelWarn,
+	"error": logLevelError,
+}
+
+// LogConfig configures the logs of the middleware.
+type LogConfig struct {
+	// Level is the minimum level logged: debug, info (default), warn or error.
+	Level string `json:"level,omitempty"`
+	// Format of the lines: text (default) or json.
+	Format string `json:"format,omitempty"`
+	// File receives the logs: stdout, stderr or a file path, appended to. The logs go to the Traefik
+	// log by default.
+	File string `json:"file,omitempty"`
+}
+
+// logger writes the leveled logs of a middleware. Its zero value, with a name, logs at the info
+// level to the standard logger.
+type logger struct {
+	name  string
+	level int
+	json  bool
+	out   *log.Logger
+}
+
+// logEntry is a line of the json log format.
+type logEntry struct {
+	Time       string `json:"time"`
+	Level      string `json:"level"`
+	Middleware string `json:"middleware"`
+	Message    string `json:"message"`
+}
+
+func newLogger(name string, config *LogConfig) (*logger, error) {
+	l := &logger{name: name}
+	if config == nil {
+		return l, nil
+	}
+
+	if config.Level != "" {
+		level, ok := logLevels[strings.ToLower(config.Level)]
+		if !ok {
+			return nil, fmt.Errorf("log: unsupported level %q", config.Level)
+		}
+
+		l.level = level
+	}
+
+	switch config.Format {
+	case "", "text":
+	case "json":
+		l.json = true
+	default:
+		return nil, fmt.Errorf("log: unsupported format %q", config.Format)
+	}
+
+	var out io.Writer
+	switch config.File {
+	case "":
+	case "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		file, err := openLogFile(config.File)
+		if err != nil {
+			return nil, fmt.Errorf("log: %w", err)
+		}
+
+		out = file
+	}
+
+	if out != nil {
+		flags := log.LstdFlags
+		if l.json {
+			flags = 0
+		}
+
+		l.out = log.New(out, "", flags)
+	}
+
+	return l, nil
+}
+
+// logFiles keeps the log files open, shared by the middlewares and their rebuilds on configuration
+// reloads.
+var logFiles = struct {
+	sync.Mutex
+	byPath map[string]*os.File
+}{byPath: map[string]*os.File{}}
+
+func openLogFile(path string) (*os.File, error) {
+	logFiles.Lock()
+	defer logFiles.Unlock()
+
+	if file, ok := logFiles.byPath[path]; ok {
+		return file, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640) //nolint:gosec // The log file is configured by the operator.
+	if err != nil {
+		return nil, err
+	}
+
+	logFiles.byPath[path] = file
+
+	return file, nil
+}
+
+func (l *logger) debugf(format string, args ...interface{}) {
+	l.logf(logLevelDebug, "debug", format, args...)
+}
+
+func (l *logger) infof(format string, args ...interface{}) {
+	l.logf(logLevelInfo, "info", format, args...)
+}
+
+func (l *logger) warnf(format string, args ...interface{}) {
+	l.logf(logLevelWarn, "warn", format, args...)
+}
+
+func (l *logger) errorf(format string, args ...interface{}) {
+	l.logf(logLevelError, "error", format, args...)
+}
+
+func (l *logger) logf(level int, levelName, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+
+	var line string
+	if l.json {
+		entry, _ := json.Marshal(logEntry{
+			Time:       time.Now().UTC().Format(time.RFC3339Nano),
+			Level:      levelName,
+			Middleware: l.name,
+			Message:    msg,
+		})
+		line = string(entry)
+	} else {
+		line = fmt.Sprintf("%s [%s] %s", strings.ToUpper(levelName), l.name, msg)
+	}
+
+	if l.out != nil {
+		l.out.Print(line)
+		return
+	}
+
+	log.Print(line)
+}
@@ -0,0 +1,132 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevelAndFormat(t *testing.T) {
+	var failure bool
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if failure {
+			res.WriteHeader(500)
+			_, _ = res.Write([]byte(`{"Type": "Service", "message": "boom"}`))
+
+			return
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.AccessLog = true
+	cfg.Log = &awslambdaplugin.LogConfig{Level: "warn", Format: "json"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	serve := func(f bool) {
+		failure = f
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The access log line is below the level.
+	serve(false)
+	assert.Empty(t, buf.String())
+
+	serve(true)
+	line := buf.String()
+
+	var entry map[string]string
+	if err := json.Unmarshal([]byte(line[strings.Index(line, "{"):]), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "lambda-plugin", entry["middleware"])
+	assert.Contains(t, entry["message"], "request failed with status 502 Bad Gateway")
+	assert.NotEmpty(t, entry["time"])
+
+	cfg.Log = &awslambdaplugin.LogConfig{Level: "verbose"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `log: unsupported level "verbose"`)
+
+	cfg.Log = &awslambdaplugin.LogConfig{Format: "xml"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `log: unsupported format "xml"`)
+}
+
+func TestLogFile(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	file := filepath.Join(t.TempDir(), "lambda.log")
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Log = &awslambdaplugin.LogConfig{Level: "debug", File: file}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(content), "DEBUG [lambda-plugin] invoked arn:aws:lambda:eu-west-1:000000000000:function:xxx:1 in ")
+	assert.Contains(t, string(content), "[request id: req-1]")
+}
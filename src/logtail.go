@@ -0,0 +1,133 @@
+package awslambdaplugin
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const logTypeTail = "Tail"
+
+// LogTailConfig exposes the log excerpt returned by the LogType=Tail invocations.
+type LogTailConfig struct {
+	// Log writes the excerpt to the Traefik log.
+	Log bool `json:"log,omitempty"`
+	// Header names a response header carrying the excerpt, with the line breaks escaped as \n.
+	// Meant for debugging: it discloses the function logs to the clients.
+	Header string `json:"header,omitempty"`
+	// Report requests the log excerpt for its REPORT line alone, whose billed duration, memory and
+	// init duration are reported by the access log and the metrics. They are whenever the excerpt is
+	// requested.
+	Report bool `json:"report,omitempty"`
+}
+
+type logTail struct {
+	log    bool
+	header string
+}
+
+func newLogTail(config *LogTailConfig) *logTail {
+	if config == nil || (!config.Log && config.Header == "" && !config.Report) {
+		return nil
+	}
+
+	return &logTail{log: config.Log, header: http.CanonicalHeaderKey(config.Header)}
+}
+
+// invocationReport holds the figures of the REPORT line closing the logs of an invocation.
+type invocationReport struct {
+	durationMs       float64
+	billedDurationMs float64
+	memorySizeMB     int
+	maxMemoryUsedMB  int
+	// initDurationMs is only reported by the invocations initializing a new execution environment.
+	initDurationMs float64
+}
+
+// parseReport parses the REPORT line of the base64 encoded log excerpt of an invocation, returning
+// nil when the excerpt has none.
+func parseReport(logResult string) *invocationReport {
+	if logResult == "" {
+		return nil
+	}
+
+	excerpt, err := base64.StdEncoding.DecodeString(logResult)
+	if err != nil {
+		return nil
+	}
+
+	line := reportLine(string(excerpt))
+	if line == "" {
+		return nil
+	}
+
+	report := &invocationReport{}
+	for _, field := range strings.Split(strings.TrimPrefix(line, "REPORT "), "\t") {
+		name, value := field, ""
+		if i := strings.Index(field, ": "); i >= 0 {
+			name, value = field[:i], field[i+2:]
+		}
+
+		number := strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(value), " ms"), " MB"))
+		switch name {
+		case "Duration":
+			report.durationMs, _ = strconv.ParseFloat(number, 64)
+		case "Billed Duration":
+			report.billedDurationMs, _ = strconv.ParseFloat(number, 64)
+		case "Memory Size":
+			report.memorySizeMB, _ = strconv.Atoi(number)
+		case "Max Memory Used":
+			report.maxMemoryUsedMB, _ = strconv.Atoi(number)
+		case "Init Duration":
+			report.initDurationMs, _ = strconv.ParseFloat(number, 64)
+		}
+	}
+
+	return report
+}
+
+// reportLine returns the last REPORT line of the log excerpt, if any.
+func reportLine(excerpt string) string {
+	var line string
+	for _, l := range strings.Split(excerpt, "\n") {
+		if strings.HasPrefix(l, "REPORT ") {
+			line = l
+		}
+	}
+
+	return line
+}
+
+// capture decodes the log excerpt of the invocation, logging it or adding it to the response.
+func (t *logTail) capture(logger *logger, result *invokeOutput, resp *LambdaResponse) {
+	if result.LogResult == "" {
+		return
+	}
+
+	excerpt, err := base64.StdEncoding.DecodeString(result.LogResult)
+	if err != nil {
+		logger.warnf("invalid log tail [request id: %s]: %s", result.RequestID, err)
+		return
+	}
+
+	text := strings.TrimRight(string(excerpt), "\n")
+	if t.log {
+		logger.infof("function log tail [request id: %s]:\n%s", result.RequestID, text)
+	}
+
+	if t.header != "" {
+		if resp.Headers == nil {
+			resp.Headers = map[string]string{}
+		}
+
+		escaped := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\t", "\\t").Replace(text)
+		resp.Headers[t.header] = strings.Map(func(r rune) rune {
+			if r < 0x20 || r == 0x7f {
+				return -1
+			}
+
+			return r
+		}, escaped)
+	}
+}
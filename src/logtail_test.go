@@ -0,0 +1,115 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogTail(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "Tail", req.Header.Get("X-Amz-Log-Type"))
+
+		logs := "START RequestId: 1\r\nprocessing\tok\nEND RequestId: 1\n"
+		res.Header().Set("X-Amz-Log-Result", base64.StdEncoding.EncodeToString([]byte(logs)))
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.LogTail = &awslambdaplugin.LogTailConfig{Log: true, Header: "X-Lambda-Log-Tail"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, `START RequestId: 1\nprocessing\tok\nEND RequestId: 1`, recorder.Header().Get("X-Lambda-Log-Tail"))
+}
+
+func TestLogTailReport(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "Tail", req.Header.Get("X-Amz-Log-Type"))
+
+		logs := "START RequestId: 1 Version: 1\nEND RequestId: 1\n" +
+			"REPORT RequestId: 1\tDuration: 12.34 ms\tBilled Duration: 13 ms\tMemory Size: 128 MB\t" +
+			"Max Memory Used: 64 MB\tInit Duration: 150.5 ms\t\n"
+		res.Header().Set("X-Amz-Log-Result", base64.StdEncoding.EncodeToString([]byte(logs)))
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.LogTail = &awslambdaplugin.LogTailConfig{Report: true}
+	cfg.AccessLog = true
+	cfg.Metrics = &awslambdaplugin.MetricsConfig{Path: "/_metrics"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+
+	// The excerpt is neither logged nor forwarded.
+	assert.NotContains(t, buf.String(), "function log tail")
+	assert.Contains(t, buf.String(), `"billedDurationMs":13,"memorySizeMb":128,"maxMemoryUsedMb":64,"initDurationMs":150.5`)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/_metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	labels := `middleware="lambda-plugin",function="arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"`
+	assert.Contains(t, recorder.Body.String(), "traefik_lambda_cold_starts_total{"+labels+"} 1\n")
+	assert.Contains(t, recorder.Body.String(), "traefik_lambda_billed_duration_seconds_sum{"+labels+"} 0.013\n")
+	assert.Contains(t, recorder.Body.String(), "traefik_lambda_max_memory_used_megabytes_bucket{"+labels+`,le="128"} 1`+"\n")
+}
@@ -5,27 +5,330 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"reflect"
 	"strconv"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/lambda"
+	"strings"
+	"time"
 )
 
 // Config the plugin configuration.
+// String values can reference environment variables as ${VAR} or ${VAR:-default}.
 type Config struct {
-	AccessKey   string `json:"accessKey,omitempty"`
-	SecretKey   string `json:"secretKey,omitempty"`
+	AccessKey   string `json:"accessKey,omitempty" redact:"true"`
+	SecretKey   string `json:"secretKey,omitempty" redact:"true"`
 	Region      string `json:"region,omitempty"`
 	FunctionArn string `json:"functionArn,omitempty"`
 	Endpoint    string `json:"endpoint,omitempty"`
+
+	// FunctionURL forwards the requests as they are to a Lambda function URL (https://<url-id>.lambda-url.<region>.on.aws/)
+	// instead of invoking functionArn, which is then optional: no event envelope is involved and responses
+	// are streamed, as are the request bodies, honoring Expect: 100-continue. FunctionURLAuthType is AWS_IAM
+	// (default), signing the requests with an unsigned payload, or NONE.
+	FunctionURL         string `json:"functionUrl,omitempty"`
+	FunctionURLAuthType string `json:"functionUrlAuthType,omitempty"`
+
+	// StateMachineArn starts a synchronous execution of a Step Functions Express state machine
+	// (StartSyncExecution) instead of invoking functionArn, which is then optional. The execution input
+	// is the usual event and its output the response; failed executions are answered with a 502, timed
+	// out ones with a 504. StepFunctionsEndpoint overrides the sync-states endpoint of the region.
+	StateMachineArn       string `json:"stateMachineArn,omitempty"`
+	StepFunctionsEndpoint string `json:"stepFunctionsEndpoint,omitempty"`
+
+	// Publish sends the events of the requests to an SNS topic, an SQS queue or an EventBridge bus and
+	// answers with a 202 or a 204 right away. functionArn is optional when every request is published.
+	Publish *PublishConfig `json:"publish,omitempty"`
+
+	// InvocationType is RequestResponse (default) or Event: the function is invoked asynchronously and
+	// the EventResponse is returned right away, carrying the invocation request ID.
+	InvocationType string               `json:"invocationType,omitempty"`
+	EventResponse  *EventResponseConfig `json:"eventResponse,omitempty"`
+	// MethodInvocationTypes overrides InvocationType for the listed HTTP methods, e.g. {"POST": "Event"}
+	// for a webhook route while GET is answered synchronously. Event invocations are never streamed.
+	MethodInvocationTypes map[string]string `json:"methodInvocationTypes,omitempty"`
+
+	// ValidateFunction checks in New that the function exists (GetFunctionConfiguration) and may be
+	// invoked with the configured credentials (DryRun invocation), failing fast on a misconfiguration.
+	ValidateFunction bool `json:"validateFunction,omitempty"`
+
+	// HealthCheck periodically performs DryRun invocations, until the context given to New is done,
+	// to detect permission or network problems before the real traffic fails.
+	HealthCheck *HealthCheckConfig `json:"healthCheck,omitempty"`
+
+	// MaxRequestBodyBytes rejects with a 413 the requests whose body exceeds it, before it is buffered.
+	MaxRequestBodyBytes int64 `json:"maxRequestBodyBytes,omitempty"`
+
+	// S3Offload uploads the request bodies over a threshold to S3 and passes the function a presigned
+	// URL of the object instead (bodyUrl event key), enabling uploads over the invocation payload limit.
+	S3Offload *S3OffloadConfig `json:"s3Offload,omitempty"`
+
+	// Warmer periodically invokes the function with a no-op event, until the context given to New is
+	// done, to reduce the cold starts hit by the user traffic.
+	Warmer *WarmerConfig `json:"warmer,omitempty"`
+
+	// ResponseStreaming invokes the function with InvokeWithResponseStream and forwards the response
+	// as it is produced. Functions streaming an HTTP response start with a JSON metadata prelude
+	// (statusCode, headers, cookies) followed by 8 NUL bytes, as for the function URLs.
+	ResponseStreaming bool `json:"responseStreaming,omitempty"`
+
+	// LogTail requests the last 4 KB of the function log (LogType=Tail) of the synchronous,
+	// non-streamed invocations, to log it or return it in a debug response header.
+	LogTail *LogTailConfig `json:"logTail,omitempty"`
+
+	// DeniedResponseHeaders are removed from the function responses, along with the hop-by-hop
+	// headers and the Content-Length headers not matching the body, always removed.
+	DeniedResponseHeaders []string `json:"deniedResponseHeaders,omitempty"`
+
+	// LenientBase64 forwards as is the response bodies flagged isBase64Encoded that are not valid
+	// base64, instead of answering 502.
+	LenientBase64 bool `json:"lenientBase64,omitempty"`
+
+	// DefaultStatusCode is the status of the function responses without statusCode (default 200).
+	// Responses with a status code out of the 100-599 range are answered with a 502.
+	DefaultStatusCode int `json:"defaultStatusCode,omitempty"`
+
+	// Log configures the level, the format and the destination of the logs.
+	Log *LogConfig `json:"log,omitempty"`
+
+	// SlowRequestThreshold logs a warning, with the time spent reading and marshaling the request,
+	// invoking the function, decoding and writing the response, for the requests lasting longer.
+	SlowRequestThreshold string `json:"slowRequestThreshold,omitempty"`
+
+	// AccessLog logs a structured line per proxied request: method, path, function and qualifier,
+	// Lambda request ID, status, duration, request, payload and response sizes and error code.
+	AccessLog bool `json:"accessLog,omitempty"`
+
+	// AccessLogSampling logs a percentage of the access log lines, by outcome.
+	AccessLogSampling *AccessLogSamplingConfig `json:"accessLogSampling,omitempty"`
+
+	// FunctionErrorDetails includes the error type and message of failed functions in the 502 response
+	// body. The full error payload is always logged.
+	FunctionErrorDetails bool `json:"functionErrorDetails,omitempty"`
+
+	// Qualifier is the version or alias (e.g. live) to invoke, so that it is not baked into functionArn.
+	// Like functionArn, it can reference a parameter (ssm:///app/active-alias) refreshed in background,
+	// so that blue/green deployments flip the traffic by updating it.
+	Qualifier string `json:"qualifier,omitempty"`
+
+	// UseFIPSEndpoint resolves the FIPS 140-2 validated Lambda and STS endpoints (lambda-fips.<region>.amazonaws.com).
+	// Ignored for explicitly configured endpoints. Defaults to AWS_USE_FIPS_ENDPOINT.
+	UseFIPSEndpoint *bool `json:"useFipsEndpoint,omitempty"`
+
+	// SigningAlgorithm of the Lambda requests: sigv4 (default) or sigv4a, whose signatures are valid in
+	// every region of SigningRegionSet (default "*"), as required by multi-region targets.
+	SigningAlgorithm string   `json:"signingAlgorithm,omitempty"`
+	SigningRegionSet []string `json:"signingRegionSet,omitempty"`
+
+	// TLS configures the client used to reach the Lambda and STS endpoints.
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// ProxyURL is an egress proxy for the Lambda and STS calls (http, https or socks5), replacing the
+	// HTTPS_PROXY/NO_PROXY environment. NoProxy lists the hosts reached directly.
+	ProxyURL string   `json:"proxyUrl,omitempty" redact:"true"`
+	NoProxy  []string `json:"noProxy,omitempty"`
+	// Transport tunes the connections of the client used to reach the Lambda and STS endpoints.
+	Transport *TransportConfig `json:"transport,omitempty"`
+
+	// SessionToken accompanies temporary (STS-issued) access keys given in accessKey/secretKey.
+	SessionToken string `json:"sessionToken,omitempty" redact:"true"`
+
+	// AccessKeyFile, SecretKeyFile, SessionTokenFile and ExternalIDFile read the matching secret
+	// from a file (e.g. a mounted Kubernetes or Docker secret) instead of the dynamic configuration.
+	AccessKeyFile    string `json:"accessKeyFile,omitempty"`
+	SecretKeyFile    string `json:"secretKeyFile,omitempty"`
+	SessionTokenFile string `json:"sessionTokenFile,omitempty"`
+	ExternalIDFile   string `json:"externalIdFile,omitempty"`
+
+	// RoleArn is an IAM role assumed through STS before invoking the function.
+	RoleArn         string `json:"roleArn,omitempty"`
+	ExternalID      string `json:"externalId,omitempty" redact:"true"`
+	RoleSessionName string `json:"roleSessionName,omitempty"`
+	// AccountRoleName is a role assumed in the account owning the function (taken from functionArn), so
+	// a single shared-services identity can invoke functions of many accounts. When roleArn is also set,
+	// the account role is assumed with the roleArn credentials (role chaining).
+	AccountRoleName string `json:"accountRoleName,omitempty"`
+	// AccountRoles maps account IDs to the role ARN to assume in them, overriding accountRoleName.
+	AccountRoles map[string]string `json:"accountRoles,omitempty"`
+	// STSEndpoint overrides the STS endpoint used to assume the role (e.g. a VPC endpoint).
+	STSEndpoint string `json:"stsEndpoint,omitempty"`
+	// STSRegionalEndpoints selects the global (legacy, default) or the regional (regional) STS endpoint.
+	// Defaults to AWS_STS_REGIONAL_ENDPOINTS.
+	STSRegionalEndpoints string `json:"stsRegionalEndpoints,omitempty"`
+
+	// CredentialProcess is an external command printing the credentials as JSON, with the
+	// same contract as the credential_process shared config directive.
+	CredentialProcess string `json:"credentialProcess,omitempty"`
+
+	// Profile selects a named profile of the shared credentials and config files.
+	// When set, the profile is the only source of credentials besides the accessKey/secretKey pair.
+	Profile string `json:"profile,omitempty"`
+
+	// KMS decrypts the secrets given as "kms:<base64 ciphertext blob>" at startup, so that the dynamic
+	// configuration never contains them in plaintext. KMS is called with the ambient credentials
+	// (credentialProcess, profile or the default chain), never with the encrypted keys.
+	KMS *KMSConfig `json:"kms,omitempty"`
+
+	// Parameters configures the lookup of functionArn, qualifier, accessKey, secretKey and
+	// sessionToken values given as ssm:///path or secretsmanager://name[#jsonKey] references.
+	Parameters *ParametersConfig `json:"parameters,omitempty"`
+
+	// CredentialsCache tunes the caching and background refresh of the resolved credentials.
+	CredentialsCache *CredentialsCacheConfig `json:"credentialsCache,omitempty"`
+
+	// IMDS configures the EC2 instance profile credentials, used when no other credentials are found.
+	IMDS *IMDSConfig `json:"imds,omitempty"`
+
+	// MultiValueHeadersEnabled reproduces the ALB target group attribute: when true every header and
+	// query parameter is sent in the multi-value maps, when false in the single-value maps (last value wins).
+	// When unset, the compat map population applies.
+	MultiValueHeadersEnabled *bool `json:"multiValueHeadersEnabled,omitempty"`
+
+	// CompatLevel presets the behavior-compatibility switches: v1 (default) keeps the historical
+	// behavior, v2 mirrors the events sent by an ALB. Compat overrides single switches.
+	CompatLevel string        `json:"compatLevel,omitempty"`
+	Compat      *CompatConfig `json:"compat,omitempty"`
+
+	// EventEncoding selects the event serialization: json (default), cbor or msgpack.
+	// Binary encodings carry the body as raw bytes and are announced to the function
+	// through the "eventEncoding" key of the ClientContext custom map. As the Invoke API
+	// only accepts JSON, the binary event is sent base64 encoded in the "payload" field of
+	// a {"eventEncoding": ..., "payload": ...} object, which the function must decode.
+	EventEncoding string `json:"eventEncoding,omitempty"`
+
+	// InvokeTimeout bounds every invocation, so hung functions cannot pin the proxy (default 15m,
+	// the maximum function timeout). With auto, it is read from the function configuration in New
+	// and extended by InvokeTimeoutMargin (default 1s).
+	InvokeTimeout       string `json:"invokeTimeout,omitempty"`
+	InvokeTimeoutMargin string `json:"invokeTimeoutMargin,omitempty"`
+
+	// Retry retries the invocations failed because of throttling or transient service errors.
+	Retry *RetryConfig `json:"retry,omitempty"`
+	// RetryOnStatus also retries, with the attempts and delays of Retry, the GET, HEAD, OPTIONS and
+	// TRACE requests the function answers with one of these 5xx status codes, e.g. [502, 503].
+	RetryOnStatus []int `json:"retryOnStatus,omitempty"`
+
+	// CircuitBreaker answers right away, without invoking the function, while it keeps failing.
+	CircuitBreaker *CircuitBreakerConfig `json:"circuitBreaker,omitempty"`
+
+	// MaxConcurrentInvocations caps the in-flight invocations of the middleware, so that a single route
+	// cannot use up the account concurrency nor buffer unbounded request bodies. Requests over the limit
+	// wait up to ConcurrencyQueueTimeout for a free slot; unset rejects them right away with a 503.
+	MaxConcurrentInvocations int    `json:"maxConcurrentInvocations,omitempty"`
+	ConcurrencyQueueTimeout  string `json:"concurrencyQueueTimeout,omitempty"`
+	// AdaptiveConcurrency lowers the limit below MaxConcurrentInvocations while the function is
+	// throttled or slow, and raises it back as the invocations succeed.
+	AdaptiveConcurrency *AdaptiveConcurrencyConfig `json:"adaptiveConcurrency,omitempty"`
+
+	// Hedging sends a second invocation for the idempotent requests still pending after a delay.
+	Hedging *HedgingConfig `json:"hedging,omitempty"`
+
+	// Coalescing shares one invocation between the concurrent identical GET requests.
+	Coalescing *CoalescingConfig `json:"coalescing,omitempty"`
+
+	// Cache serves the repeated GET and HEAD requests from the fresh responses of the function.
+	Cache *CacheConfig `json:"cache,omitempty"`
+
+	// ETag adds a strong ETag, computed over the decoded body, to the 200 responses of the function
+	// that have none, and answers the GET and HEAD requests whose If-None-Match matches with a 304
+	// Not Modified, without the body. Streamed responses are left as is.
+	ETag bool `json:"etag,omitempty"`
+
+	// ClientContext is passed to the function on every invocation; values can reference the
+	// request headers as {header:Name}.
+	ClientContext *ClientContextConfig `json:"clientContext,omitempty"`
+
+	// IdempotencyKey propagates or generates an idempotency key header for every event.
+	IdempotencyKey *IdempotencyKeyConfig `json:"idempotencyKey,omitempty"`
+
+	// TimeoutHeader names a request header (e.g. X-Invoke-Timeout-Ms) through which callers can
+	// shorten the invoke deadline, in milliseconds. The header is never forwarded to the function.
+	TimeoutHeader string `json:"timeoutHeader,omitempty"`
+	// MaxTimeoutOverride caps the deadline requested through TimeoutHeader.
+	MaxTimeoutOverride string `json:"maxTimeoutOverride,omitempty"`
+	// TimeoutHeaderTrustedIPs restricts TimeoutHeader to clients in these IPs or CIDR ranges.
+	TimeoutHeaderTrustedIPs []string `json:"timeoutHeaderTrustedIps,omitempty"`
+
+	// FallbackFunctionArn is invoked in place of the function when its invocation fails (error,
+	// throttling, timeout, function error or open circuit), e.g. a warm standby or degraded-mode handler.
+	FallbackFunctionArn string `json:"fallbackFunctionArn,omitempty"`
+
+	// ErrorPages replaces the bodies of the error responses by class of failure.
+	ErrorPages *ErrorPagesConfig `json:"errorPages,omitempty"`
+
+	// ErrorStatusCodes maps the categories of failed invocations (ResourceNotFound, AccessDenied,
+	// Unhandled, Handled, Throttled, Timeout) to the status codes of their responses, 502 or 503 when
+	// unset.
+	ErrorStatusCodes map[string]int `json:"errorStatusCodes,omitempty"`
+
+	// ErrorFormat of the error response bodies: text (default) or json, machine-readable bodies
+	// ({"error":"lambda_invoke_failed","requestId":"..."}) for the API consumers. The error pages
+	// take precedence.
+	ErrorFormat string `json:"errorFormat,omitempty"`
+
+	// OnError selects how failed invocations are answered: fail (default) returns the error response,
+	// continue passes the original request to the next handler, e.g. a static or alternative backend
+	// (not supported with functionUrl, whose request bodies are streamed).
+	OnError string `json:"onError,omitempty"`
+
+	// Mirror asynchronously invokes a second function with a copy of every event, ignoring its outcome.
+	Mirror *MirrorConfig `json:"mirror,omitempty"`
+
+	// Canary sends a percentage of the requests to another version or alias of the function.
+	Canary *CanaryConfig `json:"canary,omitempty"`
+
+	// LatencyRouting invokes the regional replica of the function with the lowest observed latency.
+	LatencyRouting *LatencyRoutingConfig `json:"latencyRouting,omitempty"`
+
+	// FunctionOverride selects another function for the requests carrying an allowlisted header value.
+	FunctionOverride *FunctionOverrideConfig `json:"functionOverride,omitempty"`
+
+	// MapIPv4MappedAddresses renders IPv4-mapped IPv6 client addresses (::ffff:a.b.c.d) as plain IPv4
+	// in the event source IP and X-Forwarded-For header, set with the normalized compat clientAddress.
+	MapIPv4MappedAddresses bool `json:"mapIpv4MappedAddresses,omitempty"`
+
+	// SLO tracks the availability and latency objectives of the requests, exposing their error
+	// budget burn rates.
+	SLO *SLOConfig `json:"slo,omitempty"`
+
+	// Metrics exposes the invocation counters and histograms in Prometheus text format.
+	Metrics *MetricsConfig `json:"metrics,omitempty"`
+
+	// PropagateRequestID copies the Lambda request ID of the invocations to the X-Amzn-RequestId
+	// response header, or to RequestIDHeader when set.
+	PropagateRequestID bool   `json:"propagateRequestId,omitempty"`
+	RequestIDHeader    string `json:"requestIdHeader,omitempty"`
+
+	// DebugHeaders adds the X-Lambda-Request-Id, X-Lambda-Duration-Ms and X-Lambda-Executed-Version
+	// headers to the responses of the invocations. Meant for debugging: it discloses them to the clients.
+	DebugHeaders bool `json:"debugHeaders,omitempty"`
+
+	// XRayTracing propagates the X-Amzn-Trace-Id header of the requests to the invocations, and to
+	// the events, generating a trace ID when missing, so that the function segments join the trace.
+	XRayTracing bool `json:"xrayTracing,omitempty"`
+
+	// DatadogTracing forwards the x-datadog-trace-id and x-datadog-parent-id headers to the function,
+	// generating them when missing, so that dd-trace instrumented functions join the APM trace. With
+	// Tracing, they identify the invocation span.
+	DatadogTracing bool `json:"datadogTracing,omitempty"`
+
+	// Audit records who invoked which function and when to a dedicated file or syslog server.
+	Audit *AuditConfig `json:"audit,omitempty"`
+
+	// EMF writes the invocation metrics in CloudWatch Embedded Metric Format.
+	EMF *EMFConfig `json:"emf,omitempty"`
+
+	// StatsD pushes the invocation metrics to a StatsD server or a Datadog agent.
+	StatsD *StatsDConfig `json:"statsd,omitempty"`
+
+	// TraceContext forwards the W3C traceparent and tracestate headers to the function, generating
+	// a traceparent when missing. With Tracing, the traceparent is the one of the invocation span.
+	TraceContext bool `json:"traceContext,omitempty"`
+
+	// Tracing exports a span per invocation over OTLP.
+	Tracing *TracingConfig `json:"tracing,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration.
@@ -39,22 +342,89 @@ func CreateConfig() *Config {
 
 // AwsLambdaPlugin plugin main struct.
 type AwsLambdaPlugin struct {
-	next        http.Handler
-	functionArn string
-	name        string
-	client      *lambda.Lambda
+	next          http.Handler
+	function      *parameterValue
+	qualifier     *parameterValue
+	event         *eventResponse
+	types         invocationTypes
+	health        *healthChecker
+	warm          *warmer
+	name          string
+	logger        *logger
+	client        *lambdaClient
+	compat        CompatConfig
+	codec         eventCodec
+	clientContext *clientContextTemplate
+	slo           *sloTracker
+	metrics       *invocationMetrics
+	tracer        *tracer
+	emf           *emfEmitter
+	statsd        *statsdExporter
+	audit         *auditLog
+	unmapIPv4     bool
+
+	invokeTimeout        time.Duration
+	timeoutOverride      *timeoutOverride
+	functionOverride     *functionOverride
+	canary               *canaryRouting
+	latency              *latencyRouter
+	offload              *s3Offloader
+	functionURL          *functionURLBackend
+	stateMachine         *stateMachineBackend
+	publisher            *publisher
+	mirror               *trafficMirror
+	idempotency          *idempotencyKey
+	fallback             string
+	continueOnError      bool
+	errorPages           errorPages
+	errorStatusCodes     errorStatusCodes
+	jsonErrors           bool
+	retry                *retryPolicy
+	breaker              *circuitBreaker
+	limiter              *concurrencyLimiter
+	hedging              *hedgingPolicy
+	coalescer            *requestCoalescer
+	cache                *responseCache
+	etag                 bool
+	functionErrorDetails bool
+	defaultStatusCode    int
+	maxBodyBytes         int64
+	lenientBase64        bool
+	accessLog            bool
+	accessLogSampler     *logSampler
+	slowThreshold        time.Duration
+	xray                 bool
+	datadog              bool
+	traceContext         bool
+	debugHeaders         bool
+	requestIDHeader      string
+	deniedHeaders        []string
+	streaming            bool
+	logTail              *logTail
 }
 
 // LambdaRequest represents a request to send to lambda.
 type LambdaRequest struct {
-	HTTPMethod                      string              `json:"httpMethod"`
-	Path                            string              `json:"path"`
-	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
-	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
-	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
-	Headers                         map[string]string   `json:"headers"`
-	Body                            string              `json:"body"`
-	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+	HTTPMethod                      string                `json:"httpMethod"`
+	Path                            string                `json:"path"`
+	QueryStringParameters           map[string]string     `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string   `json:"multiValueQueryStringParameters"`
+	MultiValueHeaders               map[string][]string   `json:"multiValueHeaders"`
+	Headers                         map[string]string     `json:"headers"`
+	Body                            string                `json:"body"`
+	IsBase64Encoded                 bool                  `json:"isBase64Encoded"`
+	BodyURL                         string                `json:"bodyUrl,omitempty"`
+	RequestContext                  *LambdaRequestContext `json:"requestContext,omitempty"`
+}
+
+// LambdaRequestContext carries the request metadata of the event.
+type LambdaRequestContext struct {
+	Identity LambdaRequestIdentity `json:"identity"`
+}
+
+// LambdaRequestIdentity describes the client that sent the request.
+type LambdaRequestIdentity struct {
+	SourceIP string `json:"sourceIp"`
 }
 
 // LambdaResponse represents a response to a lambda HTTP request from LB.
@@ -67,66 +437,890 @@ type LambdaResponse struct {
 	Body              string              `json:"body"`
 }
 
+// awsSetup the region, the credentials and the HTTP client shared by the AWS clients of the middleware.
+type awsSetup struct {
+	region     string
+	profile    string
+	httpClient *http.Client
+	cache      cacheOptions
+	creds      *lazyCredentials
+}
+
 // New created a new AwsLambdaPlugin plugin.
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
-	if len(config.FunctionArn) == 0 {
-		return nil, fmt.Errorf("function arn cannot be empty")
+	config, err := interpolateConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err = resolveSecretFiles(config)
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := newLogger(name, config.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBackends(config); err != nil {
+		return nil, err
+	}
+
+	setup, err := newAWSSetup(logger, config)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err = decryptKMSSecrets(ctx, config, setup.region, setup.profile, setup.httpClient, setup.cache)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AwsLambdaPlugin{
+		next:                 next,
+		name:                 name,
+		logger:               logger,
+		unmapIPv4:            config.MapIPv4MappedAddresses,
+		etag:                 config.ETag,
+		functionErrorDetails: config.FunctionErrorDetails,
+		maxBodyBytes:         config.MaxRequestBodyBytes,
+		lenientBase64:        config.LenientBase64,
+		accessLog:            config.AccessLog,
+		xray:                 config.XRayTracing,
+		datadog:              config.DatadogTracing,
+		traceContext:         config.TraceContext,
+		debugHeaders:         config.DebugHeaders,
+		requestIDHeader:      requestIDHeader(config),
+		deniedHeaders:        config.DeniedResponseHeaders,
+		streaming:            config.ResponseStreaming,
+		logTail:              newLogTail(config.LogTail),
+	}
+
+	// The audit log connects to syslog, the StatsD exporter dials and the metrics listen, last, once
+	// the configuration is known to be valid.
+	for _, build := range []func(context.Context, *Config, *awsSetup) error{
+		a.buildClients, a.buildBackends, a.buildEvents, a.buildResilience, a.buildResponses,
+		a.buildRouting, a.buildProbes, a.buildObservability, a.buildExporters,
+	} {
+		if err := build(ctx, config, setup); err != nil {
+			return nil, err
+		}
+	}
+
+	reportConfigReload(logger, config)
+	a.start(ctx, setup.creds)
+
+	return a, nil
+}
+
+// checkBackends checks a single backend of the requests is configured, along with its options.
+func checkBackends(config *Config) error {
+	publishOnly := config.Publish != nil && len(config.Publish.Methods) == 0
+	if len(config.FunctionArn) == 0 && config.FunctionURL == "" && config.StateMachineArn == "" && !publishOnly {
+		return fmt.Errorf("function arn cannot be empty")
+	}
+
+	if config.FunctionURL != "" && config.StateMachineArn != "" {
+		return fmt.Errorf("functionUrl and stateMachineArn are mutually exclusive")
+	}
+
+	if config.FunctionURL != "" {
+		if err := checkFunctionURLOptions(config); err != nil {
+			return err
+		}
+	}
+
+	if config.StateMachineArn != "" {
+		return checkInvokeOptions(config, "stateMachineArn")
+	}
+
+	return nil
+}
+
+func newAWSSetup(logger *logger, config *Config) (*awsSetup, error) {
+	profile := config.Profile
+	if profile == "" {
+		profile = envProfile()
+	}
+
+	region, err := configRegion(config, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := newCacheOptions(config.CredentialsCache)
+	if err != nil {
+		return nil, err
+	}
+	cache.logger = logger
+
+	httpClient, err := sharedHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &awsSetup{region: region, profile: profile, httpClient: httpClient, cache: cache}, nil
+}
+
+// configRegion returns the region of the middleware: the configured one, defaulting to the region of
+// the function, the function URL or the state machine, then to the environment and profile one.
+func configRegion(config *Config, profile string) (string, error) {
+	region := config.Region
+
+	// Referenced function ARNs are validated once resolved, with the region known.
+	if config.FunctionArn != "" && !isParameterRef(config.FunctionArn) {
+		fn, err := parseFunctionArn(config.FunctionArn)
+		if err != nil {
+			return "", err
+		}
+
+		if region, err = functionRegion(region, fn); err != nil {
+			return "", err
+		}
+
+		if !isParameterRef(config.Qualifier) {
+			if err := checkQualifier(config.Qualifier, fn); err != nil {
+				return "", err
+			}
+		}
 	}
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	if region == "" && config.FunctionURL != "" {
+		region = functionURLRegion(config.FunctionURL)
+	}
 
-	var region *string
-	if len(config.Region) > 0 {
-		region = aws.String(config.Region)
+	if config.StateMachineArn != "" {
+		var err error
+		if region, err = stateMachineRegion(region, config.StateMachineArn); err != nil {
+			return "", err
+		}
 	}
 
-	var endpoint *string
-	if len(config.Endpoint) > 0 {
-		endpoint = aws.String(config.Endpoint)
+	region = resolveRegion(region, profile)
+	if len(region) == 0 {
+		return "", fmt.Errorf("region cannot be empty")
 	}
 
-	var creds *credentials.Credentials
+	return region, nil
+}
+
+// buildClients resolves the function and the credentials, building the Lambda client.
+func (a *AwsLambdaPlugin) buildClients(ctx context.Context, config *Config, setup *awsSetup) error {
+	var (
+		params *parameterClient
+		err    error
+	)
+	if hasParameterRefs(config) {
+		params, err = newParameterClient(config, setup.region, setup.profile, setup.httpClient, setup.cache)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.function, a.qualifier, err = newFunctionValue(ctx, params, config, setup.region); err != nil {
+		return err
+	}
+
+	static, staticKey, err := staticConfigCredentials(ctx, config, params)
+	if err != nil {
+		return err
+	}
+
+	// The clients sign with the credentials chain built on first use, not to slow the plugin load down.
+	setup.creds = newLazyCredentials(func() (credentialsProvider, error) {
+		source, sourceKey := static, staticKey
+		if source == nil {
+			var err error
+			source, sourceKey, err = sharedAmbientCredentials(config, setup.profile, setup.cache)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return sharedRoleCredentials(config, setup.region, source, sourceKey, setup.httpClient, setup.cache)
+	})
+
+	if a.client, err = newLambdaClient(config, setup.region, config.Endpoint, setup.creds, setup.httpClient); err != nil {
+		return err
+	}
+
+	if config.ValidateFunction && config.FunctionArn != "" {
+		return validateFunction(ctx, a.client, a.function.get(), a.qualifier.get())
+	}
+
+	return nil
+}
+
+// staticConfigCredentials returns the configured static credentials, if any, and their sharing key.
+func staticConfigCredentials(ctx context.Context, config *Config, params *parameterClient) (credentialsProvider, string, error) {
 	if len(config.AccessKey) > 0 && len(config.SecretKey) > 0 {
-		creds = credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, "")
+		static, err := newConfigCredentials(ctx, config, params)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return static, staticCredentialsKey(static), nil
+	}
+
+	if len(config.SessionToken) > 0 {
+		return nil, "", fmt.Errorf("session token requires both access key and secret key")
+	}
+
+	return nil, "", nil
+}
+
+// buildBackends builds the function URL, state machine and publish backends, the traffic mirror and
+// the S3 offload of the request bodies.
+func (a *AwsLambdaPlugin) buildBackends(_ context.Context, config *Config, setup *awsSetup) error {
+	var err error
+	if config.FunctionURL != "" {
+		if a.functionURL, err = newFunctionURLBackend(config, setup.region, setup.creds, setup.httpClient); err != nil {
+			return err
+		}
+	}
+
+	if config.StateMachineArn != "" {
+		if a.stateMachine, err = newStateMachineBackend(config, setup.region, setup.creds, setup.httpClient); err != nil {
+			return err
+		}
+	}
+
+	if config.Publish != nil {
+		if config.EventEncoding != "" && config.EventEncoding != encodingJSON {
+			return fmt.Errorf("publish requires the %s event encoding", encodingJSON)
+		}
+
+		if a.publisher, err = newPublisher(config.Publish, setup.region, setup.creds, setup.httpClient); err != nil {
+			return err
+		}
+	}
+
+	if config.Mirror != nil {
+		if a.mirror, err = newTrafficMirror(a.logger, config.Mirror, setup.region, a.client); err != nil {
+			return err
+		}
+	}
+
+	if config.S3Offload != nil {
+		a.offload, err = newS3Offloader(config, setup.region, setup.creds, setup.httpClient)
+	}
+
+	return err
+}
+
+// buildEvents builds the encoding of the events and the invocation options.
+func (a *AwsLambdaPlugin) buildEvents(ctx context.Context, config *Config, setup *awsSetup) error {
+	var err error
+	if a.compat, err = resolveCompat(config); err != nil {
+		return err
 	}
 
-	client := lambda.New(sess, &aws.Config{
-		Region:      region,
-		Endpoint:    endpoint,
-		Credentials: creds,
+	if a.codec, err = newEventCodec(config.EventEncoding); err != nil {
+		return err
+	}
+
+	if a.clientContext, err = newClientContextTemplate(idempotencyClientContext(config), a.codec.name()); err != nil {
+		return err
+	}
+
+	if a.types, err = newInvocationTypes(config); err != nil {
+		return err
+	}
+
+	if a.event, err = newEventResponse(config, a.types); err != nil {
+		return err
+	}
+
+	a.invokeTimeout, err = resolveInvokeTimeout(ctx, a.logger, config, a.client, a.function.get(), a.qualifier.get())
+	if err != nil {
+		return err
+	}
+
+	if a.timeoutOverride, err = newTimeoutOverride(config); err != nil {
+		return err
+	}
+
+	a.fallback, err = newFallbackFunction(config.FallbackFunctionArn, setup.region)
+
+	return err
+}
+
+// buildResilience builds the retries, the circuit breaker, the concurrency limiter, the hedging,
+// the coalescing and the response cache.
+func (a *AwsLambdaPlugin) buildResilience(_ context.Context, config *Config, _ *awsSetup) error {
+	var err error
+	if a.retry, err = newRetryPolicy(config.Retry, config.RetryOnStatus); err != nil {
+		return err
+	}
+
+	if config.CircuitBreaker != nil {
+		if a.breaker, err = newCircuitBreaker(a.logger, config.CircuitBreaker); err != nil {
+			return err
+		}
+	}
+
+	if a.limiter, err = newConcurrencyLimiter(config); err != nil {
+		return err
+	}
+
+	if a.hedging, err = newHedgingPolicy(config.Hedging); err != nil {
+		return err
+	}
+
+	if config.Coalescing != nil {
+		a.coalescer = newRequestCoalescer(config.Coalescing)
+	}
+
+	if config.Cache != nil {
+		a.cache, err = newResponseCache(config.Cache)
+	}
+
+	return err
+}
+
+// buildResponses builds the handling of the request bodies, the responses and the errors.
+func (a *AwsLambdaPlugin) buildResponses(_ context.Context, config *Config, _ *awsSetup) error {
+	if config.MaxRequestBodyBytes < 0 {
+		return fmt.Errorf("max request body bytes cannot be negative")
+	}
+
+	a.defaultStatusCode = config.DefaultStatusCode
+	if a.defaultStatusCode == 0 {
+		a.defaultStatusCode = http.StatusOK
+	}
+	if a.defaultStatusCode < 100 || a.defaultStatusCode > 599 {
+		return fmt.Errorf("invalid default status code %d", config.DefaultStatusCode)
+	}
+
+	var err error
+	if a.continueOnError, err = parseOnError(config.OnError); err != nil {
+		return err
+	}
+
+	if a.errorPages, err = newErrorPages(config.ErrorPages); err != nil {
+		return err
+	}
+
+	if a.errorStatusCodes, err = newErrorStatusCodes(config.ErrorStatusCodes); err != nil {
+		return err
+	}
+
+	a.jsonErrors, err = parseErrorFormat(config.ErrorFormat)
+
+	return err
+}
+
+// buildRouting builds the idempotency key, the canary, the function override and the latency routing.
+func (a *AwsLambdaPlugin) buildRouting(_ context.Context, config *Config, setup *awsSetup) error {
+	if config.IdempotencyKey != nil {
+		a.idempotency = newIdempotencyKey(config.IdempotencyKey)
+	}
+
+	var err error
+	if config.Canary != nil {
+		if a.canary, err = newCanaryRouting(config.Canary, config.FunctionArn); err != nil {
+			return err
+		}
+	}
+
+	if config.FunctionOverride != nil {
+		if a.functionOverride, err = newFunctionOverride(config.FunctionOverride, setup.region); err != nil {
+			return err
+		}
+	}
+
+	if config.LatencyRouting == nil {
+		return nil
+	}
+
+	newClient := func(region, endpoint string) (*lambdaClient, error) {
+		return newLambdaClient(config, region, endpoint, setup.creds, setup.httpClient)
+	}
+
+	a.latency, err = newLatencyRouter(a.logger, config, setup.region, a.client, newClient, func(ctx context.Context, c *lambdaClient, fn string) error {
+		if fn == "" {
+			fn = a.function.get()
+		}
+
+		_, err := c.invoke(ctx, &invokeInput{
+			FunctionName:   fn,
+			Qualifier:      a.qualifier.get(),
+			InvocationType: invocationTypeDryRun,
+		})
+
+		return err
 	})
 
-	return &AwsLambdaPlugin{
-		functionArn: config.FunctionArn,
-		client:      client,
-		next:        next,
-		name:        name,
-	}, nil
+	return err
+}
+
+// buildProbes builds the health check and the warmer of the function.
+func (a *AwsLambdaPlugin) buildProbes(_ context.Context, config *Config, _ *awsSetup) error {
+	var err error
+	if config.HealthCheck != nil {
+		a.health, err = newHealthChecker(a.logger, config.HealthCheck, func(ctx context.Context) error {
+			_, err := a.client.invoke(ctx, &invokeInput{
+				FunctionName:   a.function.get(),
+				Qualifier:      a.qualifier.get(),
+				InvocationType: invocationTypeDryRun,
+			})
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Warmer != nil {
+		a.warm, err = newWarmer(a.logger, config.Warmer, a.invokeTimeout, func(ctx context.Context, payload []byte) error {
+			result, err := a.client.invoke(ctx, &invokeInput{
+				FunctionName: a.function.get(),
+				Qualifier:    a.qualifier.get(),
+				Payload:      payload,
+			})
+			if err == nil && result.FunctionError != "" {
+				err = functionError(result)
+			}
+
+			return err
+		})
+	}
+
+	return err
+}
+
+// buildObservability builds the SLO tracking, the logging of the requests, the EMF metrics and the tracing.
+func (a *AwsLambdaPlugin) buildObservability(_ context.Context, config *Config, _ *awsSetup) error {
+	var err error
+	if config.SLO != nil {
+		if a.slo, err = newSLOTracker(a.logger, config.SLO); err != nil {
+			return err
+		}
+	}
+
+	a.slowThreshold, err = parseDurationDefault(config.SlowRequestThreshold, 0)
+	if err != nil || a.slowThreshold < 0 {
+		return fmt.Errorf("invalid slow request threshold %q", config.SlowRequestThreshold)
+	}
+
+	if a.accessLogSampler, err = newAccessLogSampler(config); err != nil {
+		return err
+	}
+
+	if config.EMF != nil {
+		if a.emf, err = newEMFEmitter(a.name, config.EMF); err != nil {
+			return err
+		}
+	}
+
+	if config.Tracing != nil {
+		a.tracer, err = newTracer(a.logger, config.Tracing)
+	}
+
+	return err
+}
+
+// newAccessLogSampler returns the access log sampler, nil without sampling.
+func newAccessLogSampler(config *Config) (*logSampler, error) {
+	if config.AccessLogSampling == nil {
+		return nil, nil
+	}
+
+	if !config.AccessLog {
+		return nil, fmt.Errorf("access log sampling requires access log")
+	}
+
+	return newLogSampler(config.AccessLogSampling)
+}
+
+// buildExporters builds the audit log, the StatsD exporter and the metrics.
+func (a *AwsLambdaPlugin) buildExporters(ctx context.Context, config *Config, _ *awsSetup) error {
+	var err error
+	if config.Audit != nil {
+		if a.audit, err = newAuditLog(a.logger, config.Audit); err != nil {
+			return err
+		}
+	}
+
+	if config.StatsD != nil {
+		if a.statsd, err = newStatsDExporter(a.logger, config.StatsD); err != nil {
+			return err
+		}
+	}
+
+	if config.Metrics != nil {
+		a.metrics, err = newInvocationMetrics(ctx, a.logger, config.Metrics, a.breaker)
+	}
+
+	return err
+}
+
+// start runs the background tasks of the middleware until the context is done.
+func (a *AwsLambdaPlugin) start(ctx context.Context, creds *lazyCredentials) {
+	go creds.warmUp(ctx, a.logger)
+
+	if a.health != nil {
+		go a.health.run(ctx)
+	}
+
+	if a.warm != nil {
+		go a.warm.run(ctx)
+	}
+
+	if a.latency != nil {
+		go a.latency.run(ctx)
+	}
+
+	if a.tracer != nil {
+		go a.tracer.run(ctx)
+	}
 }
 
 func (a *AwsLambdaPlugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	base64Encoded, body := bodyToBase64(req)
-	resp := a.invokeFunction(LambdaRequest{
-		HTTPMethod:                      req.Method,
-		Path:                            req.URL.Path,
-		QueryStringParameters:           valuesToMap(req.URL.Query()),
-		MultiValueQueryStringParameters: valuesToMultiMap(req.URL.Query()),
-		Headers:                         headersToMap(req.Header),
-		MultiValueHeaders:               headersToMultiMap(req.Header),
-		Body:                            body,
-		IsBase64Encoded:                 base64Encoded,
-	})
+	if a.serveMetrics(rw, req) {
+		return
+	}
 
-	body = resp.Body
-	if resp.IsBase64Encoded {
-		buf, err := base64.StdEncoding.DecodeString(body)
+	start := time.Now()
+	record := &invocationRecord{}
+	rec := &statusRecorder{ResponseWriter: rw, record: record, debugHeaders: a.debugHeaders, requestIDHeader: a.requestIDHeader}
+	req = req.WithContext(withInvocationRecord(req.Context(), record))
+
+	if a.tracer != nil {
+		record.span = a.tracer.start(req, start)
+	}
+
+	defer func() {
+		r := recover()
+
+		status := rec.status
+		if r != nil {
+			status = http.StatusInternalServerError
+		}
+
+		a.observe(req, record, status, time.Since(start))
+		if r != nil {
+			a.recoverPanic(rec, r)
+		}
+	}()
+
+	a.proxy(rec, req)
+}
+
+// serveMetrics answers the requests to the SLO gauges and the metrics paths, reporting whether the
+// request is one of them.
+func (a *AwsLambdaPlugin) serveMetrics(rw http.ResponseWriter, req *http.Request) bool {
+	if a.slo != nil && a.slo.metricsPath != "" && req.URL.Path == a.slo.metricsPath {
+		a.slo.writeGauges(rw, time.Now())
+		return true
+	}
+
+	if a.metrics != nil && a.metrics.path != "" && req.URL.Path == a.metrics.path {
+		a.metrics.write(rw)
+		return true
+	}
+
+	return false
+}
+
+// observe accounts the served request in the SLOs, the metrics, the audit log, the trace and the logs.
+func (a *AwsLambdaPlugin) observe(req *http.Request, record *invocationRecord, status int, elapsed time.Duration) {
+	if a.slo != nil {
+		a.slo.record(req.URL.Path, elapsed, status, time.Now())
+	}
+
+	function := record.function
+	if function == "" {
+		function = a.function.get()
+	}
+
+	if a.metrics != nil {
+		a.metrics.record(function, record, elapsed)
+	}
+
+	if a.emf != nil {
+		a.emf.emit(function, record, status, elapsed, time.Now())
+	}
+
+	if a.statsd != nil {
+		a.statsd.send(function, record, elapsed)
+	}
+
+	if a.audit != nil {
+		a.recordAudit(req, function, record, status)
+	}
+
+	if record.span != nil {
+		a.tracer.end(record.span, record, status, time.Now())
+	}
+
+	a.logRequest(req, record, status, elapsed)
+}
+
+func (a *AwsLambdaPlugin) recordAudit(req *http.Request, function string, record *invocationRecord, status int) {
+	clientIP := ""
+	if req.RemoteAddr != "" {
+		clientIP = normalizeIP(req.RemoteAddr, a.unmapIPv4)
+	}
+
+	a.audit.record(req, clientIP, function, record, status, time.Now())
+}
+
+// logRequest logs the slow requests and, when sampled, the access log entry of the request.
+func (a *AwsLambdaPlugin) logRequest(req *http.Request, record *invocationRecord, status int, elapsed time.Duration) {
+	if a.slowThreshold > 0 && elapsed > a.slowThreshold {
+		a.logSlowRequest(req, record, status, elapsed)
+	}
+
+	if a.accessLog && a.accessLogSampler.sample(status >= http.StatusInternalServerError || record.errorCode != "") {
+		a.logAccess(req, record, status, elapsed)
+	}
+}
+
+func (a *AwsLambdaPlugin) proxy(rw http.ResponseWriter, req *http.Request) {
+	if a.health != nil && a.health.intercept(rw) {
+		return
+	}
+
+	if !a.checkContentLength(rw, req) {
+		return
+	}
+
+	if a.limiter != nil {
+		release := a.limiter.intercept(rw, req)
+		if release == nil {
+			return
+		}
+		defer release()
+	}
+
+	request := LambdaRequest{
+		HTTPMethod: req.Method,
+		Path:       req.URL.Path,
+	}
+
+	ctx, cancel := a.invokeContext(req)
+	defer cancel()
+
+	var target string
+	if a.functionOverride != nil {
+		target = a.functionOverride.target(req)
+	}
+
+	if a.idempotency != nil {
+		if err := a.idempotency.apply(req); err != nil {
+			a.writeError(rw, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	a.setClientAddress(&request, req)
+	a.propagateTracing(rw, req)
+
+	if a.functionURL != nil {
+		a.serveFunctionURL(ctx, rw, req)
+		return
+	}
+
+	a.populateMaps(&request, req)
+	a.serveEvent(ctx, rw, req, &request, target)
+}
+
+// propagateTracing adds the X-Ray, W3C and Datadog trace headers to the request, as configured.
+func (a *AwsLambdaPlugin) propagateTracing(rw http.ResponseWriter, req *http.Request) {
+	if a.xray {
+		if traceID := xrayTraceID(req, time.Now()); traceID != "" {
+			req.Header.Set(xrayTraceHeader, traceID)
+		}
+	}
+
+	invokeSpan := invocationRecordOf(rw).tracingSpan()
+	if a.traceContext || invokeSpan != nil {
+		propagateTraceContext(req, invokeSpan)
+	}
+
+	if a.datadog {
+		propagateDatadogTrace(req, invokeSpan)
+	}
+}
+
+// serveEvent sends the event of the request to the publish target, the state machine or the function.
+func (a *AwsLambdaPlugin) serveEvent(ctx context.Context, rw http.ResponseWriter, req *http.Request, request *LambdaRequest, target string) {
+	marshalStart := time.Now()
+	body, ok := a.readRequestBody(rw, req)
+	if !ok {
+		return
+	}
+
+	if a.publisher != nil && a.publisher.matches(req.Method) {
+		a.servePublish(ctx, rw, req, request, body)
+		return
+	}
+
+	if a.stateMachine != nil {
+		a.serveStateMachine(ctx, rw, req, request, body)
+		return
+	}
+
+	in, err := a.newInvokeInput(ctx, req, request, body, target)
+	if errors.Is(err, errClientContextTooLarge) {
+		http.Error(rw, http.StatusText(http.StatusRequestHeaderFieldsTooLarge), http.StatusRequestHeaderFieldsTooLarge)
+		return
+	}
+
+	var tooLarge *payloadTooLargeError
+	if errors.As(err, &tooLarge) {
+		writePayloadTooLarge(rw, err)
+		return
+	}
+
+	if err != nil {
+		a.writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	invocationRecordOf(rw).setInput(in)
+	invocationRecordOf(rw).addTiming(phaseMarshal, time.Since(marshalStart))
+	if a.mirror != nil {
+		a.mirror.send(in)
+	}
+
+	if a.streaming && in.InvocationType != invocationTypeEvent {
+		a.streamFunction(ctx, rw, req, in)
+		return
+	}
+
+	a.invokeCached(ctx, rw, req, in)
+}
+
+// readRequestBody reads the body of the request, answering the error when it cannot, and keeps it
+// readable by the next handler when the failed invocations continue.
+func (a *AwsLambdaPlugin) readRequestBody(rw http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	body, err := readBody(req)
+	invocationRecordOf(rw).requestBytes = len(body)
+	var bodyTooLarge *requestBodyTooLargeError
+	if errors.As(err, &bodyTooLarge) {
+		writePayloadTooLarge(rw, err)
+		return nil, false
+	}
+
+	if err != nil {
+		a.writeError(rw, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if a.continueOnError {
+		// Keep the body readable by the next handler.
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return body, true
+}
+
+// newInvokeInput builds the invocation of the function for the request; a non-empty target
+// replaces the configured function and qualifier.
+func (a *AwsLambdaPlugin) newInvokeInput(
+	ctx context.Context, req *http.Request, request *LambdaRequest, body []byte, target string,
+) (*invokeInput, error) {
+	if a.offload != nil && int64(len(body)) > a.offload.threshold {
+		bodyURL, err := a.offload.offload(ctx, body, req.Header.Get("Content-Type"))
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 
-		body = string(buf)
+		request.BodyURL = bodyURL
+		body = nil
+	}
+
+	payload, err := a.codec.encode(request, body, a.compat.encodeAsText(req, body))
+	if err != nil {
+		return nil, err
+	}
+
+	invocationType := a.types.get(req.Method)
+	if err := checkPayloadSize(int64(len(payload)), invocationType); err != nil {
+		return nil, err
+	}
+
+	clientContext, err := a.clientContext.render(req)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &invokeInput{
+		FunctionName:  a.function.get(),
+		Qualifier:     a.qualifier.get(),
+		ClientContext: clientContext,
+		Payload:       payload,
+	}
+	if a.xray {
+		in.TraceHeader = req.Header.Get(xrayTraceHeader)
+	}
+
+	a.route(in, target)
+	if invocationType == invocationTypeEvent {
+		in.InvocationType = invocationTypeEvent
+	} else if a.logTail != nil && !a.streaming {
+		in.LogType = logTypeTail
+	}
+
+	return in, nil
+}
+
+// route selects the function invoked: the target when not empty, otherwise the lowest latency
+// replica and the canary version, when configured.
+func (a *AwsLambdaPlugin) route(in *invokeInput, target string) {
+	if target != "" {
+		in.FunctionName, in.Qualifier = target, ""
+		return
+	}
+
+	if a.latency != nil {
+		a.latency.route(in)
+	}
+
+	if a.canary != nil && a.canary.pick() {
+		in.Qualifier = a.canary.qualifier
+	}
+}
+
+// writeResponse writes the response returned by the function, answering 502 when its status code
+// is invalid or its body cannot be decoded, unless base64 decoding is lenient.
+func (a *AwsLambdaPlugin) writeResponse(rw http.ResponseWriter, resp LambdaResponse) {
+	start := time.Now()
+	defer func() { invocationRecordOf(rw).addTiming(phaseWrite, time.Since(start)) }()
+
+	statusCode, err := a.statusCode(resp.StatusCode)
+	if err != nil {
+		a.writeError(rw, http.StatusBadGateway, err)
+		return
+	}
+
+	if description, rejected := statusDescription(statusCode, resp.StatusDescription); rejected {
+		a.logger.warnf("status description %q does not match the status code, using %q", resp.StatusDescription, description)
+	}
+
+	// The body is written from a pooled buffer, decoded there when base64 encoded.
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if resp.IsBase64Encoded {
+		buf.Grow(base64.StdEncoding.DecodedLen(len(resp.Body)) + bytes.MinRead)
+		_, err := buf.ReadFrom(base64.NewDecoder(base64.StdEncoding, strings.NewReader(resp.Body)))
+		switch {
+		case err == nil:
+		case a.lenientBase64:
+			a.logger.warnf("invalid base64 response body of %d bytes, forwarded as is: %s", len(resp.Body), err)
+			buf.Reset()
+			buf.WriteString(resp.Body)
+		default:
+			a.writeError(rw, http.StatusBadGateway, fmt.Errorf("%w: invalid base64 body of %d bytes: %s", errBadResponse, len(resp.Body), err))
+			return
+		}
+	} else {
+		buf.WriteString(resp.Body)
 	}
 
 	for key, value := range resp.Headers {
@@ -139,66 +1333,178 @@ func (a *AwsLambdaPlugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	rw.WriteHeader(resp.StatusCode)
-	_, err := rw.Write([]byte(body))
+	sanitizeHeaders(rw.Header(), int64(buf.Len()), a.deniedHeaders)
+	rw.WriteHeader(statusCode)
+	if buf.Len() == 0 {
+		// Nothing to write, as for the 204 responses that do not allow a body.
+		return
+	}
+
+	if _, err := rw.Write(buf.Bytes()); err != nil {
+		a.logger.warnf("cannot write the response: %s", err)
+	}
+}
+
+// statusCode returns the status code of a function response, the default one when it is unset.
+func (a *AwsLambdaPlugin) statusCode(statusCode int) (int, error) {
+	if statusCode == 0 {
+		return a.defaultStatusCode, nil
+	}
+
+	if statusCode < 100 || statusCode > 599 {
+		return 0, fmt.Errorf("%w: invalid status code %d", errBadResponse, statusCode)
+	}
+
+	return statusCode, nil
+}
+
+// populateMaps fills the headers and query string maps of the event according to the compat settings.
+func (a *AwsLambdaPlugin) populateMaps(request *LambdaRequest, req *http.Request) {
+	query := req.URL.Query()
+
+	header := req.Header
+	if a.compat.HeaderCasing == headerCasingLower {
+		header = make(http.Header, len(req.Header))
+		for name, values := range req.Header {
+			header[a.compat.headerName(name)] = values
+		}
+	}
+
+	switch a.compat.MapPopulation {
+	case mapPopulationMulti:
+		request.MultiValueQueryStringParameters = map[string][]string(query)
+		request.MultiValueHeaders = map[string][]string(header)
+	case mapPopulationSingle:
+		request.QueryStringParameters = lastValues(query)
+		request.Headers = lastValues(header)
+	default:
+		precision := a.compat.floatPrecision()
+		request.QueryStringParameters = valuesToMap(query, precision)
+		request.MultiValueQueryStringParameters = valuesToMultiMap(query, precision)
+		request.Headers = headersToMap(header)
+		request.MultiValueHeaders = headersToMultiMap(header)
+	}
+}
+
+// readBody reads the request body, returning nil when the request has none. The content is read
+// whatever the declared length, unknown for the chunked requests and not trusted for the others.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := readAll(req.Body, req.ContentLength)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("cannot read the request body: %w", err)
 	}
+
+	return body, nil
 }
 
-func bodyToBase64(req *http.Request) (bool, string) {
-	base64Encoded := false
-	body := ""
-	if req.ContentLength != 0 {
-		var buf bytes.Buffer
-		encoder := base64.NewEncoder(base64.StdEncoding, &buf)
+// invokeFunction invokes the function, or the fallback function when it fails. A non-nil error
+// reports a failed invocation, answered with the returned response, if any.
+func (a *AwsLambdaPlugin) invokeFunction(ctx context.Context, req *http.Request, in *invokeInput) (LambdaResponse, error) {
+	if a.breaker != nil && !a.breaker.allow(time.Now()) {
+		if a.shouldFallback(req) {
+			return a.invokeFallback(req, in, errCircuitOpen)
+		}
 
-		_, err := io.Copy(encoder, req.Body)
-		if err != nil {
-			panic(err)
+		return a.breaker.response(), errCircuitOpen
+	}
+
+	start := time.Now()
+	result, err := a.hedgedInvoke(ctx, in, req.Method)
+	invocationRecordFrom(ctx).setResult(result, time.Since(start))
+	invocationRecordFrom(ctx).addTiming(phaseInvoke, time.Since(start))
+	if err == nil {
+		a.logger.debugf("invoked %s in %s [request id: %s]", in.FunctionName, time.Since(start), result.RequestID)
+	}
+	if a.breaker != nil {
+		if canceledByClient(req, err) {
+			a.breaker.release()
+		} else {
+			a.breaker.record(err != nil || result.FunctionError != "", time.Since(start), time.Now())
 		}
+	}
 
-		err = encoder.Close()
+	if a.limiter != nil {
+		a.limiter.record(start, err)
+	}
+
+	if a.shouldFallback(req) {
 		if err != nil {
-			panic(err)
+			return a.invokeFallback(req, in, err)
 		}
 
-		body = buf.String()
-		base64Encoded = true
+		if result.FunctionError != "" {
+			return a.invokeFallback(req, in, functionError(result))
+		}
 	}
 
-	return base64Encoded, body
+	decodeStart := time.Now()
+	defer func() { invocationRecordFrom(ctx).addTiming(phaseDecode, time.Since(decodeStart)) }()
+
+	return a.invocationResponse(in, result, err)
 }
 
-func (a *AwsLambdaPlugin) invokeFunction(request LambdaRequest) LambdaResponse {
-	payload, err := json.Marshal(request)
+// invocationResponse maps the outcome of an invocation to the response.
+func (a *AwsLambdaPlugin) invocationResponse(in *invokeInput, result *invokeOutput, err error) (LambdaResponse, error) {
 	if err != nil {
-		panic(err)
+		resp, _ := throttledResponse(err)
+		return resp, err
 	}
 
-	result, err := a.client.Invoke(&lambda.InvokeInput{
-		FunctionName: aws.String(a.functionArn),
-		Payload:      payload,
-	})
+	resp, err := a.functionResponse(in, result)
 	if err != nil {
-		panic(err)
+		return LambdaResponse{}, err
+	}
+
+	if a.logTail != nil {
+		a.logTail.capture(a.logger, result, &resp)
+	}
+
+	if result.FunctionError != "" {
+		return resp, functionError(result)
+	}
+
+	return resp, nil
+}
+
+// errBadResponse reports a function response that cannot be decoded.
+var errBadResponse = errors.New("invalid function response")
+
+// errUnexpectedInvokeStatus reports an invocation answered with an unexpected status code.
+var errUnexpectedInvokeStatus = errors.New("call to lambda failed")
+
+// functionResponse maps the result of a successful invocation to the response.
+func (a *AwsLambdaPlugin) functionResponse(in *invokeInput, result *invokeOutput) (LambdaResponse, error) {
+	if in.InvocationType == invocationTypeEvent {
+		if result.StatusCode != http.StatusAccepted {
+			return LambdaResponse{}, fmt.Errorf("%w: unexpected status code %d", errUnexpectedInvokeStatus, result.StatusCode)
+		}
+
+		return a.event.response(result.RequestID), nil
+	}
+
+	if result.StatusCode != http.StatusOK {
+		return LambdaResponse{}, fmt.Errorf("%w: unexpected status code %d", errUnexpectedInvokeStatus, result.StatusCode)
 	}
 
-	if *result.StatusCode != 200 {
-		panic(fmt.Errorf("call to lambda failed"))
+	if result.FunctionError != "" {
+		return a.functionErrorResponse(result), nil
 	}
 
-	var resp LambdaResponse
-	err = json.Unmarshal(result.Payload, &resp)
+	resp, err := a.codec.decode(result.Payload)
 	if err != nil {
-		panic(err)
+		a.logBadResponse(result.RequestID, result.Payload)
+		return LambdaResponse{}, fmt.Errorf("%w: %s", errBadResponse, err)
 	}
 
-	return resp
+	return resp, nil
 }
 
 func headersToMap(h http.Header) map[string]string {
-	values := map[string]string{}
+	values := make(map[string]string, len(h))
 	for name, headers := range h {
 		if len(headers) != 1 {
 			continue
@@ -210,8 +1516,28 @@ func headersToMap(h http.Header) map[string]string {
 	return values
 }
 
+func lastValues(m map[string][]string) map[string]string {
+	values := make(map[string]string, len(m))
+	for name, v := range m {
+		if len(v) == 0 {
+			continue
+		}
+
+		values[name] = v[len(v)-1]
+	}
+
+	return values
+}
+
 func headersToMultiMap(h http.Header) map[string][]string {
-	values := map[string][]string{}
+	size := 0
+	for _, headers := range h {
+		if len(headers) > 1 {
+			size++
+		}
+	}
+
+	values := make(map[string][]string, size)
 	for name, headers := range h {
 		if len(headers) < 2 {
 			continue
@@ -223,7 +1549,7 @@ func headersToMultiMap(h http.Header) map[string][]string {
 	return values
 }
 
-func valueToString(f interface{}) (string, bool) {
+func valueToString(f interface{}, precision int) (string, bool) {
 	var v string
 	typeof := reflect.TypeOf(f)
 	s := reflect.ValueOf(f)
@@ -234,13 +1560,13 @@ func valueToString(f interface{}) (string, bool) {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		v = strconv.FormatUint(s.Uint(), 10)
 	case reflect.Float32:
-		v = strconv.FormatFloat(s.Float(), 'f', 4, 32)
+		v = strconv.FormatFloat(s.Float(), 'f', precision, 32)
 	case reflect.Float64:
-		v = strconv.FormatFloat(s.Float(), 'f', 4, 64)
+		v = strconv.FormatFloat(s.Float(), 'f', precision, 64)
 	case reflect.String:
 		v = s.String()
 	case reflect.Slice:
-		t, valid := valuesToStrings(f)
+		t, valid := valuesToStrings(f, precision)
 		if !valid || len(t) != 1 {
 			return "", false
 		}
@@ -253,7 +1579,7 @@ func valueToString(f interface{}) (string, bool) {
 	return v, true
 }
 
-func valuesToStrings(f interface{}) ([]string, bool) {
+func valuesToStrings(f interface{}, precision int) ([]string, bool) {
 	typeof := reflect.TypeOf(f)
 	if typeof.Kind() != reflect.Slice {
 		return []string{}, false
@@ -267,7 +1593,7 @@ func valuesToStrings(f interface{}) ([]string, bool) {
 		s := reflect.ValueOf(f)
 
 		for i := 0; i < s.Len(); i++ {
-			conv, valid := valueToString(s.Index(i).Interface())
+			conv, valid := valueToString(s.Index(i).Interface(), precision)
 			if !valid {
 				continue
 			}
@@ -281,10 +1607,10 @@ func valuesToStrings(f interface{}) ([]string, bool) {
 	return v, true
 }
 
-func valuesToMap(i url.Values) map[string]string {
-	values := map[string]string{}
+func valuesToMap(i url.Values, precision int) map[string]string {
+	values := make(map[string]string, len(i))
 	for name, val := range i {
-		value, valid := valueToString(val)
+		value, valid := valueToString(val, precision)
 		if !valid {
 			continue
 		}
@@ -295,10 +1621,17 @@ func valuesToMap(i url.Values) map[string]string {
 	return values
 }
 
-func valuesToMultiMap(i url.Values) map[string][]string {
-	values := map[string][]string{}
+func valuesToMultiMap(i url.Values, precision int) map[string][]string {
+	size := 0
+	for _, val := range i {
+		if len(val) > 1 {
+			size++
+		}
+	}
+
+	values := make(map[string][]string, size)
 	for name, val := range i {
-		value, valid := valuesToStrings(val)
+		value, valid := valuesToStrings(val, precision)
 		if !valid || len(value) == 1 {
 			continue
 		}
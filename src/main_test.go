@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
@@ -17,6 +19,7 @@ func TestInvoke(t *testing.T) {
 	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		assert.Equal(t, "POST", req.Method)
 		assert.Equal(t, "/2015-03-31/functions/arn%3Aaws%3Alambda%3Aeu-west-1%3A000000000000%3Afunction%3Axxx%3A1/invocations", req.URL.RawPath)
+		assert.Regexp(t, `^AWS4-HMAC-SHA256 Credential=aws-key/\d{8}/eu-west-1/lambda/aws4_request, SignedHeaders=[a-z0-9;-]+, Signature=[0-9a-f]{64}$`, req.Header.Get("Authorization"))
 
 		var buf bytes.Buffer
 		_, err := io.Copy(&buf, req.Body)
@@ -75,3 +78,341 @@ func TestInvoke(t *testing.T) {
 
 	handler.ServeHTTP(recorder, req)
 }
+
+func TestInvokeMultiValueHeaders(t *testing.T) {
+	enabled, disabled := true, false
+	testCases := []struct {
+		desc       string
+		multiValue *bool
+		headers    map[string]string
+		multi      map[string][]string
+		query      map[string]string
+		multiQuery map[string][]string
+	}{
+		{
+			desc:       "enabled",
+			multiValue: &enabled,
+			multi:      map[string][]string{"Content-Type": {"text/plain"}, "X-Test": {"foo", "foobar"}},
+			multiQuery: map[string][]string{"a": {"1"}, "c": {"3", "4"}},
+		},
+		{
+			desc:       "disabled",
+			multiValue: &disabled,
+			headers:    map[string]string{"Content-Type": "text/plain", "X-Test": "foobar"},
+			query:      map[string]string{"a": "1", "c": "4"},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				var buf bytes.Buffer
+				_, err := io.Copy(&buf, req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var lReq awslambdaplugin.LambdaRequest
+				err = json.Unmarshal(buf.Bytes(), &lReq)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				assert.Equal(t, test.headers, lReq.Headers)
+				assert.Equal(t, test.multi, lReq.MultiValueHeaders)
+				assert.Equal(t, test.query, lReq.QueryStringParameters)
+				assert.Equal(t, test.multiQuery, lReq.MultiValueQueryStringParameters)
+
+				res.WriteHeader(200)
+				_, _ = res.Write([]byte("{\"statusCode\": 202}"))
+			}))
+			defer func() { mockserver.Close() }()
+
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.MultiValueHeadersEnabled = test.multiValue
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/?a=1&c=3&c=4", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Content-Type", "text/plain")
+			req.Header.Add("X-Test", "foo")
+			req.Header.Add("X-Test", "foobar")
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, 202, recorder.Code)
+		})
+	}
+}
+
+func TestInvokeSessionToken(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "session-token", req.Header.Get("X-Amz-Security-Token"))
+		assert.Contains(t, req.Header.Get("Authorization"), "x-amz-security-token")
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.SessionToken = "session-token"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+
+	cfg.AccessKey = ""
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "session token requires both access key and secret key")
+}
+
+func TestRegionFromFunctionArn(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Contains(t, req.Header.Get("Authorization"), "/eu-south-1/lambda/aws4_request")
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-south-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+
+	cfg.Region = "eu-west-1"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `region "eu-west-1" does not match the function arn region "eu-south-1"`)
+}
+
+func TestQualifier(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "live", req.URL.Query().Get("Qualifier"))
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx"
+	cfg.Qualifier = "live"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `qualifier "live" does not match the function arn qualifier "1"`)
+
+	cfg.Qualifier = "li.ve"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `invalid qualifier "li.ve"`)
+}
+
+func TestDefaultStatusCode(t *testing.T) {
+	var payload string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(payload))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	serve := func(cfg *awslambdaplugin.Config, p string) *httptest.ResponseRecorder {
+		handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload = p
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := serve(cfg, `{"body": "ok"}`)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+
+	assert.Equal(t, 502, serve(cfg, `{"statusCode": 42, "body": "ok"}`).Code)
+	assert.Equal(t, 502, serve(cfg, `{"statusCode": 600}`).Code)
+
+	cfg.DefaultStatusCode = 204
+	assert.Equal(t, 204, serve(cfg, `{}`).Code)
+
+	cfg.DefaultStatusCode = 1000
+	_, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "invalid default status code 1000")
+}
+
+func TestInvalidBase64ResponseBody(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200, "body": "not base64!", "isBase64Encoded": true}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	serve := func() *httptest.ResponseRecorder {
+		handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	assert.Equal(t, 502, serve().Code)
+
+	cfg.LenientBase64 = true
+	recorder := serve()
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "not base64!", recorder.Body.String())
+}
+
+// TestCatalogTestData loads the middleware with the testData of the plugin catalog manifest, as the
+// catalog does to validate the plugin.
+func TestCatalogTestData(t *testing.T) {
+	manifest, err := os.ReadFile("../.traefik.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testData := map[string]string{}
+	inTestData := false
+	for _, line := range strings.Split(string(manifest), "\n") {
+		switch {
+		case line == "testData:":
+			inTestData = true
+		case inTestData && strings.HasPrefix(line, "  "):
+			parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+			testData[parts[0]] = strings.Trim(strings.TrimSpace(parts[1]), "'\"")
+		default:
+			inTestData = false
+		}
+	}
+
+	encoded, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := awslambdaplugin.CreateConfig()
+	if err := json.Unmarshal(encoded, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NotEmpty(t, cfg.FunctionArn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = awslambdaplugin.New(ctx, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}), cfg, "lambda-plugin")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,373 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultMetricsListenerPath = "/metrics"
+
+var (
+	durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	sizeBuckets     = []float64{1024, 10 * 1024, 100 * 1024, 1024 * 1024, 6 * 1024 * 1024}
+	memoryBuckets   = []float64{128, 256, 512, 1024, 2048, 4096, 10240}
+)
+
+// MetricsConfig exposes the invocation metrics in Prometheus text format, on the routes of the
+// middleware and/or on a dedicated listener.
+type MetricsConfig struct {
+	// Path serves the metrics on the routes of the middleware, e.g. /metrics.
+	Path string `json:"path,omitempty"`
+	// Address of a dedicated listener serving the metrics on Path (default /metrics), e.g. :9464. The
+	// middlewares configured with the same address share the listener, and must use the same Path.
+	Address string `json:"address,omitempty"`
+}
+
+// invocationMetrics holds the counters and histograms of the requests, by function.
+type invocationMetrics struct {
+	logger     *logger
+	middleware string
+	path       string
+	breaker    *circuitBreaker
+
+	mu        sync.Mutex
+	functions map[string]*functionMetrics
+}
+
+type functionMetrics struct {
+	invocations  int64
+	throttles    int64
+	retries      int64
+	coldStarts   int64
+	cacheHits    int64
+	cacheMisses  int64
+	errors       map[string]int64
+	duration     *histogram
+	requestSize  *histogram
+	responseSize *histogram
+	// billedDuration and memoryUsed are observed from the REPORT lines of the log excerpts.
+	billedDuration *histogram
+	memoryUsed     *histogram
+}
+
+// histogram is a cumulative Prometheus histogram.
+type histogram struct {
+	buckets []float64
+	counts  []int64
+	sum     float64
+	count   int64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += value
+	h.count++
+}
+
+func (h *histogram) write(buf *bytes.Buffer, name, labels string) {
+	for i, bound := range h.buckets {
+		fmt.Fprintf(buf, "%s_bucket{%s,le=%q} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+
+	fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(buf, "%s_sum{%s} %g\n", name, labels, h.sum)
+	fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func newInvocationMetrics(ctx context.Context, logger *logger, config *MetricsConfig, breaker *circuitBreaker) (*invocationMetrics, error) {
+	if config.Path == "" && config.Address == "" {
+		return nil, fmt.Errorf("metrics: path or address is required")
+	}
+
+	m := &invocationMetrics{
+		logger:     logger,
+		middleware: logger.name,
+		path:       config.Path,
+		breaker:    breaker,
+		functions:  map[string]*functionMetrics{},
+	}
+
+	if config.Address != "" {
+		if err := m.listen(ctx, config.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// metricsListener is a dedicated listener shared by the middlewares serving their metrics on the same
+// address: Traefik builds a middleware per router, and builds them again on every configuration reload.
+type metricsListener struct {
+	path   string
+	server *http.Server
+	// instances are the registered middlewares by name, a rebuilt middleware replacing the previous one.
+	instances map[string]*invocationMetrics
+}
+
+// metricsListeners are the dedicated listeners by address, guarded by metricsListenersMu along with
+// their registered middlewares.
+var (
+	metricsListenersMu sync.Mutex
+	metricsListeners   = map[string]*metricsListener{}
+)
+
+// listen registers the metrics on the listener of the address, opened by the first middleware, until
+// the context is done. The last middleware leaving closes it.
+func (m *invocationMetrics) listen(ctx context.Context, address string) error {
+	path := m.path
+	if path == "" {
+		path = defaultMetricsListenerPath
+	}
+
+	metricsListenersMu.Lock()
+	defer metricsListenersMu.Unlock()
+
+	l, ok := metricsListeners[address]
+	if !ok {
+		var err error
+		if l, err = startMetricsListener(m.logger, address, path); err != nil {
+			return err
+		}
+
+		metricsListeners[address] = l
+	} else if l.path != path {
+		return fmt.Errorf("metrics: address %s already serves the metrics on %s", address, l.path)
+	}
+
+	l.instances[m.middleware] = m
+
+	go func() {
+		<-ctx.Done()
+		l.release(address, m)
+	}()
+
+	return nil
+}
+
+func startMetricsListener(logger *logger, address, path string) (*metricsListener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+
+	l := &metricsListener{path: path, instances: map[string]*invocationMetrics{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, l.serve)
+
+	l.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := l.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.errorf("metrics listener failed: %v", err)
+		}
+	}()
+
+	return l, nil
+}
+
+// serve writes the metrics of the registered middlewares, by name.
+func (l *metricsListener) serve(rw http.ResponseWriter, _ *http.Request) {
+	metricsListenersMu.Lock()
+	names := make([]string, 0, len(l.instances))
+	for name := range l.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	instances := make([]*invocationMetrics, 0, len(names))
+	for _, name := range names {
+		instances = append(instances, l.instances[name])
+	}
+	metricsListenersMu.Unlock()
+
+	writeMetrics(rw, instances)
+}
+
+// release unregisters the metrics of a middleware, closing the listener once none is left.
+func (l *metricsListener) release(address string, m *invocationMetrics) {
+	metricsListenersMu.Lock()
+	defer metricsListenersMu.Unlock()
+
+	if l.instances[m.middleware] == m {
+		delete(l.instances, m.middleware)
+	}
+
+	if len(l.instances) == 0 && metricsListeners[address] == l {
+		delete(metricsListeners, address)
+		_ = l.server.Close()
+	}
+}
+
+// record accounts a served request.
+func (m *invocationMetrics) record(function string, record *invocationRecord, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.functions[function]
+	if !ok {
+		f = &functionMetrics{
+			errors:       map[string]int64{},
+			duration:     newHistogram(durationBuckets),
+			requestSize:  newHistogram(sizeBuckets),
+			responseSize: newHistogram(sizeBuckets),
+
+			billedDuration: newHistogram(durationBuckets),
+			memoryUsed:     newHistogram(memoryBuckets),
+		}
+		m.functions[function] = f
+	}
+
+	f.invocations++
+	f.retries += record.retryCount()
+	if record.errorCode != "" {
+		f.errors[record.errorCode]++
+	}
+
+	if record.errorCode == "lambda_throttled" {
+		f.throttles++
+	}
+
+	f.duration.observe(duration.Seconds())
+	f.requestSize.observe(float64(record.payloadBytes))
+	f.responseSize.observe(float64(record.responseBytes))
+	if record.report != nil {
+		f.billedDuration.observe(record.report.billedDurationMs / 1000)
+		f.memoryUsed.observe(float64(record.report.maxMemoryUsedMB))
+	}
+
+	if record.coldStart {
+		f.coldStarts++
+	}
+
+	switch record.cacheStatus {
+	case "hit":
+		f.cacheHits++
+	case "miss":
+		f.cacheMisses++
+	}
+}
+
+var metricsCounters = []struct {
+	name, help string
+	value      func(*functionMetrics) int64
+}{
+	{"traefik_lambda_invocations_total", "Requests served by the middleware.", func(f *functionMetrics) int64 { return f.invocations }},
+	{"traefik_lambda_throttles_total", "Requests throttled by Lambda.", func(f *functionMetrics) int64 { return f.throttles }},
+	{"traefik_lambda_retries_total", "Retried invocations.", func(f *functionMetrics) int64 { return f.retries }},
+	{"traefik_lambda_cold_starts_total", "Invocations initializing an execution environment, from the log excerpts.", func(f *functionMetrics) int64 { return f.coldStarts }},
+	{"traefik_lambda_cache_hits_total", "Cacheable requests served from the response cache.", func(f *functionMetrics) int64 { return f.cacheHits }},
+	{"traefik_lambda_cache_misses_total", "Cacheable requests invoking the function.", func(f *functionMetrics) int64 { return f.cacheMisses }},
+}
+
+var metricsHistograms = []struct {
+	name, help string
+	value      func(*functionMetrics) *histogram
+}{
+	{"traefik_lambda_duration_seconds", "Duration of the requests.", func(f *functionMetrics) *histogram { return f.duration }},
+	{"traefik_lambda_request_payload_bytes", "Size of the invocation payloads.", func(f *functionMetrics) *histogram { return f.requestSize }},
+	{"traefik_lambda_response_payload_bytes", "Size of the function responses.", func(f *functionMetrics) *histogram { return f.responseSize }},
+	{"traefik_lambda_billed_duration_seconds", "Billed duration of the invocations, from the log excerpts.", func(f *functionMetrics) *histogram { return f.billedDuration }},
+	{"traefik_lambda_max_memory_used_megabytes", "Memory used by the invocations, from the log excerpts.", func(f *functionMetrics) *histogram { return f.memoryUsed }},
+}
+
+// write writes the metrics in Prometheus text exposition format.
+func (m *invocationMetrics) write(rw http.ResponseWriter) {
+	writeMetrics(rw, []*invocationMetrics{m})
+}
+
+// writeMetrics writes the metrics of the middlewares in Prometheus text exposition format, with the
+// samples of every middleware under a single family header.
+func writeMetrics(rw http.ResponseWriter, instances []*invocationMetrics) {
+	var buf bytes.Buffer
+
+	for _, c := range metricsCounters {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, m := range instances {
+			m.each(func(f *functionMetrics, labels string) {
+				fmt.Fprintf(&buf, "%s{%s} %d\n", c.name, labels, c.value(f))
+			})
+		}
+	}
+
+	buf.WriteString("# HELP traefik_lambda_errors_total Failed requests by error code.\n")
+	buf.WriteString("# TYPE traefik_lambda_errors_total counter\n")
+	for _, m := range instances {
+		m.each(func(f *functionMetrics, labels string) {
+			codes := make([]string, 0, len(f.errors))
+			for code := range f.errors {
+				codes = append(codes, code)
+			}
+			sort.Strings(codes)
+
+			for _, code := range codes {
+				fmt.Fprintf(&buf, "traefik_lambda_errors_total{%s,error=%q} %d\n", labels, code, f.errors[code])
+			}
+		})
+	}
+
+	for _, h := range metricsHistograms {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+		for _, m := range instances {
+			m.each(func(f *functionMetrics, labels string) {
+				h.value(f).write(&buf, h.name, labels)
+			})
+		}
+	}
+
+	writeBreakerStates(&buf, instances)
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(buf.Bytes())
+}
+
+// each calls fn with the metrics and the labels of every function, by name.
+func (m *invocationMetrics) each(fn func(f *functionMetrics, labels string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.functions))
+	for name := range m.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fn(m.functions[name], fmt.Sprintf("middleware=%q,function=%q", m.middleware, name))
+	}
+}
+
+// writeBreakerStates writes the state of the circuit breakers of the middlewares having one.
+func writeBreakerStates(buf *bytes.Buffer, instances []*invocationMetrics) {
+	header := false
+	for _, m := range instances {
+		if m.breaker == nil {
+			continue
+		}
+
+		if !header {
+			buf.WriteString("# HELP traefik_lambda_circuit_breaker_state State of the circuit breaker: 0 closed, 1 open, 2 half open.\n")
+			buf.WriteString("# TYPE traefik_lambda_circuit_breaker_state gauge\n")
+			header = true
+		}
+
+		fmt.Fprintf(buf, "traefik_lambda_circuit_breaker_state{middleware=%q} %d\n", m.middleware, m.breaker.currentState())
+	}
+}
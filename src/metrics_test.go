@@ -0,0 +1,221 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	var failure string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch failure {
+		case "throttle":
+			res.WriteHeader(429)
+			_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+		default:
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`{"statusCode": 200}`))
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Metrics = &awslambdaplugin.MetricsConfig{Path: "/_metrics"}
+	cfg.CircuitBreaker = &awslambdaplugin.CircuitBreakerConfig{}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(f, path string) *httptest.ResponseRecorder {
+		failure = f
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	serve("", "/")
+	serve("", "/")
+	serve("throttle", "/")
+
+	recorder := serve("", "/_metrics")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "text/plain; version=0.0.4", recorder.Header().Get("Content-Type"))
+
+	labels := `middleware="lambda-plugin",function="arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"`
+	body := recorder.Body.String()
+	assert.Contains(t, body, "traefik_lambda_invocations_total{"+labels+"} 3\n")
+	assert.Contains(t, body, "traefik_lambda_throttles_total{"+labels+"} 1\n")
+	assert.Contains(t, body, "traefik_lambda_errors_total{"+labels+`,error="lambda_throttled"} 1`+"\n")
+	assert.Contains(t, body, "traefik_lambda_duration_seconds_count{"+labels+"} 3\n")
+	assert.Contains(t, body, "traefik_lambda_response_payload_bytes_bucket{"+labels+`,le="1024"} 3`+"\n")
+	assert.Contains(t, body, `traefik_lambda_circuit_breaker_state{middleware="lambda-plugin"} 0`+"\n")
+
+	cfg.Metrics = &awslambdaplugin.MetricsConfig{}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "metrics: path or address is required")
+}
+
+func TestMetricsListener(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Metrics = &awslambdaplugin.MetricsConfig{Address: address}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The metrics are not served on the routes of the middleware without a path.
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	resp, err := http.Get("http://" + address + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, string(body), `traefik_lambda_invocations_total{middleware="lambda-plugin",function="arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"} 2`)
+}
+
+func TestSharedMetricsListener(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	// One middleware per router, the first one rebuilt by a reload.
+	var cancels []context.CancelFunc
+	for _, name := range []string{"first", "second", "first"} {
+		cfg := awslambdaplugin.CreateConfig()
+		cfg.Region = "eu-west-1"
+		cfg.AccessKey = "aws-key"
+		cfg.SecretKey = "@@not-a-key"
+		cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:" + name
+		cfg.Endpoint = mockserver.URL
+		cfg.Metrics = &awslambdaplugin.MetricsConfig{Address: address}
+
+		instanceCtx, instanceCancel := context.WithCancel(ctx)
+		cancels = append(cancels, instanceCancel)
+
+		handler, err := awslambdaplugin.New(instanceCtx, next, cfg, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	scrape := func() string {
+		resp, err := http.Get("http://" + address + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(body)
+	}
+
+	body := scrape()
+	assert.Equal(t, 1, strings.Count(body, "# TYPE traefik_lambda_invocations_total counter"))
+	assert.Contains(t, body, `traefik_lambda_invocations_total{middleware="first",function="arn:aws:lambda:eu-west-1:000000000000:function:first"} 1`)
+	assert.Contains(t, body, `traefik_lambda_invocations_total{middleware="second",function="arn:aws:lambda:eu-west-1:000000000000:function:second"} 1`)
+	assert.Equal(t, 1, strings.Count(body, `traefik_lambda_invocations_total{middleware="first"`))
+
+	// The replaced middleware leaving keeps the one rebuilt in its place.
+	cancels[0]()
+	time.Sleep(20 * time.Millisecond)
+	assert.Contains(t, scrape(), `traefik_lambda_invocations_total{middleware="first"`)
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:third"
+	cfg.Metrics = &awslambdaplugin.MetricsConfig{Address: address, Path: "/other"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "third")
+	assert.EqualError(t, err, "metrics: address "+address+" already serves the metrics on /metrics")
+}
@@ -0,0 +1,100 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultMirrorMaxInFlight = 100
+	mirrorTimeout            = 10 * time.Second
+)
+
+// MirrorConfig sends a copy of the events to a second function, e.g. to validate a rewritten handler
+// against the production traffic. The copies are invoked asynchronously (Event invocation type) and
+// their outcome never affects the response.
+type MirrorConfig struct {
+	// FunctionArn of the function receiving the copies.
+	FunctionArn string `json:"functionArn,omitempty"`
+	// Percentage of the requests mirrored (default 100).
+	Percentage float64 `json:"percentage,omitempty"`
+	// MaxInFlight caps the pending mirror invocations; copies over the cap are dropped (default 100).
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+}
+
+// trafficMirror invokes the mirror function in background.
+type trafficMirror struct {
+	logger     *logger
+	function   string
+	percentage float64
+	slots      chan struct{}
+	client     *lambdaClient
+}
+
+func newTrafficMirror(logger *logger, config *MirrorConfig, region string, client *lambdaClient) (*trafficMirror, error) {
+	fn, err := parseFunctionArn(config.FunctionArn)
+	if err != nil {
+		return nil, fmt.Errorf("mirror: %w", err)
+	}
+
+	if _, err := functionRegion(region, fn); err != nil {
+		return nil, fmt.Errorf("mirror: %w", err)
+	}
+
+	percentage := config.Percentage
+	if percentage == 0 {
+		percentage = 100
+	}
+	if percentage < 0 || percentage > 100 {
+		return nil, fmt.Errorf("mirror: percentage must be between 0 and 100")
+	}
+
+	maxInFlight := config.MaxInFlight
+	if maxInFlight == 0 {
+		maxInFlight = defaultMirrorMaxInFlight
+	}
+	if maxInFlight < 0 {
+		return nil, fmt.Errorf("mirror: max in flight must be positive")
+	}
+
+	return &trafficMirror{
+		logger:     logger,
+		function:   config.FunctionArn,
+		percentage: percentage,
+		slots:      make(chan struct{}, maxInFlight),
+		client:     client,
+	}, nil
+}
+
+// send invokes the mirror function with a copy of the invocation, unless too many copies are pending
+// or the payload exceeds the asynchronous invocation limit.
+func (m *trafficMirror) send(in *invokeInput) {
+	if rand.Float64()*100 >= m.percentage || len(in.Payload) > eventPayloadLimit { //nolint:gosec // No need for a secure random source.
+		return
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		return
+	}
+
+	mirrored := *in
+	mirrored.FunctionName = m.function
+	mirrored.Qualifier = ""
+	mirrored.InvocationType = invocationTypeEvent
+	mirrored.LogType = ""
+
+	go func() {
+		defer func() { <-m.slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+		defer cancel()
+
+		if _, err := m.client.invoke(ctx, &mirrored); err != nil {
+			m.logger.warnf("mirror invocation failed: %s", err)
+		}
+	}()
+}
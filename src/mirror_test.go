@@ -0,0 +1,73 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirror(t *testing.T) {
+	type mirrored struct {
+		invocationType string
+		payload        string
+	}
+
+	mirrors := make(chan mirrored, 1)
+	var primary string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if strings.Contains(req.URL.Path, "/shadow/") {
+			mirrors <- mirrored{req.Header.Get("X-Amz-Invocation-Type"), string(body)}
+			res.Header().Set("X-Amzn-Errortype", "ServiceException")
+			res.WriteHeader(500)
+			return
+		}
+
+		primary = string(body)
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200, \"body\": \"primary\"}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Mirror = &awslambdaplugin.MirrorConfig{FunctionArn: "shadow"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "primary", recorder.Body.String())
+
+	select {
+	case m := <-mirrors:
+		assert.Equal(t, "Event", m.invocationType)
+		assert.Equal(t, primary, m.payload)
+	case <-time.After(time.Second):
+		t.Fatal("the mirror function was not invoked")
+	}
+}
@@ -0,0 +1,156 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOffloadThreshold = 1024 * 1024
+	defaultOffloadURLExpiry = 15 * time.Minute
+	maxPresignedURLExpiry   = 7 * 24 * time.Hour
+)
+
+// S3OffloadConfig uploads the large request bodies to S3 and sends the function a presigned URL of
+// the object in the event bodyUrl key instead of the body (claim-check pattern), so that uploads are
+// not bound to the invocation payload limit. The objects are not deleted: expire them with a bucket
+// lifecycle rule.
+type S3OffloadConfig struct {
+	// Bucket receiving the bodies. The plugin credentials need s3:PutObject and s3:GetObject on it.
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix of the object keys (e.g. lambda-payloads/).
+	Prefix string `json:"prefix,omitempty"`
+	// Threshold is the body size in bytes over which it is offloaded (default 1 MiB).
+	Threshold int64 `json:"threshold,omitempty"`
+	// URLExpiry is the validity of the presigned URLs (default 15m, at most 7 days). Presigned URLs stop
+	// working when temporary credentials expire.
+	URLExpiry string `json:"urlExpiry,omitempty"`
+	// Region of the bucket, when different from the plugin region.
+	Region string `json:"region,omitempty"`
+	// Endpoint overrides the S3 endpoint, addressed in path style (e.g. a VPC endpoint).
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// s3Offloader stores the request bodies in S3.
+type s3Offloader struct {
+	client    *serviceClient
+	bucket    string
+	prefix    string
+	threshold int64
+	expiry    time.Duration
+	pathStyle bool
+}
+
+func newS3Offloader(config *Config, region string, creds credentialsProvider, httpClient *http.Client) (*s3Offloader, error) {
+	offload := config.S3Offload
+	if offload.Bucket == "" {
+		return nil, fmt.Errorf("s3 offload: bucket cannot be empty")
+	}
+
+	expiry, err := parseDurationDefault(offload.URLExpiry, defaultOffloadURLExpiry)
+	if err != nil || expiry < time.Second || expiry > maxPresignedURLExpiry {
+		return nil, fmt.Errorf("s3 offload: invalid url expiry %q", offload.URLExpiry)
+	}
+
+	o := &s3Offloader{
+		bucket:    offload.Bucket,
+		prefix:    offload.Prefix,
+		threshold: offload.Threshold,
+		expiry:    expiry,
+	}
+	if o.threshold == 0 {
+		o.threshold = defaultOffloadThreshold
+	}
+	if o.threshold < 0 {
+		return nil, fmt.Errorf("s3 offload: threshold must be positive")
+	}
+
+	if offload.Region != "" {
+		region = offload.Region
+	}
+
+	// Bucket names with dots do not match the wildcard certificate of the virtual hosts.
+	o.pathStyle = offload.Endpoint != "" || strings.Contains(o.bucket, ".")
+
+	endpoint, err := o.endpoint(config, region)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.client, err = newServiceClient("s3", region, endpoint, creds, httpClient); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// endpoint returns the configured endpoint, defaulting to the regional one, addressing the bucket as
+// virtual host unless path style.
+func (o *s3Offloader) endpoint(config *Config, region string) (string, error) {
+	if config.S3Offload.Endpoint != "" {
+		return config.S3Offload.Endpoint, nil
+	}
+
+	fips, err := useFIPSEndpoint(config, region)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := serviceEndpoint("s3", region, fips)
+	if !o.pathStyle {
+		endpoint = strings.Replace(endpoint, "://", "://"+o.bucket+".", 1)
+	}
+
+	return endpoint, nil
+}
+
+// offload uploads the body and returns the presigned URL of the object.
+func (o *s3Offloader) offload(ctx context.Context, body []byte, contentType string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	objectPath := "/" + o.prefix + hex.EncodeToString(id)
+	if o.pathStyle {
+		objectPath = "/" + o.bucket + objectPath
+	}
+	escapedPath := escapeRFC3986(objectPath, false)
+
+	header := http.Header{"X-Amz-Content-Sha256": {hashHex(body)}}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := o.client.send(ctx, http.MethodPut, escapedPath, nil, header, body)
+	if err != nil {
+		return "", fmt.Errorf("s3 offload: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("s3 offload: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("s3 offload: %w", newRESTError(resp, respBody))
+	}
+
+	creds, err := o.client.credentials.retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u := *o.client.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + objectPath
+	u.RawPath = strings.TrimSuffix(o.client.endpoint.EscapedPath(), "/") + escapedPath
+
+	return presignV4(&u, creds, o.client.region, "s3", o.expiry, time.Now()), nil
+}
@@ -0,0 +1,92 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3Offload(t *testing.T) {
+	objects := map[string]string{}
+	var event map[string]interface{}
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if req.Method == http.MethodPut {
+			assert.Equal(t, "text/plain", req.Header.Get("Content-Type"))
+			assert.NotEmpty(t, req.Header.Get("X-Amz-Content-Sha256"))
+			assert.Contains(t, req.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request")
+			objects[req.URL.Path] = string(body)
+			res.WriteHeader(200)
+			return
+		}
+
+		event = nil
+		_ = json.Unmarshal(body, &event)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.S3Offload = &awslambdaplugin.S3OffloadConfig{
+		Bucket:    "payloads",
+		Prefix:    "requests/",
+		Threshold: 10,
+		Endpoint:  mockserver.URL,
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(body string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "text/plain")
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+	}
+
+	serve("small")
+	assert.Equal(t, "c21hbGw=", event["body"])
+	assert.NotContains(t, event, "bodyUrl")
+	assert.Empty(t, objects)
+
+	serve("a body over the threshold")
+	assert.Equal(t, "", event["body"])
+	if !assert.Len(t, objects, 1) {
+		return
+	}
+
+	bodyURL, err := url.Parse(event["bodyUrl"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, strings.HasPrefix(bodyURL.Path, "/payloads/requests/"))
+	assert.Equal(t, "a body over the threshold", objects[bodyURL.Path])
+	assert.Equal(t, "900", bodyURL.Query().Get("X-Amz-Expires"))
+	assert.NotEmpty(t, bodyURL.Query().Get("X-Amz-Signature"))
+}
@@ -0,0 +1,101 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	onErrorFail     = "fail"
+	onErrorContinue = "continue"
+)
+
+// parseOnError reports whether the failed invocations continue to the next handler.
+func parseOnError(value string) (bool, error) {
+	switch value {
+	case "", onErrorFail:
+		return false, nil
+	case onErrorContinue:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported onError %q", value)
+	}
+}
+
+// respond writes the response of the invocation. The requests whose invocation failed are passed to
+// the next handler with onError continue; failures without a response of their own are answered
+// with a 504 when the invoke deadline is exceeded, a 502 otherwise.
+func (a *AwsLambdaPlugin) respond(rw http.ResponseWriter, req *http.Request, resp LambdaResponse, err error) {
+	if err == nil {
+		a.writeConditional(rw, req, resp)
+		return
+	}
+
+	if a.continueOnError {
+		a.logger.warnf("invocation failed, passing the request to the next handler: %s", err)
+		a.next.ServeHTTP(rw, req)
+
+		return
+	}
+
+	if resp.StatusCode == 0 {
+		a.writeError(rw, failureStatusCode(err), err)
+		return
+	}
+
+	resp = a.errorStatusCodes.apply(resp, err)
+	invocationRecordOf(rw).setError(resp.StatusCode, err)
+	if errResp, ok := a.errorResponse(resp, err); ok {
+		resp = errResp
+	}
+
+	a.writeResponse(rw, resp)
+}
+
+// writeError logs the cause of a failed request and answers it with the status code, and the error
+// page or JSON error of the failure, if any.
+func (a *AwsLambdaPlugin) writeError(rw http.ResponseWriter, statusCode int, err error) {
+	statusCode = a.errorStatusCodes.apply(LambdaResponse{StatusCode: statusCode}, err).StatusCode
+	invocationRecordOf(rw).setError(statusCode, err)
+	description, _ := statusDescription(statusCode, "")
+	a.logger.errorf("request failed with status %s: %s", description, err)
+
+	if resp, ok := a.errorResponse(LambdaResponse{StatusCode: statusCode}, err); ok {
+		a.writeResponse(rw, resp)
+		return
+	}
+
+	http.Error(rw, http.StatusText(statusCode), statusCode)
+}
+
+// errorResponse replaces the body of an error response with the error page of the failure or, in
+// the json error format, with its JSON error. It reports false when the response is unchanged.
+func (a *AwsLambdaPlugin) errorResponse(resp LambdaResponse, err error) (LambdaResponse, bool) {
+	if page, ok := a.errorPages.apply(resp, err); ok {
+		return page, true
+	}
+
+	if a.jsonErrors {
+		return jsonErrorResponse(resp, err), true
+	}
+
+	return resp, false
+}
+
+// failureStatusCode returns the status code of a failed invocation without a response of its own:
+// 504 when the deadline of the invocation is exceeded, so that slow functions can be told from the
+// failed ones, 413 when the request body exceeds maxRequestBodyBytes, 502 otherwise.
+func failureStatusCode(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	var bodyTooLarge *requestBodyTooLargeError
+	if errors.As(err, &bodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadGateway
+}
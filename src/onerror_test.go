@@ -0,0 +1,88 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnErrorContinue(t *testing.T) {
+	var failure string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch failure {
+		case "service error":
+			res.Header().Set("X-Amzn-Errortype", "ServiceException")
+			res.WriteHeader(500)
+			return
+		case "function error":
+			res.Header().Set("X-Amz-Function-Error", "Unhandled")
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200, \"body\": \"lambda\"}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.OnError = "continue"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		_, _ = rw.Write([]byte("next: " + string(body)))
+	})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		failure  string
+		expected string
+	}{
+		{expected: "lambda"},
+		{failure: "service error", expected: "next: payload"},
+		{failure: "function error", expected: "next: payload"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.failure, func(t *testing.T) {
+			failure = test.failure
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/", strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, 200, recorder.Code)
+			assert.Equal(t, test.expected, recorder.Body.String())
+		})
+	}
+}
+
+func TestOnErrorConfig(t *testing.T) {
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.OnError = "ignore"
+
+	_, err := awslambdaplugin.New(context.Background(), http.NotFoundHandler(), cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported onError "ignore"`)
+}
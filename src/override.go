@@ -0,0 +1,78 @@
+package awslambdaplugin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+const defaultFunctionOverrideHeader = "X-Lambda-Override"
+
+// FunctionOverrideConfig lets a request header select another function, e.g. to route developer
+// preview environments through the same edge. Only the allowlisted header values are honored.
+type FunctionOverrideConfig struct {
+	// Header carrying the override (default X-Lambda-Override). It is never forwarded to the function.
+	Header string `json:"header,omitempty"`
+	// Targets maps the allowed header values to the function ARN, name or alias to invoke instead,
+	// e.g. "pr-42": "arn:aws:lambda:eu-west-1:000000000000:function:app:pr-42". Qualifier does not
+	// apply to the targets.
+	Targets map[string]string `json:"targets,omitempty"`
+	// TrustedIPs restricts the override to clients in these IPs or CIDR ranges.
+	TrustedIPs []string `json:"trustedIps,omitempty"`
+}
+
+// functionOverride selects the function to invoke from the override header.
+type functionOverride struct {
+	header  string
+	targets map[string]string
+	trusted []*net.IPNet
+}
+
+func newFunctionOverride(config *FunctionOverrideConfig, region string) (*functionOverride, error) {
+	if len(config.Targets) == 0 {
+		return nil, fmt.Errorf("function override: no targets")
+	}
+
+	for value, target := range config.Targets {
+		fn, err := parseFunctionArn(target)
+		if err != nil {
+			return nil, fmt.Errorf("function override: target %q: %w", value, err)
+		}
+
+		if _, err := functionRegion(region, fn); err != nil {
+			return nil, fmt.Errorf("function override: target %q: %w", value, err)
+		}
+	}
+
+	trusted, err := parseCIDRs(config.TrustedIPs)
+	if err != nil {
+		return nil, fmt.Errorf("function override: invalid trusted ips: %w", err)
+	}
+
+	header := config.Header
+	if header == "" {
+		header = defaultFunctionOverrideHeader
+	}
+
+	return &functionOverride{
+		header:  http.CanonicalHeaderKey(header),
+		targets: config.Targets,
+		trusted: trusted,
+	}, nil
+}
+
+// target returns the function selected by the request and strips the header from it.
+// It returns an empty string when the header is absent, not allowlisted or sent by an untrusted client.
+func (o *functionOverride) target(req *http.Request) string {
+	value := req.Header.Get(o.header)
+	if value == "" {
+		return ""
+	}
+
+	req.Header.Del(o.header)
+	if !isTrustedAddr(o.trusted, req.RemoteAddr) {
+		return ""
+	}
+
+	return o.targets[value]
+}
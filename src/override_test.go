@@ -0,0 +1,95 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFunctionOverride(t *testing.T) {
+	var path, qualifier string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		path = req.URL.EscapedPath()
+		qualifier = req.URL.Query().Get("Qualifier")
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		desc       string
+		value      string
+		remoteAddr string
+		path       string
+		qualifier  string
+	}{
+		{desc: "no header", path: "/2015-03-31/functions/xxx/invocations", qualifier: "live"},
+		{desc: "allowlisted", value: "pr-42", path: "/2015-03-31/functions/preview%3Apr-42/invocations"},
+		{desc: "unknown", value: "pr-43", path: "/2015-03-31/functions/xxx/invocations", qualifier: "live"},
+		{desc: "untrusted", value: "pr-42", remoteAddr: "192.0.2.1:1234", path: "/2015-03-31/functions/xxx/invocations", qualifier: "live"},
+	}
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "xxx"
+	cfg.Qualifier = "live"
+	cfg.Endpoint = mockserver.URL
+	cfg.FunctionOverride = &awslambdaplugin.FunctionOverrideConfig{
+		Targets:    map[string]string{"pr-42": "preview:pr-42"},
+		TrustedIPs: []string{"10.0.0.0/8"},
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.RemoteAddr = "10.0.0.1:1234"
+			if test.remoteAddr != "" {
+				req.RemoteAddr = test.remoteAddr
+			}
+			if test.value != "" {
+				req.Header.Set("X-Lambda-Override", test.value)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, 200, recorder.Result().StatusCode)
+			assert.Equal(t, test.path, path)
+			assert.Equal(t, test.qualifier, qualifier)
+			assert.Empty(t, req.Header.Get("X-Lambda-Override"))
+		})
+	}
+}
+
+func TestFunctionOverrideInvalidTarget(t *testing.T) {
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.FunctionOverride = &awslambdaplugin.FunctionOverrideConfig{
+		Targets: map[string]string{"pr-42": "arn:aws:lambda:us-east-1:000000000000:function:preview"},
+	}
+
+	_, err := awslambdaplugin.New(context.Background(), http.NotFoundHandler(), cfg, "lambda-plugin")
+	assert.EqualError(t, err, `function override: target "pr-42": region "eu-west-1" does not match the function arn region "us-east-1"`)
+}
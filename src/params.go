@@ -0,0 +1,334 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ssmParameterPrefix   = "ssm://"
+	secretsManagerPrefix = "secretsmanager://"
+
+	parameterLookupTimeout        = 10 * time.Second
+	parameterRefreshRetryInterval = 10 * time.Second
+)
+
+// ParametersConfig configures the lookup of the values given as SSM Parameter Store (ssm:///path)
+// or Secrets Manager (secretsmanager://name[#jsonKey]) references.
+type ParametersConfig struct {
+	// RefreshInterval re-resolves the references in background this often. Unset resolves them once.
+	RefreshInterval string `json:"refreshInterval,omitempty"`
+	// Region of the parameters and secrets, when different from the plugin region.
+	Region string `json:"region,omitempty"`
+	// SSMEndpoint and SecretsManagerEndpoint override the service endpoints (e.g. VPC endpoints).
+	SSMEndpoint            string `json:"ssmEndpoint,omitempty"`
+	SecretsManagerEndpoint string `json:"secretsManagerEndpoint,omitempty"`
+}
+
+// isParameterRef reports whether the value references an SSM parameter or a Secrets Manager secret.
+func isParameterRef(value string) bool {
+	return strings.HasPrefix(value, ssmParameterPrefix) || strings.HasPrefix(value, secretsManagerPrefix)
+}
+
+// parameterClient resolves the parameter references through the SSM and Secrets Manager JSON APIs.
+type parameterClient struct {
+	ssm     *serviceClient
+	secrets *serviceClient
+	refresh time.Duration
+	logger  *logger
+}
+
+// hasParameterRefs reports whether any of the values supporting references is one.
+func hasParameterRefs(config *Config) bool {
+	for _, value := range []string{config.FunctionArn, config.Qualifier, config.AccessKey, config.SecretKey, config.SessionToken} {
+		if isParameterRef(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newParameterClient(config *Config, region, profile string, httpClient *http.Client, cache cacheOptions) (*parameterClient, error) {
+	var (
+		ssmEndpoint, secretsEndpoint string
+		refresh                      time.Duration
+		err                          error
+	)
+	if config.Parameters != nil {
+		refresh, err = parseDurationDefault(config.Parameters.RefreshInterval, 0)
+		if err != nil {
+			return nil, fmt.Errorf("parameters: invalid refresh interval: %w", err)
+		}
+
+		ssmEndpoint = config.Parameters.SSMEndpoint
+		secretsEndpoint = config.Parameters.SecretsManagerEndpoint
+		if config.Parameters.Region != "" {
+			region = config.Parameters.Region
+		}
+	}
+
+	fips, err := useFIPSEndpoint(config, region)
+	if err != nil {
+		return nil, err
+	}
+
+	if ssmEndpoint == "" {
+		ssmEndpoint = serviceEndpoint("ssm", region, fips)
+	}
+
+	if secretsEndpoint == "" {
+		secretsEndpoint = serviceEndpoint("secretsmanager", region, fips)
+	}
+
+	creds, err := ambientCredentials(config, profile, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	ssm, err := newServiceClient("ssm", region, ssmEndpoint, creds, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := newServiceClient("secretsmanager", region, secretsEndpoint, creds, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parameterClient{ssm: ssm, secrets: secrets, refresh: refresh, logger: cache.logger}, nil
+}
+
+// lookup returns the current value of a reference.
+func (c *parameterClient) lookup(ctx context.Context, ref string) (string, error) {
+	if strings.HasPrefix(ref, ssmParameterPrefix) {
+		return c.getParameter(ctx, strings.TrimPrefix(ref, ssmParameterPrefix))
+	}
+
+	name := strings.TrimPrefix(ref, secretsManagerPrefix)
+	key := ""
+	if i := strings.LastIndexByte(name, '#'); i >= 0 {
+		name, key = name[:i], name[i+1:]
+	}
+
+	return c.getSecretValue(ctx, name, key)
+}
+
+func (c *parameterClient) getParameter(ctx context.Context, name string) (string, error) {
+	in := map[string]interface{}{"Name": name, "WithDecryption": true}
+
+	var out struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	if err := c.ssm.callJSON(ctx, "AmazonSSM.GetParameter", in, &out); err != nil {
+		return "", err
+	}
+
+	return out.Parameter.Value, nil
+}
+
+func (c *parameterClient) getSecretValue(ctx context.Context, name, key string) (string, error) {
+	in := map[string]interface{}{"SecretId": name}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+	}
+	if err := c.secrets.callJSON(ctx, "secretsmanager.GetSecretValue", in, &out); err != nil {
+		return "", err
+	}
+
+	value := out.SecretString
+	if value == "" {
+		value = string(out.SecretBinary)
+	}
+
+	if key == "" {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a json object", name)
+	}
+
+	field, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no %q string key", name, key)
+	}
+
+	return field, nil
+}
+
+// parameterValue a configuration value, optionally resolved from a parameter reference. Once the
+// refresh interval has elapsed the reference is looked up again in background, while the current
+// value is still served; a failed or rejected lookup keeps the current value.
+type parameterValue struct {
+	client   *parameterClient
+	ref      string
+	interval time.Duration
+	validate func(string) error
+	logger   *logger
+
+	mu          sync.Mutex
+	value       string
+	nextRefresh time.Time
+	refreshing  bool
+}
+
+// newParameterValue resolves the value; plain values are returned as is.
+func newParameterValue(ctx context.Context, client *parameterClient, name, value string) (*parameterValue, error) {
+	if !isParameterRef(value) {
+		return &parameterValue{value: value}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, parameterLookupTimeout)
+	defer cancel()
+
+	resolved, err := client.lookup(ctx, value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s: %w", name, err)
+	}
+
+	p := &parameterValue{client: client, ref: value, interval: client.refresh, value: resolved, logger: client.logger}
+	if p.interval > 0 {
+		p.nextRefresh = time.Now().Add(p.interval)
+	}
+
+	return p, nil
+}
+
+func (p *parameterValue) get() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.interval > 0 && !p.refreshing && !time.Now().Before(p.nextRefresh) {
+		p.refreshing = true
+		go p.refresh()
+	}
+
+	return p.value
+}
+
+// refresh looks the reference up again in background.
+func (p *parameterValue) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), parameterLookupTimeout)
+	defer cancel()
+
+	value, err := p.client.lookup(ctx, p.ref)
+	if err == nil && p.validate != nil {
+		err = p.validate(value)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.refreshing = false
+	if err != nil {
+		p.logger.warnf("refresh of %s failed, retrying in %s: %s", p.ref, parameterRefreshRetryInterval, err)
+		p.nextRefresh = time.Now().Add(parameterRefreshRetryInterval)
+		return
+	}
+
+	p.value = value
+	p.nextRefresh = time.Now().Add(p.interval)
+}
+
+// parameterCredentials static credentials whose values may be parameter references.
+type parameterCredentials struct {
+	accessKey, secretKey, sessionToken *parameterValue
+}
+
+func (c parameterCredentials) retrieve(context.Context) (awsCredentials, error) {
+	return awsCredentials{
+		AccessKeyID:     c.accessKey.get(),
+		SecretAccessKey: c.secretKey.get(),
+		SessionToken:    c.sessionToken.get(),
+		Source:          "parameter store",
+	}, nil
+}
+
+// newFunctionValue resolves the function ARN and qualifier, so that deployments can switch the
+// invoked function or alias by updating a parameter. Referenced values are validated like configured
+// ones, also when refreshed, and the ARN must stay in the plugin region; config.FunctionArn and
+// config.Qualifier are set to the resolved values.
+func newFunctionValue(ctx context.Context, client *parameterClient, config *Config, region string) (*parameterValue, *parameterValue, error) {
+	function, err := newParameterValue(ctx, client, "functionArn", config.FunctionArn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qualifier, err := newParameterValue(ctx, client, "qualifier", config.Qualifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validate := func(functionArn, qualifier string) error {
+		fn, err := parseFunctionArn(functionArn)
+		if err != nil {
+			return err
+		}
+
+		if _, err := functionRegion(region, fn); err != nil {
+			return err
+		}
+
+		return checkQualifier(qualifier, fn)
+	}
+
+	if function.ref != "" {
+		function.validate = func(value string) error { return validate(value, qualifier.get()) }
+		if err := function.validate(function.value); err != nil {
+			return nil, nil, fmt.Errorf("invalid functionArn %s: %w", function.ref, err)
+		}
+	}
+
+	if qualifier.ref != "" {
+		qualifier.validate = func(value string) error { return validate(function.get(), value) }
+		if err := qualifier.validate(qualifier.value); err != nil {
+			return nil, nil, fmt.Errorf("invalid qualifier %s: %w", qualifier.ref, err)
+		}
+	}
+
+	config.FunctionArn = function.value
+	config.Qualifier = qualifier.value
+
+	return function, qualifier, nil
+}
+
+// newConfigCredentials returns the credentials of the configuration, resolving the referenced keys.
+func newConfigCredentials(ctx context.Context, config *Config, client *parameterClient) (credentialsProvider, error) {
+	if !isParameterRef(config.AccessKey) && !isParameterRef(config.SecretKey) && !isParameterRef(config.SessionToken) {
+		return staticCredentials{
+			AccessKeyID:     config.AccessKey,
+			SecretAccessKey: config.SecretKey,
+			SessionToken:    config.SessionToken,
+			Source:          "configuration",
+		}, nil
+	}
+
+	var (
+		creds parameterCredentials
+		err   error
+	)
+	if creds.accessKey, err = newParameterValue(ctx, client, "accessKey", config.AccessKey); err != nil {
+		return nil, err
+	}
+
+	if creds.secretKey, err = newParameterValue(ctx, client, "secretKey", config.SecretKey); err != nil {
+		return nil, err
+	}
+
+	if creds.sessionToken, err = newParameterValue(ctx, client, "sessionToken", config.SessionToken); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
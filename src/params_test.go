@@ -0,0 +1,209 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParameterReferences(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "ambient-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "ambient-secret")
+
+	var mu sync.Mutex
+	activeFunction := "arn:aws:lambda:eu-west-1:000000000000:function:blue"
+
+	params := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Contains(t, req.Header.Get("Authorization"), "Credential=ambient-key/")
+
+		var in map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			t.Fatal(err)
+		}
+
+		switch req.Header.Get("X-Amz-Target") {
+		case "AmazonSSM.GetParameter":
+			assert.Equal(t, "/traefik/function", in["Name"])
+			assert.Equal(t, true, in["WithDecryption"])
+
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = res.Write([]byte(`{"Parameter": {"Name": "/traefik/function", "Value": "` + activeFunction + `"}}`))
+		case "secretsmanager.GetSecretValue":
+			assert.Equal(t, "traefik/keys", in["SecretId"])
+			_, _ = res.Write([]byte(`{"SecretString": "{\"id\": \"secret-key-id\", \"secret\": \"secret-value\"}"}`))
+		default:
+			t.Errorf("unexpected target %q", req.Header.Get("X-Amz-Target"))
+		}
+	}))
+	defer func() { params.Close() }()
+
+	var invoked []string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Contains(t, req.Header.Get("Authorization"), "Credential=secret-key-id/")
+
+		mu.Lock()
+		invoked = append(invoked, req.URL.EscapedPath())
+		mu.Unlock()
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "secretsmanager://traefik/keys#id"
+	cfg.SecretKey = "secretsmanager://traefik/keys#secret"
+	cfg.FunctionArn = "ssm:///traefik/function"
+	cfg.Endpoint = mockserver.URL
+	cfg.Parameters = &awslambdaplugin.ParametersConfig{
+		RefreshInterval:        "10ms",
+		SSMEndpoint:            params.URL,
+		SecretsManagerEndpoint: params.URL,
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+	}
+
+	serve()
+	assert.Contains(t, invoked[0], "/functions/arn%3Aaws%3Alambda%3Aeu-west-1%3A000000000000%3Afunction%3Ablue/")
+
+	mu.Lock()
+	activeFunction = "arn:aws:lambda:eu-west-1:000000000000:function:green"
+	mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		serve()
+
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Contains(invoked[len(invoked)-1], "function%3Agreen")
+	}, time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	activeFunction = "arn:aws:lambda:us-east-1:000000000000:function:other"
+	mu.Unlock()
+
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `invalid functionArn ssm:///traefik/function: region "eu-west-1" does not match the function arn region "us-east-1"`)
+
+	mu.Lock()
+	activeFunction = "arn:aws:lambda:eu-west-1:000000000000:function:blue"
+	mu.Unlock()
+
+	cfg.AccessKey = "secretsmanager://traefik/keys#missing"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `cannot resolve accessKey: secret traefik/keys has no "missing" string key`)
+}
+
+func TestQualifierParameterReference(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "ambient-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "ambient-secret")
+
+	var mu sync.Mutex
+	activeQualifier := "blue"
+
+	params := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var in map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "/traefik/qualifier", in["Name"])
+
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = res.Write([]byte(`{"Parameter": {"Name": "/traefik/qualifier", "Value": "` + activeQualifier + `"}}`))
+	}))
+	defer func() { params.Close() }()
+
+	var invoked []string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		invoked = append(invoked, req.URL.Query().Get("Qualifier"))
+		mu.Unlock()
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx"
+	cfg.Qualifier = "ssm:///traefik/qualifier"
+	cfg.Endpoint = mockserver.URL
+	cfg.Parameters = &awslambdaplugin.ParametersConfig{
+		RefreshInterval: "10ms",
+		SSMEndpoint:     params.URL,
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+	}
+
+	serve()
+	assert.Equal(t, "blue", invoked[0])
+
+	mu.Lock()
+	activeQualifier = "green"
+	mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		serve()
+
+		mu.Lock()
+		defer mu.Unlock()
+		return invoked[len(invoked)-1] == "green"
+	}, time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	activeQualifier = "not valid"
+	mu.Unlock()
+
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid qualifier ssm:///traefik/qualifier: ")
+}
@@ -0,0 +1,112 @@
+package awslambdaplugin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// syncPayloadLimit is the largest payload of the synchronous and streamed invocations.
+	syncPayloadLimit = 6 * 1024 * 1024
+	// eventPayloadLimit is the largest payload of the asynchronous (Event) invocations.
+	eventPayloadLimit = 1024 * 1024
+)
+
+// payloadTooLargeError reports an invocation payload over the Lambda limit.
+type payloadTooLargeError struct {
+	size, limit int64
+}
+
+func (e *payloadTooLargeError) Error() string {
+	return fmt.Sprintf("the invocation payload of %d bytes exceeds the %d bytes limit", e.size, e.limit)
+}
+
+// requestBodyTooLargeError reports a request body over maxRequestBodyBytes.
+type requestBodyTooLargeError struct {
+	limit int64
+}
+
+func (e *requestBodyTooLargeError) Error() string {
+	return fmt.Sprintf("the request body exceeds the %d bytes limit", e.limit)
+}
+
+// limitedBody is a request body failing once more than limit bytes are read, for the requests
+// whose length is unknown or not trusted.
+type limitedBody struct {
+	io.ReadCloser
+	limit, remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, &requestBodyTooLargeError{limit: b.limit}
+	}
+
+	// Read one byte over the limit to tell a body of that exact size from a larger one.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), &requestBodyTooLargeError{limit: b.limit}
+	}
+
+	return n, err
+}
+
+// payloadLimit returns the largest payload of the invocations of the type.
+func payloadLimit(invocationType string) int64 {
+	if invocationType == invocationTypeEvent {
+		return eventPayloadLimit
+	}
+
+	return syncPayloadLimit
+}
+
+// checkPayloadSize returns an error when the payload exceeds the invocation limit.
+func checkPayloadSize(size int64, invocationType string) error {
+	if limit := payloadLimit(invocationType); size > limit {
+		return &payloadTooLargeError{size: size, limit: limit}
+	}
+
+	return nil
+}
+
+// checkContentLength answers 413 to the requests whose declared body alone exceeds maxRequestBodyBytes
+// or the payload limit, before reading it, unless the bodies are offloaded to S3 or streamed to the
+// function URL. The declared length is not trusted, nor known for the chunked requests: the bodies are
+// cut at maxRequestBodyBytes, or at the payload limit. Bodies growing over the limit once encoded are
+// rejected when the payload is built.
+func (a *AwsLambdaPlugin) checkContentLength(rw http.ResponseWriter, req *http.Request) bool {
+	if a.maxBodyBytes > 0 && req.ContentLength > a.maxBodyBytes {
+		writePayloadTooLarge(rw, &requestBodyTooLargeError{limit: a.maxBodyBytes})
+		return false
+	}
+
+	limit := a.maxBodyBytes
+	if limit == 0 && a.offload == nil && a.functionURL == nil {
+		limit = payloadLimit(a.types.get(req.Method))
+	}
+
+	if limit > 0 && req.Body != nil && req.Body != http.NoBody {
+		req.Body = &limitedBody{ReadCloser: req.Body, limit: limit, remaining: limit}
+	}
+
+	if a.offload != nil || a.functionURL != nil {
+		return true
+	}
+
+	if err := checkPayloadSize(req.ContentLength, a.types.get(req.Method)); err != nil {
+		writePayloadTooLarge(rw, err)
+		return false
+	}
+
+	return true
+}
+
+func writePayloadTooLarge(rw http.ResponseWriter, err error) {
+	http.Error(rw, http.StatusText(http.StatusRequestEntityTooLarge)+": "+err.Error(), http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,189 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadLimit(t *testing.T) {
+	calls := 0
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc   string
+		size   int
+		status int
+		calls  int
+	}{
+		{desc: "small", size: 1024, status: 200, calls: 1},
+		{desc: "base64 encoded over the limit", size: 5 * 1024 * 1024, status: 413},
+		{desc: "content length over the limit", size: 7 * 1024 * 1024, status: 413},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			calls = 0
+
+			body := bytes.Repeat([]byte{0xff}, test.size)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/octet-stream")
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.calls, calls)
+			if test.status == 413 {
+				assert.Contains(t, recorder.Body.String(), "exceeds the 6291456 bytes limit")
+			}
+		})
+	}
+}
+
+func TestMaxRequestBodyBytes(t *testing.T) {
+	calls := 0
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.MaxRequestBodyBytes = 1024
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc          string
+		size          int
+		contentLength int64
+		status        int
+		calls         int
+	}{
+		{desc: "at the limit", size: 1024, contentLength: 1024, status: 200, calls: 1},
+		{desc: "content length over the limit", size: 1025, contentLength: 1025, status: 413},
+		{desc: "unknown length at the limit", size: 1024, contentLength: -1, status: 200, calls: 1},
+		{desc: "unknown length over the limit", size: 4096, contentLength: -1, status: 413},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			calls = 0
+
+			body := bytes.Repeat([]byte("a"), test.size)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.ContentLength = test.contentLength
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.calls, calls)
+		})
+	}
+
+	cfg.MaxRequestBodyBytes = -1
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "max request body bytes cannot be negative")
+}
+
+func TestUnknownLengthRequestBody(t *testing.T) {
+	var received awslambdaplugin.LambdaRequest
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		received = awslambdaplugin.LambdaRequest{}
+		_ = json.NewDecoder(req.Body).Decode(&received)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, contentLength := range []int64{-1, 0} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.ContentLength = contentLength
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, 200, recorder.Code)
+		assert.Equal(t, "aGVsbG8=", received.Body, "content length %d", contentLength)
+	}
+
+	// Unknown-length bodies are cut at the payload limit.
+	body := bytes.Repeat([]byte("a"), 6*1024*1024+1)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = -1
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 413, recorder.Code)
+}
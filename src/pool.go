@@ -0,0 +1,44 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the capacity of the largest buffer returned to the pool, so that a few
+// large payloads do not pin their memory.
+const maxPooledBufferSize = 1024 * 1024
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// readAll reads r to its end in a pooled buffer, sized for the expected length when known, and
+// returns a copy of the content. It is nil when empty.
+func readAll(r io.Reader, size int64) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if size > 0 && size <= maxPooledBufferSize {
+		// ReadFrom needs MinRead free bytes to detect the end without growing the buffer.
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), buf.Bytes()...), nil
+}
@@ -0,0 +1,90 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+)
+
+// benchmarkServeHTTP measures the requests proxied to a function answering with the body.
+func benchmarkServeHTTP(b *testing.B, body []byte, base64Encoded bool) {
+	b.Helper()
+
+	respBody := string(body)
+	if base64Encoded {
+		respBody = base64.StdEncoding.EncodeToString(body)
+	}
+
+	response, err := json.Marshal(awslambdaplugin.LambdaResponse{
+		StatusCode:      200,
+		Headers:         map[string]string{"Content-Type": "application/octet-stream"},
+		IsBase64Encoded: base64Encoded,
+		Body:            respBody,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write(response)
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	payload := bytes.Repeat([]byte("x"), len(body))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/items?page=1", bytes.NewReader(payload))
+			if err != nil {
+				b.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "text/plain")
+			req.Header.Set("Accept", "*/*")
+			req.Header.Add("X-Forwarded-For", "192.0.2.1")
+			req.Header.Add("X-Forwarded-For", "192.0.2.2")
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code != 200 {
+				b.Fatalf("unexpected status %d", recorder.Code)
+			}
+		}
+	})
+}
+
+func BenchmarkServeHTTPSmall(b *testing.B) {
+	benchmarkServeHTTP(b, []byte("hello"), false)
+}
+
+func BenchmarkServeHTTPLarge(b *testing.B) {
+	benchmarkServeHTTP(b, bytes.Repeat([]byte("0123456789abcdef"), 4096), false)
+}
+
+func BenchmarkServeHTTPLargeBase64(b *testing.B) {
+	benchmarkServeHTTP(b, bytes.Repeat([]byte("0123456789abcdef"), 4096), true)
+}
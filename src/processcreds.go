@@ -0,0 +1,86 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const processCredentialsTimeout = time.Minute
+
+// processCredentials credentials printed by an external helper command (credential_process),
+// e.g. a Vault or 1Password broker.
+type processCredentials struct {
+	command string
+}
+
+// newProfileProcessCredentials returns the credential_process of a shared credentials or config
+// file profile, or nil when the profile defines none.
+func newProfileProcessCredentials(profile string) credentialsProvider {
+	if ini, err := loadINI(sharedCredentialsFilename()); err == nil {
+		if command := ini[profile]["credential_process"]; command != "" {
+			return &processCredentials{command: command}
+		}
+	}
+
+	if ini, err := loadINI(sharedConfigFilename()); err == nil {
+		if command := profileSection(ini, profile)["credential_process"]; command != "" {
+			return &processCredentials{command: command}
+		}
+	}
+
+	return nil
+}
+
+func (p *processCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, processCredentialsTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd.exe", "/C", p.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", p.command)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return awsCredentials{}, fmt.Errorf("credential process: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var payload struct {
+		Version         int       `json:"Version"`
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		SessionToken    string    `json:"SessionToken"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		return awsCredentials{}, fmt.Errorf("credential process: invalid output: %w", err)
+	}
+
+	if payload.Version != 1 {
+		return awsCredentials{}, fmt.Errorf("credential process: unsupported output version %d", payload.Version)
+	}
+
+	if payload.AccessKeyID == "" || payload.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("credential process: %w", errNoCredentials)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     payload.AccessKeyID,
+		SecretAccessKey: payload.SecretAccessKey,
+		SessionToken:    payload.SessionToken,
+		Expires:         payload.Expiration,
+		Source:          "credential process",
+	}, nil
+}
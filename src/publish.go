@@ -0,0 +1,307 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// publishMessageLimit is the maximum size of an SNS or SQS message, or of an EventBridge entry.
+	publishMessageLimit = 256 * 1024
+
+	messageIDPlaceholder = "{messageId}"
+
+	defaultPublishSource     = "traefik"
+	defaultPublishDetailType = "HTTP Request"
+)
+
+// PublishConfig publishes the event of the matching requests to an SNS topic, an SQS queue or an
+// EventBridge event bus instead of invoking the function, answering right away, e.g. to ingest
+// webhooks without a function in the hot path.
+type PublishConfig struct {
+	// TopicArn of the SNS topic, QueueURL of the SQS queue or EventBusName (name or ARN) of the
+	// EventBridge bus receiving the events.
+	TopicArn     string `json:"topicArn,omitempty"`
+	QueueURL     string `json:"queueUrl,omitempty"`
+	EventBusName string `json:"eventBusName,omitempty"`
+	// MessageGroupID is required by the FIFO topics and queues.
+	MessageGroupID string `json:"messageGroupId,omitempty"`
+	// Source (default traefik) and DetailType (default "HTTP Request") of the EventBridge events,
+	// whose detail is the HTTP event.
+	Source     string `json:"source,omitempty"`
+	DetailType string `json:"detailType,omitempty"`
+	// Methods whose requests are published (default all): the other ones invoke functionArn.
+	Methods []string `json:"methods,omitempty"`
+	// StatusCode of the response, 202 (default) or 204.
+	StatusCode int `json:"statusCode,omitempty"`
+	// Body and Headers of the 202 responses; {messageId} placeholders are replaced with the ID of the
+	// message or event (default {"messageId":"{messageId}"}).
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Endpoint overrides the SNS, SQS or EventBridge endpoint of the region.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// publisher sends the events to the topic, the queue or the event bus.
+type publisher struct {
+	topicArn       string
+	queueURL       string
+	eventBusName   string
+	messageGroupID string
+	source         string
+	detailType     string
+	methods        map[string]bool
+	statusCode     int
+	body           string
+	headers        map[string]string
+	client         *serviceClient
+}
+
+func newPublisher(config *PublishConfig, region string, creds credentialsProvider, httpClient *http.Client) (*publisher, error) {
+	if publishTargets(config) != 1 {
+		return nil, fmt.Errorf("publish: one of topicArn, queueUrl and eventBusName is required")
+	}
+
+	p := &publisher{
+		topicArn:       config.TopicArn,
+		queueURL:       config.QueueURL,
+		eventBusName:   config.EventBusName,
+		messageGroupID: config.MessageGroupID,
+		source:         config.Source,
+		detailType:     config.DetailType,
+		statusCode:     config.StatusCode,
+		body:           config.Body,
+		headers:        map[string]string{},
+	}
+	p.setDefaults(config)
+
+	if p.statusCode != http.StatusAccepted && p.statusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("publish: status code must be 202 or 204")
+	}
+
+	service, err := p.service(region)
+	if err != nil {
+		return nil, err
+	}
+
+	p.client, err = newServiceClient(service, region, config.Endpoint, creds, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("publish: %w", err)
+	}
+
+	if service == "sqs" {
+		p.client.jsonVersion = "1.0"
+	}
+
+	return p, nil
+}
+
+// publishTargets counts the configured topic, queue and event bus.
+func publishTargets(config *PublishConfig) int {
+	targets := 0
+	for _, target := range []string{config.TopicArn, config.QueueURL, config.EventBusName} {
+		if target != "" {
+			targets++
+		}
+	}
+
+	return targets
+}
+
+func (p *publisher) setDefaults(config *PublishConfig) {
+	if p.source == "" {
+		p.source = defaultPublishSource
+	}
+	if p.detailType == "" {
+		p.detailType = defaultPublishDetailType
+	}
+
+	for name, value := range config.Headers {
+		p.headers[name] = value
+	}
+
+	if p.body == "" {
+		p.body = `{"messageId":"` + messageIDPlaceholder + `"}`
+		if !hasHeader(p.headers, "Content-Type") {
+			p.headers["Content-Type"] = "application/json"
+		}
+	}
+
+	if p.statusCode == 0 {
+		p.statusCode = http.StatusAccepted
+	}
+
+	if len(config.Methods) > 0 {
+		p.methods = map[string]bool{}
+		for _, m := range config.Methods {
+			p.methods[strings.ToUpper(m)] = true
+		}
+	}
+}
+
+// service returns the name of the service receiving the events, validating the topic arn or the
+// queue url.
+func (p *publisher) service(region string) (string, error) {
+	switch {
+	case p.eventBusName != "":
+		return "events", nil
+	case p.topicArn != "":
+		parts := strings.Split(p.topicArn, ":")
+		if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" {
+			return "", fmt.Errorf("publish: invalid topic arn %q", p.topicArn)
+		}
+
+		if parts[3] != region {
+			return "", fmt.Errorf("publish: region %q does not match the topic arn region %q", region, parts[3])
+		}
+
+		return "sns", nil
+	default:
+		if u, err := url.Parse(p.queueURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return "", fmt.Errorf("publish: invalid queue url %q", p.queueURL)
+		}
+
+		return "sqs", nil
+	}
+}
+
+// target returns the topic, the queue or the event bus receiving the events.
+func (p *publisher) target() string {
+	switch {
+	case p.eventBusName != "":
+		return p.eventBusName
+	case p.topicArn != "":
+		return p.topicArn
+	default:
+		return p.queueURL
+	}
+}
+
+// matches reports whether the requests with the method are published.
+func (p *publisher) matches(method string) bool {
+	return p.methods == nil || p.methods[method]
+}
+
+// publish sends the message, returning its ID.
+func (p *publisher) publish(ctx context.Context, message []byte) (string, error) {
+	if p.eventBusName != "" {
+		return p.putEvent(ctx, message)
+	}
+
+	if p.topicArn != "" {
+		form := url.Values{}
+		form.Set("Action", "Publish")
+		form.Set("Version", "2010-03-31")
+		form.Set("TopicArn", p.topicArn)
+		form.Set("Message", string(message))
+		if p.messageGroupID != "" {
+			form.Set("MessageGroupId", p.messageGroupID)
+		}
+
+		var out struct {
+			MessageID string `xml:"PublishResult>MessageId"`
+		}
+		if err := p.client.query(ctx, form, &out); err != nil {
+			return "", err
+		}
+
+		return out.MessageID, nil
+	}
+
+	in := map[string]string{
+		"QueueUrl":    p.queueURL,
+		"MessageBody": string(message),
+	}
+	if p.messageGroupID != "" {
+		in["MessageGroupId"] = p.messageGroupID
+	}
+
+	var out struct {
+		MessageID string `json:"MessageId"`
+	}
+	if err := p.client.callJSON(ctx, "AmazonSQS.SendMessage", in, &out); err != nil {
+		return "", err
+	}
+
+	return out.MessageID, nil
+}
+
+// putEvent sends the message as the detail of an EventBridge event, returning the event ID.
+func (p *publisher) putEvent(ctx context.Context, detail []byte) (string, error) {
+	in := map[string][]map[string]string{
+		"Entries": {{
+			"EventBusName": p.eventBusName,
+			"Source":       p.source,
+			"DetailType":   p.detailType,
+			"Detail":       string(detail),
+		}},
+	}
+
+	var out struct {
+		FailedEntryCount int `json:"FailedEntryCount"`
+		Entries          []struct {
+			EventID      string `json:"EventId"`
+			ErrorCode    string `json:"ErrorCode"`
+			ErrorMessage string `json:"ErrorMessage"`
+		} `json:"Entries"`
+	}
+	if err := p.client.callJSON(ctx, "AWSEvents.PutEvents", in, &out); err != nil {
+		return "", err
+	}
+
+	if len(out.Entries) != 1 {
+		return "", fmt.Errorf("publish: unexpected PutEvents response with %d entries", len(out.Entries))
+	}
+
+	if entry := out.Entries[0]; out.FailedEntryCount > 0 || entry.ErrorCode != "" {
+		return "", fmt.Errorf("publish: event rejected: %s: %s", entry.ErrorCode, entry.ErrorMessage)
+	}
+
+	return out.Entries[0].EventID, nil
+}
+
+// response returns the response of a published request.
+func (p *publisher) response(messageID string) LambdaResponse {
+	if p.statusCode == http.StatusNoContent {
+		return LambdaResponse{StatusCode: http.StatusNoContent}
+	}
+
+	headers := make(map[string]string, len(p.headers))
+	for name, value := range p.headers {
+		headers[name] = strings.ReplaceAll(value, messageIDPlaceholder, messageID)
+	}
+
+	return LambdaResponse{
+		StatusCode: p.statusCode,
+		Headers:    headers,
+		Body:       strings.ReplaceAll(p.body, messageIDPlaceholder, messageID),
+	}
+}
+
+// servePublish publishes the event of the request.
+func (a *AwsLambdaPlugin) servePublish(ctx context.Context, rw http.ResponseWriter, req *http.Request, request *LambdaRequest, body []byte) {
+	invocationRecordOf(rw).setTarget(a.publisher.target())
+
+	message, err := a.codec.encode(request, body, a.compat.encodeAsText(req, body))
+	if err != nil {
+		a.writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(message) > publishMessageLimit {
+		writePayloadTooLarge(rw, &payloadTooLargeError{size: int64(len(message)), limit: publishMessageLimit})
+		return
+	}
+
+	messageID, err := a.publisher.publish(ctx, message)
+	if err != nil {
+		resp, _ := throttledResponse(err)
+		a.respond(rw, req, resp, err)
+		return
+	}
+
+	a.respond(rw, req, a.publisher.response(messageID), nil)
+}
@@ -0,0 +1,154 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	var message string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		switch {
+		case strings.Contains(req.Header.Get("Authorization"), "/sns/aws4_request"):
+			form, _ := url.ParseQuery(string(body))
+			assert.Equal(t, "Publish", form.Get("Action"))
+			assert.Equal(t, "arn:aws:sns:eu-west-1:000000000000:webhooks", form.Get("TopicArn"))
+			message = form.Get("Message")
+
+			_, _ = res.Write([]byte(`<PublishResponse><PublishResult><MessageId>sns-id</MessageId></PublishResult></PublishResponse>`))
+		case strings.Contains(req.Header.Get("Authorization"), "/sqs/aws4_request"):
+			assert.Equal(t, "AmazonSQS.SendMessage", req.Header.Get("X-Amz-Target"))
+
+			var in map[string]string
+			_ = json.Unmarshal(body, &in)
+			assert.Equal(t, "https://sqs.eu-west-1.amazonaws.com/000000000000/webhooks.fifo", in["QueueUrl"])
+			assert.Equal(t, "webhooks", in["MessageGroupId"])
+			message = in["MessageBody"]
+
+			_, _ = res.Write([]byte(`{"MessageId": "sqs-id"}`))
+		case strings.Contains(req.Header.Get("Authorization"), "/events/aws4_request"):
+			assert.Equal(t, "AWSEvents.PutEvents", req.Header.Get("X-Amz-Target"))
+
+			var in struct {
+				Entries []map[string]string
+			}
+			_ = json.Unmarshal(body, &in)
+			assert.Equal(t, "webhooks", in.Entries[0]["EventBusName"])
+			assert.Equal(t, "com.example.webhooks", in.Entries[0]["Source"])
+			assert.Equal(t, "HTTP Request", in.Entries[0]["DetailType"])
+			message = in.Entries[0]["Detail"]
+
+			_, _ = res.Write([]byte(`{"FailedEntryCount": 0, "Entries": [{"EventId": "event-id"}]}`))
+		default:
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte("{\"statusCode\": 200, \"body\": \"invoked\"}"))
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		desc    string
+		publish *awslambdaplugin.PublishConfig
+		status  int
+		body    string
+	}{
+		{
+			desc:    "sns",
+			publish: &awslambdaplugin.PublishConfig{TopicArn: "arn:aws:sns:eu-west-1:000000000000:webhooks", Methods: []string{"post"}},
+			status:  202,
+			body:    `{"messageId":"sns-id"}`,
+		},
+		{
+			desc: "sqs",
+			publish: &awslambdaplugin.PublishConfig{
+				QueueURL:       "https://sqs.eu-west-1.amazonaws.com/000000000000/webhooks.fifo",
+				MessageGroupID: "webhooks",
+				Methods:        []string{"POST"},
+				StatusCode:     204,
+			},
+			status: 204,
+		},
+		{
+			desc: "eventbridge",
+			publish: &awslambdaplugin.PublishConfig{
+				EventBusName: "webhooks",
+				Source:       "com.example.webhooks",
+				Methods:      []string{"POST"},
+				Body:         "accepted {messageId}",
+				Headers:      map[string]string{"Content-Type": "text/plain"},
+			},
+			status: 202,
+			body:   "accepted event-id",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.Publish = test.publish
+			cfg.Publish.Endpoint = mockserver.URL
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			serve := func(method string) *httptest.ResponseRecorder {
+				req, err := http.NewRequestWithContext(ctx, method, "http://localhost/hook", strings.NewReader("payload"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, req)
+
+				return recorder
+			}
+
+			message = ""
+			recorder := serve(http.MethodPost)
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.body, recorder.Body.String())
+
+			var event map[string]interface{}
+			if err := json.Unmarshal([]byte(message), &event); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "POST", event["httpMethod"])
+			assert.Equal(t, "/hook", event["path"])
+
+			recorder = serve(http.MethodGet)
+			assert.Equal(t, 200, recorder.Code)
+			assert.Equal(t, "invoked", recorder.Body.String())
+		})
+	}
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.Publish = &awslambdaplugin.PublishConfig{TopicArn: "arn:aws:sns:us-east-1:000000000000:webhooks"}
+
+	_, err := awslambdaplugin.New(context.Background(), http.NotFoundHandler(), cfg, "lambda-plugin")
+	assert.EqualError(t, err, `publish: region "eu-west-1" does not match the topic arn region "us-east-1"`)
+}
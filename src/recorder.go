@@ -0,0 +1,37 @@
+package awslambdaplugin
+
+import "net/http"
+
+// statusRecorder captures the status code written by the wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status          int
+	record          *invocationRecord
+	debugHeaders    bool
+	requestIDHeader string
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.writeInvocationHeaders()
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+		r.writeInvocationHeaders()
+	}
+
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush forwards the streamed responses.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,24 @@
+package awslambdaplugin
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverPanic handles a panic recovered while serving a request, so that a bug cannot take down the
+// entrypoint: the stack is logged and the request answered with a 500, or the response aborted when
+// it is already started. The http.ErrAbortHandler panics, aborting a started response on purpose,
+// are passed on.
+func (a *AwsLambdaPlugin) recoverPanic(rec *statusRecorder, r interface{}) {
+	if r == http.ErrAbortHandler { //nolint:errorlint // The panic value is compared as net/http does.
+		panic(r)
+	}
+
+	a.logger.errorf("panic while serving the request: %v\n%s", r, debug.Stack())
+
+	if rec.status != 0 {
+		panic(http.ErrAbortHandler)
+	}
+
+	http.Error(rec, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,152 @@
+package awslambdaplugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// clientRegistry shares the HTTP clients and the credentials between the middlewares built with the
+// same settings, e.g. the many routes of a provider using the same credentials, region and endpoint:
+// they reuse one connection pool and one cache of credentials instead of building their own in every
+// New. The entries are kept for the life of the process, a new configuration registering new ones.
+type clientRegistry struct {
+	mu      sync.Mutex
+	entries map[string]interface{}
+}
+
+var sharedClients = &clientRegistry{entries: map[string]interface{}{}}
+
+// get returns the value registered under the key, built and registered by the first call. A failed
+// build is not registered.
+func (r *clientRegistry) get(key string, build func() (interface{}, error)) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.entries[key]; ok {
+		return v, nil
+	}
+
+	v, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	r.entries[key] = v
+
+	return v, nil
+}
+
+// registryKey hashes the settings identifying a shared value, not to keep secrets in the keys.
+func registryKey(kind string, settings ...interface{}) string {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		// Not shared: every caller gets its own value.
+		return ""
+	}
+
+	sum := sha256.Sum256(encoded)
+
+	return kind + ":" + hex.EncodeToString(sum[:])
+}
+
+// awsEnvironment returns the AWS_ variables, which the ambient credentials and the endpoints
+// resolution depend on.
+func awsEnvironment() []string {
+	var env []string
+	for _, v := range os.Environ() {
+		if strings.HasPrefix(v, "AWS_") {
+			env = append(env, v)
+		}
+	}
+
+	sort.Strings(env)
+
+	return env
+}
+
+// sharedHTTPClient returns the client of the middlewares with the same TLS, proxy and transport
+// settings.
+func sharedHTTPClient(config *Config) (*http.Client, error) {
+	key := registryKey("http", config.TLS, config.ProxyURL, config.NoProxy, config.Transport)
+	if key == "" {
+		return newHTTPClient(config)
+	}
+
+	client, err := sharedClients.get(key, func() (interface{}, error) {
+		return newHTTPClient(config)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return client.(*http.Client), nil
+}
+
+// sharedAmbientCredentials returns the cached ambient credentials of the middlewares with the same
+// credentials settings and environment, along with their registry key.
+func sharedAmbientCredentials(config *Config, profile string, cache cacheOptions) (credentialsProvider, string, error) {
+	key := registryKey("ambient", config.CredentialProcess, config.Profile, profile, config.IMDS,
+		config.CredentialsCache, awsEnvironment())
+	if key == "" {
+		creds, err := ambientCredentials(config, profile, cache)
+		return creds, "", err
+	}
+
+	creds, err := sharedClients.get(key, func() (interface{}, error) {
+		return ambientCredentials(config, profile, cache)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return creds.(credentialsProvider), key, nil
+}
+
+// staticCredentialsKey returns the registry key of the credentials given in the configuration.
+func staticCredentialsKey(creds credentialsProvider) string {
+	static, ok := creds.(staticCredentials)
+	if !ok {
+		// Resolved from parameters, possibly rotated: not shared.
+		return ""
+	}
+
+	return registryKey("static", static.AccessKeyID, static.SecretAccessKey, static.SessionToken)
+}
+
+// sharedRoleCredentials returns the assumed role credentials of the middlewares assuming the same
+// roles from the same source credentials, identified by sourceKey; empty when they are not shared.
+func sharedRoleCredentials(
+	config *Config, region string, source credentialsProvider, sourceKey string, httpClient *http.Client, cache cacheOptions,
+) (credentialsProvider, error) {
+	target, err := accountRoleArn(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if sourceKey == "" || (config.RoleArn == "" && target == "") {
+		return newRoleCredentials(config, region, source, httpClient, cache)
+	}
+
+	key := registryKey("role", sourceKey, config.RoleArn, config.ExternalID, config.RoleSessionName, target,
+		config.STSEndpoint, config.STSRegionalEndpoints, config.UseFIPSEndpoint, region,
+		registryKey("http", config.TLS, config.ProxyURL, config.NoProxy, config.Transport), config.CredentialsCache,
+		awsEnvironment())
+	if key == "" {
+		return newRoleCredentials(config, region, source, httpClient, cache)
+	}
+
+	creds, err := sharedClients.get(key, func() (interface{}, error) {
+		return newRoleCredentials(config, region, source, httpClient, cache)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return creds.(credentialsProvider), nil
+}
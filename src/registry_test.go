@@ -0,0 +1,87 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedClients(t *testing.T) {
+	assumed := 0
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	sts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assumed++
+		_, _ = res.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIASHARED</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-token</SessionToken>
+      <Expiration>` + expiration.Format(time.RFC3339) + `</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`))
+	}))
+	defer func() { sts.Close() }()
+
+	connections := map[string]bool{}
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIASHARED/"))
+		connections[req.RemoteAddr] = true
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	newConfig := func(function string) *awslambdaplugin.Config {
+		cfg := awslambdaplugin.CreateConfig()
+		cfg.Region = "eu-west-1"
+		cfg.AccessKey = "shared-key"
+		cfg.SecretKey = "@@not-a-key"
+		cfg.RoleArn = "arn:aws:iam::000000000000:role/shared"
+		cfg.STSEndpoint = sts.URL
+		cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:" + function
+		cfg.Endpoint = mockserver.URL
+
+		return cfg
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	serve := func(cfg *awslambdaplugin.Config) {
+		handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+	}
+
+	// Two routes of the same provider: one role session, one connection.
+	serve(newConfig("first"))
+	serve(newConfig("second"))
+	assert.Equal(t, 1, assumed)
+	assert.Len(t, connections, 1)
+
+	// Other source credentials assume the role again.
+	other := newConfig("third")
+	other.AccessKey = "other-key"
+	serve(other)
+	assert.Equal(t, 2, assumed)
+}
@@ -0,0 +1,235 @@
+package awslambdaplugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// configSubsystems maps configuration prefixes to the stateful subsystem they configure.
+// State of every enabled subsystem is rebuilt each time the middleware is reconstructed, so
+// every subsystem keeping state across the requests must be listed.
+var configSubsystems = []struct {
+	prefixes []string
+	name     string
+}{
+	{prefixes: []string{"slo"}, name: "slo"},
+	{prefixes: []string{"healthCheck"}, name: "healthCheck"},
+	{prefixes: []string{"circuitBreaker"}, name: "circuitBreaker"},
+	{prefixes: []string{"maxConcurrentInvocations", "concurrencyQueueTimeout", "adaptiveConcurrency"}, name: "concurrencyLimiter"},
+	{prefixes: []string{"warmer"}, name: "warmer"},
+	{prefixes: []string{"latencyRouting"}, name: "latencyRouting"},
+	{prefixes: []string{"coalescing"}, name: "coalescing"},
+	{prefixes: []string{"retry.budgetRatio", "retry.budgetBurst"}, name: "retryBudget"},
+	{prefixes: []string{"metrics"}, name: "metrics"},
+	{prefixes: []string{"cache"}, name: "cache"},
+}
+
+var effectiveConfigs = struct {
+	sync.Mutex
+	byName map[string]map[string]string
+}{byName: map[string]map[string]string{}}
+
+// configChange a single difference between two effective configurations.
+type configChange struct {
+	key      string
+	old, new string
+	redacted bool
+}
+
+func (c configChange) String() string {
+	switch {
+	case c.redacted:
+		return c.key + ": changed (redacted)"
+	case c.old == "":
+		return fmt.Sprintf("%s: set to %q", c.key, c.new)
+	case c.new == "":
+		return fmt.Sprintf("%s: unset (was %q)", c.key, c.old)
+	default:
+		return fmt.Sprintf("%s: %q -> %q", c.key, c.old, c.new)
+	}
+}
+
+// reportConfigReload logs the differences between the previous effective configuration of the
+// named middleware and the new one, along with the subsystems whose state is reset.
+func reportConfigReload(logger *logger, config *Config) {
+	name := logger.name
+	current := flattenConfig(config)
+
+	effectiveConfigs.Lock()
+	previous, found := effectiveConfigs.byName[name]
+	effectiveConfigs.byName[name] = current
+	effectiveConfigs.Unlock()
+
+	if !found {
+		return
+	}
+
+	changes := diffConfig(previous, current)
+	if len(changes) == 0 {
+		return
+	}
+
+	parts := make([]string, 0, len(changes))
+	for _, c := range changes {
+		parts = append(parts, c.String())
+	}
+
+	msg := "configuration reloaded: " + strings.Join(parts, "; ")
+	if reset := resetSubsystems(current, changes); len(reset) > 0 {
+		msg += "; subsystems reset: " + strings.Join(reset, ", ")
+	}
+
+	logger.infof("%s", msg)
+}
+
+func diffConfig(previous, current map[string]string) []configChange {
+	keys := map[string]struct{}{}
+	for k := range previous {
+		keys[k] = struct{}{}
+	}
+	for k := range current {
+		keys[k] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []configChange
+	for _, k := range sorted {
+		o, n := previous[k], current[k]
+		if o == n {
+			continue
+		}
+
+		redacted := strings.HasPrefix(o, redactedPrefix) || strings.HasPrefix(n, redactedPrefix)
+		changes = append(changes, configChange{key: k, old: o, new: n, redacted: redacted})
+	}
+
+	return changes
+}
+
+// resetSubsystems lists the enabled stateful subsystems, flagging the reconfigured ones.
+func resetSubsystems(current map[string]string, changes []configChange) []string {
+	var reset []string
+	for _, s := range configSubsystems {
+		enabled, changed := false, false
+		for k := range current {
+			enabled = enabled || hasConfigPrefix(k, s.prefixes...)
+		}
+
+		for _, c := range changes {
+			changed = changed || hasConfigPrefix(c.key, s.prefixes...)
+		}
+
+		switch {
+		case changed:
+			reset = append(reset, s.name+" (reconfigured)")
+		case enabled:
+			reset = append(reset, s.name)
+		}
+	}
+
+	return reset
+}
+
+// hasConfigPrefix reports whether the key is one of the prefixes or under one of them.
+func hasConfigPrefix(key string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if key == prefix || strings.HasPrefix(key, prefix+".") || strings.HasPrefix(key, prefix+"[") {
+			return true
+		}
+	}
+
+	return false
+}
+
+const redactedPrefix = "redacted:"
+
+// flattenConfig renders the configuration as a flat map of json paths to values.
+// Fields tagged with `redact:"true"` are replaced by a digest of their value.
+func flattenConfig(config *Config) map[string]string {
+	values := map[string]string{}
+	flattenValue(values, "", reflect.ValueOf(config).Elem(), false)
+
+	return values
+}
+
+func flattenValue(values map[string]string, path string, v reflect.Value, redact bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		flattenPointer(values, path, v, redact)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			flattenValue(values, configFieldPath(path, field), v.Field(i), redact || field.Tag.Get("redact") == "true")
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			flattenValue(values, path+"["+strconv.Itoa(i)+"]", v.Index(i), redact)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		for _, k := range keys {
+			flattenValue(values, path+"."+fmt.Sprint(k.Interface()), v.MapIndex(k), redact)
+		}
+	default:
+		if v.IsZero() {
+			return
+		}
+
+		s := fmt.Sprint(v.Interface())
+		if redact {
+			sum := sha256.Sum256([]byte(s))
+			s = redactedPrefix + hex.EncodeToString(sum[:])
+		}
+
+		values[path] = s
+	}
+}
+
+func flattenPointer(values map[string]string, path string, v reflect.Value, redact bool) {
+	if v.IsNil() {
+		return
+	}
+
+	if elem := v.Elem(); elem.IsZero() {
+		// An explicitly set zero value differs from an unset one, e.g. an enabled subsystem
+		// with the default settings.
+		values[path] = fmt.Sprint(elem.Interface())
+		if elem.Kind() == reflect.Struct {
+			values[path] = "{}"
+		}
+
+		return
+	}
+
+	flattenValue(values, path, v.Elem(), redact)
+}
+
+// configFieldPath returns the dotted path of a config field, named after its JSON key.
+func configFieldPath(parent string, field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		name = field.Name
+	}
+
+	if parent != "" {
+		name = parent + "." + name
+	}
+
+	return name
+}
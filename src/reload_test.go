@@ -0,0 +1,180 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigReloadReport(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	_, err := awslambdaplugin.New(context.Background(), next, cfg, "reload-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, buf.String())
+
+	cfg = awslambdaplugin.CreateConfig()
+	cfg.Region = "us-east-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@another-key"
+	cfg.FunctionArn = "arn:aws:lambda:us-east-1:000000000000:function:xxx:1"
+	cfg.SLO = &awslambdaplugin.SLOConfig{
+		Objectives: []awslambdaplugin.SLOObjective{{Name: "api", AvailabilityTarget: 0.99}},
+	}
+
+	_, err = awslambdaplugin.New(context.Background(), next, cfg, "reload-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, buf.String(), `[reload-plugin] configuration reloaded: `+
+		`functionArn: "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1" -> "arn:aws:lambda:us-east-1:000000000000:function:xxx:1"; `+
+		`region: "eu-west-1" -> "us-east-1"; secretKey: changed (redacted); `+
+		`slo.objectives[0].availabilityTarget: set to "0.99"; slo.objectives[0].name: set to "api"; `+
+		`subsystems reset: slo (reconfigured)`)
+	assert.NotContains(t, buf.String(), "@@another-key")
+}
+
+func TestConfigReloadSubsystems(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		subsystem string
+		// previous configures the first middleware, before the subsystem is configured.
+		previous  func(cfg *awslambdaplugin.Config)
+		configure func(cfg *awslambdaplugin.Config)
+	}{
+		{
+			subsystem: "slo",
+			configure: func(cfg *awslambdaplugin.Config) {
+				cfg.SLO = &awslambdaplugin.SLOConfig{Objectives: []awslambdaplugin.SLOObjective{{Name: "api", AvailabilityTarget: 0.99}}}
+			},
+		},
+		{
+			subsystem: "healthCheck",
+			configure: func(cfg *awslambdaplugin.Config) { cfg.HealthCheck = &awslambdaplugin.HealthCheckConfig{} },
+		},
+		{
+			subsystem: "circuitBreaker",
+			configure: func(cfg *awslambdaplugin.Config) { cfg.CircuitBreaker = &awslambdaplugin.CircuitBreakerConfig{} },
+		},
+		{
+			subsystem: "concurrencyLimiter",
+			configure: func(cfg *awslambdaplugin.Config) { cfg.MaxConcurrentInvocations = 10 },
+		},
+		{
+			subsystem: "concurrencyLimiter",
+			previous:  func(cfg *awslambdaplugin.Config) { cfg.MaxConcurrentInvocations = 10 },
+			configure: func(cfg *awslambdaplugin.Config) {
+				cfg.MaxConcurrentInvocations = 10
+				cfg.AdaptiveConcurrency = &awslambdaplugin.AdaptiveConcurrencyConfig{}
+			},
+		},
+		{
+			subsystem: "warmer",
+			configure: func(cfg *awslambdaplugin.Config) { cfg.Warmer = &awslambdaplugin.WarmerConfig{} },
+		},
+		{
+			subsystem: "latencyRouting",
+			configure: func(cfg *awslambdaplugin.Config) {
+				cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx"
+				cfg.LatencyRouting = &awslambdaplugin.LatencyRoutingConfig{
+					Replicas:  []string{"arn:aws:lambda:eu-south-1:000000000000:function:xxx"},
+					Endpoints: map[string]string{"eu-south-1": mockserver.URL},
+				}
+			},
+		},
+		{
+			subsystem: "coalescing",
+			configure: func(cfg *awslambdaplugin.Config) { cfg.Coalescing = &awslambdaplugin.CoalescingConfig{} },
+		},
+		{
+			subsystem: "retryBudget",
+			previous:  func(cfg *awslambdaplugin.Config) { cfg.Retry = &awslambdaplugin.RetryConfig{} },
+			configure: func(cfg *awslambdaplugin.Config) { cfg.Retry = &awslambdaplugin.RetryConfig{BudgetRatio: 0.2} },
+		},
+		{
+			subsystem: "metrics",
+			configure: func(cfg *awslambdaplugin.Config) { cfg.Metrics = &awslambdaplugin.MetricsConfig{Path: "/metrics"} },
+		},
+		{
+			subsystem: "cache",
+			configure: func(cfg *awslambdaplugin.Config) { cfg.Cache = &awslambdaplugin.CacheConfig{} },
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.subsystem, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			newConfig := func() *awslambdaplugin.Config {
+				cfg := awslambdaplugin.CreateConfig()
+				cfg.Region = "eu-west-1"
+				cfg.AccessKey = "aws-key"
+				cfg.SecretKey = "@@not-a-key"
+				cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+				cfg.Endpoint = mockserver.URL
+
+				return cfg
+			}
+
+			name := "reload-" + t.Name()
+			cfg := newConfig()
+			if test.previous != nil {
+				test.previous(cfg)
+			}
+
+			if _, err := awslambdaplugin.New(ctx, next, cfg, name); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg = newConfig()
+			test.configure(cfg)
+			if _, err := awslambdaplugin.New(ctx, next, cfg, name); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Contains(t, buf.String(), "subsystems reset: "+test.subsystem+" (reconfigured)")
+
+			// Rebuilt unchanged along another change, the enabled subsystem is reset too.
+			cfg = newConfig()
+			test.configure(cfg)
+			cfg.DebugHeaders = true
+			if _, err := awslambdaplugin.New(ctx, next, cfg, name); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Contains(t, buf.String(), "subsystems reset: "+test.subsystem+"\n")
+		})
+	}
+}
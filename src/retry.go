@@ -0,0 +1,302 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay    = 2 * time.Second
+	defaultRetryBudgetBurst = 10
+
+	// retryBudgetToken is the cost of a retry, in budget tokens.
+	retryBudgetToken = 1000
+
+	retryJitterFull  = "full"
+	retryJitterEqual = "equal"
+	retryJitterNone  = "none"
+)
+
+// RetryConfig retries the invocations rejected because of throttling (429) or a service error (5xx).
+type RetryConfig struct {
+	// MaxAttempts including the first one (default 3).
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// BaseDelay doubled at every attempt (default 100ms), up to MaxDelay (default 2s).
+	BaseDelay string `json:"baseDelay,omitempty"`
+	MaxDelay  string `json:"maxDelay,omitempty"`
+	// Jitter randomizes the delays: full (default, between zero and the computed delay), equal
+	// (between half and the whole computed delay) or none.
+	Jitter string `json:"jitter,omitempty"`
+	// BudgetRatio caps the retries to a share of the invocations, e.g. 0.2 for at most one retry every
+	// five invocations, so that a widespread failure does not turn into a retry storm. Unset retries
+	// are not limited.
+	BudgetRatio float64 `json:"budgetRatio,omitempty"`
+	// BudgetBurst is the number of retries allowed above the ratio, e.g. at low traffic (default 10).
+	BudgetBurst int `json:"budgetBurst,omitempty"`
+}
+
+// retryPolicy parsed RetryConfig.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	jitter      string
+	budget      *retryBudget
+	// statusCodes of the function responses retried for the safe methods.
+	statusCodes map[int]bool
+}
+
+// retrySafeMethods are the methods whose requests can be retried on the function status code.
+var retrySafeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// retryBudget is a token bucket filled by the invocations and drained by the retries. The tokens are
+// counted in thousandths of a retry, so that the deposits add up exactly.
+type retryBudget struct {
+	deposits int64
+	capacity int64
+
+	mu     sync.Mutex
+	tokens int64
+}
+
+func newRetryBudget(ratio float64, burst int) *retryBudget {
+	capacity := int64(burst) * retryBudgetToken
+
+	return &retryBudget{deposits: int64(math.Round(ratio * retryBudgetToken)), capacity: capacity, tokens: capacity}
+}
+
+// deposit accounts an invocation.
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.deposits
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// withdraw reports whether a retry is within the budget, accounting it.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < retryBudgetToken {
+		return false
+	}
+
+	b.tokens -= retryBudgetToken
+
+	return true
+}
+
+func newRetryPolicy(config *RetryConfig, onStatus []int) (*retryPolicy, error) {
+	if config == nil {
+		if len(onStatus) > 0 {
+			return nil, fmt.Errorf("retry on status requires retry")
+		}
+
+		return nil, nil
+	}
+
+	p := &retryPolicy{maxAttempts: config.MaxAttempts}
+	if p.maxAttempts == 0 {
+		p.maxAttempts = defaultRetryMaxAttempts
+	}
+
+	if p.maxAttempts < 1 {
+		return nil, fmt.Errorf("retry: max attempts must be positive")
+	}
+
+	var err error
+	if p.baseDelay, err = parseDurationDefault(config.BaseDelay, defaultRetryBaseDelay); err != nil || p.baseDelay <= 0 {
+		return nil, fmt.Errorf("retry: invalid base delay %q", config.BaseDelay)
+	}
+
+	if p.maxDelay, err = parseDurationDefault(config.MaxDelay, defaultRetryMaxDelay); err != nil || p.maxDelay < p.baseDelay {
+		return nil, fmt.Errorf("retry: invalid max delay %q", config.MaxDelay)
+	}
+
+	if p.jitter, err = retryJitter(config.Jitter); err != nil {
+		return nil, err
+	}
+
+	if p.budget, err = newRetryPolicyBudget(config); err != nil {
+		return nil, err
+	}
+
+	if p.statusCodes, err = retryStatusCodes(onStatus); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func retryJitter(jitter string) (string, error) {
+	switch jitter {
+	case "":
+		return retryJitterFull, nil
+	case retryJitterFull, retryJitterEqual, retryJitterNone:
+		return jitter, nil
+	default:
+		return "", fmt.Errorf("retry: unsupported jitter %q", jitter)
+	}
+}
+
+// newRetryPolicyBudget returns the retry budget, nil without budget ratio.
+func newRetryPolicyBudget(config *RetryConfig) (*retryBudget, error) {
+	if config.BudgetRatio < 0 || config.BudgetRatio > 1 {
+		return nil, fmt.Errorf("retry: budget ratio must be between 0 and 1")
+	}
+
+	if config.BudgetRatio == 0 {
+		return nil, nil
+	}
+
+	burst := config.BudgetBurst
+	if burst == 0 {
+		burst = defaultRetryBudgetBurst
+	}
+	if burst < 0 {
+		return nil, fmt.Errorf("retry: budget burst must be positive")
+	}
+
+	return newRetryBudget(config.BudgetRatio, burst), nil
+}
+
+// retryStatusCodes returns the set of the retried status codes, nil when empty.
+func retryStatusCodes(onStatus []int) (map[int]bool, error) {
+	if len(onStatus) == 0 {
+		return nil, nil
+	}
+
+	statusCodes := map[int]bool{}
+	for _, statusCode := range onStatus {
+		if statusCode < 500 || statusCode > 599 {
+			return nil, fmt.Errorf("retry: retry on status %d is not a 5xx status code", statusCode)
+		}
+
+		statusCodes[statusCode] = true
+	}
+
+	return statusCodes, nil
+}
+
+// delay returns the wait before the given retry, starting from 1.
+func (p *retryPolicy) delay(retry int) time.Duration {
+	d := p.maxDelay
+	if shift := uint(retry - 1); shift < 32 && p.baseDelay<<shift < p.maxDelay {
+		d = p.baseDelay << shift
+	}
+
+	switch p.jitter {
+	case retryJitterFull:
+		d = time.Duration(rand.Int63n(int64(d) + 1)) //nolint:gosec // No need for a secure random source.
+	case retryJitterEqual:
+		d = d/2 + time.Duration(rand.Int63n(int64(d-d/2)+1)) //nolint:gosec // No need for a secure random source.
+	}
+
+	return d
+}
+
+// retryableError reports whether the invocation was rejected by throttling or by a service error.
+func retryableError(err error) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+}
+
+// invoke calls the function, retrying according to the retry policy.
+func (a *AwsLambdaPlugin) invoke(ctx context.Context, in *invokeInput) (*invokeOutput, error) {
+	result, err := a.clientFor(in.FunctionName).invoke(ctx, in)
+	if a.retry == nil {
+		return result, err
+	}
+
+	if a.retry.budget != nil {
+		a.retry.budget.deposit()
+	}
+
+	for retry := 1; retry < a.retry.maxAttempts && retryableError(err); retry++ {
+		if a.retry.budget != nil && !a.retry.budget.withdraw() {
+			return result, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(a.retry.delay(retry)):
+		}
+
+		invocationRecordFrom(ctx).retried()
+		result, err = a.clientFor(in.FunctionName).invoke(ctx, in)
+	}
+
+	return result, err
+}
+
+// invokeRetryingStatus invokes the function, retrying the safe requests answered with one of the
+// retryOnStatus status codes. The last response is returned when the attempts are exhausted.
+func (a *AwsLambdaPlugin) invokeRetryingStatus(ctx context.Context, req *http.Request, in *invokeInput) (LambdaResponse, error) {
+	resp, err := a.invokeFunction(ctx, req, in)
+	if a.retry == nil || a.retry.statusCodes == nil || !retrySafeMethods[req.Method] {
+		return resp, err
+	}
+
+	for retry := 1; retry < a.retry.maxAttempts && err == nil && a.retry.statusCodes[resp.StatusCode]; retry++ {
+		if a.retry.budget != nil && !a.retry.budget.withdraw() {
+			return resp, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(a.retry.delay(retry)):
+		}
+
+		invocationRecordFrom(ctx).retried()
+		resp, err = a.invokeFunction(ctx, req, in)
+	}
+
+	return resp, err
+}
+
+// throttledResponse maps an invocation throttled by Lambda to a 503, whose Retry-After header
+// carries the back off suggested by the service (at least one second).
+func throttledResponse(err error) (LambdaResponse, bool) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		return LambdaResponse{}, false
+	}
+
+	seconds := int64((apiErr.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return LambdaResponse{
+		StatusCode: http.StatusServiceUnavailable,
+		Headers: map[string]string{
+			"Content-Type": "text/plain; charset=utf-8",
+			"Retry-After":  strconv.FormatInt(seconds, 10),
+		},
+		Body: http.StatusText(http.StatusServiceUnavailable),
+	}, true
+}
@@ -0,0 +1,242 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	failures := 0
+	status := 0
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls <= failures {
+			res.Header().Set("X-Amzn-Errortype", "TooManyRequestsException")
+			res.WriteHeader(status)
+			return
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Retry = &awslambdaplugin.RetryConfig{MaxAttempts: 3, BaseDelay: "1ms", MaxDelay: "5ms", Jitter: "none"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	calls, failures, status = 0, 2, 429
+	assert.Equal(t, 200, serve().Code)
+	assert.Equal(t, 3, calls)
+
+	calls, failures, status = 0, 1, 503
+	assert.Equal(t, 200, serve().Code)
+	assert.Equal(t, 2, calls)
+
+	calls, failures, status = 0, 3, 500
+	assert.Equal(t, 502, serve().Code)
+	assert.Equal(t, 3, calls)
+
+	calls, failures, status = 0, 1, 400
+	assert.Equal(t, 502, serve().Code)
+	assert.Equal(t, 1, calls)
+
+	cfg.Retry = &awslambdaplugin.RetryConfig{BaseDelay: "1s", MaxDelay: "10ms"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `retry: invalid max delay "10ms"`)
+}
+
+func TestThrottledInvocation(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Errortype", "TooManyRequestsException")
+		res.WriteHeader(429)
+		_, _ = res.Write([]byte(`{"Reason": "ReservedFunctionConcurrentInvocationLimitExceeded", "retryAfterSeconds": "2.5"}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 503, recorder.Code)
+	assert.Equal(t, "3", recorder.Header().Get("Retry-After"))
+}
+
+func TestRetryBudget(t *testing.T) {
+	calls := 0
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		res.Header().Set("X-Amzn-Errortype", "TooManyRequestsException")
+		res.WriteHeader(429)
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Retry = &awslambdaplugin.RetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   "1ms",
+		MaxDelay:    "5ms",
+		Jitter:      "equal",
+		BudgetRatio: 0.1,
+		BudgetBurst: 1,
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() int {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder.Code
+	}
+
+	// The burst allows a single retry, then the budget is refilled by a tenth of a retry per invocation.
+	assert.Equal(t, 503, serve())
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	for i := 0; i < 9; i++ {
+		assert.Equal(t, 503, serve())
+	}
+	assert.Equal(t, 9, calls)
+
+	calls = 0
+	assert.Equal(t, 503, serve())
+	assert.Equal(t, 2, calls)
+
+	cfg.Retry = &awslambdaplugin.RetryConfig{BudgetRatio: 2}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "retry: budget ratio must be between 0 and 1")
+}
+
+func TestRetryOnStatus(t *testing.T) {
+	calls, failures := 0, 0
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+
+		res.WriteHeader(200)
+		if calls <= failures {
+			_, _ = res.Write([]byte(`{"statusCode": 503, "body": "unavailable"}`))
+			return
+		}
+
+		_, _ = res.Write([]byte(`{"statusCode": 200, "body": "ok"}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Retry = &awslambdaplugin.RetryConfig{MaxAttempts: 3, BaseDelay: "1ms", MaxDelay: "5ms"}
+	cfg.RetryOnStatus = []int{502, 503}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	calls, failures = 0, 2
+	assert.Equal(t, 200, serve(http.MethodGet).Code)
+	assert.Equal(t, 3, calls)
+
+	calls, failures = 0, 3
+	recorder := serve(http.MethodGet)
+	assert.Equal(t, 503, recorder.Code)
+	assert.Equal(t, "unavailable", recorder.Body.String())
+	assert.Equal(t, 3, calls)
+
+	// Unsafe methods are never retried.
+	calls, failures = 0, 1
+	assert.Equal(t, 503, serve(http.MethodPost).Code)
+	assert.Equal(t, 1, calls)
+
+	cfg.RetryOnStatus = []int{404}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "retry: retry on status 404 is not a 5xx status code")
+
+	cfg.Retry = nil
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "retry on status requires retry")
+}
@@ -0,0 +1,23 @@
+package awslambdaplugin
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// sanitizeHeaders removes the response headers breaking the framing of the response: the hop-by-hop
+// headers, the ones listed by Connection and a Content-Length not matching the body of bodySize bytes
+// (unknown when negative), along with the denied headers.
+func sanitizeHeaders(header http.Header, bodySize int64, denied []string) {
+	removeHopHeaders(header)
+
+	if values := header.Values("Content-Length"); len(values) > 0 {
+		if size, err := strconv.ParseInt(values[0], 10, 64); err != nil || len(values) > 1 || size != bodySize {
+			header.Del("Content-Length")
+		}
+	}
+
+	for _, name := range denied {
+		header.Del(name)
+	}
+}
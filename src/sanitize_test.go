@@ -0,0 +1,73 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeResponseHeaders(t *testing.T) {
+	var payload string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(payload))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.DeniedResponseHeaders = []string{"x-internal"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(p string) *httptest.ResponseRecorder {
+		payload = p
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := serve(`{"statusCode": 200, "body": "hello", "headers": {
+		"Transfer-Encoding": "chunked",
+		"Connection": "X-Session",
+		"X-Session": "abc",
+		"Keep-Alive": "timeout=5",
+		"Content-Length": "999",
+		"X-Internal": "secret",
+		"X-Kept": "yes"
+	}}`)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "hello", recorder.Body.String())
+
+	header := recorder.Header()
+	for _, name := range []string{"Transfer-Encoding", "Connection", "X-Session", "Keep-Alive", "Content-Length", "X-Internal"} {
+		assert.Empty(t, header.Values(name), name)
+	}
+	assert.Equal(t, "yes", header.Get("X-Kept"))
+
+	recorder = serve(`{"statusCode": 200, "body": "hello", "headers": {"Content-Length": "5"}}`)
+	assert.Equal(t, "5", recorder.Header().Get("Content-Length"))
+
+	recorder = serve(`{"statusCode": 200, "body": "hello", "multiValueHeaders": {"Content-Length": ["5", "6"]}}`)
+	assert.Empty(t, recorder.Header().Values("Content-Length"))
+}
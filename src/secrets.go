@@ -0,0 +1,60 @@
+package awslambdaplugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretFile a secret configuration value and the file it can be read from instead.
+type secretFile struct {
+	name   string
+	file   string
+	target *string
+}
+
+// configSecrets lists the secret values of the configuration, pointing into it.
+func configSecrets(config *Config) []secretFile {
+	secrets := []secretFile{
+		{"accessKey", config.AccessKeyFile, &config.AccessKey},
+		{"secretKey", config.SecretKeyFile, &config.SecretKey},
+		{"sessionToken", config.SessionTokenFile, &config.SessionToken},
+		{"externalId", config.ExternalIDFile, &config.ExternalID},
+	}
+
+	if config.SLO != nil {
+		secrets = append(secrets, secretFile{"slo.webhookUrl", config.SLO.WebhookURLFile, &config.SLO.WebhookURL})
+	}
+
+	return secrets
+}
+
+// resolveSecretFiles returns a copy of the configuration where every secret given through
+// its *File variant (e.g. a mounted Kubernetes or Docker secret) is replaced by the file content.
+func resolveSecretFiles(config *Config) (*Config, error) {
+	resolved := *config
+	if config.SLO != nil {
+		slo := *config.SLO
+		resolved.SLO = &slo
+	}
+
+	for _, s := range configSecrets(&resolved) {
+		if s.file == "" {
+			continue
+		}
+
+		if *s.target != "" {
+			return nil, fmt.Errorf("%s and %sFile are mutually exclusive", s.name, s.name)
+		}
+
+		data, err := os.ReadFile(filepath.Clean(s.file))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %sFile: %w", s.name, err)
+		}
+
+		*s.target = strings.TrimSpace(string(data))
+	}
+
+	return &resolved, nil
+}
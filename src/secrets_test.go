@@ -0,0 +1,69 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	for file, content := range map[string]string{"access-key": "file-key\n", "secret-key": "file-secret\n", "token": "file-token"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Contains(t, req.Header.Get("Authorization"), "Credential=file-key/")
+		assert.Equal(t, "file-token", req.Header.Get("X-Amz-Security-Token"))
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKeyFile = filepath.Join(dir, "access-key")
+	cfg.SecretKeyFile = filepath.Join(dir, "secret-key")
+	cfg.SessionTokenFile = filepath.Join(dir, "token")
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, cfg.AccessKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+
+	cfg.AccessKey = "inline-key"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "accessKey and accessKeyFile are mutually exclusive")
+
+	cfg.AccessKey = ""
+	cfg.SecretKeyFile = filepath.Join(dir, "missing")
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot read secretKeyFile")
+	}
+}
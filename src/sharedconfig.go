@@ -0,0 +1,140 @@
+package awslambdaplugin
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultProfile = "default"
+
+// iniFile sections of a shared config file, keyed by section name.
+type iniFile map[string]map[string]string
+
+// loadINI parses an AWS shared config/credentials file.
+// Indented lines following an empty-valued key are stored as "parent.key" sub-properties.
+func loadINI(filename string) (iniFile, error) {
+	f, err := os.Open(filepath.Clean(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	ini := iniFile{}
+	var section map[string]string
+	var parent string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if isINIComment(line) {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = ini.section(strings.Join(strings.Fields(line[1:len(line)-1]), " "))
+			parent = ""
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if section == nil || eq < 0 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(line[:eq]))
+		value := strings.TrimSpace(line[eq+1:])
+
+		nested := raw[0] == ' ' || raw[0] == '\t'
+		switch {
+		case nested && parent != "":
+			section[parent+"."+key] = value
+		case value == "":
+			parent = key
+		default:
+			parent = ""
+			section[key] = value
+		}
+	}
+
+	return ini, scanner.Err()
+}
+
+// isINIComment reports whether the trimmed line is empty or a comment.
+func isINIComment(line string) bool {
+	return line == "" || line[0] == '#' || line[0] == ';'
+}
+
+// section returns the named section, adding it when missing.
+func (ini iniFile) section(name string) map[string]string {
+	section := ini[name]
+	if section == nil {
+		section = map[string]string{}
+		ini[name] = section
+	}
+
+	return section
+}
+
+func awsConfigDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".aws"
+	}
+
+	return filepath.Join(home, ".aws")
+}
+
+func sharedCredentialsFilename() string {
+	if f := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); f != "" {
+		return f
+	}
+
+	return filepath.Join(awsConfigDir(), "credentials")
+}
+
+func sharedConfigFilename() string {
+	if f := os.Getenv("AWS_CONFIG_FILE"); f != "" {
+		return f
+	}
+
+	return filepath.Join(awsConfigDir(), "config")
+}
+
+// envProfile returns the shared config profile selected by the environment.
+func envProfile() string {
+	if p := firstEnv("AWS_PROFILE", "AWS_DEFAULT_PROFILE"); p != "" {
+		return p
+	}
+
+	return defaultProfile
+}
+
+// profileSection returns the shared config file section of the given profile.
+func profileSection(ini iniFile, profile string) map[string]string {
+	if s, ok := ini["profile "+profile]; ok {
+		return s
+	}
+
+	return ini[profile]
+}
+
+// resolveRegion returns the configured region, falling back to the environment and the shared config file.
+func resolveRegion(region, profile string) string {
+	if region != "" {
+		return region
+	}
+
+	if r := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"); r != "" {
+		return r
+	}
+
+	ini, err := loadINI(sharedConfigFilename())
+	if err != nil {
+		return ""
+	}
+
+	return profileSection(ini, profile)["region"]
+}
@@ -0,0 +1,231 @@
+package awslambdaplugin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	shortDateFormat  = "20060102"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty payload.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// unsignedPayload replaces the payload hash of the presigned requests.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// ignoredSigningHeaders are never included in the signature, as proxies may alter them.
+var ignoredSigningHeaders = map[string]bool{
+	"authorization":     true,
+	"user-agent":        true,
+	"x-amzn-trace-id":   true,
+	"expect":            true,
+	"transfer-encoding": true,
+}
+
+// signV4 signs the request in place with AWS Signature Version 4.
+func signV4(req *http.Request, payloadHash string, creds awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format(shortDateFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signedHeaders, canonicalRequest := buildCanonicalRequest(req, payloadHash, service)
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	signature := signatureV4(creds, date, region, service, scope, amzDate, canonicalRequest)
+
+	req.Header.Set("Authorization", signingAlgorithm+" Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// presignV4 returns the URL of a GET request authenticated by a Signature Version 4 in the query
+// string, valid for the given duration.
+func presignV4(u *url.URL, creds awsCredentials, region, service string, expires time.Duration, now time.Time) string {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format(shortDateFormat)
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+
+	signed := *u
+	query := signed.Query()
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	signed.RawQuery = query.Encode()
+
+	req := &http.Request{Method: http.MethodGet, URL: &signed, Header: http.Header{}}
+	_, canonicalRequest := buildCanonicalRequest(req, unsignedPayload, service)
+	signed.RawQuery += "&X-Amz-Signature=" + signatureV4(creds, date, region, service, scope, amzDate, canonicalRequest)
+
+	return signed.String()
+}
+
+func signatureV4(creds awsCredentials, date, region, service, scope, amzDate, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{signingAlgorithm, amzDate, scope, hashHex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// buildCanonicalRequest returns the signed headers list and the canonical request shared by
+// the Signature Version 4 and 4A algorithms.
+func buildCanonicalRequest(req *http.Request, payloadHash, service string) (string, string) {
+	signedHeaders, canonicalHeaders := canonicalizeHeaders(req)
+
+	return signedHeaders, strings.Join([]string{
+		req.Method,
+		canonicalURI(req, service),
+		canonicalQuery(req),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+}
+
+func canonicalizeHeaders(req *http.Request) (string, string) {
+	values := map[string][]string{"host": {requestHost(req)}}
+	for name, v := range req.Header {
+		name = strings.ToLower(name)
+		if ignoredSigningHeaders[name] {
+			continue
+		}
+
+		values[name] = append(values[name], v...)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(':')
+		for i, v := range values[name] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strings.Join(strings.Fields(v), " "))
+		}
+		b.WriteByte('\n')
+	}
+
+	return strings.Join(names, ";"), b.String()
+}
+
+// requestHost returns the host the request is sent to, without the default port.
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	switch {
+	case req.URL.Scheme == "https" && strings.HasSuffix(host, ":443"):
+		host = strings.TrimSuffix(host, ":443")
+	case req.URL.Scheme == "http" && strings.HasSuffix(host, ":80"):
+		host = strings.TrimSuffix(host, ":80")
+	}
+
+	return host
+}
+
+// canonicalURI escapes the already escaped path a second time, as required for every service but S3.
+func canonicalURI(req *http.Request, service string) string {
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		return "/"
+	}
+
+	if service == "s3" {
+		return uri
+	}
+
+	return escapeRFC3986(uri, false)
+}
+
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(query))
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, escapeRFC3986(k, true)+"="+escapeRFC3986(v, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// escapeRFC3986 percent-encodes everything but the unreserved characters (and "/" unless encodeSep is set).
+func escapeRFC3986(s string, encodeSep bool) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) || (c == '/' && !encodeSep) {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0x0f])
+	}
+
+	return b.String()
+}
+
+// isUnreserved reports whether c is an RFC 3986 unreserved character.
+func isUnreserved(c byte) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package awslambdaplugin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const signingAlgorithmV4A = "AWS4-ECDSA-P256-SHA256"
+
+// Values of the signingAlgorithm option.
+const (
+	signingSigV4  = "sigv4"
+	signingSigV4A = "sigv4a"
+)
+
+// sigV4AKeys memoizes the ECDSA keys derived from the secret access keys, as the derivation
+// is much more expensive than the signature itself.
+type sigV4AKeys struct {
+	mu   sync.Mutex
+	keys map[string]*ecdsa.PrivateKey
+}
+
+func (k *sigV4AKeys) get(creds awsCredentials) (*ecdsa.PrivateKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	cacheKey := creds.AccessKeyID + "\x00" + creds.SecretAccessKey
+	if key, ok := k.keys[cacheKey]; ok {
+		return key, nil
+	}
+
+	key, err := deriveSigV4AKey(creds.AccessKeyID, creds.SecretAccessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.keys == nil || len(k.keys) >= 16 {
+		// Temporary credentials rotate: drop the keys of the previous ones.
+		k.keys = map[string]*ecdsa.PrivateKey{}
+	}
+
+	k.keys[cacheKey] = key
+
+	return key, nil
+}
+
+// signV4A signs the request in place with AWS Signature Version 4A, valid in every region of regionSet.
+func signV4A(req *http.Request, payloadHash string, creds awsCredentials, key *ecdsa.PrivateKey,
+	regionSet []string, service string, now time.Time,
+) error {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format(shortDateFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Region-Set", strings.Join(regionSet, ","))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signedHeaders, canonicalRequest := buildCanonicalRequest(req, payloadHash, service)
+
+	scope := strings.Join([]string{date, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{signingAlgorithmV4A, amzDate, scope, hashHex([]byte(canonicalRequest))}, "\n")
+
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", signingAlgorithmV4A+" Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(signature))
+
+	return nil
+}
+
+// deriveSigV4AKey derives the P-256 signing key of an access key pair: candidate scalars are
+// produced by the NIST SP 800-108 HMAC-SHA256 counter mode KDF, keyed with "AWS4A" + secret key,
+// over the access key and an external counter, until one lower than n-2 is found.
+func deriveSigV4AKey(accessKey, secretKey string) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	nMinusTwo := new(big.Int).Sub(curve.Params().N, big.NewInt(2))
+	inputKey := []byte("AWS4A" + secretKey)
+
+	for counter := 1; counter <= 0xff; counter++ {
+		context := append([]byte(accessKey), byte(counter))
+		candidate := new(big.Int).SetBytes(kdfCounterMode(inputKey, []byte(signingAlgorithmV4A), context, 256))
+		if candidate.Cmp(nMinusTwo) >= 0 {
+			continue
+		}
+
+		d := candidate.Add(candidate, big.NewInt(1))
+		key := &ecdsa.PrivateKey{D: d}
+		key.PublicKey.Curve = curve
+		key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+
+		return key, nil
+	}
+
+	return nil, errors.New("sigv4a: cannot derive a signing key")
+}
+
+// kdfCounterMode implements the NIST SP 800-108 KDF in counter mode with HMAC-SHA256.
+func kdfCounterMode(key, label, context []byte, bits int) []byte {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(bits))
+
+	var out []byte
+	for i := uint32(1); len(out) < bits/8; i++ {
+		counter := make([]byte, 4)
+		binary.BigEndian.PutUint32(counter, i)
+
+		h := hmac.New(sha256.New, key)
+		_, _ = h.Write(counter)
+		_, _ = h.Write(label)
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write(context)
+		_, _ = h.Write(length)
+		out = h.Sum(out)
+	}
+
+	return out[:bits/8]
+}
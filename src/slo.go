@@ -0,0 +1,386 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSLOWindow          = time.Hour
+	defaultSLOShortWindow     = 5 * time.Minute
+	defaultSLOBurnRate        = 14.4
+	defaultSLOWebhookCooldown = 15 * time.Minute
+	sloBucketsPerShortWindow  = 5
+)
+
+// SLOConfig configures the service level objectives tracked by the middleware.
+type SLOConfig struct {
+	// Objectives lists the objectives, matched in order against the request path.
+	Objectives []SLOObjective `json:"objectives,omitempty"`
+	// Window is the long burn-rate window (default 1h).
+	Window string `json:"window,omitempty"`
+	// ShortWindow is the short burn-rate window (default 5m).
+	ShortWindow string `json:"shortWindow,omitempty"`
+	// BurnRateThreshold is the burn rate both windows must reach to raise an alert (default 14.4).
+	BurnRateThreshold float64 `json:"burnRateThreshold,omitempty"`
+	// WebhookURL receives a JSON POST when an alert is raised.
+	WebhookURL string `json:"webhookUrl,omitempty" redact:"true"`
+	// WebhookURLFile reads the webhook URL from a file.
+	WebhookURLFile string `json:"webhookUrlFile,omitempty"`
+	// WebhookCooldown is the minimum delay between two alerts for the same objective (default 15m).
+	WebhookCooldown string `json:"webhookCooldown,omitempty"`
+	// MetricsPath, if set, serves the burn-rate gauges in Prometheus text format.
+	MetricsPath string `json:"metricsPath,omitempty"`
+}
+
+// SLOObjective a latency and/or availability objective for a group of routes.
+type SLOObjective struct {
+	Name               string  `json:"name,omitempty"`
+	PathPrefix         string  `json:"pathPrefix,omitempty"`
+	LatencyThreshold   string  `json:"latencyThreshold,omitempty"`
+	LatencyTarget      float64 `json:"latencyTarget,omitempty"`
+	AvailabilityTarget float64 `json:"availabilityTarget,omitempty"`
+}
+
+// SLOAlert is the payload posted to the SLO webhook.
+type SLOAlert struct {
+	Middleware    string    `json:"middleware"`
+	Objective     string    `json:"objective"`
+	SLI           string    `json:"sli"`
+	Target        float64   `json:"target"`
+	ShortBurnRate float64   `json:"shortBurnRate"`
+	LongBurnRate  float64   `json:"longBurnRate"`
+	Threshold     float64   `json:"threshold"`
+	ShortWindow   string    `json:"shortWindow"`
+	LongWindow    string    `json:"longWindow"`
+	Time          time.Time `json:"time"`
+}
+
+const (
+	sliLatency      = "latency"
+	sliAvailability = "availability"
+)
+
+type sloTracker struct {
+	logger      *logger
+	middleware  string
+	objectives  []*sloObjective
+	width       time.Duration
+	short, long time.Duration
+	threshold   float64
+	webhookURL  string
+	cooldown    time.Duration
+	metricsPath string
+	client      *http.Client
+}
+
+type sloObjective struct {
+	name               string
+	pathPrefix         string
+	latencyThreshold   time.Duration
+	latencyTarget      float64
+	availabilityTarget float64
+
+	mu        sync.Mutex
+	buckets   []sloBucket
+	lastAlert map[string]time.Time
+}
+
+type sloBucket struct {
+	index  int64
+	total  int64
+	slow   int64
+	failed int64
+}
+
+func newSLOTracker(logger *logger, config *SLOConfig) (*sloTracker, error) {
+	if len(config.Objectives) == 0 {
+		return nil, fmt.Errorf("slo: at least one objective must be configured")
+	}
+
+	long, err := parseDurationDefault(config.Window, defaultSLOWindow)
+	if err != nil {
+		return nil, fmt.Errorf("slo: invalid window: %w", err)
+	}
+
+	short, err := parseDurationDefault(config.ShortWindow, defaultSLOShortWindow)
+	if err != nil {
+		return nil, fmt.Errorf("slo: invalid short window: %w", err)
+	}
+
+	if short <= 0 || long < short {
+		return nil, fmt.Errorf("slo: short window must be positive and not longer than the window")
+	}
+
+	cooldown, err := parseDurationDefault(config.WebhookCooldown, defaultSLOWebhookCooldown)
+	if err != nil {
+		return nil, fmt.Errorf("slo: invalid webhook cooldown: %w", err)
+	}
+
+	threshold := config.BurnRateThreshold
+	if threshold == 0 {
+		threshold = defaultSLOBurnRate
+	}
+
+	width := short / sloBucketsPerShortWindow
+	if width < time.Second {
+		width = time.Second
+	}
+
+	count := int(long / width)
+	if long%width != 0 {
+		count++
+	}
+
+	t := &sloTracker{
+		logger:      logger,
+		middleware:  logger.name,
+		width:       width,
+		short:       short,
+		long:        long,
+		threshold:   threshold,
+		webhookURL:  config.WebhookURL,
+		cooldown:    cooldown,
+		metricsPath: config.MetricsPath,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+
+	for i, o := range config.Objectives {
+		objective, err := newSLOObjective(i, o, count)
+		if err != nil {
+			return nil, err
+		}
+
+		t.objectives = append(t.objectives, objective)
+	}
+
+	return t, nil
+}
+
+func newSLOObjective(i int, o SLOObjective, buckets int) (*sloObjective, error) {
+	name := o.Name
+	if name == "" {
+		name = fmt.Sprintf("objective-%d", i)
+	}
+
+	if o.LatencyTarget == 0 && o.AvailabilityTarget == 0 {
+		return nil, fmt.Errorf("slo: objective %q must define a latency or availability target", name)
+	}
+
+	for _, target := range []float64{o.LatencyTarget, o.AvailabilityTarget} {
+		if target < 0 || target >= 1 {
+			return nil, fmt.Errorf("slo: objective %q targets must be between 0 and 1 (exclusive)", name)
+		}
+	}
+
+	var threshold time.Duration
+	if o.LatencyTarget > 0 {
+		var err error
+		threshold, err = time.ParseDuration(o.LatencyThreshold)
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("slo: objective %q requires a valid latency threshold", name)
+		}
+	}
+
+	return &sloObjective{
+		name:               name,
+		pathPrefix:         o.PathPrefix,
+		latencyThreshold:   threshold,
+		latencyTarget:      o.LatencyTarget,
+		availabilityTarget: o.AvailabilityTarget,
+		buckets:            make([]sloBucket, buckets),
+		lastAlert:          map[string]time.Time{},
+	}, nil
+}
+
+func (t *sloTracker) match(path string) *sloObjective {
+	for _, o := range t.objectives {
+		if strings.HasPrefix(path, o.pathPrefix) {
+			return o
+		}
+	}
+
+	return nil
+}
+
+// record accounts a served request against the objective matching its path.
+func (t *sloTracker) record(path string, latency time.Duration, status int, now time.Time) {
+	o := t.match(path)
+	if o == nil {
+		return
+	}
+
+	index := now.UnixNano() / int64(t.width)
+
+	o.mu.Lock()
+	b := &o.buckets[index%int64(len(o.buckets))]
+	if b.index != index {
+		*b = sloBucket{index: index}
+	}
+
+	b.total++
+	if status >= http.StatusInternalServerError {
+		b.failed++
+	}
+
+	if o.latencyThreshold > 0 && latency > o.latencyThreshold {
+		b.slow++
+	}
+
+	alerts := t.alerts(o, index, now)
+	o.mu.Unlock()
+
+	for _, alert := range alerts {
+		t.logger.warnf("SLO %s burn rate alert on objective %q: %.2f (short) / %.2f (long)",
+			alert.SLI, alert.Objective, alert.ShortBurnRate, alert.LongBurnRate)
+
+		if t.webhookURL != "" {
+			go t.notify(alert)
+		}
+	}
+}
+
+// alerts returns the alerts of the burn rates over the threshold out of the cooldown. The caller
+// holds the objective lock.
+func (t *sloTracker) alerts(o *sloObjective, index int64, now time.Time) []SLOAlert {
+	var alerts []SLOAlert
+	for _, sli := range []string{sliLatency, sliAvailability} {
+		target := o.target(sli)
+		if target == 0 {
+			continue
+		}
+
+		short := o.burnRate(sli, index, t.bucketsIn(t.short))
+		long := o.burnRate(sli, index, t.bucketsIn(t.long))
+		if short < t.threshold || long < t.threshold || now.Sub(o.lastAlert[sli]) < t.cooldown {
+			continue
+		}
+
+		o.lastAlert[sli] = now
+		alerts = append(alerts, SLOAlert{
+			Middleware:    t.middleware,
+			Objective:     o.name,
+			SLI:           sli,
+			Target:        target,
+			ShortBurnRate: short,
+			LongBurnRate:  long,
+			Threshold:     t.threshold,
+			ShortWindow:   t.short.String(),
+			LongWindow:    t.long.String(),
+			Time:          now,
+		})
+	}
+
+	return alerts
+}
+
+func (t *sloTracker) bucketsIn(window time.Duration) int64 {
+	n := int64(window / t.width)
+	if n < 1 {
+		n = 1
+	}
+
+	return n
+}
+
+func (o *sloObjective) target(sli string) float64 {
+	if sli == sliLatency {
+		return o.latencyTarget
+	}
+
+	return o.availabilityTarget
+}
+
+// burnRate computes the budget burn rate over the last n buckets. Caller must hold o.mu.
+func (o *sloObjective) burnRate(sli string, index, n int64) float64 {
+	var total, bad int64
+	for _, b := range o.buckets {
+		if b.index <= index-n || b.index > index {
+			continue
+		}
+
+		total += b.total
+		if sli == sliLatency {
+			bad += b.slow
+		} else {
+			bad += b.failed
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return (float64(bad) / float64(total)) / (1 - o.target(sli))
+}
+
+func (t *sloTracker) notify(alert SLOAlert) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		t.logger.errorf("cannot encode SLO alert: %v", err)
+		return
+	}
+
+	resp, err := t.client.Post(t.webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		t.logger.warnf("SLO webhook notification failed: %v", err)
+		return
+	}
+
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		t.logger.warnf("SLO webhook responded with status %d", resp.StatusCode)
+	}
+}
+
+// writeGauges writes the burn-rate gauges in Prometheus text exposition format.
+func (t *sloTracker) writeGauges(rw http.ResponseWriter, now time.Time) {
+	var buf bytes.Buffer
+	buf.WriteString("# HELP traefik_lambda_slo_burn_rate Error budget burn rate per objective, SLI and window.\n")
+	buf.WriteString("# TYPE traefik_lambda_slo_burn_rate gauge\n")
+
+	index := now.UnixNano() / int64(t.width)
+	windows := map[string]int64{
+		t.short.String(): t.bucketsIn(t.short),
+		t.long.String():  t.bucketsIn(t.long),
+	}
+
+	labels := make([]string, 0, len(windows))
+	for label := range windows {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, o := range t.objectives {
+		o.mu.Lock()
+		for _, sli := range []string{sliLatency, sliAvailability} {
+			if o.target(sli) == 0 {
+				continue
+			}
+
+			for _, window := range labels {
+				fmt.Fprintf(&buf, "traefik_lambda_slo_burn_rate{middleware=%q,objective=%q,sli=%q,window=%q} %.6g\n",
+					t.middleware, o.name, sli, window, o.burnRate(sli, index, windows[window]))
+			}
+		}
+		o.mu.Unlock()
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(buf.Bytes())
+}
+
+func parseDurationDefault(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,107 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLOBurnRateAlert(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, err := res.Write([]byte("{\"statusCode\": 503}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	alerts := make(chan awslambdaplugin.SLOAlert, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, req.Body)
+
+		var alert awslambdaplugin.SLOAlert
+		if err := json.Unmarshal(buf.Bytes(), &alert); err != nil {
+			t.Error(err)
+		}
+
+		alerts <- alert
+	}))
+	defer func() { webhook.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.SLO = &awslambdaplugin.SLOConfig{
+		Objectives: []awslambdaplugin.SLOObjective{
+			{Name: "api", PathPrefix: "/api", AvailabilityTarget: 0.99},
+		},
+		BurnRateThreshold: 10,
+		WebhookURL:        webhook.URL,
+		MetricsPath:       "/_slo",
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/api/users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 503, recorder.Code)
+
+	select {
+	case alert := <-alerts:
+		assert.Equal(t, "lambda-plugin", alert.Middleware)
+		assert.Equal(t, "api", alert.Objective)
+		assert.Equal(t, "availability", alert.SLI)
+		assert.InDelta(t, 100, alert.ShortBurnRate, 0.001)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not notified")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/_slo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(),
+		`traefik_lambda_slo_burn_rate{middleware="lambda-plugin",objective="api",sli="availability",window="5m0s"} 100`))
+}
+
+func TestSLOInvalidObjective(t *testing.T) {
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.SLO = &awslambdaplugin.SLOConfig{
+		Objectives: []awslambdaplugin.SLOObjective{{Name: "api", LatencyTarget: 0.99}},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	_, err := awslambdaplugin.New(context.Background(), next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `slo: objective "api" requires a valid latency threshold`)
+}
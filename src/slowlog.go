@@ -0,0 +1,41 @@
+package awslambdaplugin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Phases of a proxied request, timed for the slow request log.
+const (
+	// phaseMarshal reads the request body and builds the invocation payload.
+	phaseMarshal = iota
+	// phaseInvoke calls the function, retries and hedged invocations included.
+	phaseInvoke
+	// phaseDecode parses the function response.
+	phaseDecode
+	// phaseWrite writes the response to the client.
+	phaseWrite
+	phaseCount
+)
+
+var phaseNames = [phaseCount]string{"marshal", "invoke", "decode", "write"}
+
+// addTiming accounts the time spent in a phase of the request.
+func (r *invocationRecord) addTiming(phase int, d time.Duration) {
+	if r != nil {
+		r.timings[phase] += d
+	}
+}
+
+// logSlowRequest warns about a request served in duration, over the slow request threshold, with
+// the time spent in each phase.
+func (a *AwsLambdaPlugin) logSlowRequest(req *http.Request, record *invocationRecord, status int, duration time.Duration) {
+	phases := make([]string, phaseCount)
+	for phase, d := range record.timings {
+		phases[phase] = phaseNames[phase] + " " + d.String()
+	}
+
+	a.logger.warnf("slow request %s %s answered with status %d in %s (%s) [request id: %s]",
+		req.Method, req.URL.Path, status, duration, strings.Join(phases, ", "), record.requestID)
+}
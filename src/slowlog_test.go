@@ -0,0 +1,70 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowRequestThreshold(t *testing.T) {
+	var delay time.Duration
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(delay)
+
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.SlowRequestThreshold = "100ms"
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	serve := func(d time.Duration) {
+		delay = d
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/items", bytes.NewReader([]byte("{}")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve(0)
+	assert.NotContains(t, buf.String(), "slow request")
+
+	serve(150 * time.Millisecond)
+	assert.Regexp(t, regexp.MustCompile(`WARN \[lambda-plugin\] slow request POST /items answered with status 200 in \S+ `+
+		`\(marshal \S+, invoke 1\d\d\.\d+ms, decode \S+, write \S+\) \[request id: req-1\]`), buf.String())
+
+	cfg.SlowRequestThreshold = "fast"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `invalid slow request threshold "fast"`)
+}
@@ -0,0 +1,144 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // The SSO cache file names are SHA-1 digests.
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ssoCredentials role credentials of an IAM Identity Center (SSO) profile, obtained with the
+// access token cached by `aws sso login`.
+type ssoCredentials struct {
+	accountID string
+	roleName  string
+	// cacheFile holds the access token written by the AWS CLI.
+	cacheFile  string
+	portalURL  string
+	httpClient *http.Client
+}
+
+// newSSOCredentials configures the SSO provider of a shared config profile, returning nil when
+// the profile does not use SSO. Both sso-session profiles and legacy sso_start_url profiles are supported.
+func newSSOCredentials(profile string) (credentialsProvider, error) {
+	ini, err := loadINI(sharedConfigFilename())
+	if err != nil {
+		return nil, nil //nolint:nilerr // A missing config file just means no SSO profile.
+	}
+
+	section := profileSection(ini, profile)
+	if section["sso_account_id"] == "" && section["sso_session"] == "" && section["sso_start_url"] == "" {
+		return nil, nil
+	}
+
+	startURL, region, cacheKey := section["sso_start_url"], section["sso_region"], section["sso_start_url"]
+	if name := section["sso_session"]; name != "" {
+		session, ok := ini["sso-session "+name]
+		if !ok {
+			return nil, fmt.Errorf("profile %q: sso-session %q not found", profile, name)
+		}
+
+		startURL, region, cacheKey = session["sso_start_url"], session["sso_region"], name
+	}
+
+	if startURL == "" || region == "" || section["sso_account_id"] == "" || section["sso_role_name"] == "" {
+		return nil, fmt.Errorf("profile %q: incomplete SSO configuration, sso_start_url, sso_region, "+
+			"sso_account_id and sso_role_name are required", profile)
+	}
+
+	sum := sha1.Sum([]byte(cacheKey)) //nolint:gosec // Cache file naming, not a security measure.
+
+	return &ssoCredentials{
+		accountID:  section["sso_account_id"],
+		roleName:   section["sso_role_name"],
+		cacheFile:  filepath.Join(awsConfigDir(), "sso", "cache", hex.EncodeToString(sum[:])+".json"),
+		portalURL:  "https://portal.sso." + region + ".amazonaws.com",
+		httpClient: &http.Client{Timeout: remoteCredentialsWait},
+	}, nil
+}
+
+func (p *ssoCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	token, err := p.accessToken()
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("sso: %w", err)
+	}
+
+	query := url.Values{"account_id": {p.accountID}, "role_name": {p.roleName}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.portalURL+"/federation/credentials?"+query.Encode(), nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	req.Header.Set("X-Amz-Sso_bearer_token", token)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("sso: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("sso: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("sso: get role credentials: %w", newRESTError(resp, body))
+	}
+
+	var payload struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			Expiration      int64  `json:"expiration"`
+		} `json:"roleCredentials"`
+	}
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return awsCredentials{}, fmt.Errorf("sso: invalid response: %w", err)
+	}
+
+	role := payload.RoleCredentials
+	if role.AccessKeyID == "" || role.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("sso: %w", errNoCredentials)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     role.AccessKeyID,
+		SecretAccessKey: role.SecretAccessKey,
+		SessionToken:    role.SessionToken,
+		Expires:         time.Unix(0, role.Expiration*int64(time.Millisecond)),
+		Source:          "sso",
+	}, nil
+}
+
+// accessToken reads the cached SSO access token. Refreshing it is left to `aws sso login`.
+func (p *ssoCredentials) accessToken() (string, error) {
+	data, err := os.ReadFile(filepath.Clean(p.cacheFile))
+	if err != nil {
+		return "", fmt.Errorf("cannot read the cached token, run `aws sso login`: %w", err)
+	}
+
+	var cached struct {
+		AccessToken string    `json:"accessToken"`
+		ExpiresAt   time.Time `json:"expiresAt"`
+	}
+
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return "", fmt.Errorf("invalid cached token %s: %w", p.cacheFile, err)
+	}
+
+	if cached.AccessToken == "" || !time.Now().Before(cached.ExpiresAt) {
+		return "", fmt.Errorf("the cached token expired, run `aws sso login`")
+	}
+
+	return cached.AccessToken, nil
+}
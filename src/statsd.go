@@ -0,0 +1,141 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultStatsDPrefix = "traefik.lambda."
+
+// statsdTagReplacer strips the characters delimiting the DogStatsD tags from their values.
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// StatsDConfig pushes the invocation metrics over UDP to a StatsD server or a Datadog agent, one
+// packet per request.
+type StatsDConfig struct {
+	// Address of the server, e.g. localhost:8125.
+	Address string `json:"address,omitempty"`
+	// Prefix of the metric names (default traefik.lambda.).
+	Prefix string `json:"prefix,omitempty"`
+	// DogStatsD tags the metrics with the middleware, the function and the error code, and sends
+	// the sizes as histograms. Without it, the metrics are aggregated across functions.
+	DogStatsD bool `json:"dogStatsD,omitempty"`
+	// Tags added to the DogStatsD metrics, e.g. env: production.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// statsdExporter sends the metrics of the requests to a StatsD server.
+type statsdExporter struct {
+	logger    *logger
+	prefix    string
+	dogstatsd bool
+	tags      string
+	conn      net.Conn
+}
+
+func newStatsDExporter(logger *logger, config *StatsDConfig) (*statsdExporter, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("statsd: address is required")
+	}
+
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return nil, fmt.Errorf("statsd: invalid address %q", config.Address)
+	}
+
+	if len(config.Tags) > 0 && !config.DogStatsD {
+		return nil, fmt.Errorf("statsd: tags require dogStatsD")
+	}
+
+	e := &statsdExporter{logger: logger, prefix: config.Prefix, dogstatsd: config.DogStatsD}
+	if e.prefix == "" {
+		e.prefix = defaultStatsDPrefix
+	}
+
+	if e.dogstatsd {
+		tags := []string{statsdTag("middleware", logger.name)}
+		for name, value := range config.Tags {
+			tags = append(tags, statsdTag(name, value))
+		}
+
+		sort.Strings(tags[1:])
+		e.tags = strings.Join(tags, ",")
+	}
+
+	// Dialing UDP does not reach the server: it only resolves the address.
+	conn, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+
+	e.conn = conn
+
+	return e, nil
+}
+
+func statsdTag(name, value string) string {
+	return statsdTagReplacer.Replace(name) + ":" + statsdTagReplacer.Replace(value)
+}
+
+// send pushes the metrics of a request served in duration.
+func (e *statsdExporter) send(function string, record *invocationRecord, duration time.Duration) {
+	tags := e.tags
+	if e.dogstatsd {
+		tags += "," + statsdTag("function", function)
+	}
+
+	var buf bytes.Buffer
+	metric := func(name, value, kind, extra string) {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+
+		buf.WriteString(e.prefix + name + ":" + value + "|" + kind)
+		if e.dogstatsd {
+			buf.WriteString("|#" + tags + extra)
+		}
+	}
+
+	sizeKind := "ms"
+	if e.dogstatsd {
+		sizeKind = "h"
+	}
+
+	metric("invocations", "1", "c", "")
+	metric("duration", formatMilliseconds(duration), "ms", "")
+	metric("request_payload_bytes", strconv.Itoa(record.payloadBytes), sizeKind, "")
+	metric("response_payload_bytes", strconv.Itoa(record.responseBytes), sizeKind, "")
+
+	if retries := record.retryCount(); retries > 0 {
+		metric("retries", strconv.FormatInt(retries, 10), "c", "")
+	}
+
+	if record.errorCode != "" {
+		metric("errors", "1", "c", ","+statsdTag("error", record.errorCode))
+	}
+
+	if record.errorCode == "lambda_throttled" {
+		metric("throttles", "1", "c", "")
+	}
+
+	if record.coldStart {
+		metric("cold_starts", "1", "c", "")
+	}
+
+	if record.report != nil {
+		metric("billed_duration", strconv.FormatFloat(record.report.billedDurationMs, 'f', -1, 64), "ms", "")
+		metric("max_memory_used_megabytes", strconv.Itoa(record.report.maxMemoryUsedMB), sizeKind, "")
+	}
+
+	if _, err := e.conn.Write(buf.Bytes()); err != nil {
+		e.logger.debugf("cannot send the statsd metrics: %v", err)
+	}
+}
+
+func formatMilliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', -1, 64)
+}
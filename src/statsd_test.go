@@ -0,0 +1,115 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsD(t *testing.T) {
+	var throttle bool
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if !throttle {
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`{"statusCode": 200}`))
+			return
+		}
+
+		res.WriteHeader(429)
+		_, _ = res.Write([]byte(`{"Type": "User", "message": "Rate Exceeded."}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = server.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.StatsD = &awslambdaplugin.StatsDConfig{Address: server.LocalAddr().String()}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	receive := func() string {
+		buf := make([]byte, 4096)
+		_ = server.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(buf[:n])
+	}
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(receive(), "\n")
+	assert.Equal(t, "traefik.lambda.invocations:1|c", lines[0])
+	assert.Regexp(t, regexp.MustCompile(`^traefik\.lambda\.duration:[0-9.]+\|ms$`), lines[1])
+	assert.Regexp(t, regexp.MustCompile(`^traefik\.lambda\.request_payload_bytes:[0-9]+\|ms$`), lines[2])
+	assert.Equal(t, "traefik.lambda.response_payload_bytes:19|ms", lines[3])
+	assert.Len(t, lines, 4)
+
+	cfg.StatsD = &awslambdaplugin.StatsDConfig{
+		Address:   server.LocalAddr().String(),
+		Prefix:    "edge.",
+		DogStatsD: true,
+		Tags:      map[string]string{"env": "production"},
+	}
+	handler, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	throttle = true
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	tags := "#middleware:lambda-plugin,env:production,function:arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	packet := receive()
+	assert.Contains(t, packet, "edge.invocations:1|c|"+tags+"\n")
+	assert.Contains(t, packet, "edge.response_payload_bytes:0|h|"+tags+"\n")
+	assert.Contains(t, packet, "edge.errors:1|c|"+tags+",error:lambda_throttled\n")
+	assert.True(t, strings.HasSuffix(packet, "edge.throttles:1|c|"+tags))
+
+	cfg.StatsD = &awslambdaplugin.StatsDConfig{}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "statsd: address is required")
+
+	cfg.StatsD = &awslambdaplugin.StatsDConfig{Address: "localhost"}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `statsd: invalid address "localhost"`)
+
+	cfg.StatsD = &awslambdaplugin.StatsDConfig{Address: "localhost:8125", Tags: map[string]string{"env": "production"}}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "statsd: tags require dogStatsD")
+}
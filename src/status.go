@@ -0,0 +1,26 @@
+package awslambdaplugin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// statusDescription returns the status line description of a response, "200 OK"-style as the
+// statusDescription of the ALB responses: the one given by the function when it matches the status
+// code, generated otherwise. The second value reports whether a non-empty description was rejected.
+func statusDescription(statusCode int, description string) (string, bool) {
+	code := strconv.Itoa(statusCode)
+	if description != "" {
+		if text := strings.TrimPrefix(description, code+" "); text != description && strings.TrimSpace(text) != "" {
+			return description, false
+		}
+	}
+
+	generated := code
+	if text := http.StatusText(statusCode); text != "" {
+		generated += " " + text
+	}
+
+	return generated, description != ""
+}
@@ -0,0 +1,30 @@
+package awslambdaplugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusDescription(t *testing.T) {
+	testCases := []struct {
+		statusCode  int
+		description string
+		expected    string
+		rejected    bool
+	}{
+		{statusCode: 200, expected: "200 OK"},
+		{statusCode: 404, description: "404 Not Found", expected: "404 Not Found"},
+		{statusCode: 200, description: "200 All Good", expected: "200 All Good"},
+		{statusCode: 200, description: "404 Not Found", expected: "200 OK", rejected: true},
+		{statusCode: 200, description: "200", expected: "200 OK", rejected: true},
+		{statusCode: 200, description: "OK", expected: "200 OK", rejected: true},
+		{statusCode: 299, expected: "299"},
+	}
+
+	for _, test := range testCases {
+		description, rejected := statusDescription(test.statusCode, test.description)
+		assert.Equal(t, test.expected, description, test.description)
+		assert.Equal(t, test.rejected, rejected, test.description)
+	}
+}
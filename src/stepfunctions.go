@@ -0,0 +1,157 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// stepFunctionsInputLimit is the maximum size of an execution input.
+	stepFunctionsInputLimit = 256 * 1024
+
+	executionSucceeded = "SUCCEEDED"
+	executionTimedOut  = "TIMED_OUT"
+)
+
+// stateMachineBackend starts synchronous executions of an Express state machine.
+type stateMachineBackend struct {
+	arn    string
+	client *serviceClient
+}
+
+func newStateMachineBackend(config *Config, region string, creds credentialsProvider, httpClient *http.Client) (*stateMachineBackend, error) {
+	endpoint := config.StepFunctionsEndpoint
+	if endpoint == "" {
+		endpoint = serviceEndpoint("sync-states", region, false)
+	}
+
+	client, err := newServiceClient("states", region, endpoint, creds, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	client.jsonVersion = "1.0"
+
+	return &stateMachineBackend{arn: config.StateMachineArn, client: client}, nil
+}
+
+// stateMachineRegion returns the region of the state machine ARN, checking it matches the configured one.
+func stateMachineRegion(region, stateMachineArn string) (string, error) {
+	parts := strings.Split(stateMachineArn, ":")
+	if len(parts) != 7 || parts[0] != "arn" || parts[2] != "states" || parts[5] != "stateMachine" || !regionRegexp.MatchString(parts[3]) {
+		return "", fmt.Errorf("invalid state machine arn %q: expected arn:partition:states:region:account:stateMachine:name", stateMachineArn)
+	}
+
+	if region != "" && region != parts[3] {
+		return "", fmt.Errorf("region %q does not match the state machine arn region %q", region, parts[3])
+	}
+
+	return parts[3], nil
+}
+
+// syncExecution the result of a StartSyncExecution call.
+type syncExecution struct {
+	ExecutionArn string `json:"executionArn"`
+	Status       string `json:"status"`
+	Output       string `json:"output"`
+	Error        string `json:"error"`
+	Cause        string `json:"cause"`
+}
+
+// start runs an execution with the given input, waiting for its completion.
+func (b *stateMachineBackend) start(ctx context.Context, input []byte) (*syncExecution, error) {
+	in := map[string]string{
+		"stateMachineArn": b.arn,
+		"input":           string(input),
+	}
+
+	var out syncExecution
+	if err := b.client.callJSON(ctx, "AWSStepFunctions.StartSyncExecution", in, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// errExecutionFailed reports an execution that did not succeed.
+var errExecutionFailed = errors.New("state machine execution failed")
+
+// serveStateMachine answers the request with the output of a state machine execution, accounting
+// the outcome in the circuit breaker.
+func (a *AwsLambdaPlugin) serveStateMachine(ctx context.Context, rw http.ResponseWriter, req *http.Request, request *LambdaRequest, body []byte) {
+	invocationRecordOf(rw).setTarget(a.stateMachine.arn)
+
+	input, err := a.codec.encode(request, body, a.compat.encodeAsText(req, body))
+	if err != nil {
+		a.writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(input) > stepFunctionsInputLimit {
+		writePayloadTooLarge(rw, &payloadTooLargeError{size: int64(len(input)), limit: stepFunctionsInputLimit})
+		return
+	}
+
+	if a.breaker != nil && !a.breaker.allow(time.Now()) {
+		a.respond(rw, req, a.breaker.response(), errCircuitOpen)
+		return
+	}
+
+	start := time.Now()
+	execution, err := a.stateMachine.start(ctx, input)
+	if a.breaker != nil {
+		if canceledByClient(req, err) {
+			a.breaker.release()
+		} else {
+			a.breaker.record(err != nil || execution.Status != executionSucceeded, time.Since(start), time.Now())
+		}
+	}
+
+	if a.limiter != nil {
+		a.limiter.record(start, err)
+	}
+
+	if err != nil {
+		resp, _ := throttledResponse(err)
+		a.respond(rw, req, resp, err)
+		return
+	}
+
+	resp, err := a.executionResponse(execution)
+	a.respond(rw, req, resp, err)
+}
+
+// executionResponse maps the result of an execution to the response: the output of succeeded
+// executions, a 504 for the timed out ones and a 502 for the others or the invalid outputs.
+func (a *AwsLambdaPlugin) executionResponse(execution *syncExecution) (LambdaResponse, error) {
+	switch execution.Status {
+	case executionSucceeded:
+		resp, err := a.codec.decode([]byte(execution.Output))
+		if err != nil {
+			a.logBadResponse(execution.ExecutionArn, []byte(execution.Output))
+			return LambdaResponse{}, fmt.Errorf("%w: invalid state machine output: %s", errBadResponse, err)
+		}
+
+		return resp, nil
+	case executionTimedOut:
+		return LambdaResponse{
+			StatusCode: http.StatusGatewayTimeout,
+			Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+			Body:       http.StatusText(http.StatusGatewayTimeout),
+		}, fmt.Errorf("%w: %s", errExecutionFailed, execution.Status)
+	}
+
+	payload, _ := json.Marshal(functionErrorPayload{ErrorType: execution.Error, ErrorMessage: execution.Cause})
+	resp := a.functionErrorResponse(&invokeOutput{
+		FunctionError: execution.Status,
+		RequestID:     execution.ExecutionArn,
+		Payload:       payload,
+	})
+
+	return resp, fmt.Errorf("%w: %s", errExecutionFailed, execution.Status)
+}
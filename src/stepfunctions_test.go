@@ -0,0 +1,97 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateMachine(t *testing.T) {
+	var event map[string]interface{}
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "AWSStepFunctions.StartSyncExecution", req.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "application/x-amz-json-1.0", req.Header.Get("Content-Type"))
+		assert.Contains(t, req.Header.Get("Authorization"), "/eu-west-1/states/aws4_request")
+
+		var in map[string]string
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "arn:aws:states:eu-west-1:000000000000:stateMachine:api", in["stateMachineArn"])
+
+		event = nil
+		_ = json.Unmarshal([]byte(in["input"]), &event)
+
+		execution := map[string]string{"executionArn": "arn:aws:states:eu-west-1:000000000000:express:api:1:1"}
+		switch event["path"] {
+		case "/failed":
+			execution["status"] = "FAILED"
+			execution["error"] = "States.TaskFailed"
+			execution["cause"] = "boom"
+		case "/timed-out":
+			execution["status"] = "TIMED_OUT"
+		default:
+			execution["status"] = "SUCCEEDED"
+			execution["output"] = `{"statusCode": 201, "headers": {"Content-Type": "text/plain"}, "body": "created"}`
+		}
+
+		_ = json.NewEncoder(res).Encode(execution)
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.StateMachineArn = "arn:aws:states:eu-west-1:000000000000:stateMachine:api"
+	cfg.StepFunctionsEndpoint = mockserver.URL
+	cfg.FunctionErrorDetails = true
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost"+path, strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := serve("/items")
+	assert.Equal(t, 201, recorder.Code)
+	assert.Equal(t, "created", recorder.Body.String())
+	assert.Equal(t, "text/plain", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "POST", event["httpMethod"])
+	assert.Equal(t, "cGF5bG9hZA==", event["body"])
+
+	recorder = serve("/failed")
+	assert.Equal(t, 502, recorder.Code)
+	assert.Equal(t, "Bad Gateway: States.TaskFailed: boom", recorder.Body.String())
+
+	assert.Equal(t, 504, serve("/timed-out").Code)
+
+	cfg.Canary = &awslambdaplugin.CanaryConfig{Qualifier: "v2", Weight: 10}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "canary is not supported with stateMachineArn")
+
+	cfg.Canary = nil
+	cfg.StateMachineArn = "arn:aws:states:eu-west-1:000000000000:execution:api"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `invalid state machine arn "arn:aws:states:eu-west-1:000000000000:execution:api": expected arn:partition:states:region:account:stateMachine:name`)
+}
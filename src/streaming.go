@@ -0,0 +1,190 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// streamPreludeLimit bounds the metadata prelude of a streamed HTTP response.
+const streamPreludeLimit = 64 << 10
+
+// streamPreludeDelimiter separates the JSON metadata prelude of a streamed HTTP response
+// (status code, headers and cookies) from the body, as with the Lambda function URLs.
+var streamPreludeDelimiter = make([]byte, 8)
+
+// streamPrelude the metadata prelude of a streamed HTTP response.
+type streamPrelude struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Cookies    []string          `json:"cookies"`
+}
+
+// streamFunction invokes a streaming-enabled function, forwarding the response to the client
+// as the function produces it. A stream without metadata prelude is buffered and decoded as
+// the usual response envelope. The fallback function is only invoked, buffered, when the stream
+// cannot be started.
+func (a *AwsLambdaPlugin) streamFunction(ctx context.Context, rw http.ResponseWriter, req *http.Request, in *invokeInput) {
+	if a.breaker != nil && !a.breaker.allow(time.Now()) {
+		if a.shouldFallback(req) {
+			resp, err := a.invokeFallback(req, in, errCircuitOpen)
+			a.respond(rw, req, resp, err)
+			return
+		}
+
+		a.respond(rw, req, a.breaker.response(), errCircuitOpen)
+		return
+	}
+
+	start := time.Now()
+	stream, err := a.clientFor(in.FunctionName).invokeStream(ctx, in)
+	if a.limiter != nil {
+		a.limiter.record(start, err)
+	}
+
+	// Failures on the started stream, e.g. a function error, are accounted when it ends.
+	failure := err
+	defer func() {
+		if a.breaker == nil {
+			return
+		}
+
+		if canceledByClient(req, failure) {
+			a.breaker.release()
+		} else {
+			a.breaker.record(failure != nil, time.Since(start), time.Now())
+		}
+	}()
+
+	if err != nil {
+		if a.shouldFallback(req) {
+			resp, err := a.invokeFallback(req, in, err)
+			a.respond(rw, req, resp, err)
+			return
+		}
+
+		resp, _ := throttledResponse(err)
+		a.respond(rw, req, resp, err)
+		return
+	}
+	defer func() { _ = stream.close() }()
+
+	invocationRecordOf(rw).setResult(&invokeOutput{ExecutedVersion: stream.ExecutedVersion, RequestID: stream.RequestID}, time.Since(start))
+
+	buf, ok, err := a.readStreamPrelude(rw, stream)
+	failure = err
+	if !ok {
+		return
+	}
+
+	if err := forwardStream(rw, stream, buf); err != nil {
+		// The status is already sent: abort the response so the client sees it is incomplete.
+		failure = err
+		a.logger.errorf("streamed invocation failed: %s", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// readStreamPrelude reads the stream up to the end of its metadata prelude, writing the response
+// headers, and returns the body read past it. It reports false when the response is already
+// complete, along with the error of the failed stream.
+func (a *AwsLambdaPlugin) readStreamPrelude(rw http.ResponseWriter, stream *responseStream) ([]byte, bool, error) {
+	var buf []byte
+	for {
+		chunk, err := stream.next()
+		if errors.Is(err, io.EOF) {
+			a.writeBufferedStream(rw, stream.RequestID, buf)
+			return nil, false, nil
+		}
+
+		if err != nil {
+			a.writeError(rw, failureStatusCode(err), err)
+			return nil, false, err
+		}
+
+		buf = append(buf, chunk...)
+		if i := bytes.Index(buf, streamPreludeDelimiter); i >= 0 {
+			var prelude streamPrelude
+			if err := json.Unmarshal(buf[:i], &prelude); err != nil {
+				a.logBadResponse(stream.RequestID, buf[:i])
+				a.writeError(rw, http.StatusBadGateway, fmt.Errorf("%w: invalid stream prelude: %s", errBadResponse, err))
+				return nil, false, nil
+			}
+
+			statusCode, err := a.statusCode(prelude.StatusCode)
+			if err != nil {
+				a.logBadResponse(stream.RequestID, buf[:i])
+				a.writeError(rw, http.StatusBadGateway, err)
+				return nil, false, nil
+			}
+
+			a.writeStreamPrelude(rw, statusCode, prelude)
+			return buf[i+len(streamPreludeDelimiter):], true, nil
+		}
+
+		if len(buf) > streamPreludeLimit || buf[0] != '{' {
+			// Not an HTTP response stream: forward the raw payload.
+			rw.WriteHeader(http.StatusOK)
+			return buf, true, nil
+		}
+	}
+}
+
+// writeBufferedStream decodes the stream without metadata prelude as the usual response envelope.
+func (a *AwsLambdaPlugin) writeBufferedStream(rw http.ResponseWriter, requestID string, buf []byte) {
+	resp, err := a.codec.decode(buf)
+	if err != nil {
+		a.logBadResponse(requestID, buf)
+		a.writeError(rw, http.StatusBadGateway, fmt.Errorf("%w: %s", errBadResponse, err))
+		return
+	}
+
+	a.writeResponse(rw, resp)
+}
+
+// forwardStream writes the body of the stream to the client as the function produces it, starting
+// with the already read buf. It returns the error of the failed stream.
+func forwardStream(rw http.ResponseWriter, stream *responseStream, buf []byte) error {
+	flusher, _ := rw.(http.Flusher)
+	for {
+		if len(buf) > 0 {
+			if _, err := rw.Write(buf); err != nil {
+				// The client went away.
+				return nil
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		var err error
+		buf, err = stream.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (a *AwsLambdaPlugin) writeStreamPrelude(rw http.ResponseWriter, statusCode int, prelude streamPrelude) {
+	for key, value := range prelude.Headers {
+		rw.Header().Set(key, value)
+	}
+
+	for _, cookie := range prelude.Cookies {
+		rw.Header().Add("Set-Cookie", cookie)
+	}
+
+	// The length of the streamed body is unknown.
+	sanitizeHeaders(rw.Header(), -1, a.deniedHeaders)
+	rw.WriteHeader(statusCode)
+}
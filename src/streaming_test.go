@@ -0,0 +1,171 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeEventStreamMessage(headers [][2]string, payload []byte) []byte {
+	var h bytes.Buffer
+	for _, header := range headers {
+		h.WriteByte(byte(len(header[0])))
+		h.WriteString(header[0])
+		h.WriteByte(7)
+		_ = binary.Write(&h, binary.BigEndian, uint16(len(header[1])))
+		h.WriteString(header[1])
+	}
+
+	total := 12 + h.Len() + len(payload) + 4
+	msg := make([]byte, 12, total)
+	binary.BigEndian.PutUint32(msg[0:4], uint32(total))
+	binary.BigEndian.PutUint32(msg[4:8], uint32(h.Len()))
+	binary.BigEndian.PutUint32(msg[8:12], crc32.ChecksumIEEE(msg[:8]))
+	msg = append(msg, h.Bytes()...)
+	msg = append(msg, payload...)
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(msg))
+
+	return append(msg, crc...)
+}
+
+func payloadChunk(payload string) []byte {
+	return encodeEventStreamMessage([][2]string{
+		{":message-type", "event"}, {":event-type", "PayloadChunk"}, {":content-type", "application/octet-stream"},
+	}, []byte(payload))
+}
+
+func invokeComplete(payload string) []byte {
+	return encodeEventStreamMessage([][2]string{
+		{":message-type", "event"}, {":event-type", "InvokeComplete"}, {":content-type", "application/json"},
+	}, []byte(payload))
+}
+
+func TestResponseStreaming(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		stream  [][]byte
+		status  int
+		body    string
+		headers map[string]string
+	}{
+		{
+			desc: "http response stream",
+			stream: [][]byte{
+				payloadChunk(`{"statusCode": 201, "headers": {"Content-Type": "text/event-stream"}, "cookies": ["a=b"]}`),
+				payloadChunk("\x00\x00\x00\x00\x00\x00\x00\x00data: 1\n\n"),
+				payloadChunk("data: 2\n\n"),
+				invokeComplete("{}"),
+			},
+			status:  201,
+			body:    "data: 1\n\ndata: 2\n\n",
+			headers: map[string]string{"Content-Type": "text/event-stream", "Set-Cookie": "a=b"},
+		},
+		{
+			desc: "response envelope",
+			stream: [][]byte{
+				payloadChunk(`{"statusCode": 202, "headers": {"X-Test": "1"},`),
+				payloadChunk(`"body": "buffered"}`),
+				invokeComplete("{}"),
+			},
+			status:  202,
+			body:    "buffered",
+			headers: map[string]string{"X-Test": "1"},
+		},
+		{
+			desc:   "raw stream",
+			stream: [][]byte{payloadChunk("plain "), payloadChunk("text"), invokeComplete("{}")},
+			status: 200,
+			body:   "plain text",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				assert.True(t, strings.HasSuffix(req.URL.Path, "/response-streaming-invocations"))
+
+				res.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+				res.WriteHeader(200)
+				for _, msg := range test.stream {
+					_, _ = res.Write(msg)
+					res.(http.Flusher).Flush()
+				}
+			}))
+			defer func() { mockserver.Close() }()
+
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.ResponseStreaming = true
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.body, recorder.Body.String())
+			for name, value := range test.headers {
+				assert.Equal(t, value, recorder.Header().Get(name))
+			}
+		})
+	}
+}
+
+func TestResponseStreamingFunctionError(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write(payloadChunk("{\"statusCode\": 200}\x00\x00\x00\x00\x00\x00\x00\x00partial"))
+		_, _ = res.Write(invokeComplete(`{"ErrorCode": "Unhandled", "ErrorDetails": "boom"}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.ResponseStreaming = true
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { handler.ServeHTTP(recorder, req) })
+	assert.Equal(t, "partial", recorder.Body.String())
+}
@@ -0,0 +1,248 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	stsVersion             = "2011-06-15"
+	stsGlobalEndpoint      = "https://sts.amazonaws.com"
+	stsGlobalRegion        = "us-east-1"
+	defaultRoleSessionName = "traefik-aws-lambda-plugin"
+	defaultRoleDuration    = time.Hour
+
+	stsEndpointsLegacy   = "legacy"
+	stsEndpointsRegional = "regional"
+)
+
+var roleSessionNameRegexp = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// assumeRoleCredentials credentials obtained by assuming an IAM role through STS.
+type assumeRoleCredentials struct {
+	client      *serviceClient
+	roleArn     string
+	externalID  string
+	sessionName string
+	duration    time.Duration
+}
+
+func newAssumeRoleCredentials(client *serviceClient, roleArn, externalID, sessionName string) (*assumeRoleCredentials, error) {
+	if sessionName == "" {
+		sessionName = defaultRoleSessionName
+	}
+
+	if !roleSessionNameRegexp.MatchString(sessionName) {
+		return nil, fmt.Errorf("invalid role session name %q", sessionName)
+	}
+
+	return &assumeRoleCredentials{
+		client:      client,
+		roleArn:     roleArn,
+		externalID:  externalID,
+		sessionName: sessionName,
+		duration:    defaultRoleDuration,
+	}, nil
+}
+
+// newRoleCredentials wraps the source credentials with the roles to assume, in order: roleArn,
+// then the role of the function account.
+func newRoleCredentials(config *Config, region string, source credentialsProvider, httpClient *http.Client, cache cacheOptions) (credentialsProvider, error) {
+	type role struct{ arn, externalID string }
+
+	var roles []role
+	if config.RoleArn != "" {
+		roles = append(roles, role{config.RoleArn, config.ExternalID})
+	}
+
+	target, err := accountRoleArn(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if target != "" && target != config.RoleArn {
+		roles = append(roles, role{arn: target})
+	}
+
+	if len(roles) == 0 {
+		return source, nil
+	}
+
+	endpoint, signingRegion, err := resolveSTSEndpoint(config, region)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := source
+	for _, r := range roles {
+		client, err := newServiceClient("sts", signingRegion, endpoint, creds, httpClient)
+		if err != nil {
+			return nil, err
+		}
+
+		provider, err := newAssumeRoleCredentials(client, r.arn, r.externalID, config.RoleSessionName)
+		if err != nil {
+			return nil, err
+		}
+
+		creds = newCachedCredentials(provider, cache)
+	}
+
+	return creds, nil
+}
+
+// accountRoleArn returns the role to assume in the account owning the function: the accountRoles
+// entry of the account or, when missing, the accountRoleName role.
+func accountRoleArn(config *Config) (string, error) {
+	if len(config.AccountRoles) == 0 && config.AccountRoleName == "" {
+		return "", nil
+	}
+
+	fn, err := parseFunctionArn(config.FunctionArn)
+	if err != nil {
+		return "", err
+	}
+
+	if fn.partition == "" {
+		return "", fmt.Errorf("account roles require a function arn including the account id")
+	}
+
+	if roleArn, ok := config.AccountRoles[fn.account]; ok {
+		return roleArn, nil
+	}
+
+	if config.AccountRoleName == "" {
+		return "", nil
+	}
+
+	return "arn:" + fn.partition + ":iam::" + fn.account + ":role/" + strings.TrimPrefix(config.AccountRoleName, "/"), nil
+}
+
+type stsCredentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+func (p *assumeRoleCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", stsVersion)
+	form.Set("RoleArn", p.roleArn)
+	form.Set("RoleSessionName", p.sessionName)
+	form.Set("DurationSeconds", fmt.Sprint(int(p.duration.Seconds())))
+	if p.externalID != "" {
+		form.Set("ExternalId", p.externalID)
+	}
+
+	var result struct {
+		Credentials stsCredentials `xml:"AssumeRoleResult>Credentials"`
+	}
+
+	if err := p.client.query(ctx, form, &result); err != nil {
+		return awsCredentials{}, fmt.Errorf("assume role %s: %w", p.roleArn, err)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		SessionToken:    result.Credentials.SessionToken,
+		Expires:         result.Credentials.Expiration,
+		Source:          "assume role " + p.roleArn,
+	}, nil
+}
+
+// resolveSTSEndpoint returns the STS endpoint and signing region. A custom endpoint (e.g. a VPC
+// endpoint) is signed for the plugin region, as the FIPS endpoints; the legacy global endpoint only exists in the aws
+// partition, so regions of the other partitions (GovCloud, China) always use the regional one.
+func resolveSTSEndpoint(config *Config, region string) (endpoint, signingRegion string, err error) {
+	if config.STSEndpoint != "" {
+		return config.STSEndpoint, region, nil
+	}
+
+	fips, err := useFIPSEndpoint(config, region)
+	if err != nil {
+		return "", "", err
+	}
+
+	if fips {
+		// The global endpoint has no FIPS counterpart.
+		return serviceEndpoint("sts", region, true), region, nil
+	}
+
+	mode := config.STSRegionalEndpoints
+	if mode == "" {
+		mode = strings.ToLower(firstEnv("AWS_STS_REGIONAL_ENDPOINTS"))
+	}
+
+	switch mode {
+	case "", stsEndpointsLegacy:
+		if regionPartition(region).name != defaultPartition {
+			return serviceEndpoint("sts", region, false), region, nil
+		}
+
+		return stsGlobalEndpoint, stsGlobalRegion, nil
+	case stsEndpointsRegional:
+		return serviceEndpoint("sts", region, false), region, nil
+	default:
+		return "", "", fmt.Errorf("unsupported sts regional endpoints %q", mode)
+	}
+}
+
+// query sends a request to an AWS Query protocol API and decodes the XML response into out.
+func (c *serviceClient) query(ctx context.Context, form url.Values, out interface{}) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	resp, err := c.send(ctx, http.MethodPost, "/", nil, header, []byte(form.Encode()))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return newQueryError(resp, body)
+	}
+
+	return xml.Unmarshal(body, out)
+}
+
+// newQueryError parses the XML error response of a Query protocol API.
+func newQueryError(resp *http.Response, body []byte) *apiError {
+	var payload struct {
+		Code      string `xml:"Error>Code"`
+		Message   string `xml:"Error>Message"`
+		RequestID string `xml:"RequestId"`
+	}
+	_ = xml.Unmarshal(body, &payload)
+
+	e := &apiError{
+		StatusCode: resp.StatusCode,
+		Code:       strings.TrimSpace(payload.Code),
+		Message:    strings.TrimSpace(payload.Message),
+		RequestID:  payload.RequestID,
+	}
+
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get("X-Amzn-Requestid")
+	}
+
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+
+	return e
+}
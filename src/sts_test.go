@@ -0,0 +1,204 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssumeRoleCredentials(t *testing.T) {
+	calls := 0
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=source-key/"))
+		assert.Contains(t, req.Header.Get("Authorization"), "/us-east-1/sts/aws4_request")
+
+		if err := req.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "AssumeRole", req.PostForm.Get("Action"))
+		assert.Equal(t, "arn:aws:iam::000000000000:role/invoker", req.PostForm.Get("RoleArn"))
+		assert.Equal(t, "ext-id", req.PostForm.Get("ExternalId"))
+		assert.Equal(t, "traefik-aws-lambda-plugin", req.PostForm.Get("RoleSessionName"))
+
+		_, _ = res.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-token</SessionToken>
+      <Expiration>` + expiration.Format(time.RFC3339) + `</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	source := staticCredentials{AccessKeyID: "source-key", SecretAccessKey: "source-secret"}
+	client, err := newServiceClient("sts", "us-east-1", mockserver.URL, source, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := newAssumeRoleCredentials(client, "arn:aws:iam::000000000000:role/invoker", "ext-id", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached := newCachedCredentials(provider, cacheOptions{})
+	for i := 0; i < 2; i++ {
+		creds, err := cached.retrieve(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "ASIAROLE", creds.AccessKeyID)
+		assert.Equal(t, "role-secret", creds.SecretAccessKey)
+		assert.Equal(t, "role-token", creds.SessionToken)
+		assert.True(t, expiration.Equal(creds.Expires))
+	}
+
+	assert.Equal(t, 1, calls)
+}
+
+func TestAssumeRoleError(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusForbidden)
+		_, _ = res.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code>` +
+			`<Message>not authorized</Message></Error><RequestId>req-1</RequestId></ErrorResponse>`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	source := staticCredentials{AccessKeyID: "source-key", SecretAccessKey: "source-secret"}
+	client, err := newServiceClient("sts", "us-east-1", mockserver.URL, source, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := newAssumeRoleCredentials(client, "arn:aws:iam::000000000000:role/invoker", "", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.retrieve(context.Background())
+	assert.EqualError(t, err, "assume role arn:aws:iam::000000000000:role/invoker: "+
+		"AccessDenied (status 403): not authorized [request id: req-1]")
+}
+
+func TestResolveSTSEndpoint(t *testing.T) {
+	fips := true
+	testCases := []struct {
+		desc     string
+		config   Config
+		region   string
+		env      string
+		endpoint string
+		signing  string
+	}{
+		{desc: "legacy", region: "eu-west-1", endpoint: "https://sts.amazonaws.com", signing: "us-east-1"},
+		{desc: "regional", config: Config{STSRegionalEndpoints: "regional"}, region: "eu-west-1", endpoint: "https://sts.eu-west-1.amazonaws.com", signing: "eu-west-1"},
+		{desc: "regional from env", region: "eu-west-1", env: "regional", endpoint: "https://sts.eu-west-1.amazonaws.com", signing: "eu-west-1"},
+		{desc: "govcloud", region: "us-gov-west-1", endpoint: "https://sts.us-gov-west-1.amazonaws.com", signing: "us-gov-west-1"},
+		{desc: "china", region: "cn-north-1", endpoint: "https://sts.cn-north-1.amazonaws.com.cn", signing: "cn-north-1"},
+		{desc: "fips", config: Config{UseFIPSEndpoint: &fips}, region: "us-east-1", endpoint: "https://sts-fips.us-east-1.amazonaws.com", signing: "us-east-1"},
+		{
+			desc:     "custom",
+			config:   Config{STSEndpoint: "https://vpce-0123-abcd.sts.eu-west-1.vpce.amazonaws.com"},
+			region:   "eu-west-1",
+			endpoint: "https://vpce-0123-abcd.sts.eu-west-1.vpce.amazonaws.com",
+			signing:  "eu-west-1",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Setenv("AWS_STS_REGIONAL_ENDPOINTS", test.env)
+
+			endpoint, signing, err := resolveSTSEndpoint(&test.config, test.region)
+			assert.NoError(t, err)
+			assert.Equal(t, test.endpoint, endpoint)
+			assert.Equal(t, test.signing, signing)
+		})
+	}
+
+	_, _, err := resolveSTSEndpoint(&Config{STSRegionalEndpoints: "local"}, "eu-west-1")
+	assert.EqualError(t, err, `unsupported sts regional endpoints "local"`)
+}
+
+func TestAccountRoleChaining(t *testing.T) {
+	var assumed []string
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+
+		roleArn := req.PostForm.Get("RoleArn")
+		assumed = append(assumed, roleArn)
+
+		key := "ASIAHUB"
+		if strings.HasSuffix(roleArn, ":role/invoker") {
+			key = "ASIAAPP"
+			assert.Contains(t, req.Header.Get("Authorization"), "Credential=ASIAHUB/")
+			assert.Equal(t, "hub-token", req.Header.Get("X-Amz-Security-Token"))
+		}
+
+		token := strings.ToLower(strings.TrimPrefix(key, "ASIA")) + "-token"
+		_, _ = res.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials>` +
+			`<AccessKeyId>` + key + `</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>` +
+			`<SessionToken>` + token + `</SessionToken>` +
+			`<Expiration>` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `</Expiration>` +
+			`</Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	config := &Config{
+		FunctionArn:     "arn:aws:lambda:eu-west-1:111111111111:function:xxx",
+		RoleArn:         "arn:aws:iam::000000000000:role/hub",
+		AccountRoleName: "invoker",
+		STSEndpoint:     mockserver.URL,
+	}
+
+	source := staticCredentials{AccessKeyID: "source-key", SecretAccessKey: "source-secret"}
+	provider, err := newRoleCredentials(config, "eu-west-1", source, http.DefaultClient, cacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := provider.retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "ASIAAPP", creds.AccessKeyID)
+	assert.Equal(t, []string{"arn:aws:iam::000000000000:role/hub", "arn:aws:iam::111111111111:role/invoker"}, assumed)
+}
+
+func TestAccountRoleArn(t *testing.T) {
+	config := &Config{
+		FunctionArn:     "arn:aws-us-gov:lambda:us-gov-west-1:111111111111:function:xxx:live",
+		AccountRoleName: "invoker",
+		AccountRoles:    map[string]string{"222222222222": "arn:aws:iam::222222222222:role/custom"},
+	}
+
+	roleArn, err := accountRoleArn(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws-us-gov:iam::111111111111:role/invoker", roleArn)
+
+	config.FunctionArn = "arn:aws:lambda:eu-west-1:222222222222:function:xxx"
+	roleArn, err = accountRoleArn(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::222222222222:role/custom", roleArn)
+
+	config.FunctionArn = "xxx"
+	_, err = accountRoleArn(config)
+	assert.EqualError(t, err, "account roles require a function arn including the account id")
+}
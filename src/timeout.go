@@ -0,0 +1,178 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultInvokeTimeout is the longest a function can run.
+	defaultInvokeTimeout = 15 * time.Minute
+
+	// invokeTimeoutAuto derives the invoke timeout from the function timeout.
+	invokeTimeoutAuto          = "auto"
+	defaultInvokeTimeoutMargin = time.Second
+)
+
+// resolveInvokeTimeout returns the configured invoke timeout. With auto, it is the timeout of the
+// function plus the margin, leaving room for the network round trip; the default applies when the
+// function configuration cannot be read.
+func resolveInvokeTimeout(ctx context.Context, logger *logger, config *Config, client *lambdaClient, function, qualifier string) (time.Duration, error) {
+	if config.InvokeTimeout != invokeTimeoutAuto {
+		invokeTimeout, err := parseDurationDefault(config.InvokeTimeout, defaultInvokeTimeout)
+		if err != nil || invokeTimeout <= 0 {
+			return 0, fmt.Errorf("invalid invoke timeout %q", config.InvokeTimeout)
+		}
+
+		return invokeTimeout, nil
+	}
+
+	if function == "" {
+		return 0, fmt.Errorf("invoke timeout %s requires functionArn", invokeTimeoutAuto)
+	}
+
+	margin, err := parseDurationDefault(config.InvokeTimeoutMargin, defaultInvokeTimeoutMargin)
+	if err != nil || margin < 0 {
+		return 0, fmt.Errorf("invalid invoke timeout margin %q", config.InvokeTimeoutMargin)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, functionValidationTimeout)
+	defer cancel()
+
+	configuration, err := client.getFunctionConfiguration(ctx, function, qualifier)
+	if err != nil || configuration.Timeout <= 0 {
+		logger.warnf("cannot read the function timeout, using an invoke timeout of %s: %v", defaultInvokeTimeout, err)
+		return defaultInvokeTimeout, nil
+	}
+
+	return time.Duration(configuration.Timeout)*time.Second + margin, nil
+}
+
+// timeoutOverride lets trusted callers shorten the invoke deadline through a request header.
+type timeoutOverride struct {
+	header  string
+	max     time.Duration
+	trusted []*net.IPNet
+}
+
+func newTimeoutOverride(config *Config) (*timeoutOverride, error) {
+	if config.TimeoutHeader == "" {
+		return nil, nil
+	}
+
+	maxTimeout, err := parseDurationDefault(config.MaxTimeoutOverride, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max timeout override: %w", err)
+	}
+
+	trusted, err := parseCIDRs(config.TimeoutHeaderTrustedIPs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout header trusted ips: %w", err)
+	}
+
+	return &timeoutOverride{
+		header:  http.CanonicalHeaderKey(config.TimeoutHeader),
+		max:     maxTimeout,
+		trusted: trusted,
+	}, nil
+}
+
+// deadline extracts the requested timeout and strips the header from the request.
+// It returns zero when the header is absent, invalid or sent by an untrusted client.
+func (o *timeoutOverride) deadline(req *http.Request) time.Duration {
+	value := req.Header.Get(o.header)
+	if value == "" {
+		return 0
+	}
+
+	req.Header.Del(o.header)
+	if !isTrustedAddr(o.trusted, req.RemoteAddr) {
+		return 0
+	}
+
+	ms, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || ms <= 0 {
+		return 0
+	}
+
+	d := time.Duration(ms) * time.Millisecond
+	if o.max > 0 && d > o.max {
+		d = o.max
+	}
+
+	return d
+}
+
+// isTrustedAddr reports whether the remote address belongs to one of the trusted networks;
+// every address is trusted when none is configured.
+func isTrustedAddr(trusted []*net.IPNet, remoteAddr string) bool {
+	if len(trusted) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(remoteHost(remoteAddr))
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// invokeContext derives the context bounding the function invocation: the request context, limited
+// by the invoke timeout or the shorter deadline requested through the timeout header.
+func (a *AwsLambdaPlugin) invokeContext(req *http.Request) (context.Context, context.CancelFunc) {
+	timeout := a.invokeTimeout
+	if a.timeoutOverride != nil {
+		if d := a.timeoutOverride.deadline(req); d > 0 && (timeout == 0 || d < timeout) {
+			timeout = d
+		}
+	}
+
+	if timeout > 0 {
+		return context.WithTimeout(req.Context(), timeout)
+	}
+
+	return context.WithCancel(req.Context())
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return host
+}
+
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
@@ -0,0 +1,186 @@
+package awslambdaplugin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutHeaderOverride(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var lReq awslambdaplugin.LambdaRequest
+		err = json.Unmarshal(buf.Bytes(), &lReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.NotContains(t, lReq.Headers, "X-Invoke-Timeout-Ms")
+
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-req.Context().Done():
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.TimeoutHeader = "X-Invoke-Timeout-Ms"
+	cfg.MaxTimeoutOverride = "10s"
+	cfg.TimeoutHeaderTrustedIPs = []string{"10.0.0.0/8"}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRequest := func(remoteAddr string) *http.Request {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Invoke-Timeout-Ms", "20")
+
+		return req
+	}
+
+	// Untrusted clients cannot shorten the deadline.
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newRequest("192.168.1.1:4321"))
+	assert.Equal(t, 200, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newRequest("10.1.2.3:4321"))
+	assert.Equal(t, 504, recorder.Code)
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-req.Context().Done():
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.InvokeTimeout = "20ms"
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 504, recorder.Code)
+	assert.Less(t, int64(time.Since(start)), int64(250*time.Millisecond))
+
+	cfg.InvokeTimeout = "0s"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `invalid invoke timeout "0s"`)
+}
+
+func TestInvokeTimeoutAuto(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/configuration") {
+			res.WriteHeader(200)
+			_, _ = res.Write([]byte(`{"Timeout": 1}`))
+			return
+		}
+
+		select {
+		case <-time.After(1500 * time.Millisecond):
+		case <-req.Context().Done():
+		}
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.InvokeTimeout = "auto"
+	cfg.InvokeTimeoutMargin = "100ms"
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, 504, recorder.Code)
+
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, int64(elapsed), int64(1100*time.Millisecond))
+	assert.Less(t, int64(elapsed), int64(2*time.Second))
+
+	cfg.InvokeTimeoutMargin = "-1s"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `invalid invoke timeout margin "-1s"`)
+
+	cfg.InvokeTimeoutMargin = ""
+	cfg.FunctionArn = ""
+	cfg.FunctionURL = "https://xxx.lambda-url.eu-west-1.on.aws/"
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "invoke timeout auto requires functionArn")
+}
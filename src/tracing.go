@@ -0,0 +1,401 @@
+package awslambdaplugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTracingServiceName   = "traefik"
+	defaultTracingFlushInterval = 5 * time.Second
+	defaultTracingBatchSize     = 512
+	maxQueuedSpans              = 4096
+
+	spanKindClient  = 3
+	spanStatusError = 2
+)
+
+// TracingConfig exports a span per invocation to an OpenTelemetry collector over OTLP/HTTP, as a
+// child of the trace context of the request (W3C traceparent header).
+type TracingConfig struct {
+	// Endpoint of the collector, e.g. http://otel-collector:4318; the spans are posted to /v1/traces.
+	Endpoint string `json:"endpoint,omitempty"`
+	// ServiceName is the service.name resource attribute (default traefik).
+	ServiceName string `json:"serviceName,omitempty"`
+	// Headers sent with the export requests, e.g. an API key.
+	Headers map[string]string `json:"headers,omitempty" redact:"true"`
+	// FlushInterval between two exports (default 5s).
+	FlushInterval string `json:"flushInterval,omitempty"`
+	// BatchSize exports the spans as soon as that many are queued (default 512).
+	BatchSize int `json:"batchSize,omitempty"`
+}
+
+// spanContext identifies a span of a trace.
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// parseTraceparent parses a W3C traceparent header: version-traceid-parentid-flags.
+func parseTraceparent(value string) (spanContext, bool) {
+	var sc spanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+
+	traceID, ok := decodeTraceField(parts[1], len(sc.traceID))
+	if !ok {
+		return sc, false
+	}
+
+	spanID, ok := decodeTraceField(parts[2], len(sc.spanID))
+	if !ok {
+		return sc, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, false
+	}
+
+	copy(sc.traceID[:], traceID)
+	copy(sc.spanID[:], spanID)
+
+	sc.sampled = flags[0]&1 == 1
+
+	return sc, true
+}
+
+// decodeTraceField decodes a lowercase hex trace or span ID of size bytes; all zeroes are invalid.
+func decodeTraceField(value string, size int) ([]byte, bool) {
+	id, err := hex.DecodeString(value)
+	if err != nil || len(id) != size || strings.ToLower(value) != value {
+		return nil, false
+	}
+
+	for _, b := range id {
+		if b != 0 {
+			return id, true
+		}
+	}
+
+	return nil, false
+}
+
+// traceparent returns the W3C traceparent header of the span context.
+func (sc spanContext) traceparent() string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// propagateTraceContext sets the traceparent header forwarded to the function: the span of the
+// invocation when traced, otherwise the one of the request, generated when missing or invalid so
+// that the function starts the trace. The tracestate header is forwarded along with a valid one.
+func propagateTraceContext(req *http.Request, s *span) {
+	if s != nil {
+		req.Header.Set("Traceparent", s.traceparent())
+		return
+	}
+
+	if _, ok := parseTraceparent(req.Header.Get("Traceparent")); ok {
+		return
+	}
+
+	sc := spanContext{sampled: true}
+	if _, err := rand.Read(sc.traceID[:]); err != nil {
+		return
+	}
+
+	if _, err := rand.Read(sc.spanID[:]); err != nil {
+		return
+	}
+
+	req.Header.Set("Traceparent", sc.traceparent())
+	req.Header.Del("Tracestate")
+}
+
+// span is an invocation being traced.
+type span struct {
+	spanContext
+	parentID [8]byte
+	start    time.Time
+}
+
+// tracer queues the finished spans and exports them in batches.
+type tracer struct {
+	logger      *logger
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	interval    time.Duration
+	batchSize   int
+	client      *http.Client
+
+	mu      sync.Mutex
+	spans   []otlpSpan
+	flushes chan struct{}
+}
+
+func newTracer(logger *logger, config *TracingConfig) (*tracer, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("tracing: endpoint is required")
+	}
+
+	interval, err := parseDurationDefault(config.FlushInterval, defaultTracingFlushInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("tracing: invalid flush interval %q", config.FlushInterval)
+	}
+
+	if config.BatchSize < 0 {
+		return nil, fmt.Errorf("tracing: batch size cannot be negative")
+	}
+
+	t := &tracer{
+		logger:      logger,
+		endpoint:    strings.TrimSuffix(config.Endpoint, "/") + "/v1/traces",
+		serviceName: config.ServiceName,
+		headers:     config.Headers,
+		interval:    interval,
+		batchSize:   config.BatchSize,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		flushes:     make(chan struct{}, 1),
+	}
+
+	if t.serviceName == "" {
+		t.serviceName = defaultTracingServiceName
+	}
+
+	if t.batchSize == 0 {
+		t.batchSize = defaultTracingBatchSize
+	}
+
+	return t, nil
+}
+
+// start starts the span of the request, continuing its trace context if any. It returns nil when
+// the request is not sampled.
+func (t *tracer) start(req *http.Request, now time.Time) *span {
+	s := &span{start: now}
+	if parent, ok := parseTraceparent(req.Header.Get("Traceparent")); ok {
+		if !parent.sampled {
+			return nil
+		}
+
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else if _, err := rand.Read(s.traceID[:]); err != nil {
+		return nil
+	}
+
+	if _, err := rand.Read(s.spanID[:]); err != nil {
+		return nil
+	}
+
+	s.sampled = true
+
+	return s
+}
+
+// end finishes the span of a request served with the status, and queues it for export.
+func (t *tracer) end(s *span, record *invocationRecord, status int, now time.Time) {
+	attributes := []otlpAttribute{
+		stringAttribute("rpc.system", "aws-api"),
+		stringAttribute("rpc.service", "Lambda"),
+		stringAttribute("rpc.method", "Invoke"),
+		stringAttribute("faas.invoked_provider", "aws"),
+		stringAttribute("faas.invoked_name", record.function),
+		intAttribute("aws.lambda.payload_bytes", int64(record.payloadBytes)),
+		intAttribute("aws.lambda.response_bytes", int64(record.responseBytes)),
+		intAttribute("http.response.status_code", int64(status)),
+	}
+
+	if strings.HasPrefix(record.function, "arn:") {
+		attributes = append(attributes, stringAttribute("aws.lambda.invoked_arn", record.function))
+	}
+
+	optional := [][2]string{
+		{"aws.lambda.qualifier", record.qualifier},
+		{"aws.lambda.executed_version", record.executedVersion},
+		{"aws.request_id", record.requestID},
+		{"error.type", record.errorCode},
+	}
+	for _, attribute := range optional {
+		if attribute[1] != "" {
+			attributes = append(attributes, stringAttribute(attribute[0], attribute[1]))
+		}
+	}
+
+	if record.coldStart {
+		attributes = append(attributes, otlpAttribute{Key: "faas.coldstart", Value: otlpValue{BoolValue: &record.coldStart}})
+	}
+
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              "Lambda.Invoke",
+		Kind:              spanKindClient,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(now.UnixNano(), 10),
+		Attributes:        attributes,
+	}
+
+	if s.parentID != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+
+	if record.errorCode != "" {
+		out.Status = &otlpStatus{Code: spanStatusError, Message: record.errorCode}
+	}
+
+	t.mu.Lock()
+	if len(t.spans) < maxQueuedSpans {
+		t.spans = append(t.spans, out)
+	}
+	full := len(t.spans) >= t.batchSize
+	t.mu.Unlock()
+
+	if full {
+		select {
+		case t.flushes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run exports the queued spans at every interval, or when a batch is full, until the context is
+// done.
+func (t *tracer) run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.flush(context.Background())
+			return
+		case <-ticker.C:
+		case <-t.flushes:
+		}
+
+		t.flush(ctx)
+	}
+}
+
+// flush exports the queued spans. The spans of a failed export are dropped.
+func (t *tracer) flush(ctx context.Context) {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", t.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "traefik-aws-lambda-plugin"}, Spans: spans}},
+	}}})
+	if err != nil {
+		t.logger.errorf("cannot encode the spans: %v", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		t.logger.warnf("span export failed: %v", err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		t.logger.warnf("span export failed: %v", err)
+		return
+	}
+
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		t.logger.warnf("span export responded with status %d, %d spans dropped", resp.StatusCode, len(spans))
+	}
+}
+
+// OTLP/HTTP JSON encoding of the spans.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            *otlpStatus     `json:"status,omitempty"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    string  `json:"intValue,omitempty"`
+		BoolValue   *bool   `json:"boolValue,omitempty"`
+	}
+)
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: strconv.FormatInt(value, 10)}}
+}
@@ -0,0 +1,202 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracing(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Amzn-Requestid", "req-1")
+		res.Header().Set("X-Amz-Executed-Version", "7")
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	exports := make(chan map[string]interface{}, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v1/traces", req.URL.Path)
+		assert.Equal(t, "secret", req.Header.Get("X-Api-Key"))
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		exports <- body
+	}))
+	defer func() { collector.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx"
+	cfg.Qualifier = "live"
+	cfg.Endpoint = mockserver.URL
+	cfg.Tracing = &awslambdaplugin.TracingConfig{
+		Endpoint:    collector.URL,
+		ServiceName: "edge",
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+		BatchSize:   1,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(traceparent string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Traceparent", traceparent)
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Not sampled by the caller.
+	serve("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	serve("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	var body map[string]interface{}
+	select {
+	case body = <-exports:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no span exported")
+	}
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	resource := resourceSpans["resource"].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "edge"}}}, resource["attributes"])
+
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	assert.Len(t, spans, 1)
+
+	span := spans[0].(map[string]interface{})
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", span["parentSpanId"])
+	assert.Len(t, span["spanId"], 16)
+	assert.Equal(t, "Lambda.Invoke", span["name"])
+	assert.Equal(t, float64(3), span["kind"])
+	assert.NotContains(t, span, "status")
+
+	attributes := map[string]interface{}{}
+	for _, attribute := range span["attributes"].([]interface{}) {
+		attribute := attribute.(map[string]interface{})
+		for _, value := range attribute["value"].(map[string]interface{}) {
+			attributes[attribute["key"].(string)] = value
+		}
+	}
+
+	assert.Equal(t, "arn:aws:lambda:eu-west-1:000000000000:function:xxx", attributes["aws.lambda.invoked_arn"])
+	assert.Equal(t, "live", attributes["aws.lambda.qualifier"])
+	assert.Equal(t, "7", attributes["aws.lambda.executed_version"])
+	assert.Equal(t, "req-1", attributes["aws.request_id"])
+	assert.Equal(t, "19", attributes["aws.lambda.response_bytes"])
+	assert.Equal(t, "200", attributes["http.response.status_code"])
+
+	select {
+	case <-exports:
+		t.Fatal("the unsampled request was exported")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cfg.Tracing = &awslambdaplugin.TracingConfig{}
+	_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "tracing: endpoint is required")
+}
+
+func TestTraceContext(t *testing.T) {
+	var event awslambdaplugin.LambdaRequest
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		event = awslambdaplugin.LambdaRequest{}
+		_ = json.NewDecoder(req.Body).Decode(&event)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	exports := make(chan map[string]interface{}, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		exports <- body
+	}))
+	defer func() { collector.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.TraceContext = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(traceparent, tracestate string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if traceparent != "" {
+			req.Header.Set("Traceparent", traceparent)
+			req.Header.Set("Tracestate", tracestate)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	serve(incoming, "vendor=1")
+	assert.Equal(t, incoming, event.Headers["Traceparent"])
+	assert.Equal(t, "vendor=1", event.Headers["Tracestate"])
+
+	for _, traceparent := range []string{"", "00-invalid-01"} {
+		serve(traceparent, "vendor=1")
+		assert.Regexp(t, regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`), event.Headers["Traceparent"])
+		assert.NotContains(t, event.Headers, "Tracestate")
+	}
+
+	// The function continues the span of the invocation.
+	cfg.TraceContext = false
+	cfg.Tracing = &awslambdaplugin.TracingConfig{Endpoint: collector.URL, BatchSize: 1}
+	handler, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve(incoming, "vendor=1")
+
+	var body map[string]interface{}
+	select {
+	case body = <-exports:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no span exported")
+	}
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	span := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span["spanId"].(string)+"-01", event.Headers["Traceparent"])
+	assert.Equal(t, "vendor=1", event.Headers["Tracestate"])
+}
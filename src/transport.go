@@ -0,0 +1,208 @@
+package awslambdaplugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultDialTimeout is the dial timeout of http.DefaultTransport.
+const defaultDialTimeout = 30 * time.Second
+
+// TLSConfig configures the TLS client used to reach the AWS endpoints, e.g. LocalStack with
+// self-signed certificates or private interface endpoints behind an internal CA.
+type TLSConfig struct {
+	// CABundle is a PEM file of certificate authorities trusted in addition to the system ones.
+	CABundle string `json:"caBundle,omitempty"`
+	// InsecureSkipVerify disables the verification of the server certificates. Only for testing.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// MinVersion of the TLS protocol: 1.0, 1.1, 1.2 (default) or 1.3.
+	MinVersion string `json:"minVersion,omitempty"`
+}
+
+// TransportConfig tunes the connections of the client used to reach the AWS endpoints. High
+// throughput deployments keep more warm connections, low throughput ones close them sooner.
+type TransportConfig struct {
+	// MaxIdleConns is the number of idle connections kept across the endpoints (default 100).
+	MaxIdleConns int `json:"maxIdleConns,omitempty"`
+	// MaxIdleConnsPerHost is the number of idle connections kept to an endpoint (default 2).
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+	// IdleConnTimeout closes the connections idle for that long (default 90s).
+	IdleConnTimeout string `json:"idleConnTimeout,omitempty"`
+	// TLSHandshakeTimeout bounds the TLS handshakes (default 10s).
+	TLSHandshakeTimeout string `json:"tlsHandshakeTimeout,omitempty"`
+	// DialTimeout bounds the connection establishment (default 30s).
+	DialTimeout string `json:"dialTimeout,omitempty"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newHTTPClient builds the client shared by the AWS service clients of a middleware.
+// Without an explicit proxyUrl, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables apply.
+func newHTTPClient(config *Config) (*http.Client, error) {
+	if config.TLS == nil && config.ProxyURL == "" && config.Transport == nil {
+		return &http.Client{}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.Transport != nil {
+		if err := tuneTransport(transport, config.Transport); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.TLS != nil {
+		tlsConfig, err := newTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if config.ProxyURL != "" {
+		proxy, err := newProxyFunc(config.ProxyURL, config.NoProxy)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.Proxy = proxy
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// tuneTransport applies the connection settings to the transport, keeping the defaults of the unset
+// ones.
+func tuneTransport(transport *http.Transport, config *TransportConfig) error {
+	if config.MaxIdleConns < 0 || config.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("transport: max idle connections cannot be negative")
+	}
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+
+	idleConnTimeout, err := parseDurationDefault(config.IdleConnTimeout, transport.IdleConnTimeout)
+	if err != nil || idleConnTimeout <= 0 {
+		return fmt.Errorf("transport: invalid idle conn timeout %q", config.IdleConnTimeout)
+	}
+
+	tlsHandshakeTimeout, err := parseDurationDefault(config.TLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	if err != nil || tlsHandshakeTimeout <= 0 {
+		return fmt.Errorf("transport: invalid tls handshake timeout %q", config.TLSHandshakeTimeout)
+	}
+
+	dialTimeout, err := parseDurationDefault(config.DialTimeout, defaultDialTimeout)
+	if err != nil || dialTimeout <= 0 {
+		return fmt.Errorf("transport: invalid dial timeout %q", config.DialTimeout)
+	}
+
+	transport.IdleConnTimeout = idleConnTimeout
+	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+	transport.DialContext = (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+
+	return nil
+}
+
+// newProxyFunc routes the requests through the proxy, except for the hosts matching noProxy
+// entries: exact host names, ".domain" suffixes or "*" for every host.
+func newProxyFunc(proxyURL string, noProxy []string) (func(*http.Request) (*url.URL, error), error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url")
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q: scheme and host are required", redactURL(u))
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		host := strings.ToLower(req.URL.Hostname())
+		for _, entry := range noProxy {
+			entry = strings.ToLower(strings.TrimSpace(entry))
+			switch {
+			case entry == "*", entry == host:
+				return nil, nil
+			case strings.HasPrefix(entry, ".") && strings.HasSuffix(host, entry),
+				!strings.HasPrefix(entry, ".") && strings.HasSuffix(host, "."+entry):
+				return nil, nil
+			}
+		}
+
+		return u, nil
+	}, nil
+}
+
+// redactURL renders an URL hiding its password, e.g. proxy credentials.
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+
+	redacted := *u
+	if _, ok := u.User.Password(); ok {
+		redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+
+	return redacted.String()
+}
+
+func newTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.InsecureSkipVerify, //nolint:gosec // Explicitly requested by the configuration.
+	}
+
+	if config.MinVersion != "" {
+		version, ok := tlsVersions[config.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls min version %q", config.MinVersion)
+		}
+
+		tlsConfig.MinVersion = version
+	}
+
+	if config.CABundle != "" {
+		pem, err := os.ReadFile(filepath.Clean(config.CABundle))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read tls ca bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls ca bundle %s contains no valid certificate", config.CABundle)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,233 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSConfig(t *testing.T) {
+	mockserver := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { mockserver.Close() }()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mockserver.Certificate().Raw})
+	if err := os.WriteFile(bundle, certificate, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc string
+		tls  *awslambdaplugin.TLSConfig
+	}{
+		{desc: "ca bundle", tls: &awslambdaplugin.TLSConfig{CABundle: bundle, MinVersion: "1.3"}},
+		{desc: "insecure skip verify", tls: &awslambdaplugin.TLSConfig{InsecureSkipVerify: true}},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = mockserver.URL
+			cfg.TLS = test.tls
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, 200, recorder.Code)
+		})
+	}
+}
+
+func TestTLSConfigInvalid(t *testing.T) {
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.TLS = &awslambdaplugin.TLSConfig{MinVersion: "1.4"}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	_, err := awslambdaplugin.New(context.Background(), next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported tls min version "1.4"`)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.TLS = &awslambdaplugin.TLSConfig{CABundle: bundle}
+	_, err = awslambdaplugin.New(context.Background(), next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, "tls ca bundle "+bundle+" contains no valid certificate")
+}
+
+func TestProxyURL(t *testing.T) {
+	proxied := 0
+	proxy := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		proxied++
+		assert.Equal(t, "lambda.eu-west-1.example.internal", req.URL.Host)
+		assert.Equal(t, "Basic dXNlcjpwYXNz", req.Header.Get("Proxy-Authorization"))
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	defer func() { proxy.Close() }()
+
+	direct := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 202}"))
+	}))
+	defer func() { direct.Close() }()
+
+	testCases := []struct {
+		desc     string
+		endpoint string
+		noProxy  []string
+		status   int
+	}{
+		{desc: "proxied", endpoint: "http://lambda.eu-west-1.example.internal", noProxy: []string{".example.com"}, status: 200},
+		{desc: "no proxy", endpoint: direct.URL, noProxy: []string{"127.0.0.1"}, status: 202},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+			cfg.Endpoint = test.endpoint
+			cfg.ProxyURL = "http://user:pass@" + proxy.Listener.Addr().String()
+			cfg.NoProxy = test.noProxy
+
+			ctx := context.Background()
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+			handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, test.status, recorder.Code)
+		})
+	}
+
+	assert.Equal(t, 1, proxied)
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.ProxyURL = "ftp://proxy.example.com"
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	_, err := awslambdaplugin.New(context.Background(), next, cfg, "lambda-plugin")
+	assert.EqualError(t, err, `unsupported proxy scheme "ftp"`)
+}
+
+func TestTransportConfig(t *testing.T) {
+	var connections int32
+	mockserver := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte("{\"statusCode\": 200}"))
+	}))
+	mockserver.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	mockserver.Start()
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.Transport = &awslambdaplugin.TransportConfig{
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     "50ms",
+		TLSHandshakeTimeout: "5s",
+		DialTimeout:         "5s",
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+	}
+
+	serve()
+	serve()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+
+	// The idle connection was closed.
+	time.Sleep(150 * time.Millisecond)
+	serve()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&connections))
+
+	testCases := []struct {
+		transport *awslambdaplugin.TransportConfig
+		err       string
+	}{
+		{transport: &awslambdaplugin.TransportConfig{MaxIdleConns: -1}, err: "transport: max idle connections cannot be negative"},
+		{transport: &awslambdaplugin.TransportConfig{IdleConnTimeout: "0s"}, err: `transport: invalid idle conn timeout "0s"`},
+		{transport: &awslambdaplugin.TransportConfig{TLSHandshakeTimeout: "soon"}, err: `transport: invalid tls handshake timeout "soon"`},
+		{transport: &awslambdaplugin.TransportConfig{DialTimeout: "-1s"}, err: `transport: invalid dial timeout "-1s"`},
+	}
+
+	for _, test := range testCases {
+		cfg.Transport = test.transport
+		_, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+		assert.EqualError(t, err, test.err)
+	}
+}
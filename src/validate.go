@@ -0,0 +1,41 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	functionValidationTimeout = 10 * time.Second
+
+	functionStateFailed = "Failed"
+)
+
+// validateFunction checks at startup that the function exists, is not in a failed state and may be
+// invoked with the current credentials (through a DryRun invocation).
+func validateFunction(ctx context.Context, client *lambdaClient, function, qualifier string) error {
+	ctx, cancel := context.WithTimeout(ctx, functionValidationTimeout)
+	defer cancel()
+
+	configuration, err := client.getFunctionConfiguration(ctx, function, qualifier)
+	if err != nil {
+		return fmt.Errorf("function validation: cannot get the configuration of %s: %w", function, err)
+	}
+
+	if configuration.State == functionStateFailed {
+		return fmt.Errorf("function validation: %s is in the %s state (%s): %s",
+			configuration.FunctionArn, configuration.State, configuration.StateReasonCode, configuration.StateReason)
+	}
+
+	_, err = client.invoke(ctx, &invokeInput{
+		FunctionName:   function,
+		Qualifier:      qualifier,
+		InvocationType: invocationTypeDryRun,
+	})
+	if err != nil {
+		return fmt.Errorf("function validation: cannot invoke %s: %w", function, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFunction(t *testing.T) {
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.Contains(req.URL.Path, ":missing/"):
+			res.Header().Set("X-Amzn-Errortype", "ResourceNotFoundException")
+			res.WriteHeader(404)
+			_, _ = res.Write([]byte(`{"Message": "Function not found"}`))
+		case strings.HasSuffix(req.URL.Path, "/configuration"):
+			assert.Equal(t, http.MethodGet, req.Method)
+			assert.Equal(t, "live", req.URL.Query().Get("Qualifier"))
+
+			state := "Active"
+			if strings.Contains(req.URL.Path, ":broken/") {
+				state = "Failed"
+			}
+
+			_, _ = res.Write([]byte(`{"FunctionArn": "arn:aws:lambda:eu-west-1:000000000000:function:xxx:live", "State": "` + state +
+				`", "StateReasonCode": "InvalidImage", "StateReason": "bad image"}`))
+		case strings.Contains(req.URL.Path, ":denied/"):
+			res.Header().Set("X-Amzn-Errortype", "AccessDeniedException")
+			res.WriteHeader(403)
+		default:
+			assert.Equal(t, "DryRun", req.Header.Get("X-Amz-Invocation-Type"))
+			res.WriteHeader(204)
+		}
+	}))
+	defer func() { mockserver.Close() }()
+
+	testCases := []struct {
+		desc     string
+		function string
+		expected string
+	}{
+		{desc: "valid", function: "xxx"},
+		{
+			desc:     "missing",
+			function: "missing",
+			expected: "function validation: cannot get the configuration of arn:aws:lambda:eu-west-1:000000000000:function:missing: " +
+				"ResourceNotFoundException (status 404): Function not found",
+		},
+		{
+			desc:     "failed state",
+			function: "broken",
+			expected: "function validation: arn:aws:lambda:eu-west-1:000000000000:function:xxx:live is in the Failed state (InvalidImage): bad image",
+		},
+		{
+			desc:     "denied",
+			function: "denied",
+			expected: "function validation: cannot invoke arn:aws:lambda:eu-west-1:000000000000:function:denied: AccessDeniedException (status 403)",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := awslambdaplugin.CreateConfig()
+			cfg.Region = "eu-west-1"
+			cfg.AccessKey = "aws-key"
+			cfg.SecretKey = "@@not-a-key"
+			cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:" + test.function
+			cfg.Qualifier = "live"
+			cfg.Endpoint = mockserver.URL
+			cfg.ValidateFunction = true
+
+			_, err := awslambdaplugin.New(context.Background(), http.NotFoundHandler(), cfg, "lambda-plugin")
+			if test.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.expected)
+			}
+		})
+	}
+}
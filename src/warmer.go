@@ -0,0 +1,99 @@
+package awslambdaplugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWarmerInterval = 5 * time.Minute
+	defaultWarmerPayload  = `{"warmer":true}`
+)
+
+// WarmerConfig enables periodic no-op invocations, keeping instances of the function initialized
+// so that user traffic hits fewer cold starts.
+type WarmerConfig struct {
+	// Interval between two warm-ups (default 5m).
+	Interval string `json:"interval,omitempty"`
+	// Payload of the warm-up invocations, which the function should recognize and answer right away
+	// (default {"warmer":true}).
+	Payload string `json:"payload,omitempty"`
+	// Concurrency is the number of parallel invocations of a warm-up, i.e. the instances kept warm (default 1).
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// warmer periodically invokes the function with the warm-up payload.
+type warmer struct {
+	logger      *logger
+	interval    time.Duration
+	timeout     time.Duration
+	payload     []byte
+	concurrency int
+	invoke      func(context.Context, []byte) error
+}
+
+func newWarmer(logger *logger, config *WarmerConfig, timeout time.Duration, invoke func(context.Context, []byte) error) (*warmer, error) {
+	interval, err := parseDurationDefault(config.Interval, defaultWarmerInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("warmer: invalid interval %q", config.Interval)
+	}
+
+	w := &warmer{
+		logger:      logger,
+		interval:    interval,
+		timeout:     timeout,
+		payload:     []byte(config.Payload),
+		concurrency: config.Concurrency,
+		invoke:      invoke,
+	}
+
+	if len(w.payload) == 0 {
+		w.payload = []byte(defaultWarmerPayload)
+	}
+	if w.concurrency == 0 {
+		w.concurrency = 1
+	}
+	if w.concurrency < 0 {
+		return nil, fmt.Errorf("warmer: concurrency must be positive")
+	}
+
+	return w, nil
+}
+
+// run warms the function up right away, then at every interval until the context is done.
+func (w *warmer) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.warm(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// warm sends the parallel warm-up invocations and waits for them, so that each one keeps an instance busy.
+func (w *warmer) warm(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := w.invoke(ctx, w.payload); err != nil && ctx.Err() == nil {
+				w.logger.warnf("warm-up invocation failed: %s", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
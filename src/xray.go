@@ -0,0 +1,57 @@
+package awslambdaplugin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const xrayTraceHeader = "X-Amzn-Trace-Id"
+
+// xrayTraceID returns the trace header of the request, generating a root trace ID when the
+// request has none or an invalid one.
+func xrayTraceID(req *http.Request, now time.Time) string {
+	value := req.Header.Get(xrayTraceHeader)
+	if validXRayTraceHeader(value) {
+		return value
+	}
+
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("Root=1-%08x-%s", now.Unix(), hex.EncodeToString(random))
+}
+
+// validXRayTraceHeader reports whether the header carries a Root=1-<8 hex>-<24 hex> trace ID.
+func validXRayTraceHeader(value string) bool {
+	for _, field := range strings.Split(value, ";") {
+		root := strings.TrimPrefix(strings.TrimSpace(field), "Root=")
+		if root == strings.TrimSpace(field) {
+			continue
+		}
+
+		parts := strings.Split(root, "-")
+		return len(parts) == 3 && parts[0] == "1" && isLowerHex(parts[1], 8) && isLowerHex(parts[2], 24)
+	}
+
+	return false
+}
+
+func isLowerHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+
+	for _, c := range value {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,77 @@
+package awslambdaplugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	awslambdaplugin "github.com/alekitto/traefik-aws-lambda-plugin/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXRayTracing(t *testing.T) {
+	var invokeHeader string
+	var event awslambdaplugin.LambdaRequest
+	mockserver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		invokeHeader = req.Header.Get("X-Amzn-Trace-Id")
+		event = awslambdaplugin.LambdaRequest{}
+		_ = json.NewDecoder(req.Body).Decode(&event)
+
+		res.WriteHeader(200)
+		_, _ = res.Write([]byte(`{"statusCode": 200}`))
+	}))
+	defer func() { mockserver.Close() }()
+
+	cfg := awslambdaplugin.CreateConfig()
+	cfg.Region = "eu-west-1"
+	cfg.AccessKey = "aws-key"
+	cfg.SecretKey = "@@not-a-key"
+	cfg.FunctionArn = "arn:aws:lambda:eu-west-1:000000000000:function:xxx:1"
+	cfg.Endpoint = mockserver.URL
+	cfg.XRayTracing = true
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(traceHeader string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if traceHeader != "" {
+			req.Header.Set("X-Amzn-Trace-Id", traceHeader)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+	}
+
+	incoming := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+	serve(incoming)
+	assert.Equal(t, incoming, invokeHeader)
+	assert.Equal(t, incoming, event.Headers["X-Amzn-Trace-Id"])
+
+	for _, traceHeader := range []string{"", "Root=invalid"} {
+		serve(traceHeader)
+		assert.Regexp(t, regexp.MustCompile(`^Root=1-[0-9a-f]{8}-[0-9a-f]{24}$`), invokeHeader)
+		assert.Equal(t, invokeHeader, event.Headers["X-Amzn-Trace-Id"])
+	}
+
+	cfg.XRayTracing = false
+	handler, err = awslambdaplugin.New(ctx, next, cfg, "lambda-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve("")
+	assert.Empty(t, invokeHeader)
+}